@@ -2,70 +2,345 @@ package main
 
 import (
 	"context"
-	"net/http"
+	"math"
+	"net"
 	"os"
 
-	_ "internal-transfers/account-service/docs"
+	"internal-transfers/account-service/docs"
 	"internal-transfers/account-service/internal/application"
+	"internal-transfers/account-service/internal/clock"
+	"internal-transfers/account-service/internal/domain"
+	"internal-transfers/account-service/internal/infrastructure/cache"
 	"internal-transfers/account-service/internal/infrastructure/messaging"
 	"internal-transfers/account-service/internal/infrastructure/postgres"
+	grpcHandler "internal-transfers/account-service/internal/interfaces/grpc"
 	httpHandler "internal-transfers/account-service/internal/interfaces/http"
+	"internal-transfers/pkg/admin"
+	"internal-transfers/pkg/config"
+	"internal-transfers/pkg/correlation"
+	"internal-transfers/pkg/database"
+	"internal-transfers/pkg/features"
+	"internal-transfers/pkg/metrics"
+	"internal-transfers/pkg/rabbitmq"
+	"internal-transfers/pkg/ratelimit"
+	"internal-transfers/pkg/retention"
+	"internal-transfers/pkg/schemaregistry"
 
 	"log/slog"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
 func main() {
+	// Load and validate configuration, reporting every problem at once
+	env := config.NewEnv()
+	cfg := config.Load(env, "account-service", "8080")
+	// Rate limit counts, kept in Redis when several instances run
+	stateCfg := config.LoadState(env)
+	grpcPort := env.Port("GRPC_PORT", "9090")
+	secondaryConfig, hasSecondary := config.LoadOptionalRabbitMQ(env, "RABBITMQ_SECONDARY")
+	secondaryConfig.ConnectionName = cfg.RabbitMQ.ConnectionName
+	balanceScale := env.Int("BALANCE_SCALE", application.DefaultBalanceScale, domain.DisplayScale, domain.MaxScale)
+	currency := env.String("CURRENCY", httpHandler.DefaultCurrency)
+	// Accounts listed in this JSON file are created at startup if missing (unset disables seeding)
+	seedAccountsFile := env.String("SEED_ACCOUNTS", "")
+	// Accounts read by id are cached for this long (unset disables the cache)
+	accountCacheTTL := env.Duration("ACCOUNT_READ_CACHE_TTL", 0)
+	feeAccountID := env.Int("FEE_ACCOUNT_ID", 0, 0, math.MaxInt)
+	// Accounts can only be created and looked up with IDs in this range
+	accountIDMin := env.Int("ACCOUNT_ID_MIN", 1, 1, math.MaxInt)
+	accountIDMax := env.Int("ACCOUNT_ID_MAX", math.MaxInt, 1, math.MaxInt)
+	// "sequence" generates the IDs of accounts created without one
+	accountIDGeneration := env.OneOf("ACCOUNT_ID_GENERATION", "off", "off", "sequence")
+	// Transfers crediting more than this to an account the source never paid before are held for review, with fraud_holds on
+	fraudHoldThreshold := env.String("FRAUD_HOLD_THRESHOLD", "")
+	consumerConcurrency := env.Int("CONSUMER_CONCURRENCY", 1, 1, 64)
+	consumerTag := env.String("CONSUMER_TAG", rabbitmq.DefaultConsumerTag("account-service"))
+	// Unacknowledged deliveries per subscription (0 uses the consumer concurrency)
+	consumerPrefetch := env.Int("CONSUMER_PREFETCH", 0, 0, 1000)
+	// "auto" acknowledges deliveries on receipt, dropping failed messages instead of retrying them
+	consumerAckMode := env.OneOf("CONSUMER_ACK_MODE", string(rabbitmq.AckManual), string(rabbitmq.AckManual), string(rabbitmq.AckAuto))
+	healthCheckInterval := env.Duration("CONSUMER_HEALTH_CHECK_INTERVAL", rabbitmq.DefaultHealthCheckInterval)
+	publishTimeout := env.Duration("PUBLISH_TIMEOUT", rabbitmq.DefaultPublishTimeout)
+	publishChannels := env.Int("PUBLISH_CHANNELS", 1, 1, 64)
+	// Decimal separator of the amounts clients send over HTTP: "point" (1000.50) or "comma" (1.000,50)
+	amountFormat := env.OneOf("AMOUNT_FORMAT", string(domain.AmountFormatPoint), string(domain.AmountFormatPoint), string(domain.AmountFormatComma))
+	// Decimal places the amounts clients send may have, whatever their currency
+	amountMaxScale := env.Int("AMOUNT_MAX_SCALE", domain.MaxScale, 0, domain.MaxScale)
+	// Replaced by the lenient_amounts feature flag; refused so that lenient parsing is not dropped silently
+	amountParsing := env.String("AMOUNT_PARSING", "")
+	eventEncoding := env.OneOf("EVENT_ENCODING", string(rabbitmq.EncodingJSON), string(rabbitmq.EncodingJSON), string(rabbitmq.EncodingProtobuf), string(rabbitmq.EncodingAvro))
+	exchangeType := env.OneOf("RABBITMQ_EXCHANGE_TYPE", string(rabbitmq.ExchangeTopic), string(rabbitmq.ExchangeTopic), string(rabbitmq.ExchangeDirect))
+	// What to do when the exchange or a queue exists with other settings: "fail" or use it as it is with "passive"
+	declareMismatch := env.OneOf("RABBITMQ_DECLARE_MISMATCH", string(rabbitmq.MismatchFail), string(rabbitmq.MismatchFail), string(rabbitmq.MismatchPassive))
+	schemaRegistryURL := env.String("SCHEMA_REGISTRY_URL", "")
+	// Processed message IDs and account idempotency keys are deleted once this old (unset keeps them forever)
+	processedMessageRetention := env.DurationAtLeast("PROCESSED_MESSAGE_RETENTION", 0, retention.MinTTL)
+	idempotencyKeyRetention := env.DurationAtLeast("IDEMPOTENCY_KEY_RETENTION", 0, retention.MinTTL)
+	// Balances are snapshotted this often, so historical balances only sum the ledger since a snapshot
+	snapshotInterval := env.DurationAtLeast("BALANCE_SNAPSHOT_INTERVAL", application.DefaultSnapshotInterval, application.MinSnapshotInterval)
+	// Behaviors turned on or off, such as "status_streams=off"; see the features package
+	featureList := env.List("FEATURE_FLAGS", "")
+	if err := env.Err(); err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+	featureFlags, err := features.Parse(featureList)
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+	if amountParsing != "" {
+		slog.Error("Failed to load configuration", "error", "AMOUNT_PARSING is replaced by the lenient_amounts feature flag")
+		os.Exit(1)
+	}
+	if accountIDMin > accountIDMax {
+		slog.Error("Failed to load configuration", "error", "ACCOUNT_ID_MIN must not be greater than ACCOUNT_ID_MAX")
+		os.Exit(1)
+	}
+	var holdThreshold domain.Money
+	if fraudHoldThreshold != "" && !featureFlags.Enabled(features.FraudHolds) {
+		slog.Error("Failed to load configuration", "error", "FRAUD_HOLD_THRESHOLD is set but the fraud_holds feature flag is off")
+		os.Exit(1)
+	}
+	if featureFlags.Enabled(features.FraudHolds) {
+		var err error
+		if holdThreshold, err = domain.ParseMoney(fraudHoldThreshold); err != nil || holdThreshold.Sign() <= 0 {
+			slog.Error("Failed to load configuration", "error", "FRAUD_HOLD_THRESHOLD must be a positive amount while the fraud_holds feature flag is on")
+			os.Exit(1)
+		}
+	}
+
 	// Initialize structured logger
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-	logger.Info("Starting account service", "port", "8080")
+	logger := cfg.Log.NewLogger()
+	slog.SetDefault(logger)
+	logger.Info("Starting account service", "port", cfg.HTTP.Port)
 
 	ctx := context.Background()
 
 	// Initialize database
-	dbPool, err := postgres.NewDBPool(ctx)
+	dbPool, err := postgres.NewDBPool(ctx, cfg.DB)
 	if err != nil {
 		logger.Error("Failed to connect to database", "error", err)
 		os.Exit(1)
 	}
 	defer dbPool.Close()
+	if err := postgres.CheckSchema(ctx, dbPool); err != nil {
+		logger.Error("Database schema check failed", "error", err)
+		os.Exit(1)
+	}
+
+	// Rate limit counts stay with each instance unless they are shared through Redis. Idempotency
+	// keys are kept in the database, which every instance already shares.
+	var (
+		rateLimiter ratelimit.Limiter
+		redisClient *redis.Client
+	)
+	if stateCfg.Shared() {
+		redisClient = redis.NewClient(&redis.Options{Addr: stateCfg.RedisAddr, Password: stateCfg.RedisPassword, DB: stateCfg.RedisDB})
+		defer redisClient.Close()
+		if err := redisClient.Ping(ctx).Err(); err != nil {
+			logger.Error("Failed to connect to Redis", "error", err)
+			os.Exit(1)
+		}
+	}
+	if stateCfg.RateLimit > 0 {
+		rateLimiter = ratelimit.NewMemoryLimiter(stateCfg.RateLimit, stateCfg.RateLimitWindow)
+		if redisClient != nil {
+			rateLimiter = ratelimit.NewRedisLimiter(redisClient, "account-service:ratelimit:", stateCfg.RateLimit, stateCfg.RateLimitWindow)
+		}
+	}
+	queryTimeout := database.WithQueryTimeout(cfg.DB.QueryTimeout)
+	acquireTimeout := database.WithAcquireTimeout(cfg.DB.AcquireTimeout)
 
-	// Initialize RabbitMQ
-	broker, err := messaging.NewRabbitMQBroker()
+	// Avro events need a schema registry; without one they are published as JSON
+	var registry *schemaregistry.Client
+	if schemaRegistryURL != "" {
+		registry = schemaregistry.NewClient(schemaRegistryURL)
+	} else if eventEncoding == string(rabbitmq.EncodingAvro) {
+		logger.Warn("SCHEMA_REGISTRY_URL is not set, publishing events as JSON instead of Avro")
+	}
+
+	// Consumer metrics carry the consumer tag, so replicas can be told apart
+	consumerRegisterer := prometheus.WrapRegistererWith(prometheus.Labels{"consumer_tag": consumerTag}, prometheus.DefaultRegisterer)
+
+	// Initialize RabbitMQ; consumed message IDs are recorded so redeliveries are skipped,
+	// retried or dead-lettered messages are counted, and consumption pauses while the database is down
+	processedMessages := database.NewProcessedMessageStore(dbPool, queryTimeout, acquireTimeout)
+	brokerOptions := []rabbitmq.Option{
+		rabbitmq.WithProcessedMessageStore(processedMessages),
+		rabbitmq.WithMetrics(metrics.NewConsumerMetrics(consumerRegisterer)),
+		rabbitmq.WithConcurrency(consumerConcurrency),
+		rabbitmq.WithPublishMetrics(metrics.NewPublisherMetrics(prometheus.DefaultRegisterer)),
+		rabbitmq.WithConsumerTag(consumerTag),
+		rabbitmq.WithPrefetch(consumerPrefetch),
+		rabbitmq.WithAckMode(rabbitmq.AckMode(consumerAckMode)),
+		rabbitmq.WithHealthCheck(dbPool, healthCheckInterval),
+		rabbitmq.WithPublishTimeout(publishTimeout),
+		rabbitmq.WithPublishChannels(publishChannels),
+		rabbitmq.WithEventEncoding(rabbitmq.EventEncoding(eventEncoding)),
+		rabbitmq.WithExchangeType(rabbitmq.ExchangeType(exchangeType)),
+		rabbitmq.WithDeclareMismatch(rabbitmq.DeclareMismatch(declareMismatch)),
+		rabbitmq.WithSchemaRegistry(registry),
+	}
+	broker, err := messaging.NewRabbitMQBroker(cfg.RabbitMQ, brokerOptions...)
 	if err != nil {
 		logger.Error("Failed to connect to RabbitMQ", "error", err)
 		os.Exit(1)
 	}
 	defer broker.Close()
 
+	// Optionally connect to a secondary RabbitMQ broker (e.g. during a broker migration).
+	// It is only used to consume transaction events; all publishing goes through the primary.
+	consumers := []messaging.MessageBroker{broker}
+	if hasSecondary {
+		secondary, err := messaging.NewRabbitMQBroker(secondaryConfig, brokerOptions...)
+		if err != nil {
+			logger.Error("Failed to connect to secondary RabbitMQ", "error", err)
+			os.Exit(1)
+		}
+		defer secondary.Close()
+		consumers = append(consumers, secondary)
+	}
+
 	// Initialize repositories and services
-	accountRepo := postgres.NewAccountRepository(dbPool)
-	accountService := application.NewAccountService(accountRepo, broker)
-	accountHandler := httpHandler.NewAccountHandler(accountService)
+	systemClock := clock.Real{}
+	accountRepo := postgres.NewAccountRepository(dbPool, queryTimeout, acquireTimeout)
+	if accountCacheTTL > 0 {
+		accountRepo = cache.NewAccountRepository(accountRepo, cache.NewMemoryCache(accountCacheTTL, systemClock))
+	}
+	serviceOptions := []application.Option{
+		application.WithClock(systemClock),
+		application.WithBalanceScale(int32(balanceScale)),
+		application.WithCurrency(currency),
+		application.WithFeeAccount(domain.AccountID(feeAccountID)),
+		application.WithFraudHold(holdThreshold),
+		application.WithFeatures(featureFlags),
+		application.WithAccountIDRange(domain.AccountID(accountIDMin), domain.AccountID(accountIDMax)),
+	}
+	if accountIDGeneration == "sequence" {
+		serviceOptions = append(serviceOptions, application.WithGeneratedAccountIDs())
+	}
+	accountService := application.NewAccountService(accountRepo, broker, serviceOptions...)
+	handlerOptions := []httpHandler.HandlerOption{
+		httpHandler.WithFeatures(featureFlags),
+		httpHandler.WithCurrency(currency),
+		httpHandler.WithAmountFormat(domain.AmountFormat(amountFormat)),
+		httpHandler.WithMaxAmountScale(int32(amountMaxScale)),
+		httpHandler.WithBasePath(cfg.HTTP.BasePath),
+	}
+	accountHandler := httpHandler.NewAccountHandler(accountService, handlerOptions...)
+
+	// Seed development accounts
+	if seedAccountsFile != "" {
+		seedAccounts, err := application.LoadSeedAccounts(seedAccountsFile)
+		if err != nil {
+			logger.Error("Failed to load seed accounts", "error", err)
+			os.Exit(1)
+		}
+		created, err := application.SeedAccounts(ctx, accountService, seedAccounts)
+		if err != nil {
+			logger.Error("Failed to seed accounts", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Seeded accounts", "created", created, "listed", len(seedAccounts))
+	}
 
-	// Subscribe to transaction events
-	if err := broker.SubscribeToTransactionEvents(ctx, accountService.HandleTransactionSubmitted); err != nil {
+	// Subscribe to transaction events on every configured broker
+	if err := messaging.SubscribeAll(ctx, consumers, accountService.HandleTransactionSubmitted); err != nil {
 		logger.Error("Failed to subscribe to transaction events", "error", err)
 		os.Exit(1)
 	}
 
+	// Delete old deduplication entries
+	if processedMessageRetention > 0 {
+		go retention.NewSweeper("processed messages", processedMessages, processedMessageRetention, retention.DefaultInterval).Run(ctx)
+	}
+	if idempotencyKeyRetention > 0 {
+		pruner := postgres.NewIdempotencyKeyPruner(dbPool, queryTimeout, acquireTimeout)
+		go retention.NewSweeper("idempotency keys", pruner, idempotencyKeyRetention, retention.DefaultInterval).Run(ctx)
+	}
+
+	// Snapshot balances for historical balance lookups
+	go application.NewBalanceSnapshotter(accountRepo, systemClock, snapshotInterval).Run(ctx)
+
 	// Setup router
 	r := chi.NewRouter()
+	// Every request gets a correlation ID, logged and published with the work it causes
+	r.Use(correlation.Middleware)
 
-	// Swagger
+	// Swagger; requests made from the UI go to the configured base path
+	docs.SwaggerInfo.BasePath = cfg.HTTP.BasePath
 	r.Get("/swagger/*", httpSwagger.Handler(
-		httpSwagger.URL("http://localhost:8080/swagger/doc.json"),
+		httpSwagger.URL("http://localhost:"+cfg.HTTP.Port+"/swagger/doc.json"),
 	))
 
+	// Health, readiness and metrics, on the API listener unless an admin listener is configured
+	adminOptions := []admin.Option{
+		admin.WithCheck("database", dbPool.Ping),
+		admin.WithCheck("broker", admin.ConnectionCheck(broker.IsConnected)),
+	}
+	if redisClient != nil {
+		adminOptions = append(adminOptions, admin.WithCheck("redis", func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		}))
+	}
+	if cfg.HTTP.Profiling {
+		adminOptions = append(adminOptions, admin.WithProfiling())
+	}
+	// The ledger is only for other services, so it is served on the admin listener alone
+	adminOptions = append(adminOptions, httpHandler.AdminRoutes(accountHandler)...)
+	adminHandler := admin.NewHandler(adminOptions...)
+	if cfg.HTTP.AdminPort == "" {
+		logger.Warn("ADMIN_PORT is not set, the ledger is not served to the transaction service")
+		for _, path := range admin.Paths {
+			r.Handle(path, adminHandler)
+		}
+	}
+
 	// API routes
-	r.Route("/api/v1", func(r chi.Router) {
+	r.Route(cfg.HTTP.BasePath, func(r chi.Router) {
+		r.Use(httpHandler.CORS(cfg.HTTP.CORS))
+		if rateLimiter != nil {
+			r.Use(ratelimit.Middleware(rateLimiter))
+		}
 		httpHandler.RegisterHandlers(r, accountHandler)
 	})
 
-	logger.Info("Account service ready to accept requests", "port", "8080")
-	if err := http.ListenAndServe(":8080", r); err != nil {
+	// Serve the gRPC API for internal callers alongside the HTTP API
+	grpcListener, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		logger.Error("Failed to listen for gRPC", "error", err)
+		os.Exit(1)
+	}
+	grpcServer := grpcHandler.NewServer(accountService)
+	go func() {
+		logger.Info("Account service ready to accept gRPC requests", "port", grpcPort)
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			logger.Error("Failed to start gRPC server", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	// Serve the admin endpoints on their own listener, apart from the API
+	if cfg.HTTP.AdminPort != "" {
+		go func() {
+			logger.Info("Admin endpoints ready", "port", cfg.HTTP.AdminPort, "profiling", cfg.HTTP.Profiling)
+			if err := admin.NewServer(cfg.HTTP.AdminPort, adminHandler).ListenAndServe(); err != nil {
+				logger.Error("Failed to start admin server", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// Create HTTP server
+	server := httpHandler.NewServer(cfg.HTTP, r)
+
+	logger.Info("Account service ready to accept requests", "port", cfg.HTTP.Port)
+	if err := server.ListenAndServe(); err != nil {
 		logger.Error("Failed to start server", "error", err)
 		os.Exit(1)
 	}
@@ -4,7 +4,7 @@ package docs
 // @version 1.0
 // @description This is the account service API for the internal transfers system
 // @host localhost:8080
-// @BasePath /
+// @BasePath /api/v1
 
 // @tag.name accounts
 // @tag.description Account management endpoints
@@ -4,12 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"internal-transfers/account-service/internal/clock"
 	"internal-transfers/account-service/internal/domain"
 	"internal-transfers/account-service/internal/infrastructure/messaging"
+	"internal-transfers/pkg/features"
 	"log/slog"
-	"math/big"
-	"os"
-	"strings"
+	"math"
+	"slices"
+	"time"
 )
 
 // Common errors that can occur during account operations
@@ -20,111 +22,407 @@ var (
 	ErrAccountNotFound   = errors.New("account not found")
 	ErrInvalidAccountID  = errors.New("invalid account ID")
 	ErrInsufficientFunds = errors.New("insufficient funds")
+
+	ErrFeeAccountNotConfigured = errors.New("fee account not configured")
+
+	ErrInvalidAccountStatus = errors.New("invalid account status")
+	ErrAccountClosed        = errors.New("account is closed")
+
+	ErrInvalidAccountSet = fmt.Errorf("between 1 and %d distinct account IDs are required", MaxAggregateAccounts)
+
+	ErrHoldNotFound = errors.New("held transfer not found")
+	ErrHoldResolved = errors.New("held transfer has already been reviewed")
+	// ErrTransferBlocked is returned when a held transfer cannot be approved because of the status
+	// of one of its accounts
+	ErrTransferBlocked = errors.New("transfer blocked by account status")
+
+	// ErrIdempotencyKeyReused is returned when an idempotency key is sent again with a different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different account creation")
+	// ErrAccountIDsExhausted is returned when no free account ID could be generated within the range
+	ErrAccountIDsExhausted = errors.New("no account ID available")
 )
 
+// errorLevel is the level a failed operation is logged at: a warning when err only reports that the
+// caller went away or ran out of time, which is no failure of the service, and an error otherwise
+func errorLevel(err error) slog.Level {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
+
+// MaxAggregateAccounts is the largest number of accounts whose balances can be added up at once
+const MaxAggregateAccounts = 1000
+
+// AvailableBalance splits the balance of an account into the funds reserved by transfers held for
+// review and the funds that can still be spent
+type AvailableBalance struct {
+	// Balance is the total balance, including the reserved funds
+	Balance   string
+	Reserved  string
+	Available string
+}
+
 // CreateAccountDTO represents the data needed to create a new account
 type CreateAccountDTO struct {
+	// AccountID is zero to have the ID generated, if enabled with WithGeneratedAccountIDs
 	AccountID      domain.AccountID
 	InitialBalance string
+	// IdempotencyKey, when set, makes retrying the creation with the same key succeed again instead
+	// of reporting the account as existing
+	IdempotencyKey string
 }
 
 // AccountService defines the interface for account-related operations
 type AccountService interface {
-	// CreateAccount creates a new account with the specified initial balance
-	CreateAccount(ctx context.Context, dto CreateAccountDTO) error
+	// CreateAccount creates a new account with the specified initial balance and returns its ID,
+	// which is generated when none is given and ID generation is enabled
+	CreateAccount(ctx context.Context, dto CreateAccountDTO) (domain.AccountID, error)
+	// ValidateAccountCreation reports the error CreateAccount would fail with, without creating the
+	// account. The idempotency key is ignored.
+	ValidateAccountCreation(ctx context.Context, dto CreateAccountDTO) error
 	// GetAccount retrieves an account by its ID
 	GetAccount(ctx context.Context, id domain.AccountID) (*domain.Account, error)
+	// AccountExists reports whether an account with the given ID exists
+	AccountExists(ctx context.Context, id domain.AccountID) (bool, error)
+	// SetAccountStatus freezes, unfreezes or closes an account; closed accounts cannot be changed again
+	SetAccountStatus(ctx context.Context, id domain.AccountID, status domain.AccountStatus) (*domain.Account, error)
+	// GetLedgerEntries retrieves the ledger entries recorded for a transaction
+	GetLedgerEntries(ctx context.Context, transactionID domain.TransactionID) ([]domain.LedgerEntry, error)
+	// GetBalanceAt reconstructs the balance of an account at a point in time from its ledger
+	GetBalanceAt(ctx context.Context, id domain.AccountID, at time.Time) (string, error)
+	// GetAvailableBalance returns the balance of an account split into reserved and spendable funds
+	GetAvailableBalance(ctx context.Context, id domain.AccountID) (*AvailableBalance, error)
+	// GetRecentTransactions retrieves up to limit of the latest transactions that moved the account's
+	// balance, skipping the first offset of them
+	GetRecentTransactions(ctx context.Context, id domain.AccountID, limit, offset int) ([]domain.AccountTransaction, error)
+	// GetBalances returns the balances of the given accounts, keyed by id; accounts that do not exist
+	// are left out
+	GetBalances(ctx context.Context, ids []domain.AccountID) (map[domain.AccountID]string, error)
+	// GetAggregateBalance returns the combined balance of the given accounts, all of which must exist
+	GetAggregateBalance(ctx context.Context, ids []domain.AccountID) (string, error)
 	// HandleTransactionSubmitted processes a transaction submitted event
 	HandleTransactionSubmitted(ctx context.Context, event domain.TransactionEvent) error
+	// ApproveHeldTransfer completes a transfer held for fraud review with its reserved funds
+	ApproveHeldTransfer(ctx context.Context, transactionID domain.TransactionID) (*domain.TransferHold, error)
+	// RejectHeldTransfer fails a transfer held for fraud review, returning its reserved funds to the source
+	RejectHeldTransfer(ctx context.Context, transactionID domain.TransactionID) (*domain.TransferHold, error)
 }
 
 type accountService struct {
 	repo   domain.AccountRepository
 	broker messaging.MessageBroker
+	clock  clock.Clock
 	logger *slog.Logger
+
+	balanceScale       int32
+	feeAccountID       domain.AccountID
+	fraudHoldThreshold domain.Money
+	// minAccountID and maxAccountID bound the IDs of accounts; see WithAccountIDRange
+	minAccountID domain.AccountID
+	maxAccountID domain.AccountID
+	// generateAccountIDs lets accounts be created without an ID; see WithGeneratedAccountIDs
+	generateAccountIDs bool
+	// currency of the balances; see WithCurrency
+	currency string
+	features features.Flags
 }
 
-// NewAccountService creates a new instance of AccountService
-func NewAccountService(repo domain.AccountRepository, broker messaging.MessageBroker) AccountService {
-	return &accountService{
-		repo:   repo,
-		broker: broker,
-		logger: slog.New(slog.NewJSONHandler(os.Stdout, nil)),
+// maxGeneratedIDAttempts is how many generated account IDs are tried before giving up, when they
+// were taken by accounts created with IDs of their own
+const maxGeneratedIDAttempts = 10
+
+// DefaultBalanceScale is the number of decimal places balances are kept with internally
+const DefaultBalanceScale = 4
+
+// Option configures optional behavior of the account service
+type Option func(*accountService)
+
+// WithClock sets the clock used for time-based logic; the system clock is used by default
+func WithClock(clk clock.Clock) Option {
+	return func(s *accountService) {
+		s.clock = clk
+	}
+}
+
+// WithBalanceScale sets the number of decimal places balances are stored with internally.
+// Amounts are still displayed with domain.DisplayScale decimal places.
+func WithBalanceScale(scale int32) Option {
+	return func(s *accountService) {
+		s.balanceScale = scale
+	}
+}
+
+// WithFeeAccount sets the account that transfer fees are credited to.
+// Transfers carrying a fee fail while no fee account is configured.
+func WithFeeAccount(id domain.AccountID) Option {
+	return func(s *accountService) {
+		s.feeAccountID = id
+	}
+}
+
+// WithFraudHold sets the threshold of the fraud_holds feature: while it is on, transfers crediting
+// more than threshold to an account the source has never sent money to are held for review instead
+// of completed. A threshold of zero holds no transfer.
+func WithFraudHold(threshold domain.Money) Option {
+	return func(s *accountService) {
+		s.fraudHoldThreshold = threshold
 	}
 }
 
-// validateAmount checks if the amount string is valid and non-negative
-func validateAmount(amount string) error {
-	// Remove any whitespace
-	amount = strings.TrimSpace(amount)
-	if amount == "" {
-		return ErrInvalidAmount
+// WithAccountIDRange restricts account IDs to the range from min to max inclusive, e.g. to 6 to 12
+// digit numbers. Any positive ID is accepted by default; invalid ranges are ignored.
+func WithAccountIDRange(min, max domain.AccountID) Option {
+	return func(s *accountService) {
+		if min > 0 && min <= max {
+			s.minAccountID, s.maxAccountID = min, max
+		}
 	}
+}
 
-	// Parse the amount as a decimal
-	value, ok := new(big.Float).SetString(amount)
-	if !ok {
-		return ErrInvalidAmount
+// WithGeneratedAccountIDs generates the IDs of accounts created without one from a database
+// sequence, within the account ID range. Accounts can still be created with IDs of their own.
+func WithGeneratedAccountIDs() Option {
+	return func(s *accountService) {
+		s.generateAccountIDs = true
+	}
+}
+
+// WithCurrency sets the ISO 4217 code of the currency balances are held in. Initial balances must
+// then fit its minor unit, e.g. whole yen for JPY; any amount the balance scale keeps is accepted
+// by default.
+func WithCurrency(code string) Option {
+	return func(s *accountService) {
+		s.currency = code
+	}
+}
+
+// WithFeatures sets the feature flags gating behaviors of the service; all are at their default otherwise
+func WithFeatures(flags features.Flags) Option {
+	return func(s *accountService) {
+		s.features = flags
+	}
+}
+
+// NewAccountService creates a new instance of AccountService
+func NewAccountService(repo domain.AccountRepository, broker messaging.MessageBroker, opts ...Option) AccountService {
+	s := &accountService{
+		repo:         repo,
+		broker:       broker,
+		clock:        clock.Real{},
+		logger:       slog.Default(),
+		balanceScale: DefaultBalanceScale,
+		minAccountID: 1,
+		maxAccountID: math.MaxInt64,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// parseAmount checks that the amount string is a valid, non-negative decimal that fits the
+// internal balance scale, and returns it at that scale
+func (s *accountService) parseAmount(amount string) (domain.Money, error) {
+	value, err := domain.ParseMoney(amount)
+	if err != nil {
+		return domain.Money{}, ErrInvalidAmount
 	}
 
 	// Check if the amount is negative
 	if value.Sign() < 0 {
-		return ErrNegativeAmount
+		return domain.Money{}, ErrNegativeAmount
 	}
 
-	return nil
+	// Reject precision that would be lost when storing the amount
+	if value.RoundsAt(s.balanceScale) {
+		return domain.Money{}, ErrInvalidAmount
+	}
+
+	return value.RoundTo(s.balanceScale), nil
 }
 
-// validateAccountID checks if the account ID is valid
-func validateAccountID(id domain.AccountID) error {
-	if id <= 0 {
+// validateAmount works like parseAmount and also rejects amounts with more decimal places than the
+// minor unit of the currency, such as "100.5" for JPY
+func (s *accountService) validateAmount(amount string) (domain.Money, error) {
+	value, err := s.parseAmount(amount)
+	if err != nil || s.currency == "" {
+		return value, err
+	}
+	if decimals := domain.CurrencyDecimals(s.currency); value.RoundsAt(decimals) {
+		return domain.Money{}, fmt.Errorf("%w: %s amounts have at most %d decimal places", ErrInvalidAmount, s.currency, decimals)
+	}
+	return value, nil
+}
+
+// getFeeAccount loads the configured fee account
+func (s *accountService) getFeeAccount(ctx context.Context) (*domain.Account, error) {
+	if s.feeAccountID == 0 {
+		return nil, ErrFeeAccountNotConfigured
+	}
+	account, err := s.repo.GetByID(ctx, s.feeAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fee account: %w", err)
+	}
+	if account == nil {
+		return nil, ErrAccountNotFound
+	}
+	return account, nil
+}
+
+// posting is a signed balance movement on an account that is part of a transfer
+type posting struct {
+	accountID domain.AccountID
+	entryType domain.LedgerEntryType
+	amount    domain.Money
+}
+
+// applyPostings computes the new balances of the accounts and the ledger entries for the postings
+// of a transaction. An account may appear in several postings; its balance carries over between them.
+func (s *accountService) applyPostings(accounts map[domain.AccountID]*domain.Account, transactionID domain.TransactionID, postings []posting) ([]*domain.Account, []domain.LedgerEntry, error) {
+	balances := make(map[domain.AccountID]domain.Money, len(accounts))
+	var updated []*domain.Account
+	entries := make([]domain.LedgerEntry, 0, len(postings))
+
+	for _, p := range postings {
+		balance, ok := balances[p.accountID]
+		if !ok {
+			var err error
+			if balance, err = domain.ParseMoney(accounts[p.accountID].Balance); err != nil {
+				return nil, nil, fmt.Errorf("invalid balance on account %d: %w", p.accountID, err)
+			}
+			updated = append(updated, accounts[p.accountID])
+		}
+		balance, err := balance.CheckedAdd(p.amount)
+		if err != nil {
+			return nil, nil, fmt.Errorf("account %d: %w", p.accountID, err)
+		}
+		// Balances stored with a larger scale, before BALANCE_SCALE was lowered, lose their extra digits
+		if balance.RoundsAt(s.balanceScale) {
+			s.logger.Warn("balance rounded to the balance scale",
+				"account_id", p.accountID,
+				"transaction_id", transactionID,
+				"balance", balance.String(),
+				"rounded_balance", balance.RoundTo(s.balanceScale).String(),
+				"balance_scale", s.balanceScale)
+		}
+		balance = balance.RoundTo(s.balanceScale)
+		balances[p.accountID] = balance
+
+		entries = append(entries, domain.LedgerEntry{
+			AccountID:     p.accountID,
+			TransactionID: transactionID,
+			Type:          p.entryType,
+			Amount:        p.amount.String(),
+			BalanceAfter:  balance.String(),
+		})
+	}
+
+	for _, account := range updated {
+		account.Balance = balances[account.ID].String()
+	}
+
+	return updated, entries, nil
+}
+
+// balancesOf returns the current balance of each account, keyed by id
+func balancesOf(accounts map[domain.AccountID]*domain.Account) map[domain.AccountID]string {
+	balances := make(map[domain.AccountID]string, len(accounts))
+	for id, account := range accounts {
+		balances[id] = account.Balance
+	}
+	return balances
+}
+
+// logBalanceChanges logs the balance of every account updated by a transaction before and after
+// the update, so that the movements of an account can be reconstructed from the logs alone
+func (s *accountService) logBalanceChanges(transactionID domain.TransactionID, before map[domain.AccountID]string, updated []*domain.Account) {
+	for _, account := range updated {
+		s.logger.Info("account balance updated",
+			"transaction_id", transactionID,
+			"account_id", account.ID,
+			"balance_before", normalizedBalance(before[account.ID]),
+			"balance_after", normalizedBalance(account.Balance))
+	}
+}
+
+// normalizedBalance returns a stored balance in its canonical form; unparsable values are returned as-is
+func normalizedBalance(balance string) string {
+	normalized, err := domain.NormalizeAmount(balance)
+	if err != nil {
+		return balance
+	}
+	return normalized
+}
+
+// validateAccountID checks if the account ID is positive and within the configured range
+func (s *accountService) validateAccountID(id domain.AccountID) error {
+	if id < s.minAccountID || id > s.maxAccountID {
 		return ErrInvalidAccountID
 	}
 	return nil
 }
 
 // CreateAccount implements the account creation logic with validation
-func (s *accountService) CreateAccount(ctx context.Context, dto CreateAccountDTO) error {
+func (s *accountService) CreateAccount(ctx context.Context, dto CreateAccountDTO) (domain.AccountID, error) {
 	s.logger.Info("creating account",
 		"account_id", dto.AccountID,
 		"initial_balance", dto.InitialBalance)
 
-	// Validate account ID
-	if err := validateAccountID(dto.AccountID); err != nil {
-		s.logger.Error("invalid account ID",
-			"error", err,
-			"account_id", dto.AccountID)
-		return fmt.Errorf("invalid account ID: %w", err)
+	initialBalance, err := s.validateAccountCreation(dto)
+	if err != nil {
+		return 0, err
 	}
 
-	// Validate initial balance
-	if err := validateAmount(dto.InitialBalance); err != nil {
-		s.logger.Error("invalid initial balance",
-			"error", err,
-			"amount", dto.InitialBalance)
-		return fmt.Errorf("invalid initial balance: %w", err)
+	// A creation retried under the same idempotency key succeeds like the original did
+	if dto.IdempotencyKey != "" {
+		if creation, err := s.replayAccountCreation(ctx, dto, initialBalance); creation != nil || err != nil {
+			return accountIDOf(creation), err
+		}
 	}
 
-	// Check if account already exists
-	existingAccount, err := s.repo.GetByID(ctx, dto.AccountID)
-	if err == nil && existingAccount != nil {
-		s.logger.Warn("account already exists",
-			"account_id", dto.AccountID)
-		return ErrAccountExists
+	if dto.AccountID == 0 {
+		if dto.AccountID, err = s.generateAccountID(ctx); err != nil {
+			return 0, err
+		}
+	} else {
+		// Check if account already exists
+		existingAccount, err := s.repo.GetByID(ctx, dto.AccountID)
+		if err == nil && existingAccount != nil {
+			s.logger.Warn("account already exists",
+				"account_id", dto.AccountID)
+			return 0, ErrAccountExists
+		}
 	}
 
 	// Create new account
 	account := &domain.Account{
 		ID:      dto.AccountID,
-		Balance: dto.InitialBalance,
+		Balance: initialBalance.String(),
+		Status:  domain.AccountStatusActive,
 	}
 
 	// Create account in database
-	if err := s.repo.Create(ctx, account); err != nil {
-		s.logger.Error("failed to create account",
+	if dto.IdempotencyKey == "" {
+		err = s.repo.Create(ctx, account)
+	} else {
+		err = s.repo.CreateWithIdempotencyKey(ctx, account, domain.AccountCreation{
+			IdempotencyKey: dto.IdempotencyKey,
+			AccountID:      account.ID,
+			InitialBalance: account.Balance,
+		})
+		// A concurrent retry under the same key may have created the account first
+		if err != nil {
+			if creation, replayErr := s.replayAccountCreation(ctx, dto, initialBalance); creation != nil || replayErr != nil {
+				return accountIDOf(creation), replayErr
+			}
+		}
+	}
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to create account",
 			"error", err,
 			"account_id", dto.AccountID)
-		return fmt.Errorf("failed to create account: %w", err)
+		return 0, fmt.Errorf("failed to create account: %w", err)
 	}
 
 	s.logger.Info("account created successfully",
@@ -133,21 +431,129 @@ func (s *accountService) CreateAccount(ctx context.Context, dto CreateAccountDTO
 
 	// Publish account created event
 	if err := s.broker.PublishAccountCreated(ctx, account); err != nil {
-		s.logger.Error("failed to publish account created event",
+		s.logger.Log(ctx, errorLevel(err), "failed to publish account created event",
 			"error", err,
 			"account_id", account.ID)
 	}
 
+	return account.ID, nil
+}
+
+// generateAccountID draws account IDs from the sequence until one is not taken yet by an account
+// created with an ID of its own
+func (s *accountService) generateAccountID(ctx context.Context) (domain.AccountID, error) {
+	for range maxGeneratedIDAttempts {
+		id, err := s.repo.NextAccountID(ctx, s.minAccountID)
+		if err != nil {
+			s.logger.Error("failed to generate account ID",
+				"error", err)
+			return 0, fmt.Errorf("failed to generate account ID: %w", err)
+		}
+		if id > s.maxAccountID {
+			s.logger.Error("account ID range exhausted",
+				"account_id", id,
+				"max_account_id", s.maxAccountID)
+			return 0, ErrAccountIDsExhausted
+		}
+
+		exists, err := s.repo.Exists(ctx, id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check account existence: %w", err)
+		}
+		if !exists {
+			return id, nil
+		}
+	}
+	return 0, ErrAccountIDsExhausted
+}
+
+// accountIDOf returns the ID of the account created by a replayed creation, or zero for none
+func accountIDOf(creation *domain.AccountCreation) domain.AccountID {
+	if creation == nil {
+		return 0
+	}
+	return creation.AccountID
+}
+
+// replayAccountCreation returns the creation recorded under the idempotency key of dto, or nil if
+// there is none. It returns ErrIdempotencyKeyReused if the key was used to create a different
+// account; a creation without an ID matches the account whose ID was generated for the key.
+func (s *accountService) replayAccountCreation(ctx context.Context, dto CreateAccountDTO, initialBalance domain.Money) (*domain.AccountCreation, error) {
+	creation, err := s.repo.GetAccountCreation(ctx, dto.IdempotencyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up idempotency key: %w", err)
+	}
+	if creation == nil {
+		return nil, nil
+	}
+
+	created, err := domain.ParseMoney(creation.InitialBalance)
+	sameAccount := dto.AccountID == 0 || creation.AccountID == dto.AccountID
+	if err != nil || !sameAccount || created.Cmp(initialBalance) != 0 {
+		s.logger.Warn("idempotency key reused for a different account creation",
+			"account_id", dto.AccountID,
+			"created_account_id", creation.AccountID)
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	s.logger.Info("account creation retried, returning the created account",
+		"account_id", creation.AccountID)
+	return creation, nil
+}
+
+// ValidateAccountCreation implements the dry run of CreateAccount
+func (s *accountService) ValidateAccountCreation(ctx context.Context, dto CreateAccountDTO) error {
+	if _, err := s.validateAccountCreation(dto); err != nil {
+		return err
+	}
+	if dto.AccountID == 0 {
+		return nil
+	}
+
+	exists, err := s.repo.Exists(ctx, dto.AccountID)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to check account existence",
+			"error", err,
+			"account_id", dto.AccountID)
+		return fmt.Errorf("failed to check account existence: %w", err)
+	}
+	if exists {
+		return ErrAccountExists
+	}
 	return nil
 }
 
+// validateAccountCreation checks the account ID and initial balance of an account to create and
+// returns the balance at the internal scale. The ID may be missing while ID generation is enabled.
+func (s *accountService) validateAccountCreation(dto CreateAccountDTO) (domain.Money, error) {
+	// Validate account ID, unless it is left to be generated
+	if dto.AccountID != 0 || !s.generateAccountIDs {
+		if err := s.validateAccountID(dto.AccountID); err != nil {
+			s.logger.Error("invalid account ID",
+				"error", err,
+				"account_id", dto.AccountID)
+			return domain.Money{}, fmt.Errorf("invalid account ID: %w", err)
+		}
+	}
+
+	// Validate initial balance
+	initialBalance, err := s.validateAmount(dto.InitialBalance)
+	if err != nil {
+		s.logger.Error("invalid initial balance",
+			"error", err,
+			"amount", dto.InitialBalance)
+		return domain.Money{}, fmt.Errorf("invalid initial balance: %w", err)
+	}
+	return initialBalance, nil
+}
+
 // GetAccount implements the account retrieval logic with validation
 func (s *accountService) GetAccount(ctx context.Context, id domain.AccountID) (*domain.Account, error) {
 	s.logger.Info("getting account",
 		"account_id", id)
 
 	// Validate account ID
-	if err := validateAccountID(id); err != nil {
+	if err := s.validateAccountID(id); err != nil {
 		s.logger.Error("invalid account ID",
 			"error", err,
 			"account_id", id)
@@ -156,7 +562,7 @@ func (s *accountService) GetAccount(ctx context.Context, id domain.AccountID) (*
 
 	account, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		s.logger.Error("failed to get account",
+		s.logger.Log(ctx, errorLevel(err), "failed to get account",
 			"error", err,
 			"account_id", id)
 		return nil, fmt.Errorf("failed to get account: %w", err)
@@ -175,217 +581,523 @@ func (s *accountService) GetAccount(ctx context.Context, id domain.AccountID) (*
 	return account, nil
 }
 
+// SetAccountStatus implements the account status change with validation
+func (s *accountService) SetAccountStatus(ctx context.Context, id domain.AccountID, status domain.AccountStatus) (*domain.Account, error) {
+	if !status.Valid() {
+		return nil, ErrInvalidAccountStatus
+	}
+
+	account, err := s.GetAccount(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if account.Status == domain.AccountStatusClosed && status != domain.AccountStatusClosed {
+		s.logger.Warn("attempt to reopen closed account",
+			"account_id", id,
+			"status", status)
+		return nil, ErrAccountClosed
+	}
+
+	found, err := s.repo.UpdateStatus(ctx, id, status)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to update account status",
+			"error", err,
+			"account_id", id)
+		return nil, fmt.Errorf("failed to update account status: %w", err)
+	}
+	if !found {
+		return nil, ErrAccountNotFound
+	}
+
+	s.logger.Info("account status updated",
+		"account_id", id,
+		"previous_status", account.Status,
+		"status", status)
+
+	account.Status = status
+	return account, nil
+}
+
+// AccountExists implements the account existence check with validation
+func (s *accountService) AccountExists(ctx context.Context, id domain.AccountID) (bool, error) {
+	// Validate account ID
+	if err := s.validateAccountID(id); err != nil {
+		return false, fmt.Errorf("invalid account ID: %w", err)
+	}
+
+	exists, err := s.repo.Exists(ctx, id)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to check account existence",
+			"error", err,
+			"account_id", id)
+		return false, fmt.Errorf("failed to check account existence: %w", err)
+	}
+
+	return exists, nil
+}
+
+// GetLedgerEntries implements the ledger lookup for a transaction
+func (s *accountService) GetLedgerEntries(ctx context.Context, transactionID domain.TransactionID) ([]domain.LedgerEntry, error) {
+	entries, err := s.repo.GetLedgerEntriesByTransaction(ctx, transactionID)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to get ledger entries",
+			"error", err,
+			"transaction_id", transactionID)
+		return nil, fmt.Errorf("failed to get ledger entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// GetBalanceAt implements the historical balance lookup with validation
+func (s *accountService) GetBalanceAt(ctx context.Context, id domain.AccountID, at time.Time) (string, error) {
+	exists, err := s.AccountExists(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", ErrAccountNotFound
+	}
+
+	balance, err := s.repo.GetBalanceAt(ctx, id, at)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to get historical balance",
+			"error", err,
+			"account_id", id,
+			"at", at)
+		return "", fmt.Errorf("failed to get historical balance: %w", err)
+	}
+
+	return balance, nil
+}
+
+// GetAvailableBalance implements the available balance lookup. The account's balance already has
+// the reserved funds taken out, so it is the available balance, and the total adds them back.
+func (s *accountService) GetAvailableBalance(ctx context.Context, id domain.AccountID) (*AvailableBalance, error) {
+	account, err := s.GetAccount(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	reserved, err := s.repo.GetReservedBalance(ctx, id)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to get reserved balance",
+			"error", err,
+			"account_id", id)
+		return nil, fmt.Errorf("failed to get reserved balance: %w", err)
+	}
+
+	available, err := domain.ParseMoney(account.Balance)
+	if err != nil {
+		return nil, fmt.Errorf("invalid balance: %w", err)
+	}
+	held, err := domain.ParseMoney(reserved)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reserved balance: %w", err)
+	}
+	total, err := available.CheckedAdd(held)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reserved balance: %w", err)
+	}
+
+	return &AvailableBalance{
+		Balance:   total.String(),
+		Reserved:  held.String(),
+		Available: available.String(),
+	}, nil
+}
+
+// GetRecentTransactions implements the recent transactions lookup
+func (s *accountService) GetRecentTransactions(ctx context.Context, id domain.AccountID, limit, offset int) ([]domain.AccountTransaction, error) {
+	transactions, err := s.repo.GetRecentTransactions(ctx, id, limit, offset)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to get recent transactions",
+			"error", err,
+			"account_id", id)
+		return nil, fmt.Errorf("failed to get recent transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// GetBalances implements the bulk balance lookup in a single query
+func (s *accountService) GetBalances(ctx context.Context, ids []domain.AccountID) (map[domain.AccountID]string, error) {
+	unique, err := s.accountSet(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	balances, err := s.repo.GetBalances(ctx, unique)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to get balances",
+			"error", err,
+			"accounts", len(unique))
+		return nil, fmt.Errorf("failed to get balances: %w", err)
+	}
+
+	return balances, nil
+}
+
+// GetAggregateBalance implements the combined balance lookup; duplicate IDs are counted once
+func (s *accountService) GetAggregateBalance(ctx context.Context, ids []domain.AccountID) (string, error) {
+	unique, err := s.accountSet(ids)
+	if err != nil {
+		return "", err
+	}
+
+	total, found, err := s.repo.SumBalances(ctx, unique)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to sum balances",
+			"error", err,
+			"accounts", len(unique))
+		return "", fmt.Errorf("failed to sum balances: %w", err)
+	}
+	if found < len(unique) {
+		return "", ErrAccountNotFound
+	}
+
+	return total, nil
+}
+
+// accountSet returns the distinct IDs of a multi-account lookup, sorted, checking that there are
+// between one and MaxAggregateAccounts of them and that each is valid
+func (s *accountService) accountSet(ids []domain.AccountID) ([]domain.AccountID, error) {
+	unique := slices.Clone(ids)
+	slices.Sort(unique)
+	unique = slices.Compact(unique)
+	if len(unique) == 0 || len(unique) > MaxAggregateAccounts {
+		return nil, ErrInvalidAccountSet
+	}
+	for _, id := range unique {
+		if err := s.validateAccountID(id); err != nil {
+			return nil, err
+		}
+	}
+	return unique, nil
+}
+
+// publishTransactionFailed publishes a failed event for the given transaction with a stable failure code
+func (s *accountService) publishTransactionFailed(ctx context.Context, event domain.TransactionEvent, code domain.FailureCode, reason string) {
+	failedEvent := domain.TransactionEvent{
+		TransactionID:        event.TransactionID,
+		SourceAccountID:      event.SourceAccountID,
+		DestinationAccountID: event.DestinationAccountID,
+		Amount:               event.Amount,
+		Fee:                  event.Fee,
+		Memo:                 event.Memo,
+		Status:               domain.EventStatusFailed,
+		FailureCode:          code,
+		FailureReason:        reason,
+		Legs:                 event.Legs,
+	}
+	if err := s.broker.PublishTransactionFailed(ctx, failedEvent); err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to publish transaction failed event",
+			"error", err,
+			"transaction_id", event.TransactionID,
+			"failure_code", code)
+	}
+}
+
+// failTransfer publishes a failed event for a transfer that can never be applied and returns err
+// marked with domain.ErrTransferFailed. Errors that a retry may resolve, such as an unreachable
+// database, are returned without a failed event instead, since the retry could apply the transfer.
+func (s *accountService) failTransfer(ctx context.Context, event domain.TransactionEvent, code domain.FailureCode, reason string, err error) error {
+	s.publishTransactionFailed(ctx, event, code, reason)
+	return fmt.Errorf("%w: %w", domain.ErrTransferFailed, err)
+}
+
 // HandleTransactionSubmitted processes a transaction submitted event
 func (s *accountService) HandleTransactionSubmitted(ctx context.Context, event domain.TransactionEvent) error {
-	s.logger.Info("handling transaction submitted",
+	s.logger.InfoContext(ctx, "handling transaction submitted",
 		"transaction_id", event.TransactionID,
 		"source_account", event.SourceAccountID,
 		"destination_account", event.DestinationAccountID,
-		"amount", event.Amount)
+		"amount", event.Amount,
+		"legs", len(event.Legs))
+
+	// Let the transaction service tell a transfer being applied from one still queued
+	processingEvent := event
+	processingEvent.Status = domain.EventStatusProcessing
+	if err := s.broker.PublishTransactionProcessing(ctx, processingEvent); err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to publish transaction processing event",
+			"error", err,
+			"transaction_id", event.TransactionID)
+	}
 
 	// Get source account
 	sourceAccount, err := s.repo.GetByID(ctx, event.SourceAccountID)
 	if err != nil {
-		s.logger.Error("failed to get source account",
+		s.logger.Log(ctx, errorLevel(err), "failed to get source account",
 			"error", err,
 			"account_id", event.SourceAccountID)
-
-		// Publish transaction failed event
-		failedEvent := domain.TransactionEvent{
-			TransactionID:        event.TransactionID,
-			SourceAccountID:      event.SourceAccountID,
-			DestinationAccountID: event.DestinationAccountID,
-			Amount:               event.Amount,
-			Status:               "failed: source account not found",
-		}
-		if err := s.broker.PublishTransactionFailed(ctx, failedEvent); err != nil {
-			s.logger.Error("failed to publish transaction failed event",
-				"error", err,
-				"transaction_id", event.TransactionID)
-		}
 		return fmt.Errorf("failed to get source account: %w", err)
 	}
 	if sourceAccount == nil {
 		s.logger.Error("source account not found",
 			"account_id", event.SourceAccountID)
-
-		// Publish transaction failed event
-		failedEvent := domain.TransactionEvent{
-			TransactionID:        event.TransactionID,
-			SourceAccountID:      event.SourceAccountID,
-			DestinationAccountID: event.DestinationAccountID,
-			Amount:               event.Amount,
-			Status:               "failed: source account not found",
-		}
-		if err := s.broker.PublishTransactionFailed(ctx, failedEvent); err != nil {
-			s.logger.Error("failed to publish transaction failed event",
-				"error", err,
-				"transaction_id", event.TransactionID)
-		}
-		return ErrAccountNotFound
+		return s.failTransfer(ctx, event, domain.FailureSourceAccountNotFound, "source account not found", ErrAccountNotFound)
 	}
 
-	// Get destination account
-	destAccount, err := s.repo.GetByID(ctx, event.DestinationAccountID)
-	if err != nil {
-		s.logger.Error("failed to get destination account",
-			"error", err,
-			"account_id", event.DestinationAccountID)
-
-		// Publish transaction failed event
-		failedEvent := domain.TransactionEvent{
-			TransactionID:        event.TransactionID,
-			SourceAccountID:      event.SourceAccountID,
-			DestinationAccountID: event.DestinationAccountID,
-			Amount:               event.Amount,
-			Status:               "failed: destination account not found",
-		}
-		if err := s.broker.PublishTransactionFailed(ctx, failedEvent); err != nil {
-			s.logger.Error("failed to publish transaction failed event",
+	// Get destination accounts; a split transfer has one per leg
+	destinationIDs := event.DestinationIDs()
+	for _, id := range destinationIDs {
+		destAccount, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			s.logger.Log(ctx, errorLevel(err), "failed to get destination account",
 				"error", err,
-				"transaction_id", event.TransactionID)
-		}
-		return fmt.Errorf("failed to get destination account: %w", err)
-	}
-	if destAccount == nil {
-		s.logger.Error("destination account not found",
-			"account_id", event.DestinationAccountID)
-
-		// Publish transaction failed event
-		failedEvent := domain.TransactionEvent{
-			TransactionID:        event.TransactionID,
-			SourceAccountID:      event.SourceAccountID,
-			DestinationAccountID: event.DestinationAccountID,
-			Amount:               event.Amount,
-			Status:               "failed: destination account not found",
+				"account_id", id)
+			return fmt.Errorf("failed to get destination account: %w", err)
 		}
-		if err := s.broker.PublishTransactionFailed(ctx, failedEvent); err != nil {
-			s.logger.Error("failed to publish transaction failed event",
-				"error", err,
-				"transaction_id", event.TransactionID)
+		if destAccount == nil {
+			s.logger.Error("destination account not found",
+				"account_id", id)
+			return s.failTransfer(ctx, event, domain.FailureDestinationAccountNotFound, "destination account not found", ErrAccountNotFound)
 		}
-		return ErrAccountNotFound
 	}
 
-	// Validate amount
-	if err := validateAmount(event.Amount); err != nil {
+	// Validate amount, or the amount of each leg of a split transfer
+	credits, amount, err := s.transferCredits(event)
+	if err != nil {
 		s.logger.Error("invalid amount",
 			"error", err,
 			"amount", event.Amount)
+		return s.failTransfer(ctx, event, domain.FailureInvalidAmount, "invalid amount", fmt.Errorf("invalid amount: %w", err))
+	}
 
-		// Publish transaction failed event
-		failedEvent := domain.TransactionEvent{
-			TransactionID:        event.TransactionID,
-			SourceAccountID:      event.SourceAccountID,
-			DestinationAccountID: event.DestinationAccountID,
-			Amount:               event.Amount,
-			Status:               "failed: invalid amount",
-		}
-		if err := s.broker.PublishTransactionFailed(ctx, failedEvent); err != nil {
-			s.logger.Error("failed to publish transaction failed event",
+	// Validate the optional fee
+	fee := domain.NewMoney(0, s.balanceScale)
+	if event.Fee != "" {
+		if fee, err = s.parseAmount(event.Fee); err != nil {
+			s.logger.Error("invalid fee",
 				"error", err,
-				"transaction_id", event.TransactionID)
+				"fee", event.Fee)
+			return s.failTransfer(ctx, event, domain.FailureInvalidAmount, "invalid fee", fmt.Errorf("invalid fee: %w", err))
 		}
-		return fmt.Errorf("invalid amount: %w", err)
+	}
+	total, err := amount.CheckedAdd(fee)
+	if err != nil {
+		s.logger.Error("invalid fee",
+			"error", err,
+			"amount", event.Amount,
+			"fee", event.Fee)
+		return s.failTransfer(ctx, event, domain.FailureInvalidAmount, "invalid fee", fmt.Errorf("invalid fee: %w", err))
 	}
 
-	// Convert balances to big.Float for comparison
-	sourceBalance, _ := new(big.Float).SetString(sourceAccount.Balance)
-	amount, _ := new(big.Float).SetString(event.Amount)
-	destBalance, _ := new(big.Float).SetString(destAccount.Balance)
-
-	// Check if source account has sufficient funds
-	if sourceBalance.Cmp(amount) < 0 {
-		s.logger.Error("insufficient funds",
-			"source_account", event.SourceAccountID,
-			"balance", sourceAccount.Balance,
-			"amount", event.Amount)
+	// The source is debited once with the total; each destination is credited its share
+	postings := append([]posting{
+		{accountID: sourceAccount.ID, entryType: domain.LedgerEntryDebit, amount: amount.Neg()},
+	}, credits...)
+	accountIDs := append([]domain.AccountID{sourceAccount.ID}, destinationIDs...)
 
-		// Publish transaction failed event
-		failedEvent := domain.TransactionEvent{
-			TransactionID:        event.TransactionID,
-			SourceAccountID:      event.SourceAccountID,
-			DestinationAccountID: event.DestinationAccountID,
-			Amount:               event.Amount,
-			Status:               "failed: insufficient funds",
-		}
-		if err := s.broker.PublishTransactionFailed(ctx, failedEvent); err != nil {
-			s.logger.Error("failed to publish transaction failed event",
+	// The fee is moved from the source to the fee account within the same balance update
+	if fee.Sign() > 0 {
+		feeAccount, err := s.getFeeAccount(ctx)
+		if err != nil {
+			s.logger.Error("fee account not available",
 				"error", err,
-				"transaction_id", event.TransactionID)
+				"fee_account", s.feeAccountID)
+			if !errors.Is(err, ErrFeeAccountNotConfigured) && !errors.Is(err, ErrAccountNotFound) {
+				return err // Left to be retried until the database is reachable
+			}
+			return s.failTransfer(ctx, event, domain.FailureFeeAccountNotFound, "fee account not found", err)
+		}
+		accountIDs = append(accountIDs, feeAccount.ID)
+		postings = append(postings,
+			posting{accountID: sourceAccount.ID, entryType: domain.LedgerEntryFee, amount: fee.Neg()},
+			posting{accountID: feeAccount.ID, entryType: domain.LedgerEntryFee, amount: fee},
+		)
+	}
+
+	// Transfers flagged for fraud review only reserve the amount and fee on the source for now
+	held, err := s.needsReview(ctx, sourceAccount.ID, credits)
+	if err != nil {
+		// Left to be retried rather than failing a transfer that may be fine
+		s.logger.Log(ctx, errorLevel(err), "failed to check transfer for fraud review",
+			"error", err,
+			"transaction_id", event.TransactionID)
+		return err
+	}
+	if held {
+		postings = []posting{
+			{accountID: sourceAccount.ID, entryType: domain.LedgerEntryHold, amount: total.Neg()},
 		}
-		return ErrInsufficientFunds
 	}
 
-	// Update balances
-	sourceBalance.Sub(sourceBalance, amount)
-	destBalance.Add(destBalance, amount)
+	// Compute the new balances from the locked accounts, so that concurrent transfers touching
+	// the same accounts are applied one after another instead of overwriting each other
+	var (
+		updated        []*domain.Account
+		balancesBefore map[domain.AccountID]string
+	)
+	transfer := func(accounts map[domain.AccountID]*domain.Account) ([]*domain.Account, []domain.LedgerEntry, error) {
+		for _, id := range accountIDs {
+			if accounts[id] == nil {
+				return nil, nil, fmt.Errorf("account %d: %w", id, ErrAccountNotFound)
+			}
+		}
 
-	// Update accounts
-	sourceAccount.Balance = sourceBalance.Text('f', 2)
-	destAccount.Balance = destBalance.Text('f', 2)
+		// Statuses are checked under the lock so a freeze cannot race with the transfer
+		for _, id := range destinationIDs {
+			if blocked := checkTransferAllowed(accounts[sourceAccount.ID], accounts[id]); blocked != nil {
+				return nil, nil, blocked
+			}
+		}
 
-	// Save changes
-	if err := s.repo.Update(ctx, sourceAccount); err != nil {
-		s.logger.Error("failed to update source account",
-			"error", err,
-			"account_id", sourceAccount.ID)
-
-		// Publish transaction failed event
-		failedEvent := domain.TransactionEvent{
-			TransactionID:        event.TransactionID,
-			SourceAccountID:      event.SourceAccountID,
-			DestinationAccountID: event.DestinationAccountID,
-			Amount:               event.Amount,
-			Status:               "failed: could not update source account",
+		// Check if source account has sufficient funds for the amount and the fee.
+		// Balances keep their full internal scale; rounding only happens for display.
+		sourceBalance, err := domain.ParseMoney(accounts[sourceAccount.ID].Balance)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid balance on account %d: %w", sourceAccount.ID, err)
 		}
-		if err := s.broker.PublishTransactionFailed(ctx, failedEvent); err != nil {
-			s.logger.Error("failed to publish transaction failed event",
-				"error", err,
-				"transaction_id", event.TransactionID)
+		if sourceBalance.Cmp(total) < 0 {
+			return nil, nil, ErrInsufficientFunds
 		}
-		return fmt.Errorf("failed to update source account: %w", err)
+
+		var entries []domain.LedgerEntry
+		balancesBefore = balancesOf(accounts)
+		updated, entries, err = s.applyPostings(accounts, event.TransactionID, postings)
+		return updated, entries, err
 	}
-	if err := s.repo.Update(ctx, destAccount); err != nil {
-		s.logger.Error("failed to update destination account",
-			"error", err,
-			"account_id", destAccount.ID)
-
-		// Publish transaction failed event
-		failedEvent := domain.TransactionEvent{
-			TransactionID:        event.TransactionID,
-			SourceAccountID:      event.SourceAccountID,
-			DestinationAccountID: event.DestinationAccountID,
-			Amount:               event.Amount,
-			Status:               "failed: could not update destination account",
+	if held {
+		err = s.repo.HoldTransfer(ctx, event, accountIDs, transfer)
+	} else {
+		err = s.repo.ApplyTransfer(ctx, accountIDs, transfer)
+	}
+	if errors.Is(err, domain.ErrAlreadyProcessed) {
+		// The event was redelivered after its transfer was committed, possibly before the outcome
+		// was published, so the outcome is published again; the transaction service skips it if known
+		s.logger.WarnContext(ctx, "transfer already applied, publishing its outcome again",
+			"transaction_id", event.TransactionID)
+		hold, holdErr := s.repo.GetHold(ctx, event.TransactionID)
+		if holdErr != nil {
+			return fmt.Errorf("failed to get hold: %w", holdErr)
 		}
-		if err := s.broker.PublishTransactionFailed(ctx, failedEvent); err != nil {
-			s.logger.Error("failed to publish transaction failed event",
+		held, err = hold != nil, nil
+	}
+	var blocked *blockedTransferError
+	if errors.As(err, &blocked) {
+		s.logger.Error("transfer blocked by account status",
+			"transaction_id", event.TransactionID,
+			"failure_code", blocked.code,
+			"source_account", event.SourceAccountID,
+			"destination_account", event.DestinationAccountID)
+		return s.failTransfer(ctx, event, blocked.code, blocked.reason, blocked)
+	}
+	if errors.Is(err, ErrInsufficientFunds) {
+		s.logger.Error("insufficient funds",
+			"source_account", event.SourceAccountID,
+			"amount", event.Amount,
+			"fee", event.Fee)
+		return s.failTransfer(ctx, event, domain.FailureInsufficientFunds, "insufficient funds", ErrInsufficientFunds)
+	}
+	if errors.Is(err, domain.ErrAmountOverflow) {
+		s.logger.Error("balance would overflow",
+			"error", err,
+			"transaction_id", event.TransactionID)
+		return s.failTransfer(ctx, event, domain.FailureInvalidAmount, "balance would overflow", err)
+	}
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to update account balances",
+			"error", err,
+			"source_account", sourceAccount.ID,
+			"destination_account", event.DestinationAccountID)
+		// Left to be retried: a failed event now could be followed by the retry applying the transfer
+		return fmt.Errorf("failed to update account balances: %w", err)
+	}
+
+	s.logBalanceChanges(event.TransactionID, balancesBefore, updated)
+
+	if held {
+		s.logger.Warn("transfer held for fraud review",
+			"transaction_id", event.TransactionID,
+			"source_account", event.SourceAccountID,
+			"amount", event.Amount)
+		heldEvent := event
+		heldEvent.Status = domain.EventStatusHeld
+		if err := s.broker.PublishTransactionHeld(ctx, heldEvent); err != nil {
+			s.logger.Log(ctx, errorLevel(err), "failed to publish transaction held event",
 				"error", err,
 				"transaction_id", event.TransactionID)
 		}
-		return fmt.Errorf("failed to update destination account: %w", err)
+		return nil
 	}
 
-	s.logger.Info("accounts updated successfully",
-		"source_account", sourceAccount.ID,
-		"source_balance", sourceAccount.Balance,
-		"destination_account", destAccount.ID,
-		"destination_balance", destAccount.Balance)
-
 	// Publish transaction completed event
 	completedEvent := domain.TransactionEvent{
 		TransactionID:        event.TransactionID,
 		SourceAccountID:      event.SourceAccountID,
 		DestinationAccountID: event.DestinationAccountID,
 		Amount:               event.Amount,
-		Status:               "complete",
+		Fee:                  event.Fee,
+		Memo:                 event.Memo,
+		Status:               domain.EventStatusComplete,
+		Legs:                 event.Legs,
 	}
 	if err := s.broker.PublishTransactionCompleted(ctx, completedEvent); err != nil {
-		s.logger.Error("failed to publish transaction completed event",
+		s.logger.Log(ctx, errorLevel(err), "failed to publish transaction completed event",
 			"error", err,
 			"transaction_id", event.TransactionID)
 	}
 
 	return nil
 }
+
+// transferCredits returns the credit posting of each destination of the transfer and their total.
+// A split transfer must credit a positive amount per leg, adding up to the transfer's amount.
+func (s *accountService) transferCredits(event domain.TransactionEvent) ([]posting, domain.Money, error) {
+	amount, err := s.parseAmount(event.Amount)
+	if err != nil {
+		return nil, domain.Money{}, err
+	}
+	if len(event.Legs) == 0 {
+		return []posting{{accountID: event.DestinationAccountID, entryType: domain.LedgerEntryCredit, amount: amount}}, amount, nil
+	}
+
+	credits := make([]posting, 0, len(event.Legs))
+	total := domain.NewMoney(0, s.balanceScale)
+	for _, leg := range event.Legs {
+		legAmount, err := s.parseAmount(leg.Amount)
+		if err != nil {
+			return nil, domain.Money{}, fmt.Errorf("leg to account %d: %w", leg.DestinationAccountID, err)
+		}
+		if legAmount.Sign() <= 0 {
+			return nil, domain.Money{}, fmt.Errorf("leg to account %d: amount must be positive", leg.DestinationAccountID)
+		}
+		credits = append(credits, posting{accountID: leg.DestinationAccountID, entryType: domain.LedgerEntryCredit, amount: legAmount})
+		if total, err = total.CheckedAdd(legAmount); err != nil {
+			return nil, domain.Money{}, err
+		}
+	}
+	if total.Cmp(amount) != 0 {
+		return nil, domain.Money{}, fmt.Errorf("legs add up to %s, not %s", total, amount)
+	}
+	return credits, amount, nil
+}
+
+// blockedTransferError reports an account whose status does not allow the transfer
+type blockedTransferError struct {
+	code   domain.FailureCode
+	reason string
+}
+
+func (e *blockedTransferError) Error() string {
+	return e.reason
+}
+
+// checkTransferAllowed returns a blockedTransferError naming the side that blocks the transfer,
+// or nil when both accounts are active. The source is checked first.
+func checkTransferAllowed(source, destination *domain.Account) *blockedTransferError {
+	switch source.Status {
+	case domain.AccountStatusFrozen:
+		return &blockedTransferError{code: domain.FailureSourceAccountFrozen, reason: "source account is frozen"}
+	case domain.AccountStatusClosed:
+		return &blockedTransferError{code: domain.FailureSourceAccountClosed, reason: "source account is closed"}
+	}
+	switch destination.Status {
+	case domain.AccountStatusFrozen:
+		return &blockedTransferError{code: domain.FailureDestinationAccountFrozen, reason: "destination account is frozen"}
+	case domain.AccountStatusClosed:
+		return &blockedTransferError{code: domain.FailureDestinationAccountClosed, reason: "destination account is closed"}
+	}
+	return nil
+}
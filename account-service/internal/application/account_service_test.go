@@ -0,0 +1,637 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"internal-transfers/account-service/internal/domain"
+	"internal-transfers/account-service/internal/infrastructure/messaging"
+	"internal-transfers/pkg/logtest"
+	"log/slog"
+	"math"
+	"sync"
+	"testing"
+)
+
+// memoryRepository keeps accounts, ledger entries and holds in memory. Transfers work on copies of
+// the accounts, which are only saved when the transfer function succeeds, like a rolled back
+// database transaction.
+type memoryRepository struct {
+	domain.AccountRepository
+
+	mu       sync.Mutex
+	accounts map[domain.AccountID]*domain.Account
+	entries  []domain.LedgerEntry
+	holds    map[domain.TransactionID]*domain.TransferHold
+}
+
+func newMemoryRepository(accounts ...domain.Account) *memoryRepository {
+	r := &memoryRepository{
+		accounts: make(map[domain.AccountID]*domain.Account),
+		holds:    make(map[domain.TransactionID]*domain.TransferHold),
+	}
+	for _, account := range accounts {
+		if account.Status == "" {
+			account.Status = domain.AccountStatusActive
+		}
+		r.accounts[account.ID] = &account
+	}
+	return r
+}
+
+func (r *memoryRepository) GetByID(_ context.Context, id domain.AccountID) (*domain.Account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	account, ok := r.accounts[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *account
+	return &copied, nil
+}
+
+func (r *memoryRepository) Create(_ context.Context, account *domain.Account) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *account
+	r.accounts[account.ID] = &copied
+	return nil
+}
+
+// balance returns the stored balance of an account, normalized for comparison
+func (r *memoryRepository) balance(t *testing.T, id domain.AccountID) string {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	account, ok := r.accounts[id]
+	if !ok {
+		t.Fatalf("account %d does not exist", id)
+	}
+	return normalizedBalance(account.Balance)
+}
+
+func (r *memoryRepository) UpdateStatus(_ context.Context, id domain.AccountID, status domain.AccountStatus) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	account, ok := r.accounts[id]
+	if !ok {
+		return false, nil
+	}
+	account.Status = status
+	return true, nil
+}
+
+func (r *memoryRepository) ApplyTransfer(_ context.Context, accountIDs []domain.AccountID, fn domain.TransferFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.apply(accountIDs, fn)
+}
+
+// apply runs fn on copies of the accounts and saves its result if it succeeds
+func (r *memoryRepository) apply(accountIDs []domain.AccountID, fn domain.TransferFunc) error {
+	locked := make(map[domain.AccountID]*domain.Account, len(accountIDs))
+	for _, id := range accountIDs {
+		if account, ok := r.accounts[id]; ok {
+			copied := *account
+			locked[id] = &copied
+		}
+	}
+	updated, entries, err := fn(locked)
+	if err != nil {
+		return err
+	}
+	for _, account := range updated {
+		copied := *account
+		r.accounts[account.ID] = &copied
+	}
+	r.entries = append(r.entries, entries...)
+	return nil
+}
+
+func (r *memoryRepository) GetLedgerEntriesByTransaction(_ context.Context, transactionID domain.TransactionID) ([]domain.LedgerEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var entries []domain.LedgerEntry
+	for _, entry := range r.entries {
+		if entry.TransactionID == transactionID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (r *memoryRepository) HasTransferred(_ context.Context, source, destination domain.AccountID) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	debited := make(map[domain.TransactionID]bool)
+	for _, entry := range r.entries {
+		if entry.AccountID == source && entry.Type == domain.LedgerEntryDebit {
+			debited[entry.TransactionID] = true
+		}
+	}
+	for _, entry := range r.entries {
+		if entry.AccountID == destination && entry.Type == domain.LedgerEntryCredit && debited[entry.TransactionID] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetReservedBalance negates the sum of the hold and release entries of the account
+func (r *memoryRepository) GetReservedBalance(_ context.Context, id domain.AccountID) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var reserved domain.Money
+	for _, entry := range r.entries {
+		if entry.AccountID != id || (entry.Type != domain.LedgerEntryHold && entry.Type != domain.LedgerEntryRelease) {
+			continue
+		}
+		amount, err := domain.ParseMoney(entry.Amount)
+		if err != nil {
+			return "", err
+		}
+		reserved = reserved.Add(amount)
+	}
+	return reserved.Neg().String(), nil
+}
+
+func (r *memoryRepository) HoldTransfer(_ context.Context, transfer domain.TransactionEvent, accountIDs []domain.AccountID, fn domain.TransferFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.holds[transfer.TransactionID]; ok {
+		return nil
+	}
+	if err := r.apply(accountIDs, fn); err != nil {
+		return err
+	}
+	r.holds[transfer.TransactionID] = &domain.TransferHold{Transfer: transfer, Status: domain.HoldStatusHeld}
+	return nil
+}
+
+func (r *memoryRepository) GetHold(_ context.Context, transactionID domain.TransactionID) (*domain.TransferHold, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hold, ok := r.holds[transactionID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *hold
+	return &copied, nil
+}
+
+func (r *memoryRepository) ResolveHold(_ context.Context, transactionID domain.TransactionID, status domain.HoldStatus, accountIDs []domain.AccountID, fn domain.TransferFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hold, ok := r.holds[transactionID]
+	if !ok || hold.Status != domain.HoldStatusHeld {
+		return domain.ErrHoldNotHeld
+	}
+	if err := r.apply(accountIDs, fn); err != nil {
+		return err
+	}
+	hold.Status = status
+	return nil
+}
+
+// recordingBroker records the transaction outcomes and account creations published by the service
+type recordingBroker struct {
+	messaging.MessageBroker
+
+	mu        sync.Mutex
+	completed []domain.TransactionEvent
+	failed    []domain.TransactionEvent
+	held      []domain.TransactionEvent
+	created   []domain.AccountID
+}
+
+func (b *recordingBroker) PublishAccountCreated(_ context.Context, account *domain.Account) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.created = append(b.created, account.ID)
+	return nil
+}
+
+func (b *recordingBroker) PublishTransactionProcessing(context.Context, domain.TransactionEvent) error {
+	return nil
+}
+
+func (b *recordingBroker) PublishTransactionCompleted(_ context.Context, event domain.TransactionEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.completed = append(b.completed, event)
+	return nil
+}
+
+func (b *recordingBroker) PublishTransactionFailed(_ context.Context, event domain.TransactionEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failed = append(b.failed, event)
+	return nil
+}
+
+func (b *recordingBroker) PublishTransactionHeld(_ context.Context, event domain.TransactionEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.held = append(b.held, event)
+	return nil
+}
+
+// failureCodes returns the failure code of each failed event published
+func (b *recordingBroker) failureCodes() []domain.FailureCode {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	codes := make([]domain.FailureCode, 0, len(b.failed))
+	for _, event := range b.failed {
+		codes = append(codes, event.FailureCode)
+	}
+	return codes
+}
+
+func TestHandleTransactionSubmittedUnknownAccount(t *testing.T) {
+	tests := []struct {
+		name  string
+		event domain.TransactionEvent
+		opts  []Option
+		want  domain.FailureCode
+	}{
+		{
+			name:  "unknown source",
+			event: domain.TransactionEvent{TransactionID: 1, SourceAccountID: 9, DestinationAccountID: 2, Amount: "10"},
+			want:  domain.FailureSourceAccountNotFound,
+		},
+		{
+			name:  "unknown destination",
+			event: domain.TransactionEvent{TransactionID: 1, SourceAccountID: 1, DestinationAccountID: 9, Amount: "10"},
+			want:  domain.FailureDestinationAccountNotFound,
+		},
+		{
+			name: "unknown split transfer leg",
+			event: domain.TransactionEvent{TransactionID: 1, SourceAccountID: 1, DestinationAccountID: 2, Amount: "10", Legs: []domain.TransferLeg{
+				{DestinationAccountID: 2, Amount: "5"},
+				{DestinationAccountID: 9, Amount: "5"},
+			}},
+			want: domain.FailureDestinationAccountNotFound,
+		},
+		{
+			name:  "unknown fee account",
+			event: domain.TransactionEvent{TransactionID: 1, SourceAccountID: 1, DestinationAccountID: 2, Amount: "10", Fee: "1.00"},
+			opts:  []Option{WithFeeAccount(99)},
+			want:  domain.FailureFeeAccountNotFound,
+		},
+		{
+			name:  "fee account not configured",
+			event: domain.TransactionEvent{TransactionID: 1, SourceAccountID: 1, DestinationAccountID: 2, Amount: "10", Fee: "1.00"},
+			want:  domain.FailureFeeAccountNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository(domain.Account{ID: 1, Balance: "100"}, domain.Account{ID: 2, Balance: "0"})
+			broker := &recordingBroker{}
+			service := NewAccountService(repo, broker, tt.opts...)
+
+			err := service.HandleTransactionSubmitted(context.Background(), tt.event)
+			if !errors.Is(err, domain.ErrTransferFailed) {
+				t.Fatalf("error = %v, want %v so that the event is not retried", err, domain.ErrTransferFailed)
+			}
+			if codes := broker.failureCodes(); len(codes) != 1 || codes[0] != tt.want {
+				t.Errorf("failure codes = %v, want [%s]", codes, tt.want)
+			}
+			if got := repo.balance(t, 1); got != "100.00" {
+				t.Errorf("source balance = %s, want it unchanged", got)
+			}
+		})
+	}
+}
+
+func TestHandleTransactionSubmittedBalanceOverflow(t *testing.T) {
+	tests := []struct {
+		name  string
+		event domain.TransactionEvent
+		opts  []Option
+	}{
+		{
+			name:  "credit",
+			event: domain.TransactionEvent{TransactionID: 1, SourceAccountID: 1, DestinationAccountID: 2, Amount: "0.01"},
+		},
+		{
+			name:  "fee credit",
+			event: domain.TransactionEvent{TransactionID: 1, SourceAccountID: 1, DestinationAccountID: 3, Amount: "10", Fee: "0.01"},
+			opts:  []Option{WithFeeAccount(2)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Account 2 holds the largest balance that fits
+			repo := newMemoryRepository(
+				domain.Account{ID: 1, Balance: "100"},
+				domain.Account{ID: 2, Balance: "92233720368547758.07"},
+				domain.Account{ID: 3, Balance: "0"},
+			)
+			broker := &recordingBroker{}
+			service := NewAccountService(repo, broker, tt.opts...)
+
+			err := service.HandleTransactionSubmitted(context.Background(), tt.event)
+			if !errors.Is(err, domain.ErrAmountOverflow) || !errors.Is(err, domain.ErrTransferFailed) {
+				t.Fatalf("error = %v, want %v marked %v", err, domain.ErrAmountOverflow, domain.ErrTransferFailed)
+			}
+			if codes := broker.failureCodes(); len(codes) != 1 || codes[0] != domain.FailureInvalidAmount {
+				t.Errorf("failure codes = %v, want [%s]", codes, domain.FailureInvalidAmount)
+			}
+			for id, want := range map[domain.AccountID]string{1: "100.00", 2: "92233720368547758.07", 3: "0.00"} {
+				if got := repo.balance(t, id); got != want {
+					t.Errorf("account %d balance = %s, want it unchanged at %s", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleTransactionSubmittedSplitTransfer(t *testing.T) {
+	repo := newMemoryRepository(
+		domain.Account{ID: 1, Balance: "100"},
+		domain.Account{ID: 2, Balance: "0"},
+		domain.Account{ID: 3, Balance: "5"},
+		domain.Account{ID: 4, Balance: "0"},
+	)
+	broker := &recordingBroker{}
+	service := NewAccountService(repo, broker)
+
+	event := domain.TransactionEvent{TransactionID: 7, SourceAccountID: 1, DestinationAccountID: 4, Amount: "60", Legs: []domain.TransferLeg{
+		{DestinationAccountID: 4, Amount: "10"},
+		{DestinationAccountID: 2, Amount: "30"},
+		{DestinationAccountID: 3, Amount: "20"},
+	}}
+	if err := service.HandleTransactionSubmitted(context.Background(), event); err != nil {
+		t.Fatalf("HandleTransactionSubmitted() error = %v", err)
+	}
+
+	for id, want := range map[domain.AccountID]string{1: "40.00", 2: "30.00", 3: "25.00", 4: "10.00"} {
+		if got := repo.balance(t, id); got != want {
+			t.Errorf("account %d balance = %s, want %s", id, got, want)
+		}
+	}
+	if len(broker.completed) != 1 || len(broker.failed) != 0 {
+		t.Errorf("published %d completed and %d failed events, want one completed", len(broker.completed), len(broker.failed))
+	}
+
+	// The source is debited once with the total, and each destination credited its share
+	entries, err := repo.GetLedgerEntriesByTransaction(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("GetLedgerEntriesByTransaction() error = %v", err)
+	}
+	var debits, credits int
+	for _, entry := range entries {
+		switch entry.Type {
+		case domain.LedgerEntryDebit:
+			debits++
+			if entry.AccountID != 1 || normalizedBalance(entry.Amount) != "-60.00" {
+				t.Errorf("debit of %s from account %d, want -60.00 from account 1", entry.Amount, entry.AccountID)
+			}
+		case domain.LedgerEntryCredit:
+			credits++
+		}
+	}
+	if debits != 1 || credits != 3 {
+		t.Errorf("%d debits and %d credits recorded, want 1 and 3", debits, credits)
+	}
+}
+
+func TestHandleTransactionSubmittedSplitTransferRollback(t *testing.T) {
+	tests := []struct {
+		name     string
+		accounts []domain.Account
+		legs     []domain.TransferLeg
+		want     domain.FailureCode
+	}{
+		{
+			name: "insufficient funds for the total",
+			legs: []domain.TransferLeg{{DestinationAccountID: 2, Amount: "60"}, {DestinationAccountID: 3, Amount: "50"}},
+			want: domain.FailureInsufficientFunds,
+		},
+		{
+			name:     "frozen destination",
+			accounts: []domain.Account{{ID: 3, Balance: "0", Status: domain.AccountStatusFrozen}},
+			legs:     []domain.TransferLeg{{DestinationAccountID: 2, Amount: "10"}, {DestinationAccountID: 3, Amount: "10"}},
+			want:     domain.FailureDestinationAccountFrozen,
+		},
+		{
+			// The first leg is credited before the second one overflows
+			name:     "last credit overflows",
+			accounts: []domain.Account{{ID: 3, Balance: "92233720368547758.07"}},
+			legs:     []domain.TransferLeg{{DestinationAccountID: 2, Amount: "10"}, {DestinationAccountID: 3, Amount: "0.01"}},
+			want:     domain.FailureInvalidAmount,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts := map[domain.AccountID]domain.Account{
+				1: {ID: 1, Balance: "100"},
+				2: {ID: 2, Balance: "0"},
+				3: {ID: 3, Balance: "0"},
+			}
+			for _, account := range tt.accounts {
+				accounts[account.ID] = account
+			}
+			repo := newMemoryRepository(accounts[1], accounts[2], accounts[3])
+			before := map[domain.AccountID]string{1: repo.balance(t, 1), 2: repo.balance(t, 2), 3: repo.balance(t, 3)}
+			broker := &recordingBroker{}
+			service := NewAccountService(repo, broker)
+
+			var amount domain.Money
+			for _, leg := range tt.legs {
+				legAmount, _ := domain.ParseMoney(leg.Amount)
+				amount = amount.Add(legAmount)
+			}
+			event := domain.TransactionEvent{TransactionID: 7, SourceAccountID: 1, DestinationAccountID: 3, Amount: amount.String(), Legs: tt.legs}
+			err := service.HandleTransactionSubmitted(context.Background(), event)
+			if !errors.Is(err, domain.ErrTransferFailed) {
+				t.Fatalf("error = %v, want %v", err, domain.ErrTransferFailed)
+			}
+			if codes := broker.failureCodes(); len(codes) != 1 || codes[0] != tt.want {
+				t.Errorf("failure codes = %v, want [%s]", codes, tt.want)
+			}
+
+			// No leg is applied when any of them fails
+			for id, want := range before {
+				if got := repo.balance(t, id); got != want {
+					t.Errorf("account %d balance = %s, want it unchanged at %s", id, got, want)
+				}
+			}
+			if len(repo.entries) != 0 || len(broker.completed) != 0 {
+				t.Errorf("%d ledger entries recorded and %d completed events published, want none", len(repo.entries), len(broker.completed))
+			}
+		})
+	}
+}
+
+func TestHandleTransactionSubmittedBlockedAccount(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      domain.AccountStatus
+		destination domain.AccountStatus
+		want        domain.FailureCode
+		wantReason  string
+	}{
+		{name: "frozen source", source: domain.AccountStatusFrozen, want: domain.FailureSourceAccountFrozen, wantReason: "source account is frozen"},
+		{name: "closed source", source: domain.AccountStatusClosed, want: domain.FailureSourceAccountClosed, wantReason: "source account is closed"},
+		{name: "frozen destination", destination: domain.AccountStatusFrozen, want: domain.FailureDestinationAccountFrozen, wantReason: "destination account is frozen"},
+		{name: "closed destination", destination: domain.AccountStatusClosed, want: domain.FailureDestinationAccountClosed, wantReason: "destination account is closed"},
+		// The source is reported when both sides block the transfer
+		{name: "frozen source and closed destination", source: domain.AccountStatusFrozen, destination: domain.AccountStatusClosed, want: domain.FailureSourceAccountFrozen, wantReason: "source account is frozen"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository(
+				domain.Account{ID: 1, Balance: "100", Status: tt.source},
+				domain.Account{ID: 2, Balance: "0", Status: tt.destination},
+			)
+			broker := &recordingBroker{}
+			service := NewAccountService(repo, broker)
+
+			err := service.HandleTransactionSubmitted(context.Background(), domain.TransactionEvent{TransactionID: 1, SourceAccountID: 1, DestinationAccountID: 2, Amount: "10"})
+			if !errors.Is(err, domain.ErrTransferFailed) {
+				t.Fatalf("error = %v, want %v so that the event is not retried", err, domain.ErrTransferFailed)
+			}
+			if len(broker.failed) != 1 {
+				t.Fatalf("published %d failed events, want 1", len(broker.failed))
+			}
+			if failed := broker.failed[0]; failed.FailureCode != tt.want || failed.FailureReason != tt.wantReason {
+				t.Errorf("failed event has code %q and reason %q, want %q and %q", failed.FailureCode, failed.FailureReason, tt.want, tt.wantReason)
+			}
+			if got := repo.balance(t, 1); got != "100.00" {
+				t.Errorf("source balance = %s, want it unchanged", got)
+			}
+		})
+	}
+}
+
+func TestHandleTransactionSubmittedRoundsStoredBalance(t *testing.T) {
+	records := logtest.NewHandler()
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(records))
+	defer slog.SetDefault(defaultLogger)
+
+	// Account 1 was stored with 6 decimal places, before the balance scale was lowered to 4
+	repo := newMemoryRepository(
+		domain.Account{ID: 1, Balance: "100.123456"},
+		domain.Account{ID: 2, Balance: "0"},
+	)
+	service := NewAccountService(repo, &recordingBroker{})
+
+	event := domain.TransactionEvent{TransactionID: 7, SourceAccountID: 1, DestinationAccountID: 2, Amount: "10"}
+	if err := service.HandleTransactionSubmitted(context.Background(), event); err != nil {
+		t.Fatalf("HandleTransactionSubmitted() error = %v", err)
+	}
+	repo.mu.Lock()
+	source := repo.accounts[1].Balance
+	repo.mu.Unlock()
+	if want := "90.1235"; normalizedBalance(source) != want {
+		t.Errorf("source balance = %s, want it rounded half away from zero to %s", source, want)
+	}
+
+	record, ok := records.Find("balance rounded to the balance scale")
+	if !ok || record.Level != slog.LevelWarn {
+		t.Fatalf("rounding logged as %+v, want a warning", record)
+	}
+	want := map[string]any{"account_id": domain.AccountID(1), "balance": "90.123456", "rounded_balance": "90.1235", "balance_scale": int64(DefaultBalanceScale)}
+	for key, value := range want {
+		if record.Attrs[key] != value {
+			t.Errorf("warning attribute %s = %v, want %v", key, record.Attrs[key], value)
+		}
+	}
+
+	// The destination balance has no extra digits, so it is rounded silently
+	warnings := 0
+	for _, r := range records.Records() {
+		if r.Message == "balance rounded to the balance scale" {
+			warnings++
+		}
+	}
+	if warnings != 1 {
+		t.Errorf("logged %d rounding warnings, want 1", warnings)
+	}
+}
+
+func TestAccountIDRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []Option
+		id    domain.AccountID
+		valid bool
+	}{
+		{name: "default zero", id: 0},
+		{name: "default negative", id: -1},
+		{name: "default lowest", id: 1, valid: true},
+		{name: "default highest", id: math.MaxInt64, valid: true},
+		{name: "below range", opts: []Option{WithAccountIDRange(100000, 999999999999)}, id: 99999},
+		{name: "range minimum", opts: []Option{WithAccountIDRange(100000, 999999999999)}, id: 100000, valid: true},
+		{name: "range maximum", opts: []Option{WithAccountIDRange(100000, 999999999999)}, id: 999999999999, valid: true},
+		{name: "above range", opts: []Option{WithAccountIDRange(100000, 999999999999)}, id: 1000000000000},
+		{name: "inverted range ignored", opts: []Option{WithAccountIDRange(10, 5)}, id: 1, valid: true},
+		{name: "range from zero ignored", opts: []Option{WithAccountIDRange(0, 5)}, id: 6, valid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewAccountService(newMemoryRepository(), &recordingBroker{}, tt.opts...)
+
+			// No account exists, so valid IDs are only looked up and not found
+			_, err := service.GetAccount(context.Background(), tt.id)
+			want := ErrInvalidAccountID
+			if tt.valid {
+				want = ErrAccountNotFound
+			}
+			if !errors.Is(err, want) {
+				t.Errorf("GetAccount(%d) error = %v, want %v", tt.id, err, want)
+			}
+		})
+	}
+}
+
+func TestCreateAccountCurrencyMinorUnit(t *testing.T) {
+	tests := []struct {
+		currency string
+		balance  string
+		valid    bool
+	}{
+		{currency: "JPY", balance: "100", valid: true},
+		{currency: "JPY", balance: "100.00", valid: true},
+		{currency: "JPY", balance: "100.5"},
+		{currency: "JPY", balance: "0.01"},
+		{currency: "USD", balance: "100.50", valid: true},
+		{currency: "USD", balance: "100.505"},
+		{currency: "usd", balance: "100.505"},
+		{currency: "KWD", balance: "100.505", valid: true},
+		{currency: "KWD", balance: "100.5055"},
+		// Without a currency, any amount the balance scale keeps is accepted
+		{currency: "", balance: "100.505", valid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.currency+" "+tt.balance, func(t *testing.T) {
+			repo, broker := newMemoryRepository(), &recordingBroker{}
+			service := NewAccountService(repo, broker, WithCurrency(tt.currency))
+
+			_, err := service.CreateAccount(context.Background(), CreateAccountDTO{AccountID: 1, InitialBalance: tt.balance})
+			if !tt.valid {
+				if !errors.Is(err, ErrInvalidAmount) {
+					t.Errorf("CreateAccount() error = %v, want %v", err, ErrInvalidAmount)
+				}
+				if len(repo.accounts) != 0 || len(broker.created) != 0 {
+					t.Error("CreateAccount() created the account, want it rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateAccount() error = %v", err)
+			}
+			if got, want := repo.balance(t, 1), normalizedBalance(tt.balance); got != want {
+				t.Errorf("balance = %s, want %s", got, want)
+			}
+		})
+	}
+}
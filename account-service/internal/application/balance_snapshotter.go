@@ -0,0 +1,69 @@
+package application
+
+import (
+	"context"
+	"internal-transfers/account-service/internal/clock"
+	"internal-transfers/account-service/internal/domain"
+	"log/slog"
+	"time"
+)
+
+// SnapshotLag is how far behind the current time balance snapshots are taken. Ledger entries are
+// timestamped when their database transaction starts, so entries timestamped just before now may
+// still be committed; a snapshot taken as of now would miss them for good.
+const SnapshotLag = 5 * time.Minute
+
+// Snapshot intervals: the default, and the shortest accepted
+const (
+	DefaultSnapshotInterval = time.Hour
+	MinSnapshotInterval     = time.Minute
+)
+
+// BalanceSnapshotter periodically snapshots the balances of the accounts whose ledger changed, so
+// historical balances only sum the ledger entries since the nearest snapshot
+type BalanceSnapshotter struct {
+	repo     domain.AccountRepository
+	interval time.Duration
+	clock    clock.Clock
+	logger   *slog.Logger
+}
+
+// NewBalanceSnapshotter creates a snapshotter that snapshots balances every interval
+func NewBalanceSnapshotter(repo domain.AccountRepository, clk clock.Clock, interval time.Duration) *BalanceSnapshotter {
+	return &BalanceSnapshotter{
+		repo:     repo,
+		interval: interval,
+		clock:    clk,
+		logger:   slog.Default(),
+	}
+}
+
+// Run snapshots balances on every interval until the context is cancelled
+func (s *BalanceSnapshotter) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Snapshot(ctx); err != nil {
+				s.logger.Error("failed to snapshot balances", "error", err)
+			}
+		}
+	}
+}
+
+// Snapshot records the balances as of SnapshotLag ago and returns how many snapshots were taken
+func (s *BalanceSnapshotter) Snapshot(ctx context.Context) (int64, error) {
+	asOf := s.clock.Now().Add(-SnapshotLag)
+	taken, err := s.repo.SnapshotBalances(ctx, asOf)
+	if err != nil {
+		return 0, err
+	}
+	if taken > 0 {
+		s.logger.Info("snapshotted balances", "accounts", taken, "as_of", asOf)
+	}
+	return taken, nil
+}
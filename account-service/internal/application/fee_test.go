@@ -0,0 +1,100 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"internal-transfers/account-service/internal/domain"
+	"testing"
+)
+
+func TestHandleTransactionSubmittedFee(t *testing.T) {
+	tests := []struct {
+		name       string
+		amount     string
+		fee        string
+		want       map[domain.AccountID]string
+		wantFailed domain.FailureCode
+	}{
+		{
+			name:   "balance covers the amount and fee",
+			amount: "99.00",
+			fee:    "1.00",
+			want:   map[domain.AccountID]string{1: "0.00", 2: "99.00", 3: "1.00"},
+		},
+		{
+			name:       "balance covers the amount but not the fee",
+			amount:     "100.00",
+			fee:        "0.01",
+			want:       map[domain.AccountID]string{1: "100.00", 2: "0.00", 3: "0.00"},
+			wantFailed: domain.FailureInsufficientFunds,
+		},
+		{
+			name:       "negative fee",
+			amount:     "10.00",
+			fee:        "-1.00",
+			want:       map[domain.AccountID]string{1: "100.00", 2: "0.00", 3: "0.00"},
+			wantFailed: domain.FailureInvalidAmount,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository(
+				domain.Account{ID: 1, Balance: "100"},
+				domain.Account{ID: 2, Balance: "0"},
+				domain.Account{ID: 3, Balance: "0"},
+			)
+			broker := &recordingBroker{}
+			service := NewAccountService(repo, broker, WithFeeAccount(3))
+
+			event := domain.TransactionEvent{TransactionID: 7, SourceAccountID: 1, DestinationAccountID: 2, Amount: tt.amount, Fee: tt.fee}
+			err := service.HandleTransactionSubmitted(context.Background(), event)
+			for id, want := range tt.want {
+				if got := repo.balance(t, id); got != want {
+					t.Errorf("account %d balance = %s, want %s", id, got, want)
+				}
+			}
+			entries, _ := repo.GetLedgerEntriesByTransaction(context.Background(), 7)
+
+			if tt.wantFailed != "" {
+				if !errors.Is(err, domain.ErrTransferFailed) {
+					t.Fatalf("error = %v, want %v", err, domain.ErrTransferFailed)
+				}
+				if codes := broker.failureCodes(); len(codes) != 1 || codes[0] != tt.wantFailed {
+					t.Errorf("failure codes = %v, want [%s]", codes, tt.wantFailed)
+				}
+				if len(entries) != 0 {
+					t.Errorf("wrote %d ledger entries for a failed transfer", len(entries))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("HandleTransactionSubmitted() error = %v", err)
+			}
+			if len(broker.completed) != 1 {
+				t.Errorf("published %d completed events, want 1", len(broker.completed))
+			}
+			// The fee is recorded on both sides next to the transfer itself
+			var fees []domain.LedgerEntry
+			for _, entry := range entries {
+				if entry.Type == domain.LedgerEntryFee {
+					fees = append(fees, entry)
+				}
+			}
+			if len(entries) != 4 || len(fees) != 2 {
+				t.Fatalf("ledger entries = %+v, want a debit, a credit and two fee entries", entries)
+			}
+			for _, entry := range fees {
+				amount, err := domain.NormalizeAmount(entry.Amount)
+				if err != nil {
+					t.Fatalf("invalid fee entry amount %q: %v", entry.Amount, err)
+				}
+				wantAmount := map[domain.AccountID]string{1: "-" + tt.fee, 3: tt.fee}[entry.AccountID]
+				if amount != wantAmount {
+					t.Errorf("fee entry of account %d = %s, want %s", entry.AccountID, amount, wantAmount)
+				}
+			}
+		})
+	}
+}
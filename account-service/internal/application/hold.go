@@ -0,0 +1,216 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"internal-transfers/account-service/internal/domain"
+	"internal-transfers/pkg/features"
+)
+
+// needsReview reports whether the transfer trips the fraud heuristic: crediting more than the hold
+// threshold to an account the source has never sent money to, while the fraud_holds feature is on
+func (s *accountService) needsReview(ctx context.Context, source domain.AccountID, credits []posting) (bool, error) {
+	if !s.features.Enabled(features.FraudHolds) || s.fraudHoldThreshold.Sign() <= 0 {
+		return false, nil
+	}
+
+	for _, credit := range credits {
+		if credit.amount.Cmp(s.fraudHoldThreshold) <= 0 {
+			continue
+		}
+		known, err := s.repo.HasTransferred(ctx, source, credit.accountID)
+		if err != nil {
+			return false, fmt.Errorf("failed to check transfer history: %w", err)
+		}
+		if !known {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ApproveHeldTransfer releases the funds reserved for a held transfer and applies the transfer as
+// it was submitted: the source is debited, the destinations are credited and the fee is collected
+func (s *accountService) ApproveHeldTransfer(ctx context.Context, transactionID domain.TransactionID) (*domain.TransferHold, error) {
+	hold, err := s.getHeldTransfer(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	transfer := hold.Transfer
+
+	credits, amount, err := s.transferCredits(transfer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid held transfer: %w", err)
+	}
+	fee, err := s.parseFee(transfer.Fee)
+	if err != nil {
+		return nil, fmt.Errorf("invalid held transfer fee: %w", err)
+	}
+
+	total, err := amount.CheckedAdd(fee)
+	if err != nil {
+		return nil, fmt.Errorf("invalid held transfer fee: %w", err)
+	}
+
+	source := transfer.SourceAccountID
+	destinationIDs := transfer.DestinationIDs()
+	postings := append([]posting{
+		{accountID: source, entryType: domain.LedgerEntryRelease, amount: total},
+		{accountID: source, entryType: domain.LedgerEntryDebit, amount: amount.Neg()},
+	}, credits...)
+	accountIDs := append([]domain.AccountID{source}, destinationIDs...)
+
+	if fee.Sign() > 0 {
+		feeAccount, err := s.getFeeAccount(ctx)
+		if err != nil {
+			return nil, err
+		}
+		accountIDs = append(accountIDs, feeAccount.ID)
+		postings = append(postings,
+			posting{accountID: source, entryType: domain.LedgerEntryFee, amount: fee.Neg()},
+			posting{accountID: feeAccount.ID, entryType: domain.LedgerEntryFee, amount: fee},
+		)
+	}
+
+	// The accounts may have been frozen or closed while the transfer was held
+	err = s.resolveHold(ctx, transactionID, domain.HoldStatusApproved, accountIDs, postings, func(accounts map[domain.AccountID]*domain.Account) error {
+		for _, id := range destinationIDs {
+			if blocked := checkTransferAllowed(accounts[source], accounts[id]); blocked != nil {
+				return fmt.Errorf("%w: %s", ErrTransferBlocked, blocked.reason)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("held transfer approved",
+		"transaction_id", transactionID)
+
+	completedEvent := transfer
+	completedEvent.Status = domain.EventStatusComplete
+	if err := s.broker.PublishTransactionCompleted(ctx, completedEvent); err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to publish transaction completed event",
+			"error", err,
+			"transaction_id", transactionID)
+	}
+
+	return s.getHold(ctx, transactionID)
+}
+
+// RejectHeldTransfer returns the funds reserved for a held transfer to its source and fails the
+// transfer. Rejecting is allowed whatever the status of the source account, as the funds are its own.
+func (s *accountService) RejectHeldTransfer(ctx context.Context, transactionID domain.TransactionID) (*domain.TransferHold, error) {
+	hold, err := s.getHeldTransfer(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	transfer := hold.Transfer
+
+	amount, err := s.parseAmount(transfer.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid held transfer: %w", err)
+	}
+	fee, err := s.parseFee(transfer.Fee)
+	if err != nil {
+		return nil, fmt.Errorf("invalid held transfer fee: %w", err)
+	}
+
+	total, err := amount.CheckedAdd(fee)
+	if err != nil {
+		return nil, fmt.Errorf("invalid held transfer fee: %w", err)
+	}
+
+	source := transfer.SourceAccountID
+	postings := []posting{
+		{accountID: source, entryType: domain.LedgerEntryRelease, amount: total},
+	}
+	err = s.resolveHold(ctx, transactionID, domain.HoldStatusRejected, []domain.AccountID{source}, postings, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("held transfer rejected",
+		"transaction_id", transactionID)
+
+	s.publishTransactionFailed(ctx, transfer, domain.FailureRejectedInReview, "rejected in fraud review")
+
+	return s.getHold(ctx, transactionID)
+}
+
+// resolveHold applies the postings that finalize a held transfer and moves it into status. check,
+// when set, may refuse the transfer based on the locked accounts.
+func (s *accountService) resolveHold(ctx context.Context, transactionID domain.TransactionID, status domain.HoldStatus, accountIDs []domain.AccountID, postings []posting, check func(accounts map[domain.AccountID]*domain.Account) error) error {
+	var (
+		updated        []*domain.Account
+		balancesBefore map[domain.AccountID]string
+	)
+	err := s.repo.ResolveHold(ctx, transactionID, status, accountIDs, func(accounts map[domain.AccountID]*domain.Account) ([]*domain.Account, []domain.LedgerEntry, error) {
+		for _, id := range accountIDs {
+			if accounts[id] == nil {
+				return nil, nil, fmt.Errorf("account %d: %w", id, ErrAccountNotFound)
+			}
+		}
+		if check != nil {
+			if err := check(accounts); err != nil {
+				return nil, nil, err
+			}
+		}
+		var (
+			entries []domain.LedgerEntry
+			err     error
+		)
+		balancesBefore = balancesOf(accounts)
+		updated, entries, err = s.applyPostings(accounts, transactionID, postings)
+		return updated, entries, err
+	})
+	switch {
+	case errors.Is(err, domain.ErrHoldNotHeld):
+		return ErrHoldResolved
+	case errors.Is(err, ErrAccountNotFound), errors.Is(err, ErrTransferBlocked):
+		return err
+	case err != nil:
+		s.logger.Log(ctx, errorLevel(err), "failed to resolve held transfer",
+			"error", err,
+			"transaction_id", transactionID,
+			"status", status)
+		return fmt.Errorf("failed to resolve held transfer: %w", err)
+	}
+
+	s.logBalanceChanges(transactionID, balancesBefore, updated)
+	return nil
+}
+
+// getHeldTransfer returns the hold of a transaction that is still awaiting review
+func (s *accountService) getHeldTransfer(ctx context.Context, transactionID domain.TransactionID) (*domain.TransferHold, error) {
+	hold, err := s.getHold(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Status != domain.HoldStatusHeld {
+		return nil, ErrHoldResolved
+	}
+	return hold, nil
+}
+
+// getHold returns the hold of a transaction, or ErrHoldNotFound if its transfer was never held
+func (s *accountService) getHold(ctx context.Context, transactionID domain.TransactionID) (*domain.TransferHold, error) {
+	hold, err := s.repo.GetHold(ctx, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hold: %w", err)
+	}
+	if hold == nil {
+		return nil, ErrHoldNotFound
+	}
+	return hold, nil
+}
+
+// parseFee parses the optional fee of a transfer; a missing fee is zero
+func (s *accountService) parseFee(fee string) (domain.Money, error) {
+	if fee == "" {
+		return domain.NewMoney(0, s.balanceScale), nil
+	}
+	return s.parseAmount(fee)
+}
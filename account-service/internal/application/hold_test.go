@@ -0,0 +1,192 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"internal-transfers/account-service/internal/domain"
+	"internal-transfers/pkg/features"
+	"testing"
+)
+
+// heldTransfer submits a transfer of 60.00 with a fee of 1.00 from account 1 to account 2, which
+// account 1 never paid before, with holds starting above 50.00, and checks that it was held
+func heldTransfer(t *testing.T) (*memoryRepository, *recordingBroker, AccountService) {
+	t.Helper()
+	flags, err := features.Parse([]string{string(features.FraudHolds)})
+	if err != nil {
+		t.Fatalf("features.Parse() error = %v", err)
+	}
+	repo := newMemoryRepository(
+		domain.Account{ID: 1, Balance: "100"},
+		domain.Account{ID: 2, Balance: "0"},
+		domain.Account{ID: 3, Balance: "0"},
+	)
+	broker := &recordingBroker{}
+	service := NewAccountService(repo, broker, WithFeatures(flags), WithFraudHold(domain.NewMoney(5000, 2)), WithFeeAccount(3))
+
+	event := domain.TransactionEvent{TransactionID: 7, SourceAccountID: 1, DestinationAccountID: 2, Amount: "60", Fee: "1.00"}
+	if err := service.HandleTransactionSubmitted(context.Background(), event); err != nil {
+		t.Fatalf("HandleTransactionSubmitted() error = %v", err)
+	}
+	if len(broker.held) != 1 || len(broker.completed) != 0 {
+		t.Fatalf("published %d held and %d completed events, want one held", len(broker.held), len(broker.completed))
+	}
+	// Only the amount and fee are reserved on the source
+	for id, want := range map[domain.AccountID]string{1: "39.00", 2: "0.00", 3: "0.00"} {
+		if got := repo.balance(t, id); got != want {
+			t.Fatalf("account %d balance = %s after the hold, want %s", id, got, want)
+		}
+	}
+	return repo, broker, service
+}
+
+func TestApproveHeldTransfer(t *testing.T) {
+	repo, broker, service := heldTransfer(t)
+
+	hold, err := service.ApproveHeldTransfer(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("ApproveHeldTransfer() error = %v", err)
+	}
+	if hold.Status != domain.HoldStatusApproved {
+		t.Errorf("hold status = %s, want %s", hold.Status, domain.HoldStatusApproved)
+	}
+	for id, want := range map[domain.AccountID]string{1: "39.00", 2: "60.00", 3: "1.00"} {
+		if got := repo.balance(t, id); got != want {
+			t.Errorf("account %d balance = %s, want %s", id, got, want)
+		}
+	}
+	if len(broker.completed) != 1 || len(broker.failed) != 0 {
+		t.Errorf("published %d completed and %d failed events, want one completed", len(broker.completed), len(broker.failed))
+	}
+}
+
+func TestRejectHeldTransfer(t *testing.T) {
+	repo, broker, service := heldTransfer(t)
+
+	hold, err := service.RejectHeldTransfer(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("RejectHeldTransfer() error = %v", err)
+	}
+	if hold.Status != domain.HoldStatusRejected {
+		t.Errorf("hold status = %s, want %s", hold.Status, domain.HoldStatusRejected)
+	}
+	// The reserved amount and fee go back to the source
+	for id, want := range map[domain.AccountID]string{1: "100.00", 2: "0.00", 3: "0.00"} {
+		if got := repo.balance(t, id); got != want {
+			t.Errorf("account %d balance = %s, want %s", id, got, want)
+		}
+	}
+	if codes := broker.failureCodes(); len(codes) != 1 || codes[0] != domain.FailureRejectedInReview || len(broker.completed) != 0 {
+		t.Errorf("failure codes = %v and %d completed events, want [%s] only", codes, len(broker.completed), domain.FailureRejectedInReview)
+	}
+}
+
+func TestResolveHeldTransferTwice(t *testing.T) {
+	type resolve func(AccountService, context.Context, domain.TransactionID) (*domain.TransferHold, error)
+	approve, reject := resolve(AccountService.ApproveHeldTransfer), resolve(AccountService.RejectHeldTransfer)
+	tests := []struct {
+		name          string
+		first, second resolve
+		want          map[domain.AccountID]string
+	}{
+		{name: "approved then approved", first: approve, second: approve, want: map[domain.AccountID]string{1: "39.00", 2: "60.00", 3: "1.00"}},
+		{name: "approved then rejected", first: approve, second: reject, want: map[domain.AccountID]string{1: "39.00", 2: "60.00", 3: "1.00"}},
+		{name: "rejected then approved", first: reject, second: approve, want: map[domain.AccountID]string{1: "100.00", 2: "0.00", 3: "0.00"}},
+		{name: "rejected then rejected", first: reject, second: reject, want: map[domain.AccountID]string{1: "100.00", 2: "0.00", 3: "0.00"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, broker, service := heldTransfer(t)
+			if _, err := tt.first(service, context.Background(), 7); err != nil {
+				t.Fatalf("first review error = %v", err)
+			}
+			completed, failed := len(broker.completed), len(broker.failed)
+
+			// The second review changes nothing, so funds are never moved or returned twice
+			if _, err := tt.second(service, context.Background(), 7); !errors.Is(err, ErrHoldResolved) {
+				t.Errorf("second review error = %v, want %v", err, ErrHoldResolved)
+			}
+			for id, want := range tt.want {
+				if got := repo.balance(t, id); got != want {
+					t.Errorf("account %d balance = %s, want %s", id, got, want)
+				}
+			}
+			if len(broker.completed) != completed || len(broker.failed) != failed {
+				t.Errorf("the second review published %d completed and %d failed events, want none",
+					len(broker.completed)-completed, len(broker.failed)-failed)
+			}
+		})
+	}
+}
+
+func TestReviewTransferNotHeld(t *testing.T) {
+	_, _, service := heldTransfer(t)
+	if _, err := service.ApproveHeldTransfer(context.Background(), 8); !errors.Is(err, ErrHoldNotFound) {
+		t.Errorf("ApproveHeldTransfer() error = %v, want %v", err, ErrHoldNotFound)
+	}
+	if _, err := service.RejectHeldTransfer(context.Background(), 8); !errors.Is(err, ErrHoldNotFound) {
+		t.Errorf("RejectHeldTransfer() error = %v, want %v", err, ErrHoldNotFound)
+	}
+}
+
+func TestApproveHeldTransferToFrozenAccount(t *testing.T) {
+	repo, broker, service := heldTransfer(t)
+	if _, err := repo.UpdateStatus(context.Background(), 2, domain.AccountStatusFrozen); err != nil {
+		t.Fatalf("UpdateStatus() error = %v", err)
+	}
+
+	// The destination was frozen during the review: the transfer stays held and can still be rejected
+	if _, err := service.ApproveHeldTransfer(context.Background(), 7); !errors.Is(err, ErrTransferBlocked) {
+		t.Fatalf("ApproveHeldTransfer() error = %v, want %v", err, ErrTransferBlocked)
+	}
+	if got := repo.balance(t, 1); got != "39.00" || len(broker.completed) != 0 {
+		t.Errorf("source balance = %s with %d completed events, want the funds still reserved", got, len(broker.completed))
+	}
+	if _, err := service.RejectHeldTransfer(context.Background(), 7); err != nil {
+		t.Errorf("RejectHeldTransfer() error = %v", err)
+	}
+	if got := repo.balance(t, 1); got != "100.00" {
+		t.Errorf("source balance = %s, want 100.00", got)
+	}
+}
+
+func TestGetAvailableBalance(t *testing.T) {
+	type balances struct{ balance, reserved, available string }
+	tests := []struct {
+		name    string
+		resolve func(AccountService, context.Context, domain.TransactionID) (*domain.TransferHold, error)
+		want    balances
+	}{
+		// The amount and fee are reserved, so less is available than the balance
+		{name: "held", want: balances{balance: "100.00", reserved: "61.00", available: "39.00"}},
+		{name: "approved", resolve: AccountService.ApproveHeldTransfer, want: balances{balance: "39.00", reserved: "0.00", available: "39.00"}},
+		{name: "rejected", resolve: AccountService.RejectHeldTransfer, want: balances{balance: "100.00", reserved: "0.00", available: "100.00"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, service := heldTransfer(t)
+			if tt.resolve != nil {
+				if _, err := tt.resolve(service, context.Background(), 7); err != nil {
+					t.Fatalf("review error = %v", err)
+				}
+			}
+
+			got, err := service.GetAvailableBalance(context.Background(), 1)
+			if err != nil {
+				t.Fatalf("GetAvailableBalance() error = %v", err)
+			}
+			if got := (balances{normalizedBalance(got.Balance), normalizedBalance(got.Reserved), normalizedBalance(got.Available)}); got != tt.want {
+				t.Errorf("GetAvailableBalance() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAvailableBalanceUnknownAccount(t *testing.T) {
+	_, _, service := heldTransfer(t)
+	if _, err := service.GetAvailableBalance(context.Background(), 9); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("GetAvailableBalance() error = %v, want %v", err, ErrAccountNotFound)
+	}
+}
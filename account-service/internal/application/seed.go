@@ -0,0 +1,59 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"internal-transfers/account-service/internal/domain"
+	"log/slog"
+	"os"
+)
+
+// SeedAccount describes an account to create at startup, as listed in a seed file
+type SeedAccount struct {
+	AccountID      int64  `json:"account_id"`
+	InitialBalance string `json:"initial_balance"`
+}
+
+// LoadSeedAccounts reads a JSON array of accounts such as [{"account_id": 1, "initial_balance": "100.00"}]
+func LoadSeedAccounts(path string) ([]SeedAccount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed file: %w", err)
+	}
+
+	var accounts []SeedAccount
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to parse seed file %s: %w", path, err)
+	}
+
+	return accounts, nil
+}
+
+// SeedAccounts creates the listed accounts that do not exist yet and returns how many were created.
+// Existing accounts are left untouched, so seeding is safe to run on every startup.
+func SeedAccounts(ctx context.Context, service AccountService, accounts []SeedAccount) (int, error) {
+	created := 0
+	for _, account := range accounts {
+		initialBalance, err := domain.NormalizeAmount(account.InitialBalance)
+		if err != nil {
+			return created, fmt.Errorf("invalid initial balance for seed account %d: %w", account.AccountID, err)
+		}
+
+		_, err = service.CreateAccount(ctx, CreateAccountDTO{
+			AccountID:      domain.AccountID(account.AccountID),
+			InitialBalance: initialBalance,
+		})
+		switch {
+		case errors.Is(err, ErrAccountExists):
+			slog.Default().Info("seed account already exists", "account_id", account.AccountID)
+		case err != nil:
+			return created, fmt.Errorf("failed to seed account %d: %w", account.AccountID, err)
+		default:
+			created++
+		}
+	}
+
+	return created, nil
+}
@@ -0,0 +1,133 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"internal-transfers/account-service/internal/domain"
+)
+
+// ErrCompensationFailed is returned when a transfer failed after its amount was reserved and the
+// reservation could not be cancelled either; the reserved funds need manual attention
+var ErrCompensationFailed = errors.New("failed to cancel reservation")
+
+// TwoPhaseTransfer moves amount from an account of the source ledger to an account of the
+// destination ledger, which may be the same ledger or another account store. The amount is
+// reserved on the source first and credited to the destination; the reservation is confirmed once
+// the credit succeeded and cancelled, returning the funds to the source, if it failed.
+func TwoPhaseTransfer(ctx context.Context, transactionID domain.TransactionID, source domain.TransferLedger, sourceID domain.AccountID, destination domain.TransferLedger, destinationID domain.AccountID, amount domain.Money) error {
+	if amount.Sign() <= 0 {
+		return ErrInvalidAmount
+	}
+
+	reservation, err := source.Reserve(ctx, transactionID, sourceID, amount)
+	if err != nil {
+		return fmt.Errorf("failed to reserve funds: %w", err)
+	}
+
+	if err := destination.Credit(ctx, transactionID, destinationID, amount); err != nil {
+		// The credit failed, so the transfer must leave no trace on the source either
+		if cancelErr := source.Cancel(context.WithoutCancel(ctx), *reservation); cancelErr != nil {
+			return fmt.Errorf("%w: transaction %d: %v (credit failed: %v)", ErrCompensationFailed, transactionID, cancelErr, err)
+		}
+		return fmt.Errorf("failed to credit destination: %w", err)
+	}
+
+	if err := source.Confirm(context.WithoutCancel(ctx), *reservation); err != nil {
+		return fmt.Errorf("failed to confirm reservation: %w", err)
+	}
+	return nil
+}
+
+// localLedger is the TransferLedger of the accounts held by this service. Reservations are
+// recorded with the same hold and release ledger entries as transfers held for fraud review.
+type localLedger struct {
+	s *accountService
+}
+
+// NewLocalLedger returns the TransferLedger of the accounts stored in repo. Only the balance scale
+// and logger options apply.
+func NewLocalLedger(repo domain.AccountRepository, opts ...Option) domain.TransferLedger {
+	s := NewAccountService(repo, nil, opts...).(*accountService)
+	return &localLedger{s: s}
+}
+
+// Reserve puts a hold on the amount, failing with ErrInsufficientFunds if the balance does not cover it
+func (l *localLedger) Reserve(ctx context.Context, transactionID domain.TransactionID, accountID domain.AccountID, amount domain.Money) (*domain.Reservation, error) {
+	postings := []posting{{accountID: accountID, entryType: domain.LedgerEntryHold, amount: amount.Neg()}}
+	err := l.apply(ctx, transactionID, postings, func(accounts map[domain.AccountID]*domain.Account) error {
+		if accounts[accountID].Status != domain.AccountStatusActive {
+			return fmt.Errorf("%w: account %d is %s", ErrTransferBlocked, accountID, accounts[accountID].Status)
+		}
+		balance, err := domain.ParseMoney(accounts[accountID].Balance)
+		if err != nil {
+			return fmt.Errorf("invalid balance on account %d: %w", accountID, err)
+		}
+		if balance.Cmp(amount) < 0 {
+			return ErrInsufficientFunds
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Reservation{TransactionID: transactionID, AccountID: accountID, Amount: amount}, nil
+}
+
+// Credit credits the amount to the account, which must be active
+func (l *localLedger) Credit(ctx context.Context, transactionID domain.TransactionID, accountID domain.AccountID, amount domain.Money) error {
+	postings := []posting{{accountID: accountID, entryType: domain.LedgerEntryCredit, amount: amount}}
+	return l.apply(ctx, transactionID, postings, func(accounts map[domain.AccountID]*domain.Account) error {
+		if accounts[accountID].Status != domain.AccountStatusActive {
+			return fmt.Errorf("%w: account %d is %s", ErrTransferBlocked, accountID, accounts[accountID].Status)
+		}
+		return nil
+	})
+}
+
+// Confirm releases the hold and debits the account, as an approved held transfer does
+func (l *localLedger) Confirm(ctx context.Context, reservation domain.Reservation) error {
+	return l.apply(ctx, reservation.TransactionID, []posting{
+		{accountID: reservation.AccountID, entryType: domain.LedgerEntryRelease, amount: reservation.Amount},
+		{accountID: reservation.AccountID, entryType: domain.LedgerEntryDebit, amount: reservation.Amount.Neg()},
+	}, nil)
+}
+
+// Cancel releases the hold, whatever the status the account is in by now, as the funds are its own
+func (l *localLedger) Cancel(ctx context.Context, reservation domain.Reservation) error {
+	return l.apply(ctx, reservation.TransactionID, []posting{
+		{accountID: reservation.AccountID, entryType: domain.LedgerEntryRelease, amount: reservation.Amount},
+	}, nil)
+}
+
+// apply locks the account of the postings, lets check refuse the change, and saves the postings
+func (l *localLedger) apply(ctx context.Context, transactionID domain.TransactionID, postings []posting, check func(accounts map[domain.AccountID]*domain.Account) error) error {
+	accountID := postings[0].accountID
+	var (
+		updated        []*domain.Account
+		balancesBefore map[domain.AccountID]string
+	)
+	err := l.s.repo.ApplyTransfer(ctx, []domain.AccountID{accountID}, func(accounts map[domain.AccountID]*domain.Account) ([]*domain.Account, []domain.LedgerEntry, error) {
+		if accounts[accountID] == nil {
+			return nil, nil, fmt.Errorf("account %d: %w", accountID, ErrAccountNotFound)
+		}
+		if check != nil {
+			if err := check(accounts); err != nil {
+				return nil, nil, err
+			}
+		}
+		var (
+			entries []domain.LedgerEntry
+			err     error
+		)
+		balancesBefore = balancesOf(accounts)
+		updated, entries, err = l.s.applyPostings(accounts, transactionID, postings)
+		return updated, entries, err
+	})
+	if err != nil {
+		return err
+	}
+
+	l.s.logBalanceChanges(transactionID, balancesBefore, updated)
+	return nil
+}
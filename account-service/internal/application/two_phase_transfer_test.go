@@ -0,0 +1,138 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"internal-transfers/account-service/internal/domain"
+	"slices"
+	"testing"
+)
+
+// fakeLedger records the calls made to it, in order across every fakeLedger sharing calls, and
+// fails the steps given an error
+type fakeLedger struct {
+	domain.TransferLedger
+
+	name                                         string
+	calls                                        *[]string
+	reserveErr, creditErr, confirmErr, cancelErr error
+}
+
+func (l *fakeLedger) record(step string) {
+	*l.calls = append(*l.calls, l.name+" "+step)
+}
+
+func (l *fakeLedger) Reserve(_ context.Context, transactionID domain.TransactionID, accountID domain.AccountID, amount domain.Money) (*domain.Reservation, error) {
+	l.record("reserve")
+	if l.reserveErr != nil {
+		return nil, l.reserveErr
+	}
+	return &domain.Reservation{TransactionID: transactionID, AccountID: accountID, Amount: amount}, nil
+}
+
+func (l *fakeLedger) Credit(context.Context, domain.TransactionID, domain.AccountID, domain.Money) error {
+	l.record("credit")
+	return l.creditErr
+}
+
+func (l *fakeLedger) Confirm(context.Context, domain.Reservation) error {
+	l.record("confirm")
+	return l.confirmErr
+}
+
+func (l *fakeLedger) Cancel(context.Context, domain.Reservation) error {
+	l.record("cancel")
+	return l.cancelErr
+}
+
+func TestTwoPhaseTransfer(t *testing.T) {
+	creditFailed := errors.New("destination unavailable")
+	tests := []struct {
+		name        string
+		source      fakeLedger
+		destination fakeLedger
+		amount      domain.Money
+		wantCalls   []string
+		wantErr     error
+	}{
+		{
+			name:      "confirmed",
+			amount:    domain.NewMoney(1000, 2),
+			wantCalls: []string{"source reserve", "destination credit", "source confirm"},
+		},
+		{
+			name:      "reservation refused",
+			source:    fakeLedger{reserveErr: ErrInsufficientFunds},
+			amount:    domain.NewMoney(1000, 2),
+			wantCalls: []string{"source reserve"},
+			wantErr:   ErrInsufficientFunds,
+		},
+		{
+			name:        "credit failed",
+			destination: fakeLedger{creditErr: creditFailed},
+			amount:      domain.NewMoney(1000, 2),
+			wantCalls:   []string{"source reserve", "destination credit", "source cancel"},
+			wantErr:     creditFailed,
+		},
+		{
+			name:        "cancellation failed",
+			source:      fakeLedger{cancelErr: errors.New("source unavailable")},
+			destination: fakeLedger{creditErr: creditFailed},
+			amount:      domain.NewMoney(1000, 2),
+			wantCalls:   []string{"source reserve", "destination credit", "source cancel"},
+			wantErr:     ErrCompensationFailed,
+		},
+		{
+			name:    "amount not positive",
+			amount:  domain.NewMoney(0, 2),
+			wantErr: ErrInvalidAmount,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			source, destination := tt.source, tt.destination
+			source.name, source.calls = "source", &calls
+			destination.name, destination.calls = "destination", &calls
+
+			err := TwoPhaseTransfer(context.Background(), 1, &source, 1, &destination, 2, tt.amount)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("TwoPhaseTransfer() error = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestTwoPhaseTransferLocalLedger(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination domain.AccountStatus
+		wantErr     error
+		want        map[domain.AccountID]string
+	}{
+		{name: "confirmed", destination: domain.AccountStatusActive, want: map[domain.AccountID]string{1: "90.00", 2: "10.00"}},
+		{name: "credit refused", destination: domain.AccountStatusFrozen, wantErr: ErrTransferBlocked, want: map[domain.AccountID]string{1: "100.00", 2: "0.00"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository(domain.Account{ID: 1, Balance: "100"}, domain.Account{ID: 2, Balance: "0", Status: tt.destination})
+			ledger := NewLocalLedger(repo)
+
+			err := TwoPhaseTransfer(context.Background(), 1, ledger, 1, ledger, 2, domain.NewMoney(1000, 2))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TwoPhaseTransfer() error = %v, want %v", err, tt.wantErr)
+			}
+			// A cancelled reservation gives the source its funds back
+			for id, want := range tt.want {
+				if got := repo.balance(t, id); got != want {
+					t.Errorf("account %d balance = %s, want %s", id, got, want)
+				}
+			}
+		})
+	}
+}
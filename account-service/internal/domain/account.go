@@ -1,6 +1,10 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
 // AccountID represents a unique identifier for an account
 type AccountID int64
@@ -8,14 +12,114 @@ type AccountID int64
 // TransactionID represents a unique identifier for a transaction
 type TransactionID int64
 
+// AccountStatus represents whether an account may take part in transfers
+type AccountStatus string
+
+const (
+	// AccountStatusActive accounts send and receive transfers
+	AccountStatusActive AccountStatus = "active"
+	// AccountStatusFrozen accounts are temporarily blocked from sending and receiving transfers
+	AccountStatusFrozen AccountStatus = "frozen"
+	// AccountStatusClosed accounts are permanently blocked and cannot be reopened
+	AccountStatusClosed AccountStatus = "closed"
+)
+
+// Valid reports whether s is a known account status
+func (s AccountStatus) Valid() bool {
+	switch s {
+	case AccountStatusActive, AccountStatusFrozen, AccountStatusClosed:
+		return true
+	}
+	return false
+}
+
 // Account represents a bank account
 type Account struct {
-	ID      AccountID `json:"id"`
-	Balance string    `json:"balance"`
+	ID      AccountID     `json:"id"`
+	Balance string        `json:"balance"`
+	Status  AccountStatus `json:"status"`
+}
+
+// TransferFunc computes the accounts to update and the ledger entries to record from the
+// locked accounts, keyed by id. Accounts that do not exist are missing from the map.
+type TransferFunc func(accounts map[AccountID]*Account) ([]*Account, []LedgerEntry, error)
+
+// ErrOverloaded is returned by repositories when no database connection became free in time
+var ErrOverloaded = errors.New("service overloaded")
+
+// ErrIdempotencyKeyExists is returned by repositories when an account was already created under the
+// idempotency key
+var ErrIdempotencyKeyExists = errors.New("idempotency key already exists")
+
+// ErrAlreadyProcessed is returned by repositories when the message being handled was already
+// applied, so the write is rolled back instead of being applied twice
+var ErrAlreadyProcessed = errors.New("message already processed")
+
+// AccountCreation is the request an account was created by under an idempotency key
+type AccountCreation struct {
+	IdempotencyKey string
+	AccountID      AccountID
+	InitialBalance string
+}
+
+// AccountCache holds copies of accounts read from the repository. Implementations may keep them
+// in memory or in a shared store such as Redis; entries may disappear at any time.
+type AccountCache interface {
+	// Get returns the cached account, if any
+	Get(ctx context.Context, id AccountID) (*Account, bool)
+	// Set caches the account
+	Set(ctx context.Context, account *Account)
+	// Delete removes the accounts from the cache
+	Delete(ctx context.Context, ids ...AccountID)
 }
 
 type AccountRepository interface {
 	Create(ctx context.Context, account *Account) error
+	// CreateWithIdempotencyKey works like Create and records the creation under its idempotency key
+	// in the same database transaction. It returns ErrIdempotencyKeyExists, creating nothing, if
+	// the key was already used.
+	CreateWithIdempotencyKey(ctx context.Context, account *Account, creation AccountCreation) error
+	// GetAccountCreation returns the creation recorded under the idempotency key, or nil if there is none
+	GetAccountCreation(ctx context.Context, idempotencyKey string) (*AccountCreation, error)
+	// GetByID returns the account, or nil if there is none
 	GetByID(ctx context.Context, id AccountID) (*Account, error)
+	// NextAccountID draws the next ID from the account ID sequence, skipping ahead to min if the
+	// sequence is still below it
+	NextAccountID(ctx context.Context, min AccountID) (AccountID, error)
+	Exists(ctx context.Context, id AccountID) (bool, error)
 	Update(ctx context.Context, account *Account) error
+	// UpdateStatus sets the status of an account, reporting whether the account exists
+	UpdateStatus(ctx context.Context, id AccountID, status AccountStatus) (bool, error)
+	// ApplyTransfer locks the given accounts in ascending id order, lets fn compute their new
+	// balances and ledger entries, and saves both in a single database transaction.
+	// The transaction is rolled back if fn returns an error. When ctx is handling a message, the
+	// message is recorded as processed in the same transaction; ErrAlreadyProcessed is returned,
+	// applying nothing, if it already was.
+	ApplyTransfer(ctx context.Context, accountIDs []AccountID, fn TransferFunc) error
+	GetLedgerEntriesByTransaction(ctx context.Context, transactionID TransactionID) ([]LedgerEntry, error)
+	// GetBalanceAt reconstructs the balance of an account at the given time from its latest balance
+	// snapshot at or before that time and the ledger entries after it
+	GetBalanceAt(ctx context.Context, id AccountID, at time.Time) (string, error)
+	// SnapshotBalances records the balance as of asOf of every account whose ledger changed since its
+	// previous snapshot, and returns how many snapshots were taken
+	SnapshotBalances(ctx context.Context, asOf time.Time) (int64, error)
+	// GetRecentTransactions returns the latest transactions that moved the account's balance, newest
+	// first, skipping the first offset of them
+	GetRecentTransactions(ctx context.Context, id AccountID, limit, offset int) ([]AccountTransaction, error)
+	// GetReservedBalance returns the funds currently reserved on the account by transfers held for review
+	GetReservedBalance(ctx context.Context, id AccountID) (string, error)
+	// GetBalances returns the balances of the given accounts that exist, keyed by id
+	GetBalances(ctx context.Context, ids []AccountID) (map[AccountID]string, error)
+	// SumBalances returns the combined balance of the given accounts and how many of them exist
+	SumBalances(ctx context.Context, ids []AccountID) (string, int, error)
+	// HasTransferred reports whether source has ever been debited by a transfer that credited destination
+	HasTransferred(ctx context.Context, source, destination AccountID) (bool, error)
+	// HoldTransfer works like ApplyTransfer and records the transfer as held in the same database
+	// transaction. A transfer that already has a hold is left as it is, applying nothing.
+	HoldTransfer(ctx context.Context, transfer TransactionEvent, accountIDs []AccountID, fn TransferFunc) error
+	// GetHold returns the hold of a transaction, or nil if its transfer was never held
+	GetHold(ctx context.Context, transactionID TransactionID) (*TransferHold, error)
+	// ResolveHold works like ApplyTransfer and moves the held transfer into status in the same
+	// database transaction. It returns ErrHoldNotHeld, applying nothing, if the transfer is not held.
+	ResolveHold(ctx context.Context, transactionID TransactionID, status HoldStatus, accountIDs []AccountID, fn TransferFunc) error
 }
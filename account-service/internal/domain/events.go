@@ -1,18 +1,82 @@
 package domain
 
+import "errors"
+
+// EventStatus represents the state carried by a transaction event
+type EventStatus string
+
+const (
+	EventStatusPending  EventStatus = "pending"
+	EventStatusComplete EventStatus = "complete"
+	EventStatusFailed   EventStatus = "failed"
+	EventStatusHeld     EventStatus = "held"
+	// EventStatusProcessing events report that the account service has started applying a transfer
+	EventStatusProcessing EventStatus = "processing"
+)
+
+// FailureCode is a stable, machine-readable reason for a failed transaction
+type FailureCode string
+
+const (
+	FailureSourceAccountNotFound      FailureCode = "source_account_not_found"
+	FailureDestinationAccountNotFound FailureCode = "destination_account_not_found"
+	FailureInvalidAmount              FailureCode = "invalid_amount"
+	FailureInsufficientFunds          FailureCode = "insufficient_funds"
+	FailureAccountUpdateFailed        FailureCode = "account_update_failed"
+	FailurePublishFailed              FailureCode = "publish_failed"
+	FailureFeeAccountNotFound         FailureCode = "fee_account_not_found"
+	FailureSourceAccountFrozen        FailureCode = "source_account_frozen"
+	FailureSourceAccountClosed        FailureCode = "source_account_closed"
+	FailureDestinationAccountFrozen   FailureCode = "destination_account_frozen"
+	FailureDestinationAccountClosed   FailureCode = "destination_account_closed"
+	FailureRejectedInReview           FailureCode = "rejected_in_review"
+)
+
+// ErrTransferFailed is returned when handling a transaction event rejected the transfer for good
+// and published its failed event; the event must not be retried
+var ErrTransferFailed = errors.New("transfer failed")
+
 // TransactionEvent represents a transaction-related event
 type TransactionEvent struct {
 	TransactionID        TransactionID `json:"transaction_id"`
 	SourceAccountID      AccountID     `json:"source_account_id"`
 	DestinationAccountID AccountID     `json:"destination_account_id"`
 	Amount               string        `json:"amount"`
-	Status               string        `json:"status"`
+	Fee                  string        `json:"fee,omitempty"`
+	Memo                 string        `json:"memo,omitempty"`
+	Status               EventStatus   `json:"status"`
+	FailureCode          FailureCode   `json:"failure_code,omitempty"`
+	FailureReason        string        `json:"failure_reason,omitempty"`
+	// Legs is set for split transfers, which credit several accounts from a single debit of the
+	// source. DestinationAccountID is then the first leg's and Amount their total.
+	Legs []TransferLeg `json:"legs,omitempty"`
+}
+
+// TransferLeg is the amount a split transfer credits to one destination account
+type TransferLeg struct {
+	DestinationAccountID AccountID `json:"destination_account_id"`
+	Amount               string    `json:"amount"`
+}
+
+// DestinationIDs returns the accounts credited by the transfer: the destination of each leg of a
+// split transfer, or the single destination otherwise
+func (e TransactionEvent) DestinationIDs() []AccountID {
+	if len(e.Legs) == 0 {
+		return []AccountID{e.DestinationAccountID}
+	}
+	ids := make([]AccountID, len(e.Legs))
+	for i, leg := range e.Legs {
+		ids[i] = leg.DestinationAccountID
+	}
+	return ids
 }
 
 // Event types
 const (
-	EventTransactionSubmitted = "transaction.submitted"
-	EventTransactionCompleted = "transaction.completed"
-	EventTransactionFailed    = "transaction.failed"
-	EventTransactionRollback  = "transaction.rollback"
+	EventTransactionSubmitted  = "transaction.submitted"
+	EventTransactionCompleted  = "transaction.completed"
+	EventTransactionFailed     = "transaction.failed"
+	EventTransactionHeld       = "transaction.held"
+	EventTransactionProcessing = "transaction.processing"
+	EventTransactionRollback   = "transaction.rollback"
 )
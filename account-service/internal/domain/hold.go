@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// HoldStatus represents where a transfer held for fraud review is in its review
+type HoldStatus string
+
+const (
+	// HoldStatusHeld transfers have their funds reserved on the source account, awaiting review
+	HoldStatusHeld HoldStatus = "held"
+	// HoldStatusApproved transfers were completed with the reserved funds
+	HoldStatusApproved HoldStatus = "approved"
+	// HoldStatusRejected transfers failed and their reserved funds went back to the source account
+	HoldStatusRejected HoldStatus = "rejected"
+)
+
+// ErrHoldNotHeld is returned by repositories when a transfer is no longer held, because it was
+// approved or rejected meanwhile
+var ErrHoldNotHeld = errors.New("transfer is not held")
+
+// TransferHold is a transfer whose funds are reserved on the source account until it is reviewed
+type TransferHold struct {
+	// Transfer is the submitted transfer, which is finalized as submitted once approved
+	Transfer   TransactionEvent `json:"transfer"`
+	Status     HoldStatus       `json:"status"`
+	CreatedAt  time.Time        `json:"created_at"`
+	ResolvedAt *time.Time       `json:"resolved_at,omitempty"`
+}
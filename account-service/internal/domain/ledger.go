@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+// LedgerEntryType describes why a ledger entry was written
+type LedgerEntryType string
+
+const (
+	LedgerEntryOpening LedgerEntryType = "opening"
+	LedgerEntryDebit   LedgerEntryType = "debit"
+	LedgerEntryCredit  LedgerEntryType = "credit"
+	LedgerEntryFee     LedgerEntryType = "fee"
+	// LedgerEntryHold reserves the funds of a transfer held for review on its source account
+	LedgerEntryHold LedgerEntryType = "hold"
+	// LedgerEntryRelease returns the reserved funds of a reviewed transfer to its source account
+	LedgerEntryRelease LedgerEntryType = "release"
+)
+
+// LedgerEntry records a single signed balance movement on an account
+type LedgerEntry struct {
+	ID            int64           `json:"id"`
+	AccountID     AccountID       `json:"account_id"`
+	TransactionID TransactionID   `json:"transaction_id,omitempty"`
+	Type          LedgerEntryType `json:"type"`
+	Amount        string          `json:"amount"`
+	BalanceAfter  string          `json:"balance_after"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// AccountTransaction summarizes the effect of one transaction on an account, as derived from its
+// ledger entries. Amount is the net signed change of the balance, including any fee.
+type AccountTransaction struct {
+	TransactionID TransactionID `json:"transaction_id"`
+	Amount        string        `json:"amount"`
+	BalanceAfter  string        `json:"balance_after"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
@@ -0,0 +1,329 @@
+package domain
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		units int64
+		scale int32
+		err   error
+	}{
+		{name: "cents", input: "10.50", units: 1050, scale: 2},
+		{name: "trailing zeros are kept", input: "10.500", units: 10500, scale: 3},
+		{name: "leading zeros", input: "007.5", units: 75, scale: 1},
+		{name: "surrounding whitespace", input: " \t10.5\n ", units: 105, scale: 1},
+		{name: "plus sign", input: "+1", units: 1, scale: 0},
+		{name: "negative", input: "-10.50", units: -1050, scale: 2},
+		{name: "zero", input: "0", units: 0, scale: 0},
+		{name: "zero with decimals", input: "0.00", units: 0, scale: 2},
+		{name: "negative zero", input: "-0", units: 0, scale: 0},
+		{name: "missing integer part", input: ".5", units: 5, scale: 1},
+		{name: "max scale", input: "0.00000001", units: 1, scale: MaxScale},
+		{name: "over max scale", input: "0.000000001", units: 1, scale: MaxScale + 1},
+		{name: "largest units", input: "92233720368547758.07", units: math.MaxInt64, scale: 2},
+		{name: "overflow", input: "92233720368547758.08", err: ErrInvalidMoney},
+		{name: "empty", input: "", err: ErrInvalidMoney},
+		{name: "sign only", input: "-", err: ErrInvalidMoney},
+		{name: "point without decimals", input: "10.", err: ErrInvalidMoney},
+		{name: "inner whitespace", input: "1 000", err: ErrInvalidMoney},
+		{name: "two points", input: "1.2.3", err: ErrInvalidMoney},
+		{name: "two signs", input: "--1", err: ErrInvalidMoney},
+		{name: "comma", input: "10,50", err: ErrInvalidMoney},
+		{name: "letters", input: "ten", err: ErrInvalidMoney},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMoney(tt.input)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("ParseMoney(%q) error = %v, want %v", tt.input, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMoney(%q) error = %v", tt.input, err)
+			}
+			if got.Units() != tt.units || got.Scale() != tt.scale {
+				t.Errorf("ParseMoney(%q) = %d at scale %d, want %d at scale %d", tt.input, got.Units(), got.Scale(), tt.units, tt.scale)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		name  string
+		money Money
+		want  string
+	}{
+		{name: "cents", money: NewMoney(1050, 2), want: "10.50"},
+		{name: "trailing zeros are kept", money: NewMoney(10500, 3), want: "10.500"},
+		{name: "below one", money: NewMoney(5, 2), want: "0.05"},
+		{name: "negative below one", money: NewMoney(-5, 2), want: "-0.05"},
+		{name: "negative", money: NewMoney(-1050, 2), want: "-10.50"},
+		{name: "zero", money: NewMoney(0, 2), want: "0.00"},
+		{name: "whole", money: NewMoney(100, 0), want: "100"},
+		{name: "max scale", money: NewMoney(1, MaxScale), want: "0.00000001"},
+		{name: "largest units", money: NewMoney(math.MaxInt64, 2), want: "92233720368547758.07"},
+		{name: "smallest units", money: NewMoney(math.MinInt64, 2), want: "-92233720368547758.08"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.money.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyStringRoundTrip(t *testing.T) {
+	for _, s := range []string{"10.50", "10.500", "0.05", "-0.05", "0.00", "100", "0.00000001", "92233720368547758.07"} {
+		m, err := ParseMoney(s)
+		if err != nil {
+			t.Fatalf("ParseMoney(%q) error = %v", s, err)
+		}
+		if got := m.String(); got != s {
+			t.Errorf("ParseMoney(%q).String() = %q", s, got)
+		}
+	}
+}
+
+func TestMoneyCheckedAdd(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  Money
+		units int64
+		scale int32
+		err   error
+	}{
+		{name: "same scale", a: NewMoney(1050, 2), b: NewMoney(25, 2), units: 1075, scale: 2},
+		{name: "larger scale wins", a: NewMoney(1050, 2), b: NewMoney(1, 3), units: 10501, scale: 3},
+		{name: "negative", a: NewMoney(1050, 2), b: NewMoney(-2000, 2), units: -950, scale: 2},
+		{name: "up to the largest units", a: NewMoney(math.MaxInt64-1, 2), b: NewMoney(1, 2), units: math.MaxInt64, scale: 2},
+		{name: "down to the smallest units", a: NewMoney(math.MinInt64+1, 2), b: NewMoney(-1, 2), units: math.MinInt64, scale: 2},
+		{name: "one unit over the largest", a: NewMoney(math.MaxInt64, 2), b: NewMoney(1, 2), err: ErrAmountOverflow},
+		{name: "one unit under the smallest", a: NewMoney(math.MinInt64, 2), b: NewMoney(-1, 2), err: ErrAmountOverflow},
+		{name: "opposite signs at the boundary", a: NewMoney(math.MaxInt64, 2), b: NewMoney(math.MinInt64, 2), units: -1, scale: 2},
+		{name: "scaling up overflows", a: NewMoney(math.MaxInt64/10+1, 2), b: NewMoney(1, 3), err: ErrAmountOverflow},
+		{name: "scaling up a negative amount overflows", a: NewMoney(1, 3), b: NewMoney(math.MinInt64/10-1, 2), err: ErrAmountOverflow},
+		{name: "scale difference beyond int64", a: NewMoney(1, 0), b: NewMoney(1, 19), err: ErrAmountOverflow},
+		{name: "zero scales up without overflowing", a: NewMoney(0, 0), b: NewMoney(1, 19), units: 1, scale: 19},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.CheckedAdd(tt.b)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("%s + %s: error = %v, want %v", tt.a, tt.b, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s + %s: error = %v", tt.a, tt.b, err)
+			}
+			if got.Units() != tt.units || got.Scale() != tt.scale {
+				t.Errorf("%s + %s = %d at scale %d, want %d at scale %d", tt.a, tt.b, got.Units(), got.Scale(), tt.units, tt.scale)
+			}
+		})
+	}
+}
+
+func TestNormalizeAmount(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		err   error
+	}{
+		{name: "canonical", input: "10.50", want: "10.50"},
+		{name: "whole", input: "10", want: "10.00"},
+		{name: "one decimal", input: "10.5", want: "10.50"},
+		{name: "trailing zeros beyond cents", input: "10.500", want: "10.50"},
+		{name: "significant decimals are kept", input: "10.125", want: "10.125"},
+		{name: "trailing zeros after significant decimals", input: "10.12500", want: "10.125"},
+		{name: "leading zeros, sign and whitespace", input: " +007.5 ", want: "7.50"},
+		{name: "missing integer part", input: ".5", want: "0.50"},
+		{name: "negative", input: "-10.5", want: "-10.50"},
+		{name: "zero", input: "0", want: "0.00"},
+		{name: "negative zero", input: "-0", want: "0.00"},
+		{name: "max scale", input: "0.00000001", want: "0.00000001"},
+		{name: "zeros beyond max scale", input: "0.0000000100", want: "0.00000001"},
+		{name: "over max scale", input: "0.000000001", err: ErrInvalidMoney},
+		{name: "largest amount", input: "92233720368547758.07", want: "92233720368547758.07"},
+		{name: "overflow once padded", input: "922337203685477581", err: ErrInvalidMoney},
+		{name: "point without decimals", input: "10.", err: ErrInvalidMoney},
+		{name: "inner whitespace", input: "1 000", err: ErrInvalidMoney},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeAmount(tt.input)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("NormalizeAmount(%q) error = %v, want %v", tt.input, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeAmount(%q) error = %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeAmount(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+
+			// The canonical form is a fixed point
+			again, err := NormalizeAmount(got)
+			if err != nil || again != got {
+				t.Errorf("NormalizeAmount(%q) = %q, %v, want it unchanged", got, again, err)
+			}
+		})
+	}
+}
+
+func TestNormalizeLocalizedAmount(t *testing.T) {
+	tests := []struct {
+		input string
+		point string
+		comma string
+	}{
+		// "." is a decimal separator in one format and groups thousands in the other
+		{input: "1.000", point: "1.00", comma: "1000.00"},
+		{input: "1.5", point: "1.50"},
+		{input: "1,5", comma: "1.50"},
+		{input: "1,000", comma: "1.00"},
+		{input: "1.000,50", comma: "1000.50"},
+		{input: "1.000.000", comma: "1000000.00"},
+		{input: "-1.234,5", comma: "-1234.50"},
+		{input: "1000", point: "1000.00", comma: "1000.00"},
+		{input: "1.00,5"},
+		{input: "1,000.50"},
+		{input: "1,5,0"},
+		{input: ",5", comma: "0.50"},
+	}
+
+	for _, tt := range tests {
+		for format, want := range map[AmountFormat]string{AmountFormatPoint: tt.point, AmountFormatComma: tt.comma} {
+			t.Run(string(format)+" "+tt.input, func(t *testing.T) {
+				got, err := NormalizeLocalizedAmount(tt.input, format)
+				if want == "" {
+					if !errors.Is(err, ErrInvalidMoney) {
+						t.Fatalf("NormalizeLocalizedAmount(%q) = %q, %v, want %v", tt.input, got, err, ErrInvalidMoney)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("NormalizeLocalizedAmount(%q) error = %v", tt.input, err)
+				}
+				if got != want {
+					t.Errorf("NormalizeLocalizedAmount(%q) = %q, want %q", tt.input, got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestMoneyRoundTo(t *testing.T) {
+	tests := []struct {
+		input  string
+		scale  int32
+		want   string
+		rounds bool
+	}{
+		{input: "10.12345", scale: 4, want: "10.1235", rounds: true},
+		{input: "10.12344", scale: 4, want: "10.1234", rounds: true},
+		{input: "-10.12345", scale: 4, want: "-10.1235", rounds: true},
+		{input: "10.12340", scale: 4, want: "10.1234"},
+		{input: "10.5", scale: 0, want: "11", rounds: true},
+		{input: "10.12", scale: 4, want: "10.1200"},
+		{input: "0.00000001", scale: 2, want: "0.00", rounds: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			m, err := ParseMoney(tt.input)
+			if err != nil {
+				t.Fatalf("ParseMoney(%q) error = %v", tt.input, err)
+			}
+			if got := m.RoundsAt(tt.scale); got != tt.rounds {
+				t.Errorf("RoundsAt(%d) = %t, want %t", tt.scale, got, tt.rounds)
+			}
+			if got := m.RoundTo(tt.scale).String(); got != tt.want {
+				t.Errorf("RoundTo(%d) = %s, want %s", tt.scale, got, tt.want)
+			}
+			// String keeps every decimal place of the unrounded amount
+			if got := m.String(); got != tt.input {
+				t.Errorf("String() = %s, want %s", got, tt.input)
+			}
+		})
+	}
+}
+
+func TestStripCurrency(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		err   error
+	}{
+		{input: "$10.50", want: "10.50"},
+		{input: "10.50 USD", want: "10.50"},
+		{input: "USD 10.50", want: "10.50"},
+		{input: "10.50usd", want: "10.50"},
+		{input: "10.50", want: "10.50"},
+		{input: "1.000,50 USD", want: "1.000,50"},
+		{input: "10.50 EUR", err: ErrCurrencyMismatch},
+		{input: "€10.50", err: ErrCurrencyMismatch},
+		{input: "$10.50 USD", err: ErrInvalidMoney},
+		{input: "10.50 dollars", err: ErrInvalidMoney},
+		{input: "#10.50", err: ErrInvalidMoney},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := StripCurrency(tt.input, "USD")
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("StripCurrency(%q) = %q, %v, want %v", tt.input, got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("StripCurrency(%q) error = %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("StripCurrency(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrencyDecimals(t *testing.T) {
+	tests := []struct {
+		currency string
+		want     int32
+	}{
+		{currency: "USD", want: 2},
+		{currency: "EUR", want: 2},
+		{currency: "JPY", want: 0},
+		{currency: "jpy", want: 0},
+		{currency: "KWD", want: 3},
+		// Unknown currencies have as many decimal places as amounts are displayed with
+		{currency: "XYZ", want: DisplayScale},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.currency, func(t *testing.T) {
+			if got := CurrencyDecimals(tt.currency); got != tt.want {
+				t.Errorf("CurrencyDecimals(%q) = %d, want %d", tt.currency, got, tt.want)
+			}
+		})
+	}
+}
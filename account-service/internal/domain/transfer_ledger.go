@@ -0,0 +1,26 @@
+package domain
+
+import "context"
+
+// Reservation is an amount taken out of an account's balance for a transfer that has not been
+// confirmed or cancelled yet
+type Reservation struct {
+	TransactionID TransactionID
+	AccountID     AccountID
+	Amount        Money
+}
+
+// TransferLedger is an account store taking part in a transfer whose source and destination may
+// live in different stores. The transfer is coordinated in two phases: the amount is reserved on
+// the source, credited on the destination, and the reservation is then confirmed, or cancelled if
+// the credit failed.
+type TransferLedger interface {
+	// Reserve takes amount out of the balance of the account and keeps it reserved for the transaction
+	Reserve(ctx context.Context, transactionID TransactionID, accountID AccountID, amount Money) (*Reservation, error)
+	// Credit adds amount to the balance of the account
+	Credit(ctx context.Context, transactionID TransactionID, accountID AccountID, amount Money) error
+	// Confirm debits the account with the reserved amount for good
+	Confirm(ctx context.Context, reservation Reservation) error
+	// Cancel returns the reserved amount to the balance of the account
+	Cancel(ctx context.Context, reservation Reservation) error
+}
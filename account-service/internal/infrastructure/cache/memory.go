@@ -0,0 +1,82 @@
+// Package cache provides the account cache used in front of the account repository.
+package cache
+
+import (
+	"context"
+	"internal-transfers/account-service/internal/clock"
+	"internal-transfers/account-service/internal/domain"
+	"sync"
+	"time"
+)
+
+// DefaultMaxEntries bounds the number of accounts held by a MemoryCache
+const DefaultMaxEntries = 10000
+
+// MemoryCache is an in-process AccountCache whose entries expire after a TTL
+type MemoryCache struct {
+	ttl        time.Duration
+	maxEntries int
+	clock      clock.Clock
+
+	mu      sync.Mutex
+	entries map[domain.AccountID]memoryEntry
+}
+
+type memoryEntry struct {
+	account domain.Account
+	expires time.Time
+}
+
+// NewMemoryCache creates an empty cache whose entries expire ttl after they were set
+func NewMemoryCache(ttl time.Duration, clk clock.Clock) *MemoryCache {
+	return &MemoryCache{
+		ttl:        ttl,
+		maxEntries: DefaultMaxEntries,
+		clock:      clk,
+		entries:    make(map[domain.AccountID]memoryEntry),
+	}
+}
+
+// Get returns a copy of the cached account, if it has not expired
+func (c *MemoryCache) Get(_ context.Context, id domain.AccountID) (*domain.Account, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	if !c.clock.Now().Before(entry.expires) {
+		delete(c.entries, id)
+		return nil, false
+	}
+	account := entry.account
+	return &account, true
+}
+
+// Set caches a copy of the account. When the cache is full, expired entries are dropped first;
+// if it is still full the account is not cached.
+func (c *MemoryCache) Set(_ context.Context, account *domain.Account) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	if _, ok := c.entries[account.ID]; !ok && len(c.entries) >= c.maxEntries {
+		for id, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, id)
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			return
+		}
+	}
+	c.entries[account.ID] = memoryEntry{account: *account, expires: now.Add(c.ttl)}
+}
+
+// Delete removes the accounts from the cache
+func (c *MemoryCache) Delete(_ context.Context, ids ...domain.AccountID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		delete(c.entries, id)
+	}
+}
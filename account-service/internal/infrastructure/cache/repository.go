@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"internal-transfers/account-service/internal/domain"
+	"sync/atomic"
+)
+
+// AccountRepository serves GetByID from a cache in front of another repository. Every write made
+// through it invalidates the accounts it touches, so reads through the same repository never see
+// a balance older than the last change. Writes made by other instances are only picked up once
+// the cached entry expires.
+type AccountRepository struct {
+	domain.AccountRepository
+	cache domain.AccountCache
+	// writes counts invalidations, so that a read racing with a write does not cache the old state
+	writes atomic.Uint64
+}
+
+// NewAccountRepository wraps repo with a read-through cache
+func NewAccountRepository(repo domain.AccountRepository, cache domain.AccountCache) *AccountRepository {
+	return &AccountRepository{AccountRepository: repo, cache: cache}
+}
+
+// GetByID returns the cached account, reading and caching it on a miss. Missing accounts are not
+// cached, so one created meanwhile is found at the next read.
+func (r *AccountRepository) GetByID(ctx context.Context, id domain.AccountID) (*domain.Account, error) {
+	if account, ok := r.cache.Get(ctx, id); ok {
+		return account, nil
+	}
+
+	writes := r.writes.Load()
+	account, err := r.AccountRepository.GetByID(ctx, id)
+	if err != nil || account == nil {
+		return nil, err
+	}
+	if r.writes.Load() == writes {
+		r.cache.Set(ctx, account)
+	}
+	return account, nil
+}
+
+// Update updates the account and invalidates its cached copy
+func (r *AccountRepository) Update(ctx context.Context, account *domain.Account) error {
+	defer r.invalidate(ctx, account.ID)
+	return r.AccountRepository.Update(ctx, account)
+}
+
+// UpdateStatus updates the status of the account and invalidates its cached copy
+func (r *AccountRepository) UpdateStatus(ctx context.Context, id domain.AccountID, status domain.AccountStatus) (bool, error) {
+	defer r.invalidate(ctx, id)
+	return r.AccountRepository.UpdateStatus(ctx, id, status)
+}
+
+// ApplyTransfer applies the transfer and invalidates the cached copies of the accounts involved
+func (r *AccountRepository) ApplyTransfer(ctx context.Context, accountIDs []domain.AccountID, fn domain.TransferFunc) error {
+	defer r.invalidate(ctx, accountIDs...)
+	return r.AccountRepository.ApplyTransfer(ctx, accountIDs, fn)
+}
+
+// HoldTransfer holds the transfer and invalidates the cached copies of the accounts involved
+func (r *AccountRepository) HoldTransfer(ctx context.Context, transfer domain.TransactionEvent, accountIDs []domain.AccountID, fn domain.TransferFunc) error {
+	defer r.invalidate(ctx, accountIDs...)
+	return r.AccountRepository.HoldTransfer(ctx, transfer, accountIDs, fn)
+}
+
+// ResolveHold resolves the held transfer and invalidates the cached copies of the accounts involved
+func (r *AccountRepository) ResolveHold(ctx context.Context, transactionID domain.TransactionID, status domain.HoldStatus, accountIDs []domain.AccountID, fn domain.TransferFunc) error {
+	defer r.invalidate(ctx, accountIDs...)
+	return r.AccountRepository.ResolveHold(ctx, transactionID, status, accountIDs, fn)
+}
+
+// invalidate drops the cached copies of the accounts once a write has finished, whether or not
+// it succeeded, even if the caller's context was cancelled meanwhile
+func (r *AccountRepository) invalidate(ctx context.Context, ids ...domain.AccountID) {
+	r.writes.Add(1)
+	r.cache.Delete(context.WithoutCancel(ctx), ids...)
+}
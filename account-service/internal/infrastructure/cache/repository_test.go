@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"context"
+	"internal-transfers/account-service/internal/clock"
+	"internal-transfers/account-service/internal/domain"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingRepository keeps accounts in memory and counts the reads reaching it; methods the tests
+// do not use panic through the embedded nil interface
+type countingRepository struct {
+	domain.AccountRepository
+
+	mu       sync.Mutex
+	accounts map[domain.AccountID]domain.Account
+	reads    int
+}
+
+func (r *countingRepository) GetByID(_ context.Context, id domain.AccountID) (*domain.Account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reads++
+	account, ok := r.accounts[id]
+	if !ok {
+		return nil, nil
+	}
+	return &account, nil
+}
+
+func (r *countingRepository) Update(_ context.Context, account *domain.Account) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.accounts[account.ID] = *account
+	return nil
+}
+
+func (r *countingRepository) ApplyTransfer(_ context.Context, accountIDs []domain.AccountID, fn domain.TransferFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	locked := make(map[domain.AccountID]*domain.Account, len(accountIDs))
+	for _, id := range accountIDs {
+		account := r.accounts[id]
+		locked[id] = &account
+	}
+	updated, _, err := fn(locked)
+	if err != nil {
+		return err
+	}
+	for _, account := range updated {
+		r.accounts[account.ID] = *account
+	}
+	return nil
+}
+
+func (r *countingRepository) readCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reads
+}
+
+// newCachedRepository serves account 1 with a balance of 100.00 through a cache
+func newCachedRepository() (*countingRepository, *AccountRepository, *clock.Fake) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	backing := &countingRepository{accounts: map[domain.AccountID]domain.Account{
+		1: {ID: 1, Balance: "100.00", Status: domain.AccountStatusActive},
+	}}
+	return backing, NewAccountRepository(backing, NewMemoryCache(time.Minute, clk)), clk
+}
+
+// getBalance reads the balance of account 1 through repo
+func getBalance(t *testing.T, repo domain.AccountRepository) string {
+	t.Helper()
+	account, err := repo.GetByID(context.Background(), 1)
+	if err != nil || account == nil {
+		t.Fatalf("GetByID() = %v, %v, want account 1", account, err)
+	}
+	return account.Balance
+}
+
+func TestCachedRead(t *testing.T) {
+	backing, repo, clk := newCachedRepository()
+
+	getBalance(t, repo)
+	getBalance(t, repo)
+	if reads := backing.readCount(); reads != 1 {
+		t.Errorf("the database was read %d times, want the second read served from the cache", reads)
+	}
+
+	// Expired entries are read again
+	clk.Advance(time.Minute)
+	getBalance(t, repo)
+	if reads := backing.readCount(); reads != 2 {
+		t.Errorf("the database was read %d times, want the expired entry read again", reads)
+	}
+
+	// Missing accounts are never cached
+	for range 2 {
+		if account, err := repo.GetByID(context.Background(), 2); account != nil || err != nil {
+			t.Fatalf("GetByID() of a missing account = %v, %v", account, err)
+		}
+	}
+	if reads := backing.readCount(); reads != 4 {
+		t.Errorf("the database was read %d times, want every read of a missing account to reach it", reads)
+	}
+}
+
+func TestCacheInvalidatedByWrites(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(repo domain.AccountRepository) error
+	}{
+		{
+			name: "update",
+			write: func(repo domain.AccountRepository) error {
+				return repo.Update(context.Background(), &domain.Account{ID: 1, Balance: "90.00", Status: domain.AccountStatusActive})
+			},
+		},
+		{
+			name: "transfer",
+			write: func(repo domain.AccountRepository) error {
+				return repo.ApplyTransfer(context.Background(), []domain.AccountID{1}, func(accounts map[domain.AccountID]*domain.Account) ([]*domain.Account, []domain.LedgerEntry, error) {
+					accounts[1].Balance = "90.00"
+					return []*domain.Account{accounts[1]}, nil, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backing, repo, _ := newCachedRepository()
+			if got := getBalance(t, repo); got != "100.00" {
+				t.Fatalf("balance = %s, want 100.00", got)
+			}
+			if err := tt.write(repo); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+
+			// The next read reaches the database and sees the new balance
+			if got := getBalance(t, repo); got != "90.00" {
+				t.Errorf("balance after the write = %s, want 90.00", got)
+			}
+			if reads := backing.readCount(); reads != 2 {
+				t.Errorf("the database was read %d times, want 2", reads)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package messaging
+
+import (
+	"internal-transfers/account-service/internal/domain"
+	eventsv1 "internal-transfers/pkg/api/events/v1"
+)
+
+// eventMapper converts transaction events to and from their protobuf message
+type eventMapper struct{}
+
+// ToProto converts event to its protobuf message
+func (eventMapper) ToProto(event domain.TransactionEvent) *eventsv1.TransactionEvent {
+	msg := &eventsv1.TransactionEvent{
+		TransactionId:        int64(event.TransactionID),
+		SourceAccountId:      int64(event.SourceAccountID),
+		DestinationAccountId: int64(event.DestinationAccountID),
+		Amount:               event.Amount,
+		Fee:                  event.Fee,
+		Memo:                 event.Memo,
+		Status:               string(event.Status),
+		FailureCode:          string(event.FailureCode),
+		FailureReason:        event.FailureReason,
+	}
+	for _, leg := range event.Legs {
+		msg.Legs = append(msg.Legs, &eventsv1.TransferLeg{DestinationAccountId: int64(leg.DestinationAccountID), Amount: leg.Amount})
+	}
+	return msg
+}
+
+// FromProto converts a protobuf message to a transaction event
+func (eventMapper) FromProto(msg *eventsv1.TransactionEvent) domain.TransactionEvent {
+	event := domain.TransactionEvent{
+		TransactionID:        domain.TransactionID(msg.GetTransactionId()),
+		SourceAccountID:      domain.AccountID(msg.GetSourceAccountId()),
+		DestinationAccountID: domain.AccountID(msg.GetDestinationAccountId()),
+		Amount:               msg.GetAmount(),
+		Fee:                  msg.GetFee(),
+		Memo:                 msg.GetMemo(),
+		Status:               domain.EventStatus(msg.GetStatus()),
+		FailureCode:          domain.FailureCode(msg.GetFailureCode()),
+		FailureReason:        msg.GetFailureReason(),
+	}
+	for _, leg := range msg.GetLegs() {
+		event.Legs = append(event.Legs, domain.TransferLeg{DestinationAccountID: domain.AccountID(leg.GetDestinationAccountId()), Amount: leg.GetAmount()})
+	}
+	return event
+}
@@ -0,0 +1,40 @@
+package messaging
+
+import (
+	"internal-transfers/account-service/internal/domain"
+	"reflect"
+	"testing"
+)
+
+func TestEventMapperRoundTrip(t *testing.T) {
+	events := []domain.TransactionEvent{
+		{TransactionID: 7, SourceAccountID: 1, DestinationAccountID: 2, Amount: "10.00", Status: domain.EventStatusPending},
+		{
+			TransactionID:        8,
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               "10.00",
+			Fee:                  "0.25",
+			Memo:                 "rent",
+			Status:               domain.EventStatusFailed,
+			FailureCode:          domain.FailureInsufficientFunds,
+			FailureReason:        "insufficient funds",
+		},
+		{
+			TransactionID:        9,
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               "15.00",
+			Status:               domain.EventStatusPending,
+			Legs:                 []domain.TransferLeg{{DestinationAccountID: 2, Amount: "5.00"}, {DestinationAccountID: 3, Amount: "10.00"}},
+		},
+	}
+
+	// Every field survives the protobuf message, so either encoding carries the same event
+	var mapper eventMapper
+	for _, event := range events {
+		if got := mapper.FromProto(mapper.ToProto(event)); !reflect.DeepEqual(got, event) {
+			t.Errorf("round trip of %+v = %+v", event, got)
+		}
+	}
+}
@@ -2,12 +2,10 @@ package messaging
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"internal-transfers/account-service/internal/domain"
-	"os"
-
-	amqp "github.com/rabbitmq/amqp091-go"
+	"internal-transfers/pkg/config"
+	"internal-transfers/pkg/rabbitmq"
 )
 
 // MessageBroker defines the interface for message broker operations
@@ -20,6 +18,10 @@ type MessageBroker interface {
 	PublishTransactionCompleted(ctx context.Context, event domain.TransactionEvent) error
 	// PublishTransactionFailed publishes a transaction failed event
 	PublishTransactionFailed(ctx context.Context, event domain.TransactionEvent) error
+	// PublishTransactionHeld publishes a transaction held event
+	PublishTransactionHeld(ctx context.Context, event domain.TransactionEvent) error
+	// PublishTransactionProcessing publishes a transaction processing event
+	PublishTransactionProcessing(ctx context.Context, event domain.TransactionEvent) error
 	// SubscribeToTransactionEvents subscribes to transaction events
 	SubscribeToTransactionEvents(ctx context.Context, handler func(ctx context.Context, event domain.TransactionEvent) error) error
 	// Close closes the message broker connection
@@ -28,270 +30,88 @@ type MessageBroker interface {
 
 // RabbitMQBroker implements MessageBroker using RabbitMQ
 type RabbitMQBroker struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
+	*rabbitmq.Broker[domain.TransactionEvent]
 }
 
-// NewRabbitMQBroker creates a new RabbitMQ broker instance
-func NewRabbitMQBroker() (*RabbitMQBroker, error) {
-	// Get RabbitMQ connection details from environment
-	user := os.Getenv("RABBITMQ_USER")
-	password := os.Getenv("RABBITMQ_PASSWORD")
-	host := os.Getenv("RABBITMQ_HOST")
-	port := os.Getenv("RABBITMQ_PORT")
-
-	// Create connection URL
-	url := fmt.Sprintf("amqp://%s:%s@%s:%s/", user, password, host, port)
-
-	// Connect to RabbitMQ
-	conn, err := amqp.Dial(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
-	}
-
-	// Create channel
-	ch, err := conn.Channel()
-	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to open channel: %w", err)
-	}
-
-	// Declare exchange
-	err = ch.ExchangeDeclare(
-		"transactions", // name
-		"topic",        // type
-		true,           // durable
-		false,          // auto-deleted
-		false,          // internal
-		false,          // no-wait
-		nil,            // arguments
-	)
+// NewRabbitMQBroker creates a new RabbitMQ broker instance for the given connection config.
+// Each call opens its own connection, so several brokers can be used side by side.
+func NewRabbitMQBroker(cfg config.RabbitMQConfig, opts ...rabbitmq.Option) (*RabbitMQBroker, error) {
+	broker, err := rabbitmq.NewBroker[domain.TransactionEvent](cfg, "transactions", eventMapper{}, opts...)
 	if err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, fmt.Errorf("failed to declare exchange: %w", err)
+		return nil, err
 	}
-
-	return &RabbitMQBroker{
-		conn:    conn,
-		channel: ch,
-	}, nil
+	return &RabbitMQBroker{Broker: broker}, nil
 }
 
 // PublishAccountCreated publishes an account created event
 func (b *RabbitMQBroker) PublishAccountCreated(ctx context.Context, account *domain.Account) error {
-	body, err := json.Marshal(account)
-	if err != nil {
-		return fmt.Errorf("failed to marshal account: %w", err)
-	}
-
-	return b.channel.PublishWithContext(ctx,
-		"transactions",    // exchange
-		"account.created", // routing key
-		false,             // mandatory
-		false,             // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+	return b.PublishJSON(ctx, "account.created", account)
 }
 
 // PublishTransactionSubmitted publishes a transaction submitted event
 func (b *RabbitMQBroker) PublishTransactionSubmitted(ctx context.Context, event domain.TransactionEvent) error {
-	body, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
-	}
-
-	return b.channel.PublishWithContext(ctx,
-		"transactions",          // exchange
-		"transaction.submitted", // routing key
-		false,                   // mandatory
-		false,                   // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+	return b.Publish(ctx, domain.EventTransactionSubmitted, event)
 }
 
 // PublishTransactionCompleted publishes a transaction completed event
 func (b *RabbitMQBroker) PublishTransactionCompleted(ctx context.Context, event domain.TransactionEvent) error {
-	body, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
-	}
-
-	return b.channel.PublishWithContext(ctx,
-		"transactions",                   // exchange
-		domain.EventTransactionCompleted, // routing key
-		false,                            // mandatory
-		false,                            // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+	return b.Publish(ctx, domain.EventTransactionCompleted, event)
 }
 
 // PublishTransactionFailed publishes a transaction failed event
 func (b *RabbitMQBroker) PublishTransactionFailed(ctx context.Context, event domain.TransactionEvent) error {
-	body, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
-	}
-
-	return b.channel.PublishWithContext(ctx,
-		"transactions",                // exchange
-		domain.EventTransactionFailed, // routing key
-		false,                         // mandatory
-		false,                         // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+	return b.Publish(ctx, domain.EventTransactionFailed, event)
 }
 
-// SubscribeToTransactionEvents subscribes to transaction events
-func (b *RabbitMQBroker) SubscribeToTransactionEvents(ctx context.Context, handler func(ctx context.Context, event domain.TransactionEvent) error) error {
-	// Declare dead letter queue
-	dlq, err := b.channel.QueueDeclare(
-		"account_transaction_events_dlq", // name
-		true,                             // durable
-		false,                            // delete when unused
-		false,                            // exclusive
-		false,                            // no-wait
-		nil,                              // arguments
-	)
-	if err != nil {
-		return fmt.Errorf("failed to declare DLQ: %w", err)
-	}
-
-	// Declare main queue with DLQ binding
-	q, err := b.channel.QueueDeclare(
-		"account_transaction_events", // name
-		true,                         // durable
-		false,                        // delete when unused
-		false,                        // exclusive
-		false,                        // no-wait
-		amqp.Table{
-			"x-dead-letter-exchange":    "", // Use default exchange
-			"x-dead-letter-routing-key": dlq.Name,
-			"x-message-ttl":             30000, // 30 seconds
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to declare queue: %w", err)
-	}
+// PublishTransactionHeld publishes a transaction held event
+func (b *RabbitMQBroker) PublishTransactionHeld(ctx context.Context, event domain.TransactionEvent) error {
+	return b.Publish(ctx, domain.EventTransactionHeld, event)
+}
 
-	// Bind queue to exchange for transaction submitted events only
-	err = b.channel.QueueBind(
-		q.Name,                           // queue name
-		domain.EventTransactionSubmitted, // routing key
-		"transactions",                   // exchange
-		false,                            // no-wait
-		nil,                              // arguments
-	)
-	if err != nil {
-		return fmt.Errorf("failed to bind queue: %w", err)
-	}
+// PublishTransactionProcessing publishes a transaction processing event
+func (b *RabbitMQBroker) PublishTransactionProcessing(ctx context.Context, event domain.TransactionEvent) error {
+	return b.Publish(ctx, domain.EventTransactionProcessing, event)
+}
 
-	// Consume messages
-	msgs, err := b.channel.Consume(
-		q.Name, // queue
-		"",     // consumer
-		false,  // auto-ack
-		false,  // exclusive
-		false,  // no-local
-		false,  // no-wait
-		nil,    // args
-	)
-	if err != nil {
-		return fmt.Errorf("failed to register consumer: %w", err)
+// SubscribeToTransactionEvents subscribes to transaction submitted events. Concurrent transfers
+// on the same accounts are serialized by row locks. Events whose transfer the handler rejected
+// are acknowledged, while other errors are retried.
+func (b *RabbitMQBroker) SubscribeToTransactionEvents(ctx context.Context, handler func(ctx context.Context, event domain.TransactionEvent) error) error {
+	queue := rabbitmq.Queue{
+		Name:     "account_transaction_events",
+		Bindings: []string{domain.EventTransactionSubmitted},
 	}
-
-	// Process messages
-	go func() {
-		for msg := range msgs {
-			var event domain.TransactionEvent
-			if err := json.Unmarshal(msg.Body, &event); err != nil {
-				fmt.Printf("Failed to unmarshal event: %v\n", err)
-				msg.Nack(false, false) // Reject without requeue
-				continue
-			}
-
-			// Initialize headers if nil
-			if msg.Headers == nil {
-				msg.Headers = make(amqp.Table)
-			}
-
-			// Get retry count from headers
-			retryCount := 0
-			if retries, ok := msg.Headers["x-retry-count"].(int32); ok {
-				retryCount = int(retries)
-			}
-
-			// Check if max retries reached
-			if retryCount >= 3 {
-				fmt.Printf("Max retries reached for transaction %d, moving to DLQ\n", event.TransactionID)
-				msg.Nack(false, false) // Move to DLQ
-				continue
-			}
-
-			if err := handler(ctx, event); err != nil {
-				fmt.Printf("Failed to handle event: %v\n", err)
-
-				// Increment retry count
-				retryCount++
-
-				// Publish the message again with updated retry count
-				headers := amqp.Table{
-					"x-retry-count": retryCount,
-				}
-
-				if retryCount >= 3 {
-					fmt.Printf("Max retries reached for transaction %d, moving to DLQ\n", event.TransactionID)
-					msg.Nack(false, false) // Move to DLQ
-				} else {
-					fmt.Printf("Retrying transaction %d (attempt %d/3)\n", event.TransactionID, retryCount)
-
-					// Publish the message again with updated headers
-					err = b.channel.PublishWithContext(ctx,
-						"transactions",                   // exchange
-						domain.EventTransactionSubmitted, // routing key
-						false,                            // mandatory
-						false,                            // immediate
-						amqp.Publishing{
-							ContentType: "application/json",
-							Body:        msg.Body,
-							Headers:     headers,
-						},
-					)
-					if err != nil {
-						fmt.Printf("Failed to republish message: %v\n", err)
-					}
-
-					msg.Ack(false) // Acknowledge the original message
-				}
-				continue
+	return b.Subscribe(ctx, queue, func(ctx context.Context, event domain.TransactionEvent) error {
+		// Normalize the amount on ingestion; invalid amounts are passed on unchanged
+		// so the handler can reject the transfer with a proper failure event
+		if amount, err := domain.NormalizeAmount(event.Amount); err == nil {
+			event.Amount = amount
+		}
+		if fee, err := domain.NormalizeAmount(event.Fee); err == nil {
+			event.Fee = fee
+		}
+		for i := range event.Legs {
+			if amount, err := domain.NormalizeAmount(event.Legs[i].Amount); err == nil {
+				event.Legs[i].Amount = amount
 			}
-
-			msg.Ack(false) // Acknowledge successful processing
 		}
-	}()
 
-	return nil
+		// A rejected transfer has been handled; retrying it could apply the transfer after its
+		// failure was reported
+		if err := handler(ctx, event); err != nil && !errors.Is(err, domain.ErrTransferFailed) {
+			return err
+		}
+		return nil
+	})
 }
 
-// Close closes the RabbitMQ connection
-func (b *RabbitMQBroker) Close() error {
-	if err := b.channel.Close(); err != nil {
-		return fmt.Errorf("failed to close channel: %w", err)
-	}
-	if err := b.conn.Close(); err != nil {
-		return fmt.Errorf("failed to close connection: %w", err)
+// SubscribeAll subscribes handler to the transaction events of every broker, e.g. a primary and a
+// secondary broker during a migration, so that events are handled whichever broker they arrive on
+func SubscribeAll(ctx context.Context, brokers []MessageBroker, handler func(ctx context.Context, event domain.TransactionEvent) error) error {
+	for _, broker := range brokers {
+		if err := broker.SubscribeToTransactionEvents(ctx, handler); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -0,0 +1,71 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"internal-transfers/account-service/internal/domain"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// fakeBroker delivers the events given to deliver to the handler subscribed to it
+type fakeBroker struct {
+	MessageBroker
+
+	handler      func(ctx context.Context, event domain.TransactionEvent) error
+	subscribeErr error
+}
+
+func (b *fakeBroker) SubscribeToTransactionEvents(_ context.Context, handler func(ctx context.Context, event domain.TransactionEvent) error) error {
+	if b.subscribeErr != nil {
+		return b.subscribeErr
+	}
+	b.handler = handler
+	return nil
+}
+
+func (b *fakeBroker) deliver(t *testing.T, event domain.TransactionEvent) {
+	t.Helper()
+	if b.handler == nil {
+		t.Fatalf("no handler subscribed to deliver event %d to", event.TransactionID)
+	}
+	if err := b.handler(context.Background(), event); err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+}
+
+func TestSubscribeAll(t *testing.T) {
+	primary, secondary := &fakeBroker{}, &fakeBroker{}
+	var (
+		mu      sync.Mutex
+		handled []domain.TransactionID
+	)
+	handler := func(_ context.Context, event domain.TransactionEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, event.TransactionID)
+		return nil
+	}
+
+	if err := SubscribeAll(context.Background(), []MessageBroker{primary, secondary}, handler); err != nil {
+		t.Fatalf("SubscribeAll() error = %v", err)
+	}
+	primary.deliver(t, domain.TransactionEvent{TransactionID: 1})
+	secondary.deliver(t, domain.TransactionEvent{TransactionID: 2})
+	primary.deliver(t, domain.TransactionEvent{TransactionID: 3})
+
+	if want := []domain.TransactionID{1, 2, 3}; !slices.Equal(handled, want) {
+		t.Errorf("handled transactions %v, want %v", handled, want)
+	}
+}
+
+func TestSubscribeAllFailure(t *testing.T) {
+	unreachable := errors.New("secondary broker unreachable")
+	brokers := []MessageBroker{&fakeBroker{}, &fakeBroker{subscribeErr: unreachable}}
+
+	err := SubscribeAll(context.Background(), brokers, func(context.Context, domain.TransactionEvent) error { return nil })
+	if !errors.Is(err, unreachable) {
+		t.Errorf("SubscribeAll() error = %v, want %v", err, unreachable)
+	}
+}
@@ -2,51 +2,185 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"internal-transfers/account-service/internal/domain"
+	"internal-transfers/pkg/database"
+	"slices"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type AccountRepository struct {
-	db *pgxpool.Pool
+	db *database.BoundedPool
+	database.QueryTimeout
 }
 
-func NewAccountRepository(db *pgxpool.Pool) domain.AccountRepository {
+func NewAccountRepository(db *pgxpool.Pool, opts ...database.Option) domain.AccountRepository {
+	o := database.NewOptions(opts)
 	return &AccountRepository{
-		db: db,
+		db:           database.NewBoundedPool(db, o.AcquireTimeout, domain.ErrOverloaded),
+		QueryTimeout: database.QueryTimeout{Timeout: o.QueryTimeout},
 	}
 }
 
 func (r *AccountRepository) Create(ctx context.Context, account *domain.Account) error {
+	return r.create(ctx, account, nil)
+}
+
+func (r *AccountRepository) CreateWithIdempotencyKey(ctx context.Context, account *domain.Account, creation domain.AccountCreation) error {
 	query := `
-		INSERT INTO accounts (id, balance)
-		VALUES ($1, $2)
+		INSERT INTO account_idempotency_keys (idempotency_key, account_id, initial_balance)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (idempotency_key) DO NOTHING
 	`
 
-	if _, err := r.db.Exec(ctx, query, account.ID, account.Balance); err != nil {
+	return r.create(ctx, account, func(ctx context.Context, tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, query, creation.IdempotencyKey, creation.AccountID, creation.InitialBalance)
+		if err != nil {
+			return fmt.Errorf("failed to record idempotency key: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return domain.ErrIdempotencyKeyExists
+		}
+		return nil
+	})
+}
+
+func (r *AccountRepository) NextAccountID(ctx context.Context, min domain.AccountID) (domain.AccountID, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT CASE WHEN id < $1 THEN setval('account_ids', $1) ELSE id END
+		FROM nextval('account_ids') AS id
+	`
+
+	var id domain.AccountID
+	if err := r.db.QueryRow(ctx, query, min).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to generate account ID: %w", err)
+	}
+
+	return id, nil
+}
+
+func (r *AccountRepository) GetAccountCreation(ctx context.Context, idempotencyKey string) (*domain.AccountCreation, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT account_id, initial_balance
+		FROM account_idempotency_keys
+		WHERE idempotency_key = $1
+	`
+
+	creation := domain.AccountCreation{IdempotencyKey: idempotencyKey}
+	err := r.db.QueryRow(ctx, query, idempotencyKey).Scan(&creation.AccountID, &creation.InitialBalance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account creation: %w", err)
+	}
+
+	return &creation, nil
+}
+
+// create inserts the account with its opening ledger entry. record, when set, writes to the same
+// database transaction after the account.
+func (r *AccountRepository) create(ctx context.Context, account *domain.Account, record func(ctx context.Context, tx pgx.Tx) error) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO accounts (id, balance, status)
+		VALUES ($1, $2, $3)
+	`
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, query, account.ID, account.Balance, account.Status); err != nil {
 		return fmt.Errorf("failed to create account: %w", err)
 	}
 
+	// Record the initial balance so the ledger always sums to the account balance
+	opening := domain.LedgerEntry{
+		AccountID:    account.ID,
+		Type:         domain.LedgerEntryOpening,
+		Amount:       account.Balance,
+		BalanceAfter: account.Balance,
+	}
+	if err := insertLedgerEntry(ctx, tx, opening); err != nil {
+		return err
+	}
+
+	if record != nil {
+		if err := record(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit account creation: %w", err)
+	}
+
 	return nil
 }
 
 func (r *AccountRepository) GetByID(ctx context.Context, id domain.AccountID) (*domain.Account, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT id, balance
+		SELECT id, balance, status
 		FROM accounts
 		WHERE id = $1
 	`
 
 	account := &domain.Account{}
-	if err := r.db.QueryRow(ctx, query, id).Scan(&account.ID, &account.Balance); err != nil {
+	if err := r.db.QueryRow(ctx, query, id).Scan(&account.ID, &account.Balance, &account.Status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
 		return nil, fmt.Errorf("failed to get account: %w", err)
 	}
 
 	return account, nil
 }
 
+func (r *AccountRepository) Exists(ctx context.Context, id domain.AccountID) (bool, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT 1
+		FROM accounts
+		WHERE id = $1
+	`
+
+	var one int
+	if err := r.db.QueryRow(ctx, query, id).Scan(&one); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check account existence: %w", err)
+	}
+
+	return true, nil
+}
+
 func (r *AccountRepository) Update(ctx context.Context, account *domain.Account) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE accounts
 		SET balance = $2
@@ -59,3 +193,486 @@ func (r *AccountRepository) Update(ctx context.Context, account *domain.Account)
 
 	return nil
 }
+
+func (r *AccountRepository) UpdateStatus(ctx context.Context, id domain.AccountID, status domain.AccountStatus) (bool, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE accounts
+		SET status = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+
+	tag, err := r.db.Exec(ctx, query, id, status)
+	if err != nil {
+		return false, fmt.Errorf("failed to update account status: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *AccountRepository) ApplyTransfer(ctx context.Context, accountIDs []domain.AccountID, fn domain.TransferFunc) error {
+	return r.runTransfer(ctx, accountIDs, fn, nil)
+}
+
+func (r *AccountRepository) HoldTransfer(ctx context.Context, transfer domain.TransactionEvent, accountIDs []domain.AccountID, fn domain.TransferFunc) error {
+	query := `
+		INSERT INTO transfer_holds (transaction_id, source_account_id, transfer, status)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (transaction_id) DO NOTHING
+	`
+
+	data, err := json.Marshal(transfer)
+	if err != nil {
+		return fmt.Errorf("failed to marshal held transfer: %w", err)
+	}
+
+	// A transfer that already has a hold, e.g. from a republished event, reserves nothing again
+	err = r.runTransfer(ctx, accountIDs, fn, func(ctx context.Context, tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, query, transfer.TransactionID, transfer.SourceAccountID, data, domain.HoldStatusHeld)
+		if err != nil {
+			return fmt.Errorf("failed to record hold: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return errAlreadyHeld
+		}
+		return nil
+	})
+	if errors.Is(err, errAlreadyHeld) {
+		return nil
+	}
+	return err
+}
+
+// errAlreadyHeld rolls back a hold of a transfer that is already held
+var errAlreadyHeld = errors.New("transfer already held")
+
+func (r *AccountRepository) GetHold(ctx context.Context, transactionID domain.TransactionID) (*domain.TransferHold, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT transfer, status, created_at, resolved_at
+		FROM transfer_holds
+		WHERE transaction_id = $1
+	`
+
+	var (
+		hold domain.TransferHold
+		data []byte
+	)
+	err := r.db.QueryRow(ctx, query, transactionID).Scan(&data, &hold.Status, &hold.CreatedAt, &hold.ResolvedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hold: %w", err)
+	}
+	if err := json.Unmarshal(data, &hold.Transfer); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal held transfer: %w", err)
+	}
+
+	return &hold, nil
+}
+
+func (r *AccountRepository) ResolveHold(ctx context.Context, transactionID domain.TransactionID, status domain.HoldStatus, accountIDs []domain.AccountID, fn domain.TransferFunc) error {
+	query := `
+		UPDATE transfer_holds
+		SET status = $2, resolved_at = CURRENT_TIMESTAMP
+		WHERE transaction_id = $1 AND status = $3
+	`
+
+	// The hold row stays locked until the transfer commits, so a concurrent review of the same
+	// transfer finds it resolved instead of finalizing it twice
+	return r.runTransfer(ctx, accountIDs, fn, func(ctx context.Context, tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, query, transactionID, status, domain.HoldStatusHeld)
+		if err != nil {
+			return fmt.Errorf("failed to resolve hold: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return domain.ErrHoldNotHeld
+		}
+		return nil
+	})
+}
+
+func (r *AccountRepository) HasTransferred(ctx context.Context, source, destination domain.AccountID) (bool, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM ledger_entries debit
+			JOIN ledger_entries credit ON credit.transaction_id = debit.transaction_id
+			WHERE debit.account_id = $1 AND debit.entry_type = 'debit'
+				AND credit.account_id = $2 AND credit.entry_type = 'credit'
+		)
+	`
+
+	var exists bool
+	if err := r.db.QueryRow(ctx, query, source, destination).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check transfer history: %w", err)
+	}
+
+	return exists, nil
+}
+
+// runTransfer applies a transfer, calling record first within the same database transaction
+// when it is set, e.g. to track the state of the transfer
+func (r *AccountRepository) runTransfer(ctx context.Context, accountIDs []domain.AccountID, fn domain.TransferFunc, record func(ctx context.Context, tx pgx.Tx) error) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	// Locks are taken in a fixed order, so deadlocks should not happen; retry anyway in case
+	// another writer locks the same rows in a different order
+	var err error
+	for attempt := 1; attempt <= maxTransferAttempts; attempt++ {
+		if err = r.applyTransfer(ctx, accountIDs, fn, record); !isDeadlock(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("transfer aborted after %d deadlocks: %w", maxTransferAttempts, err)
+}
+
+// maxTransferAttempts bounds how often a transfer is retried after a deadlock
+const maxTransferAttempts = 3
+
+// applyTransfer runs a single attempt of runTransfer in its own database transaction
+func (r *AccountRepository) applyTransfer(ctx context.Context, accountIDs []domain.AccountID, fn domain.TransferFunc, record func(ctx context.Context, tx pgx.Tx) error) error {
+	query := `
+		UPDATE accounts
+		SET balance = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// A redelivered message whose transfer was already committed is not applied again
+	first, err := database.RecordProcessed(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if !first {
+		return domain.ErrAlreadyProcessed
+	}
+
+	if record != nil {
+		if err := record(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	accounts, err := lockAccounts(ctx, tx, accountIDs)
+	if err != nil {
+		return err
+	}
+
+	updated, entries, err := fn(accounts)
+	if err != nil {
+		return err
+	}
+
+	for _, account := range updated {
+		if _, err := tx.Exec(ctx, query, account.ID, account.Balance); err != nil {
+			return fmt.Errorf("failed to update account %d: %w", account.ID, err)
+		}
+	}
+
+	for _, entry := range entries {
+		if err := insertLedgerEntry(ctx, tx, entry); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transfer: %w", err)
+	}
+
+	return nil
+}
+
+func (r *AccountRepository) GetLedgerEntriesByTransaction(ctx context.Context, transactionID domain.TransactionID) ([]domain.LedgerEntry, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, account_id, COALESCE(transaction_id, 0), entry_type, amount::text, balance_after, created_at
+		FROM ledger_entries
+		WHERE transaction_id = $1
+		ORDER BY id
+	`
+
+	rows, err := r.db.Query(ctx, query, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []domain.LedgerEntry{}
+	for rows.Next() {
+		var entry domain.LedgerEntry
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.AccountID,
+			&entry.TransactionID,
+			&entry.Type,
+			&entry.Amount,
+			&entry.BalanceAfter,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ledger entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (r *AccountRepository) GetBalanceAt(ctx context.Context, id domain.AccountID, at time.Time) (string, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	// Start from the latest snapshot at or before the time, if any, and add the entries after it
+	query := `
+		WITH snapshot AS (
+			SELECT as_of, balance
+			FROM balance_snapshots
+			WHERE account_id = $1 AND as_of <= $2
+			ORDER BY as_of DESC
+			LIMIT 1
+		)
+		SELECT (
+			COALESCE((SELECT balance FROM snapshot), 0) + COALESCE((
+				SELECT SUM(amount)
+				FROM ledger_entries
+				WHERE account_id = $1 AND created_at <= $2
+					AND created_at > COALESCE((SELECT as_of FROM snapshot), '-infinity')
+			), 0)
+		)::text
+	`
+
+	var balance string
+	if err := r.db.QueryRow(ctx, query, id, at).Scan(&balance); err != nil {
+		return "", fmt.Errorf("failed to get balance at %s: %w", at.Format(time.RFC3339), err)
+	}
+
+	return balance, nil
+}
+
+func (r *AccountRepository) SnapshotBalances(ctx context.Context, asOf time.Time) (int64, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	// Each new snapshot is the previous one plus the entries since, so only those entries are read
+	query := `
+		INSERT INTO balance_snapshots (account_id, as_of, balance)
+		SELECT a.id, $1::timestamptz, COALESCE(s.balance, 0) + changes.amount
+		FROM accounts a
+		LEFT JOIN LATERAL (
+			SELECT as_of, balance
+			FROM balance_snapshots
+			WHERE account_id = a.id AND as_of <= $1
+			ORDER BY as_of DESC
+			LIMIT 1
+		) s ON true
+		CROSS JOIN LATERAL (
+			SELECT SUM(amount) AS amount
+			FROM ledger_entries
+			WHERE account_id = a.id AND created_at <= $1
+				AND created_at > COALESCE(s.as_of, '-infinity')
+		) changes
+		WHERE changes.amount IS NOT NULL
+		ON CONFLICT (account_id, as_of) DO NOTHING
+	`
+
+	tag, err := r.db.Exec(ctx, query, asOf)
+	if err != nil {
+		return 0, fmt.Errorf("failed to snapshot balances as of %s: %w", asOf.Format(time.RFC3339), err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func (r *AccountRepository) GetRecentTransactions(ctx context.Context, id domain.AccountID, limit, offset int) ([]domain.AccountTransaction, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT transaction_id, SUM(amount)::text, (array_agg(balance_after ORDER BY id DESC))[1], MAX(created_at)
+		FROM ledger_entries
+		WHERE account_id = $1 AND transaction_id IS NOT NULL
+		GROUP BY transaction_id
+		ORDER BY MAX(id) DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.Query(ctx, query, id, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent transactions: %w", err)
+	}
+	defer rows.Close()
+
+	transactions := []domain.AccountTransaction{}
+	for rows.Next() {
+		var transaction domain.AccountTransaction
+		if err := rows.Scan(
+			&transaction.TransactionID,
+			&transaction.Amount,
+			&transaction.BalanceAfter,
+			&transaction.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan recent transaction: %w", err)
+		}
+		transactions = append(transactions, transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recent transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// GetReservedBalance adds up the hold and release entries of the account, which cancel out once a
+// held transfer is approved or rejected
+func (r *AccountRepository) GetReservedBalance(ctx context.Context, id domain.AccountID) (string, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT (-COALESCE(SUM(amount), 0))::text
+		FROM ledger_entries
+		WHERE account_id = $1 AND entry_type IN ('hold', 'release')
+	`
+
+	var reserved string
+	if err := r.db.QueryRow(ctx, query, id).Scan(&reserved); err != nil {
+		return "", fmt.Errorf("failed to get reserved balance: %w", err)
+	}
+
+	return reserved, nil
+}
+
+func (r *AccountRepository) GetBalances(ctx context.Context, ids []domain.AccountID) (map[domain.AccountID]string, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, balance
+		FROM accounts
+		WHERE id = ANY($1)
+	`
+
+	rows, err := r.db.Query(ctx, query, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balances: %w", err)
+	}
+	defer rows.Close()
+
+	balances := make(map[domain.AccountID]string, len(ids))
+	for rows.Next() {
+		var (
+			id      domain.AccountID
+			balance string
+		)
+		if err := rows.Scan(&id, &balance); err != nil {
+			return nil, fmt.Errorf("failed to scan balance: %w", err)
+		}
+		balances[id] = balance
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get balances: %w", err)
+	}
+
+	return balances, nil
+}
+
+func (r *AccountRepository) SumBalances(ctx context.Context, ids []domain.AccountID) (string, int, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT COALESCE(SUM(balance::numeric), 0)::text, COUNT(*)
+		FROM accounts
+		WHERE id = ANY($1)
+	`
+
+	var (
+		total string
+		found int
+	)
+	if err := r.db.QueryRow(ctx, query, ids).Scan(&total, &found); err != nil {
+		return "", 0, fmt.Errorf("failed to sum balances: %w", err)
+	}
+
+	return total, found, nil
+}
+
+// lockAccounts locks the rows of the given accounts for the rest of the transaction and returns
+// them keyed by id. Locks are acquired one by one from the lowest id to the highest, whatever the
+// role of the account in the transfer, so two transfers between the same accounts in opposite
+// directions wait for each other instead of deadlocking.
+func lockAccounts(ctx context.Context, tx pgx.Tx, accountIDs []domain.AccountID) (map[domain.AccountID]*domain.Account, error) {
+	query := `
+		SELECT id, balance, status
+		FROM accounts
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	ids := slices.Clone(accountIDs)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	accounts := make(map[domain.AccountID]*domain.Account, len(ids))
+	for _, id := range ids {
+		account := &domain.Account{}
+		err := tx.QueryRow(ctx, query, id).Scan(&account.ID, &account.Balance, &account.Status)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock account %d: %w", id, err)
+		}
+		accounts[id] = account
+	}
+
+	return accounts, nil
+}
+
+// deadlockDetected is the SQLSTATE Postgres reports when it aborts a transaction to break a deadlock
+const deadlockDetected = "40P01"
+
+// isDeadlock reports whether Postgres aborted the transaction to resolve a deadlock
+func isDeadlock(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == deadlockDetected
+}
+
+// insertLedgerEntry writes a ledger entry as part of an open database transaction
+func insertLedgerEntry(ctx context.Context, tx pgx.Tx, entry domain.LedgerEntry) error {
+	query := `
+		INSERT INTO ledger_entries (account_id, transaction_id, entry_type, amount, balance_after)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5)
+	`
+
+	if _, err := tx.Exec(ctx, query,
+		entry.AccountID,
+		entry.TransactionID,
+		entry.Type,
+		entry.Amount,
+		entry.BalanceAfter,
+	); err != nil {
+		return fmt.Errorf("failed to record ledger entry for account %d: %w", entry.AccountID, err)
+	}
+
+	return nil
+}
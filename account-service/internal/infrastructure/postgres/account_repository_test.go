@@ -0,0 +1,398 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"internal-transfers/account-service/internal/domain"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testPool connects to the database named by TEST_DATABASE_URL, which must have been set up by
+// init-db.sh, and skips the test when it is not set
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	if err := CheckSchema(ctx, pool); err != nil {
+		t.Fatalf("test database is not set up: %v", err)
+	}
+	return pool
+}
+
+// createAccounts creates an active account with each of the given balances under a fresh ID, so
+// that tests do not collide with accounts left in the database, and returns their IDs
+func createAccounts(t *testing.T, repo domain.AccountRepository, balances ...string) []domain.AccountID {
+	t.Helper()
+	ctx := context.Background()
+	ids := make([]domain.AccountID, 0, len(balances))
+	for _, balance := range balances {
+		id, err := repo.NextAccountID(ctx, 1)
+		if err != nil {
+			t.Fatalf("NextAccountID() error = %v", err)
+		}
+		if err := repo.Create(ctx, &domain.Account{ID: id, Balance: balance, Status: domain.AccountStatusActive}); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// moveFunds returns a transfer function moving amount from source to destination, recording a
+// debit and a credit like the account service does
+func moveFunds(source, destination domain.AccountID, amount string) domain.TransferFunc {
+	return func(accounts map[domain.AccountID]*domain.Account) ([]*domain.Account, []domain.LedgerEntry, error) {
+		moved, err := domain.ParseMoney(amount)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var entries []domain.LedgerEntry
+		for _, p := range []struct {
+			id        domain.AccountID
+			entryType domain.LedgerEntryType
+			amount    domain.Money
+		}{
+			{source, domain.LedgerEntryDebit, moved.Neg()},
+			{destination, domain.LedgerEntryCredit, moved},
+		} {
+			balance, err := domain.ParseMoney(accounts[p.id].Balance)
+			if err != nil {
+				return nil, nil, err
+			}
+			accounts[p.id].Balance = balance.Add(p.amount).String()
+			entries = append(entries, domain.LedgerEntry{
+				AccountID:    p.id,
+				Type:         p.entryType,
+				Amount:       p.amount.String(),
+				BalanceAfter: accounts[p.id].Balance,
+			})
+		}
+		return []*domain.Account{accounts[source], accounts[destination]}, entries, nil
+	}
+}
+
+// balance reads the stored balance of an account, normalized for comparison
+func balance(t *testing.T, repo domain.AccountRepository, id domain.AccountID) string {
+	t.Helper()
+	account, err := repo.GetByID(context.Background(), id)
+	if err != nil || account == nil {
+		t.Fatalf("GetByID(%d) = %v, %v", id, account, err)
+	}
+	return normalize(t, account.Balance)
+}
+
+func TestGetByIDMissingAccount(t *testing.T) {
+	repo := NewAccountRepository(testPool(t))
+	id, err := repo.NextAccountID(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("NextAccountID() error = %v", err)
+	}
+
+	// A missing account is not an error, so that the service can answer 404 rather than 500
+	account, err := repo.GetByID(context.Background(), id)
+	if err != nil || account != nil {
+		t.Errorf("GetByID(%d) = %v, %v, want nil, nil", id, account, err)
+	}
+}
+
+func TestApplyTransferOppositeDirections(t *testing.T) {
+	repo := NewAccountRepository(testPool(t))
+	ids := createAccounts(t, repo, "1000.00", "1000.00")
+	a, b := ids[0], ids[1]
+
+	// Transfers between the same two accounts in both directions at once, listing the accounts
+	// source first like the account service does
+	const transfers = 20
+	errs := make(chan error, 2*transfers)
+	var wg sync.WaitGroup
+	for range transfers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- repo.ApplyTransfer(context.Background(), []domain.AccountID{a, b}, moveFunds(a, b, "1.00"))
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- repo.ApplyTransfer(context.Background(), []domain.AccountID{b, a}, moveFunds(b, a, "3.00"))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("ApplyTransfer() error = %v", err)
+		}
+	}
+
+	// Every transfer is applied exactly once, and no money is created or lost
+	if got := balance(t, repo, a); got != "1040.00" {
+		t.Errorf("balance of A = %s, want 1040.00", got)
+	}
+	if got := balance(t, repo, b); got != "960.00" {
+		t.Errorf("balance of B = %s, want 960.00", got)
+	}
+}
+
+func TestLockAccountsOppositeOrders(t *testing.T) {
+	pool := testPool(t)
+	ids := createAccounts(t, NewAccountRepository(pool), "100.00", "100.00", "100.00")
+
+	// Transactions lock the same accounts listed in every order and hold the locks for a moment.
+	// Locking them as listed would deadlock; lockAccounts is called directly so that no retry
+	// can hide a deadlock.
+	orders := [][]domain.AccountID{
+		{ids[0], ids[1], ids[2]},
+		{ids[2], ids[1], ids[0]},
+		{ids[1], ids[0], ids[2]},
+		{ids[2], ids[0], ids[1]},
+	}
+	const rounds = 25
+	errs := make(chan error, rounds*len(orders))
+	var wg sync.WaitGroup
+	for range rounds {
+		for _, order := range orders {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- lockInTransaction(pool, order)
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if isDeadlock(err) {
+			t.Fatalf("locking accounts deadlocked: %v", err)
+		}
+		if err != nil {
+			t.Errorf("locking accounts failed: %v", err)
+		}
+	}
+}
+
+// lockInTransaction locks the accounts in a transaction of its own and holds the locks briefly,
+// giving transactions locking them in another order the chance to deadlock with it
+func lockInTransaction(pool *pgxpool.Pool, accountIDs []domain.AccountID) error {
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	accounts, err := lockAccounts(ctx, tx, accountIDs)
+	if err != nil {
+		return err
+	}
+	if len(accounts) != len(accountIDs) {
+		return fmt.Errorf("locked %d of %d accounts", len(accounts), len(accountIDs))
+	}
+	time.Sleep(time.Millisecond)
+	return tx.Commit(ctx)
+}
+
+// dbNow reads the clock of the database, which timestamps ledger entries
+func dbNow(t *testing.T, pool *pgxpool.Pool) time.Time {
+	t.Helper()
+	var now time.Time
+	if err := pool.QueryRow(context.Background(), "SELECT clock_timestamp()").Scan(&now); err != nil {
+		t.Fatalf("failed to read the database clock: %v", err)
+	}
+	return now
+}
+
+// ledgerBalanceAt sums every ledger entry of an account up to the given time, without snapshots
+func ledgerBalanceAt(t *testing.T, pool *pgxpool.Pool, id domain.AccountID, at time.Time) string {
+	t.Helper()
+	query := `
+		SELECT COALESCE(SUM(amount), 0)::text
+		FROM ledger_entries
+		WHERE account_id = $1 AND created_at <= $2
+	`
+	var sum string
+	if err := pool.QueryRow(context.Background(), query, id, at).Scan(&sum); err != nil {
+		t.Fatalf("failed to sum the ledger: %v", err)
+	}
+	return sum
+}
+
+func TestGetBalanceAtAfterTransfers(t *testing.T) {
+	pool := testPool(t)
+	repo := NewAccountRepository(pool)
+	ctx := context.Background()
+	beforeCreation := dbNow(t, pool)
+	ids := createAccounts(t, repo, "100.00", "0")
+	a, b := ids[0], ids[1]
+
+	// The balances of both accounts after the creation and after each transfer
+	points := []struct {
+		at   time.Time
+		a, b string
+	}{{dbNow(t, pool), "100.00", "0.00"}}
+	for _, transfer := range []struct {
+		source, destination domain.AccountID
+		amount              string
+		a, b                string
+	}{
+		{a, b, "30.00", "70.00", "30.00"},
+		{b, a, "5.50", "75.50", "24.50"},
+		{a, b, "75.50", "0.00", "100.00"},
+	} {
+		if err := repo.ApplyTransfer(ctx, []domain.AccountID{a, b}, moveFunds(transfer.source, transfer.destination, transfer.amount)); err != nil {
+			t.Fatalf("ApplyTransfer() error = %v", err)
+		}
+		points = append(points, struct {
+			at   time.Time
+			a, b string
+		}{dbNow(t, pool), transfer.a, transfer.b})
+	}
+
+	for _, p := range points {
+		for id, want := range map[domain.AccountID]string{a: p.a, b: p.b} {
+			got, err := repo.GetBalanceAt(ctx, id, p.at)
+			if err != nil {
+				t.Fatalf("GetBalanceAt() error = %v", err)
+			}
+			if normalize(t, got) != want {
+				t.Errorf("balance of account %d at %s = %s, want %s", id, p.at, got, want)
+			}
+		}
+	}
+
+	// Before its creation an account had no balance
+	got, err := repo.GetBalanceAt(ctx, a, beforeCreation)
+	if err != nil {
+		t.Fatalf("GetBalanceAt() error = %v", err)
+	}
+	if normalize(t, got) != "0.00" {
+		t.Errorf("balance before the creation = %s, want 0.00", got)
+	}
+}
+
+func TestGetBalanceAtMatchesLedger(t *testing.T) {
+	pool := testPool(t)
+	repo := NewAccountRepository(pool)
+	ctx := context.Background()
+	ids := createAccounts(t, repo, "500.00", "0")
+	a, b := ids[0], ids[1]
+
+	// Transfers interleaved with snapshots, remembering points in time before, between and after them
+	checkpoints := []time.Time{dbNow(t, pool)}
+	for i, amount := range []string{"10.25", "0.75", "100.00", "3.33", "42.00", "0.01"} {
+		if err := repo.ApplyTransfer(ctx, []domain.AccountID{a, b}, moveFunds(a, b, amount)); err != nil {
+			t.Fatalf("ApplyTransfer() error = %v", err)
+		}
+		checkpoints = append(checkpoints, dbNow(t, pool))
+		if i%2 == 1 {
+			if _, err := repo.SnapshotBalances(ctx, dbNow(t, pool)); err != nil {
+				t.Fatalf("SnapshotBalances() error = %v", err)
+			}
+		}
+	}
+
+	for _, id := range ids {
+		for _, at := range checkpoints {
+			got, err := repo.GetBalanceAt(ctx, id, at)
+			if err != nil {
+				t.Fatalf("GetBalanceAt() error = %v", err)
+			}
+			want := ledgerBalanceAt(t, pool, id, at)
+			if normalize(t, got) != normalize(t, want) {
+				t.Errorf("balance of account %d at %s = %s from snapshots, want %s from the full ledger", id, at, got, want)
+			}
+		}
+	}
+}
+
+// normalize writes an amount in its canonical form, for comparison
+func normalize(t *testing.T, amount string) string {
+	t.Helper()
+	normalized, err := domain.NormalizeAmount(amount)
+	if err != nil {
+		t.Fatalf("invalid amount %q: %v", amount, err)
+	}
+	return normalized
+}
+
+func TestSumBalances(t *testing.T) {
+	repo := NewAccountRepository(testPool(t))
+	ids := createAccounts(t, repo, "100.25", "0.75", "1000")
+
+	total, found, err := repo.SumBalances(context.Background(), append(ids, ids[2]+1000000))
+	if err != nil {
+		t.Fatalf("SumBalances() error = %v", err)
+	}
+	if normalize(t, total) != "1101.00" || found != 3 {
+		t.Errorf("SumBalances() = %s over %d accounts, want 1101.00 over 3", total, found)
+	}
+}
+
+func TestGetBalances(t *testing.T) {
+	repo := NewAccountRepository(testPool(t))
+	ids := createAccounts(t, repo, "100.25", "0.75")
+	missing := ids[1] + 1000000
+
+	balances, err := repo.GetBalances(context.Background(), []domain.AccountID{ids[0], missing, ids[1]})
+	if err != nil {
+		t.Fatalf("GetBalances() error = %v", err)
+	}
+	if len(balances) != 2 {
+		t.Fatalf("GetBalances() = %v, want the balances of accounts %d and %d", balances, ids[0], ids[1])
+	}
+	for id, want := range map[domain.AccountID]string{ids[0]: "100.25", ids[1]: "0.75"} {
+		if got, ok := balances[id]; !ok || normalize(t, got) != want {
+			t.Errorf("balance of account %d = %q, want %s", id, got, want)
+		}
+	}
+	if balance, ok := balances[missing]; ok {
+		t.Errorf("GetBalances() returned %s for missing account %d", balance, missing)
+	}
+}
+
+func TestIdempotencyKeyPrunerKeepsRecentKeys(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	ids := createAccounts(t, NewAccountRepository(pool), "1.00", "2.00")
+	now := dbNow(t, pool)
+
+	old, recent := fmt.Sprintf("prune-old-%d", ids[0]), fmt.Sprintf("prune-recent-%d", ids[1])
+	insert := `INSERT INTO account_idempotency_keys (idempotency_key, account_id, initial_balance, created_at) VALUES ($1, $2, $3, $4)`
+	if _, err := pool.Exec(ctx, insert, old, ids[0], "1.00", now.Add(-2*time.Hour)); err != nil {
+		t.Fatalf("failed to insert the old key: %v", err)
+	}
+	if _, err := pool.Exec(ctx, insert, recent, ids[1], "2.00", now.Add(-time.Minute)); err != nil {
+		t.Fatalf("failed to insert the recent key: %v", err)
+	}
+
+	deleted, err := NewIdempotencyKeyPruner(pool).Prune(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if deleted < 1 {
+		t.Errorf("Prune() deleted %d keys, want at least the old one", deleted)
+	}
+	for key, want := range map[string]bool{old: false, recent: true} {
+		var exists bool
+		if err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM account_idempotency_keys WHERE idempotency_key = $1)`, key).Scan(&exists); err != nil {
+			t.Fatalf("failed to look up %s: %v", key, err)
+		}
+		if exists != want {
+			t.Errorf("key %s exists = %t, want %t", key, exists, want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"internal-transfers/account-service/internal/domain"
+	"internal-transfers/pkg/database"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// IdempotencyKeyPruner deletes old entries from the account_idempotency_keys table
+type IdempotencyKeyPruner struct {
+	pool *database.BoundedPool
+	database.QueryTimeout
+}
+
+// NewIdempotencyKeyPruner creates a new instance of IdempotencyKeyPruner
+func NewIdempotencyKeyPruner(pool *pgxpool.Pool, opts ...database.Option) *IdempotencyKeyPruner {
+	o := database.NewOptions(opts)
+	return &IdempotencyKeyPruner{
+		pool:         database.NewBoundedPool(pool, o.AcquireTimeout, domain.ErrOverloaded),
+		QueryTimeout: database.QueryTimeout{Timeout: o.QueryTimeout},
+	}
+}
+
+// Prune deletes up to a batch of the idempotency keys recorded before the cutoff and returns how
+// many were deleted. Retries using those keys then create a new account.
+func (p *IdempotencyKeyPruner) Prune(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := p.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		DELETE FROM account_idempotency_keys
+		WHERE idempotency_key IN (
+			SELECT idempotency_key
+			FROM account_idempotency_keys
+			WHERE created_at < $1
+			LIMIT $2
+		)
+	`
+
+	tag, err := p.pool.Exec(ctx, query, before, database.PruneBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete idempotency keys: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// requiredSchema lists the tables and columns the repositories rely on
+var requiredSchema = []struct {
+	table   string
+	columns []string
+}{
+	{"accounts", []string{"id", "balance", "status", "updated_at"}},
+	{"ledger_entries", []string{"id", "account_id", "transaction_id", "entry_type", "amount", "balance_after", "created_at"}},
+	{"balance_snapshots", []string{"account_id", "as_of", "balance"}},
+	{"processed_messages", []string{"message_id", "processed_at"}},
+	{"transfer_holds", []string{"transaction_id", "source_account_id", "transfer", "status", "created_at", "resolved_at"}},
+	{"account_idempotency_keys", []string{"idempotency_key", "account_id", "initial_balance", "created_at"}},
+}
+
+// CheckSchema verifies that every table and column used by the repositories exists, so a missing
+// or outdated schema is reported once at startup instead of by the first query that touches it
+func CheckSchema(ctx context.Context, pool *pgxpool.Pool) error {
+	query := `
+		SELECT table_name, column_name
+		FROM information_schema.columns
+		WHERE table_schema = current_schema()
+	`
+
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to read database schema: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]map[string]bool)
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return fmt.Errorf("failed to scan database schema: %w", err)
+		}
+		if existing[table] == nil {
+			existing[table] = make(map[string]bool)
+		}
+		existing[table][column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read database schema: %w", err)
+	}
+
+	var missing []string
+	for _, required := range requiredSchema {
+		columns, ok := existing[required.table]
+		if !ok {
+			missing = append(missing, "table "+required.table)
+			continue
+		}
+		for _, column := range required.columns {
+			if !columns[column] {
+				missing = append(missing, "column "+required.table+"."+column)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("database schema is missing or out of date, apply init-db.sh: missing %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"internal-transfers/account-service/internal/application"
+	"internal-transfers/account-service/internal/domain"
+	accountv1 "internal-transfers/pkg/api/account/v1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AccountServer implements the gRPC AccountService on top of the application service
+type AccountServer struct {
+	accountv1.UnimplementedAccountServiceServer
+	accountService application.AccountService
+}
+
+// NewAccountServer creates a new instance of AccountServer
+func NewAccountServer(accountService application.AccountService) *AccountServer {
+	return &AccountServer{accountService: accountService}
+}
+
+// NewServer creates a gRPC server with the account service registered
+func NewServer(accountService application.AccountService) *grpc.Server {
+	server := grpc.NewServer()
+	accountv1.RegisterAccountServiceServer(server, NewAccountServer(accountService))
+	return server
+}
+
+// CreateAccount creates an account and returns it
+func (s *AccountServer) CreateAccount(ctx context.Context, req *accountv1.CreateAccountRequest) (*accountv1.Account, error) {
+	// Normalize the balance once at the boundary so the service only sees canonical amounts
+	initialBalance, err := domain.NormalizeAmount(req.GetInitialBalance())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, application.ErrInvalidAmount.Error())
+	}
+
+	dto := application.CreateAccountDTO{
+		AccountID:      domain.AccountID(req.GetAccountId()),
+		InitialBalance: initialBalance,
+	}
+	id, err := s.accountService.CreateAccount(ctx, dto)
+	if err != nil {
+		return nil, toStatus(err, "failed to create account")
+	}
+
+	account, err := s.accountService.GetAccount(ctx, id)
+	if err != nil {
+		return nil, toStatus(err, "failed to get account")
+	}
+	return newAccount(account), nil
+}
+
+// GetAccount retrieves an account by its ID
+func (s *AccountServer) GetAccount(ctx context.Context, req *accountv1.GetAccountRequest) (*accountv1.Account, error) {
+	account, err := s.accountService.GetAccount(ctx, domain.AccountID(req.GetAccountId()))
+	if err != nil {
+		return nil, toStatus(err, "failed to get account")
+	}
+	return newAccount(account), nil
+}
+
+// newAccount maps a domain account to its gRPC representation
+func newAccount(account *domain.Account) *accountv1.Account {
+	balance := account.Balance
+	if value, err := domain.ParseMoney(balance); err == nil {
+		balance = value.Display()
+	}
+	return &accountv1.Account{
+		AccountId: int64(account.ID),
+		Balance:   balance,
+		Status:    string(account.Status),
+	}
+}
+
+// toStatus maps application errors to gRPC status codes the same way the HTTP API maps them
+// to status codes; unexpected errors are reported as message without their details
+func toStatus(err error, message string) error {
+	switch {
+	case errors.Is(err, application.ErrAccountNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, application.ErrAccountExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, application.ErrInvalidAmount),
+		errors.Is(err, application.ErrNegativeAmount),
+		errors.Is(err, application.ErrInvalidAccountID):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, domain.ErrOverloaded):
+		return status.Error(codes.Unavailable, domain.ErrOverloaded.Error())
+	default:
+		return status.Error(codes.Internal, message)
+	}
+}
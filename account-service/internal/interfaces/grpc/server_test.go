@@ -0,0 +1,135 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"internal-transfers/account-service/internal/application"
+	"internal-transfers/account-service/internal/domain"
+	accountv1 "internal-transfers/pkg/api/account/v1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// memoryAccountService keeps accounts in memory; methods the tests do not use panic through the
+// embedded nil interface
+type memoryAccountService struct {
+	application.AccountService
+
+	mu       sync.Mutex
+	accounts map[domain.AccountID]domain.Account
+	nextID   domain.AccountID
+}
+
+func (s *memoryAccountService) CreateAccount(_ context.Context, dto application.CreateAccountDTO) (domain.AccountID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := dto.AccountID
+	if id == 0 {
+		s.nextID++
+		id = s.nextID
+	}
+	if _, ok := s.accounts[id]; ok {
+		return 0, application.ErrAccountExists
+	}
+	s.accounts[id] = domain.Account{ID: id, Balance: dto.InitialBalance, Status: domain.AccountStatusActive}
+	return id, nil
+}
+
+func (s *memoryAccountService) GetAccount(_ context.Context, id domain.AccountID) (*domain.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, ok := s.accounts[id]
+	if !ok {
+		return nil, application.ErrAccountNotFound
+	}
+	return &account, nil
+}
+
+// dial serves server in process and returns a client connected to it
+func dial(t *testing.T, server *grpc.Server) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to connect to the in-process server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestAccountServer(t *testing.T) {
+	service := &memoryAccountService{accounts: map[domain.AccountID]domain.Account{
+		1: {ID: 1, Balance: "100.0000", Status: domain.AccountStatusActive},
+	}, nextID: 1}
+	client := accountv1.NewAccountServiceClient(dial(t, NewServer(service)))
+	ctx := context.Background()
+
+	account, err := client.GetAccount(ctx, &accountv1.GetAccountRequest{AccountId: 1})
+	if err != nil {
+		t.Fatalf("GetAccount() error = %v", err)
+	}
+	if account.GetAccountId() != 1 || account.GetBalance() != "100.00" || account.GetStatus() != string(domain.AccountStatusActive) {
+		t.Errorf("GetAccount() = %v, want active account 1 with 100.00", account)
+	}
+
+	created, err := client.CreateAccount(ctx, &accountv1.CreateAccountRequest{AccountId: 5, InitialBalance: "12.5"})
+	if err != nil {
+		t.Fatalf("CreateAccount() error = %v", err)
+	}
+	if created.GetAccountId() != 5 || created.GetBalance() != "12.50" {
+		t.Errorf("CreateAccount() = %v, want account 5 with 12.50", created)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{
+			name: "unknown account",
+			call: func() error {
+				_, err := client.GetAccount(ctx, &accountv1.GetAccountRequest{AccountId: 9})
+				return err
+			},
+			want: codes.NotFound,
+		},
+		{
+			name: "existing account",
+			call: func() error {
+				_, err := client.CreateAccount(ctx, &accountv1.CreateAccountRequest{AccountId: 1, InitialBalance: "10"})
+				return err
+			},
+			want: codes.AlreadyExists,
+		},
+		{
+			name: "invalid balance",
+			call: func() error {
+				_, err := client.CreateAccount(ctx, &accountv1.CreateAccountRequest{AccountId: 6, InitialBalance: "ten"})
+				return err
+			},
+			want: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(tt.call()); got != tt.want {
+				t.Errorf("status code = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
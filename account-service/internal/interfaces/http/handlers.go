@@ -1,13 +1,22 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"internal-transfers/account-service/internal/application"
 	"internal-transfers/account-service/internal/domain"
+	"internal-transfers/pkg/admin"
+	"internal-transfers/pkg/config"
+	"internal-transfers/pkg/features"
+	"internal-transfers/pkg/pagination"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
@@ -17,103 +26,601 @@ import (
 type AccountHandler struct {
 	accountService application.AccountService
 	validator      *validator.Validate
+	currency       string
+	amountFormat   domain.AmountFormat
+	basePath       string
+	// maxAmountScale caps the decimal places of the amounts clients send; see WithMaxAmountScale
+	maxAmountScale int32
+	features       features.Flags
 }
 
-// CreateAccountRequest represents the request body for creating an account
+// DefaultCurrency is the ISO 4217 code reported for balances unless WithCurrency is used
+const DefaultCurrency = "USD"
+
+// HandlerOption configures optional behavior of the account handler
+type HandlerOption func(*AccountHandler)
+
+// WithCurrency sets the ISO 4217 code of the currency balances are held in
+func WithCurrency(code string) HandlerOption {
+	return func(h *AccountHandler) {
+		h.currency = code
+	}
+}
+
+// MaxIdempotencyKeyLength is the longest Idempotency-Key header accepted when creating an account
+const MaxIdempotencyKeyLength = 255
+
+// WithAmountFormat sets how clients write the decimal separator of the amounts they send
+func WithAmountFormat(format domain.AmountFormat) HandlerOption {
+	return func(h *AccountHandler) {
+		h.amountFormat = format
+	}
+}
+
+// WithMaxAmountScale rejects the amounts clients send with more than scale significant decimal
+// places, whatever their currency. Amounts may have up to domain.MaxScale by default.
+func WithMaxAmountScale(scale int32) HandlerOption {
+	return func(h *AccountHandler) {
+		if scale >= 0 && scale <= domain.MaxScale {
+			h.maxAmountScale = scale
+		}
+	}
+}
+
+// WithBasePath sets the path the routes are mounted under, used in the URLs of created accounts
+func WithBasePath(path string) HandlerOption {
+	return func(h *AccountHandler) {
+		h.basePath = path
+	}
+}
+
+// WithFeatures sets the feature flags gating behaviors of the handler; all are at their default otherwise
+func WithFeatures(flags features.Flags) HandlerOption {
+	return func(h *AccountHandler) {
+		h.features = flags
+	}
+}
+
+// CreateAccountRequest represents the request body for creating an account. The account ID may be
+// left out when the service generates IDs.
 type CreateAccountRequest struct {
-	AccountID      int64  `json:"account_id" validate:"required,gt=0"`
+	AccountID      int64  `json:"account_id,omitempty" validate:"omitempty,gt=0"`
 	InitialBalance string `json:"initial_balance" validate:"required"`
 }
 
-// AccountResponse represents the response for account queries
+// CreateAccountResponse holds the ID of the created account, which may have been generated
+type CreateAccountResponse struct {
+	AccountID int64 `json:"account_id"`
+}
+
+// ValidateAccountResponse reports that an account creation would succeed
+type ValidateAccountResponse struct {
+	Valid bool `json:"valid"`
+}
+
+// AccountResponse represents the response for account queries. With verbose=true the balance is
+// also given in minor units (e.g. cents) and as a decimal string, together with its currency.
 type AccountResponse struct {
+	AccountID      int64  `json:"account_id"`
+	Balance        string `json:"balance"`
+	Status         string `json:"status" enums:"active,frozen,closed"`
+	BalanceMinor   *int64 `json:"balance_minor,omitempty" example:"4000"`
+	BalanceDecimal string `json:"balance_decimal,omitempty" example:"40.00"`
+	Currency       string `json:"currency,omitempty" example:"USD"`
+}
+
+// UpdateAccountStatusRequest represents the request body for changing the status of an account
+type UpdateAccountStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=active frozen closed" enums:"active,frozen,closed"`
+}
+
+// AccountWithTransactionsResponse represents an account together with its recent transactions,
+// returned by GET /accounts/{account_id}?include=transactions
+type AccountWithTransactionsResponse struct {
+	AccountResponse
+	Transactions []AccountTransactionResponse `json:"transactions"`
+}
+
+// AccountTransactionResponse represents the net effect of a transaction on an account
+type AccountTransactionResponse struct {
+	TransactionID int64  `json:"transaction_id"`
+	Amount        string `json:"amount"`
+	BalanceAfter  string `json:"balance_after"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// recentTransactionsPage is the pagination of the transactions embedded in an account response
+var recentTransactionsPage = pagination.Params{DefaultLimit: 10, MaxLimit: pagination.MaxLimit}
+
+// BalanceResponse represents the balance of an account, optionally at a point in time
+type BalanceResponse struct {
 	AccountID int64  `json:"account_id"`
 	Balance   string `json:"balance"`
+	At        string `json:"at,omitempty"`
+}
+
+// AvailableBalanceResponse represents the balance of an account split into the funds reserved by
+// transfers held for review and the funds that can still be spent
+type AvailableBalanceResponse struct {
+	AccountID int64  `json:"account_id"`
+	Balance   string `json:"balance"`
+	Reserved  string `json:"reserved"`
+	Available string `json:"available"`
+}
+
+// AggregateBalanceRequest represents the request body for adding up the balances of several accounts
+type AggregateBalanceRequest struct {
+	AccountIDs []int64 `json:"account_ids" validate:"required,min=1,max=1000,dive,gt=0"`
+}
+
+// AggregateBalanceResponse represents the combined balance of several accounts. All accounts are
+// held in the service's currency, so their balances can always be added up.
+type AggregateBalanceResponse struct {
+	AccountCount int    `json:"account_count" example:"3"`
+	Balance      string `json:"balance" example:"1250.00"`
+	Currency     string `json:"currency" example:"USD"`
+}
+
+// BalancesRequest represents the request body for looking up the balances of several accounts
+type BalancesRequest struct {
+	AccountIDs []int64 `json:"account_ids" validate:"required,min=1,max=1000,dive,gt=0"`
+}
+
+// BalancesResponse maps the IDs of the requested accounts that exist to their balances. JSON
+// objects are unordered, so the requested accounts that do not exist are listed separately, in
+// the order they were requested.
+type BalancesResponse struct {
+	Balances map[int64]string `json:"balances"`
+	Missing  []int64          `json:"missing"`
+	Currency string           `json:"currency" example:"USD"`
+}
+
+// LedgerEntryResponse represents a single ledger entry
+type LedgerEntryResponse struct {
+	ID            int64  `json:"id"`
+	AccountID     int64  `json:"account_id"`
+	TransactionID int64  `json:"transaction_id,omitempty"`
+	Type          string `json:"type" enums:"opening,debit,credit,fee,hold,release"`
+	Amount        string `json:"amount"`
+	BalanceAfter  string `json:"balance_after"`
+	CreatedAt     string `json:"created_at"`
 }
 
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error string `json:"error"`
+// HoldResponse represents a transfer held for fraud review and the outcome of its review
+type HoldResponse struct {
+	TransactionID        int64  `json:"transaction_id"`
+	SourceAccountID      int64  `json:"source_account_id"`
+	DestinationAccountID int64  `json:"destination_account_id"`
+	Amount               string `json:"amount"`
+	Fee                  string `json:"fee,omitempty"`
+	Status               string `json:"status" enums:"held,approved,rejected"`
+	CreatedAt            string `json:"created_at"`
+	ResolvedAt           string `json:"resolved_at,omitempty"`
 }
 
 // NewAccountHandler creates a new instance of AccountHandler
-func NewAccountHandler(accountService application.AccountService) *AccountHandler {
-	return &AccountHandler{
+func NewAccountHandler(accountService application.AccountService, opts ...HandlerOption) *AccountHandler {
+	h := &AccountHandler{
 		accountService: accountService,
-		validator:      validator.New(),
+		validator:      newValidator(),
+		currency:       DefaultCurrency,
+		amountFormat:   domain.AmountFormatPoint,
+		maxAmountScale: domain.MaxScale,
+		basePath:       config.DefaultBasePath,
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// normalizeAmount converts an amount sent by a client into its canonical form, first stripping its
+// currency if the lenient_amounts feature is on, and rejects it if it has more decimal places than allowed
+func (h *AccountHandler) normalizeAmount(s string) (string, error) {
+	if h.features.Enabled(features.LenientAmounts) {
+		var err error
+		if s, err = domain.StripCurrency(s, h.currency); err != nil {
+			return "", err
+		}
+	}
+	normalized, err := domain.NormalizeLocalizedAmount(s, h.amountFormat)
+	if err != nil {
+		return "", err
+	}
+	if amount, err := domain.ParseMoney(normalized); err != nil || amount.RoundsAt(h.maxAmountScale) {
+		return "", fmt.Errorf("%w: at most %d are allowed", domain.ErrAmountScale, h.maxAmountScale)
+	}
+	return normalized, nil
+}
+
+// amountErrorMessage returns the message reported for an amount normalizeAmount refused: why the
+// currency does not match or the amount is too precise, or message for any other problem
+func amountErrorMessage(err error, message string) string {
+	if errors.Is(err, domain.ErrCurrencyMismatch) || errors.Is(err, domain.ErrAmountScale) {
+		return err.Error()
+	}
+	return message
 }
 
 // RegisterHandlers registers all account-related routes
 func RegisterHandlers(r chi.Router, h *AccountHandler) {
 	r.Post("/accounts", h.CreateAccount)
+	r.Post("/accounts/validate", h.ValidateAccount)
 	r.Get("/accounts/{account_id}", h.GetAccount)
+	r.Head("/accounts/{account_id}", h.HeadAccount)
+	r.Put("/accounts/{account_id}/status", h.UpdateAccountStatus)
+	r.Get("/accounts/{account_id}/balance", h.GetBalance)
+	r.Get("/accounts/{account_id}/available", h.GetAvailableBalance)
+	r.Post("/accounts/balance/aggregate", h.GetAggregateBalance)
+	r.Post("/accounts/balances", h.GetBalances)
+	r.Post("/holds/{transaction_id}/approve", h.ApproveHeldTransfer)
+	r.Post("/holds/{transaction_id}/reject", h.RejectHeldTransfer)
+}
+
+// AdminRoutes returns the internal routes served on the admin listener only, out of reach of API
+// clients: the raw ledger entries of a transaction, which the transaction service reads
+func AdminRoutes(h *AccountHandler) []admin.Option {
+	return []admin.Option{
+		admin.WithRoute("GET /ledger", http.HandlerFunc(h.GetLedgerEntries)),
+	}
 }
 
 // @Summary Create a new account
-// @Description Create a new account with initial balance
+// @Description Create a new account with initial balance. A creation retried with the same Idempotency-Key
+// @Description and body is answered with 201 again; the key cannot be reused for a different account or balance.
+// @Description When the service generates account IDs, account_id may be left out and the generated ID is returned.
 // @Tags accounts
 // @Accept json
 // @Produce json
 // @Param account body CreateAccountRequest true "Account creation request"
-// @Success 201 "Created"
+// @Param Idempotency-Key header string false "Client-chosen key identifying the creation, at most 255 characters"
+// @Success 201 {object} CreateAccountResponse
+// @Header 201 {string} Location "URL of the created account"
 // @Failure 400 {object} ErrorResponse
-// @Failure 409 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "Account exists, or the idempotency key was used for a different creation"
 // @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Router /accounts [post]
 func (h *AccountHandler) CreateAccount(w http.ResponseWriter, r *http.Request) {
+	dto, ok := h.decodeCreateAccount(w, r)
+	if !ok {
+		return
+	}
+
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if len(idempotencyKey) > MaxIdempotencyKeyLength {
+		respondWithError(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+		return
+	}
+	if h.features.Enabled(features.IdempotencyKeys) {
+		dto.IdempotencyKey = idempotencyKey
+	}
+
+	id, err := h.accountService.CreateAccount(r.Context(), dto)
+	if err != nil {
+		respondWithCreateAccountError(w, err, "Failed to create account")
+		return
+	}
+
+	w.Header().Set("Location", h.basePath+"/accounts/"+strconv.FormatInt(int64(id), 10))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateAccountResponse{AccountID: int64(id)})
+}
+
+// @Summary Validate an account creation
+// @Description Run the checks of account creation without creating the account, e.g. to validate an onboarding
+// @Description form. Answers 200 if the creation would succeed, and otherwise the error the creation would fail with,
+// @Description 409 if the account already exists.
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param account body CreateAccountRequest true "Account creation request"
+// @Success 200 {object} ValidateAccountResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse "Validation is turned off"
+// @Failure 409 {object} ErrorResponse "Account exists"
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /accounts/validate [post]
+func (h *AccountHandler) ValidateAccount(w http.ResponseWriter, r *http.Request) {
+	if !h.features.Enabled(features.AccountValidation) {
+		respondWithError(w, http.StatusNotFound, "Account validation is not enabled")
+		return
+	}
+
+	dto, ok := h.decodeCreateAccount(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.accountService.ValidateAccountCreation(r.Context(), dto); err != nil {
+		respondWithCreateAccountError(w, err, "Failed to validate account")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ValidateAccountResponse{Valid: true})
+}
+
+// decodeCreateAccount decodes and validates an account creation request, responding with 400 and
+// returning false if it is invalid
+func (h *AccountHandler) decodeCreateAccount(w http.ResponseWriter, r *http.Request) (application.CreateAccountDTO, bool) {
 	var req CreateAccountRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
-		return
+		return application.CreateAccountDTO{}, false
 	}
 
 	if err := h.validator.Struct(req); err != nil {
+		respondWithValidationError(w, err)
+		return application.CreateAccountDTO{}, false
+	}
+
+	// Normalize the balance once at the boundary so the service only sees canonical amounts
+	initialBalance, err := h.normalizeAmount(req.InitialBalance)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, amountErrorMessage(err, application.ErrInvalidAmount.Error()))
+		return application.CreateAccountDTO{}, false
+	}
+
+	return application.CreateAccountDTO{
+		AccountID:      domain.AccountID(req.AccountID),
+		InitialBalance: initialBalance,
+	}, true
+}
+
+// respondWithCreateAccountError responds with the status of an error returned by account creation,
+// or with message as a server error
+func respondWithCreateAccountError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, application.ErrAccountExists),
+		errors.Is(err, application.ErrIdempotencyKeyReused):
+		respondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, application.ErrInvalidAmount),
+		errors.Is(err, application.ErrNegativeAmount),
+		errors.Is(err, application.ErrInvalidAccountID):
 		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondWithServerError(w, err, message)
+	}
+}
+
+// @Summary Get account details
+// @Description Get account details by ID. With include=transactions the response also embeds the
+// @Description account's most recent transactions (newest first, 10 unless limit is given) as AccountWithTransactionsResponse.
+// @Description With verbose=true the balance is also returned in minor units and as a decimal, with its currency.
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param account_id path int true "Account ID"
+// @Param include query string false "Related data to embed" Enums(transactions)
+// @Param verbose query bool false "Include balance_minor, balance_decimal and currency"
+// @Param limit query int false "Number of embedded transactions (default 10, at most 100)"
+// @Param offset query int false "Number of newest transactions to skip"
+// @Success 200 {object} AccountWithTransactionsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /accounts/{account_id} [get]
+func (h *AccountHandler) GetAccount(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.ParseInt(chi.URLParam(r, "account_id"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid account ID")
 		return
 	}
 
-	dto := application.CreateAccountDTO{
-		AccountID:      domain.AccountID(req.AccountID),
-		InitialBalance: req.InitialBalance,
+	includeTransactions := false
+	for _, include := range strings.Split(r.URL.Query().Get("include"), ",") {
+		switch strings.TrimSpace(include) {
+		case "":
+		case "transactions":
+			includeTransactions = true
+		default:
+			respondWithError(w, http.StatusBadRequest, "Unsupported include, expected transactions")
+			return
+		}
+	}
+
+	limit, offset, err := recentTransactionsPage.Parse(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	verbose := false
+	if value := r.URL.Query().Get("verbose"); value != "" {
+		if verbose, err = strconv.ParseBool(value); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid verbose flag, expected true or false")
+			return
+		}
 	}
 
-	if err := h.accountService.CreateAccount(r.Context(), dto); err != nil {
+	account, err := h.accountService.GetAccount(r.Context(), domain.AccountID(accountID))
+	if err != nil {
 		switch {
-		case errors.Is(err, application.ErrAccountExists):
-			respondWithError(w, http.StatusConflict, err.Error())
-		case errors.Is(err, application.ErrInvalidAmount),
-			errors.Is(err, application.ErrNegativeAmount),
-			errors.Is(err, application.ErrInvalidAccountID):
+		case errors.Is(err, application.ErrAccountNotFound):
+			respondWithError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, application.ErrInvalidAccountID):
 			respondWithError(w, http.StatusBadRequest, err.Error())
 		default:
-			respondWithError(w, http.StatusInternalServerError, "Failed to create account")
+			respondWithServerError(w, err, "Failed to get account")
 		}
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	response := newAccountResponse(account)
+	if verbose {
+		// Both representations come from the same rounded value so they always agree
+		if balance, err := domain.ParseMoney(account.Balance); err == nil {
+			rounded := balance.RoundTo(domain.DisplayScale)
+			minor := rounded.Units()
+			response.BalanceMinor = &minor
+			response.BalanceDecimal = rounded.String()
+			response.Currency = h.currency
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !includeTransactions {
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	transactions, err := h.accountService.GetRecentTransactions(r.Context(), account.ID, limit, offset)
+	if err != nil {
+		respondWithServerError(w, err, "Failed to get account transactions")
+		return
+	}
+
+	withTransactions := AccountWithTransactionsResponse{
+		AccountResponse: response,
+		Transactions:    make([]AccountTransactionResponse, 0, len(transactions)),
+	}
+	for _, transaction := range transactions {
+		withTransactions.Transactions = append(withTransactions.Transactions, AccountTransactionResponse{
+			TransactionID: int64(transaction.TransactionID),
+			Amount:        displayAmount(transaction.Amount),
+			BalanceAfter:  displayAmount(transaction.BalanceAfter),
+			CreatedAt:     transaction.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	json.NewEncoder(w).Encode(withTransactions)
 }
 
-// @Summary Get account details
-// @Description Get account details by ID
+// @Summary Change account status
+// @Description Freeze, unfreeze or close an account. Transfers from or to a frozen or closed account fail
+// @Description with a failure code naming the blocking side. Closed accounts cannot be reopened.
 // @Tags accounts
 // @Accept json
 // @Produce json
 // @Param account_id path int true "Account ID"
+// @Param status body UpdateAccountStatusRequest true "New status"
 // @Success 200 {object} AccountResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
-// @Router /accounts/{account_id} [get]
-func (h *AccountHandler) GetAccount(w http.ResponseWriter, r *http.Request) {
+// @Failure 503 {object} ErrorResponse
+// @Router /accounts/{account_id}/status [put]
+func (h *AccountHandler) UpdateAccountStatus(w http.ResponseWriter, r *http.Request) {
 	accountID, err := strconv.ParseInt(chi.URLParam(r, "account_id"), 10, 64)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid account ID")
 		return
 	}
 
-	account, err := h.accountService.GetAccount(r.Context(), domain.AccountID(accountID))
+	var req UpdateAccountStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+
+	account, err := h.accountService.SetAccountStatus(r.Context(), domain.AccountID(accountID), domain.AccountStatus(req.Status))
+	if err != nil {
+		switch {
+		case errors.Is(err, application.ErrAccountNotFound):
+			respondWithError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, application.ErrAccountClosed):
+			respondWithError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, application.ErrInvalidAccountStatus),
+			errors.Is(err, application.ErrInvalidAccountID):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondWithServerError(w, err, "Failed to update account status")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newAccountResponse(account))
+}
+
+// @Summary Check account existence
+// @Description Check whether an account exists without returning its details
+// @Tags accounts
+// @Param account_id path int true "Account ID"
+// @Success 200 "OK"
+// @Failure 400 "Bad Request"
+// @Failure 404 "Not Found"
+// @Failure 500 "Internal Server Error"
+// @Failure 503 "Service Unavailable"
+// @Router /accounts/{account_id} [head]
+func (h *AccountHandler) HeadAccount(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.ParseInt(chi.URLParam(r, "account_id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	exists, err := h.accountService.AccountExists(r.Context(), domain.AccountID(accountID))
+	if err != nil {
+		switch {
+		case errors.Is(err, application.ErrInvalidAccountID):
+			w.WriteHeader(http.StatusBadRequest)
+		case errors.Is(err, domain.ErrOverloaded):
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case errors.Is(err, context.Canceled):
+			w.WriteHeader(StatusClientClosedRequest)
+		case errors.Is(err, context.DeadlineExceeded):
+			w.WriteHeader(http.StatusGatewayTimeout)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// @Summary Get account balance
+// @Description Get the current balance of an account, or its balance at a point in time reconstructed from the ledger
+// @Tags accounts
+// @Produce json
+// @Param account_id path int true "Account ID"
+// @Param at query string false "RFC 3339 timestamp, e.g. 2024-01-31T23:59:59Z"
+// @Success 200 {object} BalanceResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /accounts/{account_id}/balance [get]
+func (h *AccountHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.ParseInt(chi.URLParam(r, "account_id"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid account ID")
+		return
+	}
+
+	// Without a timestamp the current balance is returned
+	var (
+		balance string
+		at      time.Time
+	)
+	if value := r.URL.Query().Get("at"); value != "" {
+		if at, err = time.Parse(time.RFC3339, value); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid timestamp, expected RFC 3339 (e.g. 2024-01-31T23:59:59Z)")
+			return
+		}
+		balance, err = h.accountService.GetBalanceAt(r.Context(), domain.AccountID(accountID), at)
+	} else {
+		var account *domain.Account
+		if account, err = h.accountService.GetAccount(r.Context(), domain.AccountID(accountID)); err == nil {
+			balance = account.Balance
+		}
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, application.ErrAccountNotFound):
@@ -121,23 +628,312 @@ func (h *AccountHandler) GetAccount(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, application.ErrInvalidAccountID):
 			respondWithError(w, http.StatusBadRequest, err.Error())
 		default:
-			respondWithError(w, http.StatusInternalServerError, "Failed to get account")
+			respondWithServerError(w, err, "Failed to get balance")
 		}
 		return
 	}
 
-	response := AccountResponse{
-		AccountID: int64(account.ID),
-		Balance:   account.Balance,
+	response := BalanceResponse{
+		AccountID: accountID,
+		Balance:   displayAmount(balance),
+	}
+	if !at.IsZero() {
+		response.At = at.Format(time.RFC3339)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// respondWithError sends an error response with the given status code and message
-func respondWithError(w http.ResponseWriter, status int, message string) {
+// @Summary Get the available balance of an account
+// @Description Get the total balance of an account, the funds reserved on it by transfers held for fraud review,
+// @Description and the available balance that can still be spent, which is the total minus the reserved funds
+// @Tags accounts
+// @Produce json
+// @Param account_id path int true "Account ID"
+// @Success 200 {object} AvailableBalanceResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /accounts/{account_id}/available [get]
+func (h *AccountHandler) GetAvailableBalance(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.ParseInt(chi.URLParam(r, "account_id"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid account ID")
+		return
+	}
+
+	balance, err := h.accountService.GetAvailableBalance(r.Context(), domain.AccountID(accountID))
+	if err != nil {
+		switch {
+		case errors.Is(err, application.ErrAccountNotFound):
+			respondWithError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, application.ErrInvalidAccountID):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondWithServerError(w, err, "Failed to get available balance")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AvailableBalanceResponse{
+		AccountID: accountID,
+		Balance:   displayAmount(balance.Balance),
+		Reserved:  displayAmount(balance.Reserved),
+		Available: displayAmount(balance.Available),
+	})
+}
+
+// @Summary Get the balances of several accounts
+// @Description Look up the current balances of the listed accounts in a single query, e.g. for a dashboard.
+// @Description Accounts that do not exist are listed under missing instead of failing the request.
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param accounts body BalancesRequest true "Accounts to look up (at most 1000)"
+// @Success 200 {object} BalancesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /accounts/balances [post]
+func (h *AccountHandler) GetBalances(w http.ResponseWriter, r *http.Request) {
+	var req BalancesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+
+	ids := make([]domain.AccountID, len(req.AccountIDs))
+	for i, id := range req.AccountIDs {
+		ids[i] = domain.AccountID(id)
+	}
+
+	balances, err := h.accountService.GetBalances(r.Context(), ids)
+	if err != nil {
+		switch {
+		case errors.Is(err, application.ErrInvalidAccountSet),
+			errors.Is(err, application.ErrInvalidAccountID):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondWithServerError(w, err, "Failed to get balances")
+		}
+		return
+	}
+
+	response := BalancesResponse{
+		Balances: make(map[int64]string, len(balances)),
+		Missing:  []int64{},
+		Currency: h.currency,
+	}
+	for _, id := range req.AccountIDs {
+		balance, ok := balances[domain.AccountID(id)]
+		if !ok {
+			if !slices.Contains(response.Missing, id) {
+				response.Missing = append(response.Missing, id)
+			}
+			continue
+		}
+		response.Balances[id] = displayAmount(balance)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+	json.NewEncoder(w).Encode(response)
+}
+
+// @Summary Get the combined balance of several accounts
+// @Description Add up the current balances of the listed accounts, e.g. for treasury reporting.
+// @Description Duplicate IDs are counted once; the request fails if any account does not exist.
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param accounts body AggregateBalanceRequest true "Accounts to add up (at most 1000)"
+// @Success 200 {object} AggregateBalanceResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /accounts/balance/aggregate [post]
+func (h *AccountHandler) GetAggregateBalance(w http.ResponseWriter, r *http.Request) {
+	var req AggregateBalanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+
+	ids := make([]domain.AccountID, len(req.AccountIDs))
+	for i, id := range req.AccountIDs {
+		ids[i] = domain.AccountID(id)
+	}
+
+	balance, err := h.accountService.GetAggregateBalance(r.Context(), ids)
+	if err != nil {
+		switch {
+		case errors.Is(err, application.ErrAccountNotFound):
+			respondWithError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, application.ErrInvalidAccountSet),
+			errors.Is(err, application.ErrInvalidAccountID):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondWithServerError(w, err, "Failed to get aggregate balance")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AggregateBalanceResponse{
+		AccountCount: countDistinct(req.AccountIDs),
+		Balance:      displayAmount(balance),
+		Currency:     h.currency,
+	})
+}
+
+// countDistinct returns the number of distinct values in ids
+func countDistinct(ids []int64) int {
+	seen := make(map[int64]struct{}, len(ids))
+	for _, id := range ids {
+		seen[id] = struct{}{}
+	}
+	return len(seen)
+}
+
+// GetLedgerEntries lists the ledger entries recorded for the transaction given by the
+// transaction_id query parameter. It is served on the admin listener, see AdminRoutes.
+func (h *AccountHandler) GetLedgerEntries(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := strconv.ParseInt(r.URL.Query().Get("transaction_id"), 10, 64)
+	if err != nil || transactionID <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+
+	entries, err := h.accountService.GetLedgerEntries(r.Context(), domain.TransactionID(transactionID))
+	if err != nil {
+		respondWithServerError(w, err, "Failed to get ledger entries")
+		return
+	}
+
+	response := make([]LedgerEntryResponse, 0, len(entries))
+	for _, entry := range entries {
+		response = append(response, LedgerEntryResponse{
+			ID:            entry.ID,
+			AccountID:     int64(entry.AccountID),
+			TransactionID: int64(entry.TransactionID),
+			Type:          string(entry.Type),
+			Amount:        displayAmount(entry.Amount),
+			BalanceAfter:  displayAmount(entry.BalanceAfter),
+			CreatedAt:     entry.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// @Summary Approve a held transfer
+// @Description Complete a transfer held for fraud review. The funds reserved on the source account are
+// @Description released and the transfer is applied as submitted, including its fee.
+// @Tags holds
+// @Produce json
+// @Param transaction_id path int true "Transaction ID"
+// @Success 200 {object} HoldResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /holds/{transaction_id}/approve [post]
+func (h *AccountHandler) ApproveHeldTransfer(w http.ResponseWriter, r *http.Request) {
+	h.resolveHeldTransfer(w, r, h.accountService.ApproveHeldTransfer)
+}
+
+// @Summary Reject a held transfer
+// @Description Fail a transfer held for fraud review with failure code rejected_in_review. The funds
+// @Description reserved on the source account are returned to it.
+// @Tags holds
+// @Produce json
+// @Param transaction_id path int true "Transaction ID"
+// @Success 200 {object} HoldResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /holds/{transaction_id}/reject [post]
+func (h *AccountHandler) RejectHeldTransfer(w http.ResponseWriter, r *http.Request) {
+	h.resolveHeldTransfer(w, r, h.accountService.RejectHeldTransfer)
+}
+
+// resolveHeldTransfer answers an approve or reject request with the reviewed hold
+func (h *AccountHandler) resolveHeldTransfer(w http.ResponseWriter, r *http.Request, resolve func(ctx context.Context, id domain.TransactionID) (*domain.TransferHold, error)) {
+	transactionID, err := strconv.ParseInt(chi.URLParam(r, "transaction_id"), 10, 64)
+	if err != nil || transactionID <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+
+	hold, err := resolve(r.Context(), domain.TransactionID(transactionID))
+	if err != nil {
+		switch {
+		case errors.Is(err, application.ErrHoldNotFound),
+			errors.Is(err, application.ErrAccountNotFound):
+			respondWithError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, application.ErrHoldResolved),
+			errors.Is(err, application.ErrTransferBlocked):
+			respondWithError(w, http.StatusConflict, err.Error())
+		default:
+			respondWithServerError(w, err, "Failed to review held transfer")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newHoldResponse(hold))
+}
+
+// newHoldResponse maps a domain hold to its API representation
+func newHoldResponse(hold *domain.TransferHold) HoldResponse {
+	response := HoldResponse{
+		TransactionID:        int64(hold.Transfer.TransactionID),
+		SourceAccountID:      int64(hold.Transfer.SourceAccountID),
+		DestinationAccountID: int64(hold.Transfer.DestinationAccountID),
+		Amount:               displayAmount(hold.Transfer.Amount),
+		Status:               string(hold.Status),
+		CreatedAt:            hold.CreatedAt.Format(time.RFC3339),
+	}
+	if hold.Transfer.Fee != "" {
+		response.Fee = displayAmount(hold.Transfer.Fee)
+	}
+	if hold.ResolvedAt != nil {
+		response.ResolvedAt = hold.ResolvedAt.Format(time.RFC3339)
+	}
+	return response
+}
+
+// newAccountResponse maps a domain account to its compact API representation
+func newAccountResponse(account *domain.Account) AccountResponse {
+	return AccountResponse{
+		AccountID: int64(account.ID),
+		Balance:   displayAmount(account.Balance),
+		Status:    string(account.Status),
+	}
+}
+
+// displayAmount rounds a stored amount to the display scale; unparsable values are returned as-is
+func displayAmount(amount string) string {
+	value, err := domain.ParseMoney(amount)
+	if err != nil {
+		return amount
+	}
+	return value.Display()
 }
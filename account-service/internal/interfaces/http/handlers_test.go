@@ -0,0 +1,756 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"internal-transfers/account-service/internal/application"
+	"internal-transfers/account-service/internal/domain"
+	"internal-transfers/account-service/internal/infrastructure/messaging"
+	"internal-transfers/pkg/admin"
+	"internal-transfers/pkg/features"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// memoryRepository keeps accounts in memory; methods the tests do not use panic through the
+// embedded nil interface
+type memoryRepository struct {
+	domain.AccountRepository
+
+	mu        sync.Mutex
+	accounts  map[domain.AccountID]domain.Account
+	entries   []domain.LedgerEntry
+	creations map[string]domain.AccountCreation
+	// sequence is the last account ID drawn by NextAccountID
+	sequence domain.AccountID
+}
+
+func newMemoryRepository(accounts ...domain.Account) *memoryRepository {
+	r := &memoryRepository{
+		accounts:  make(map[domain.AccountID]domain.Account),
+		creations: make(map[string]domain.AccountCreation),
+	}
+	for _, account := range accounts {
+		r.accounts[account.ID] = account
+	}
+	return r
+}
+
+func (r *memoryRepository) Exists(_ context.Context, id domain.AccountID) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.accounts[id]
+	return ok, nil
+}
+
+func (r *memoryRepository) GetByID(_ context.Context, id domain.AccountID) (*domain.Account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	account, ok := r.accounts[id]
+	if !ok {
+		return nil, nil
+	}
+	return &account, nil
+}
+
+func (r *memoryRepository) GetLedgerEntriesByTransaction(_ context.Context, transactionID domain.TransactionID) ([]domain.LedgerEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var entries []domain.LedgerEntry
+	for _, entry := range r.entries {
+		if entry.TransactionID == transactionID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (r *memoryRepository) Create(_ context.Context, account *domain.Account) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.accounts[account.ID] = *account
+	return nil
+}
+
+// NextAccountID draws IDs from an in-memory sequence like the account_ids database sequence
+func (r *memoryRepository) NextAccountID(_ context.Context, min domain.AccountID) (domain.AccountID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sequence = max(r.sequence+1, min)
+	return r.sequence, nil
+}
+
+// CreateWithIdempotencyKey creates the account and records its creation under the key
+func (r *memoryRepository) CreateWithIdempotencyKey(_ context.Context, account *domain.Account, creation domain.AccountCreation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.creations[creation.IdempotencyKey]; ok {
+		return errors.New("duplicate idempotency key")
+	}
+	r.accounts[account.ID] = *account
+	r.creations[creation.IdempotencyKey] = creation
+	return nil
+}
+
+func (r *memoryRepository) GetAccountCreation(_ context.Context, idempotencyKey string) (*domain.AccountCreation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	creation, ok := r.creations[idempotencyKey]
+	if !ok {
+		return nil, nil
+	}
+	return &creation, nil
+}
+
+// GetBalanceAt sums the entries of the account recorded up to at
+func (r *memoryRepository) GetBalanceAt(_ context.Context, id domain.AccountID, at time.Time) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	balance := domain.NewMoney(0, 0)
+	for _, entry := range r.entries {
+		if entry.AccountID != id || entry.CreatedAt.After(at) {
+			continue
+		}
+		amount, err := domain.ParseMoney(entry.Amount)
+		if err != nil {
+			return "", err
+		}
+		balance = balance.Add(amount)
+	}
+	return balance.String(), nil
+}
+
+// GetBalances returns the balances of the accounts that exist
+func (r *memoryRepository) GetBalances(_ context.Context, ids []domain.AccountID) (map[domain.AccountID]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	balances := make(map[domain.AccountID]string, len(ids))
+	for _, id := range ids {
+		if account, ok := r.accounts[id]; ok {
+			balances[id] = account.Balance
+		}
+	}
+	return balances, nil
+}
+
+// SumBalances adds up the balances of the accounts that exist
+func (r *memoryRepository) SumBalances(_ context.Context, ids []domain.AccountID) (string, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	total, found := domain.NewMoney(0, 0), 0
+	for _, id := range ids {
+		account, ok := r.accounts[id]
+		if !ok {
+			continue
+		}
+		balance, err := domain.ParseMoney(account.Balance)
+		if err != nil {
+			return "", 0, err
+		}
+		total, found = total.Add(balance), found+1
+	}
+	return total.String(), found, nil
+}
+
+// discardBroker drops the events published by the account service
+type discardBroker struct {
+	messaging.MessageBroker
+}
+
+func (discardBroker) PublishAccountCreated(context.Context, *domain.Account) error { return nil }
+
+// newRouter serves the account API on top of repo
+func newRouter(repo domain.AccountRepository, opts ...HandlerOption) http.Handler {
+	r := chi.NewRouter()
+	RegisterHandlers(r, NewAccountHandler(application.NewAccountService(repo, nil), opts...))
+	return r
+}
+
+func TestHeadAccount(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{name: "existing account", path: "/accounts/1", status: http.StatusOK},
+		{name: "unknown account", path: "/accounts/2", status: http.StatusNotFound},
+		{name: "invalid id", path: "/accounts/one", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRouter(newMemoryRepository(domain.Account{ID: 1, Balance: "100.00", Status: domain.AccountStatusActive}))
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, tt.path, nil))
+			if rec.Code != tt.status {
+				t.Errorf("HEAD %s answered %d, want %d", tt.path, rec.Code, tt.status)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("HEAD %s answered with a body: %q", tt.path, rec.Body)
+			}
+		})
+	}
+}
+
+func TestGetAccount(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		wantCode string
+	}{
+		{name: "existing account", path: "/accounts/1", status: http.StatusOK},
+		{name: "unknown account", path: "/accounts/2", status: http.StatusNotFound, wantCode: CodeNotFound},
+		{name: "invalid id", path: "/accounts/one", status: http.StatusBadRequest, wantCode: CodeBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRouter(newMemoryRepository(domain.Account{ID: 1, Balance: "100.00", Status: domain.AccountStatusActive}))
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("GET %s answered %d, want %d: %s", tt.path, rec.Code, tt.status, rec.Body)
+			}
+
+			if tt.wantCode != "" {
+				var response ErrorResponse
+				if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+					t.Fatalf("failed to decode the error response: %v", err)
+				}
+				if response.Code != tt.wantCode {
+					t.Errorf("error code = %q, want %q", response.Code, tt.wantCode)
+				}
+				return
+			}
+
+			var response AccountResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode the account: %v", err)
+			}
+			if response.AccountID != 1 || response.Balance != "100.00" {
+				t.Errorf("account = %+v, want account 1 with 100.00", response)
+			}
+		})
+	}
+}
+
+func TestLedgerOnAdminListenerOnly(t *testing.T) {
+	repo := newMemoryRepository()
+	repo.entries = []domain.LedgerEntry{
+		{ID: 1, AccountID: 1, TransactionID: 7, Type: domain.LedgerEntryDebit, Amount: "-10.00", BalanceAfter: "90.00"},
+		{ID: 2, AccountID: 2, TransactionID: 7, Type: domain.LedgerEntryCredit, Amount: "10.00", BalanceAfter: "10.00"},
+		{ID: 3, AccountID: 1, TransactionID: 8, Type: domain.LedgerEntryDebit, Amount: "-5.00", BalanceAfter: "85.00"},
+	}
+	h := NewAccountHandler(application.NewAccountService(repo, nil))
+	public := chi.NewRouter()
+	RegisterHandlers(public, h)
+	adminHandler := admin.NewHandler(AdminRoutes(h)...)
+
+	// Any caller of the API could otherwise read the movements of every account
+	rec := httptest.NewRecorder()
+	public.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ledger?transaction_id=7", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /ledger on the API answered %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = httptest.NewRecorder()
+	adminHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ledger?transaction_id=7", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /ledger on the admin listener answered %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var entries []LedgerEntryResponse
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatalf("failed to decode the ledger entries: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != 1 || entries[1].ID != 2 {
+		t.Errorf("ledger entries = %+v, want entries 1 and 2 of transaction 7", entries)
+	}
+
+	rec = httptest.NewRecorder()
+	adminHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ledger?transaction_id=seven", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /ledger with an invalid transaction ID answered %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestMetricsOnAdminListenerOnly(t *testing.T) {
+	h := NewAccountHandler(application.NewAccountService(newMemoryRepository(), nil))
+	public := chi.NewRouter()
+	RegisterHandlers(public, h)
+	adminHandler := admin.NewHandler(AdminRoutes(h)...)
+
+	for _, path := range admin.Paths {
+		rec := httptest.NewRecorder()
+		public.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s on the API answered %d, want %d", path, rec.Code, http.StatusNotFound)
+		}
+
+		rec = httptest.NewRecorder()
+		adminHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s on the admin listener answered %d, want %d", path, rec.Code, http.StatusOK)
+		}
+	}
+}
+
+func TestGetBalanceAt(t *testing.T) {
+	opened := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	repo := newMemoryRepository(domain.Account{ID: 1, Balance: "75.50", Status: domain.AccountStatusActive})
+	repo.entries = []domain.LedgerEntry{
+		{ID: 1, AccountID: 1, Type: domain.LedgerEntryOpening, Amount: "100.00", BalanceAfter: "100.00", CreatedAt: opened},
+		{ID: 2, AccountID: 1, TransactionID: 7, Type: domain.LedgerEntryDebit, Amount: "-30.00", BalanceAfter: "70.00", CreatedAt: opened.Add(time.Hour)},
+		{ID: 3, AccountID: 1, TransactionID: 8, Type: domain.LedgerEntryCredit, Amount: "5.50", BalanceAfter: "75.50", CreatedAt: opened.Add(2 * time.Hour)},
+	}
+	r := newRouter(repo)
+
+	tests := []struct {
+		name        string
+		path        string
+		status      int
+		wantBalance string
+		wantAt      string
+	}{
+		{name: "current balance", path: "/accounts/1/balance", status: http.StatusOK, wantBalance: "75.50"},
+		{name: "after the first transfer", path: "/accounts/1/balance?at=2024-01-01T10:30:00Z", status: http.StatusOK, wantBalance: "70.00", wantAt: "2024-01-01T10:30:00Z"},
+		{name: "at a transfer", path: "/accounts/1/balance?at=2024-01-01T11:00:00Z", status: http.StatusOK, wantBalance: "75.50", wantAt: "2024-01-01T11:00:00Z"},
+		{name: "in another time zone", path: "/accounts/1/balance?at=2024-01-01T12:30:00%2B02:00", status: http.StatusOK, wantBalance: "70.00", wantAt: "2024-01-01T12:30:00+02:00"},
+		{name: "before the opening", path: "/accounts/1/balance?at=2023-12-31T23:59:59Z", status: http.StatusOK, wantBalance: "0.00", wantAt: "2023-12-31T23:59:59Z"},
+		{name: "malformed timestamp", path: "/accounts/1/balance?at=yesterday", status: http.StatusBadRequest},
+		{name: "date only", path: "/accounts/1/balance?at=2024-01-01", status: http.StatusBadRequest},
+		{name: "unknown account", path: "/accounts/2/balance?at=2024-01-01T10:30:00Z", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("GET %s answered %d, want %d: %s", tt.path, rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var response BalanceResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode the balance: %v", err)
+			}
+			if response.Balance != tt.wantBalance || response.At != tt.wantAt {
+				t.Errorf("balance = %s at %q, want %s at %q", response.Balance, response.At, tt.wantBalance, tt.wantAt)
+			}
+		})
+	}
+}
+
+func TestGetAggregateBalance(t *testing.T) {
+	repo := newMemoryRepository(
+		domain.Account{ID: 1, Balance: "100.25", Status: domain.AccountStatusActive},
+		domain.Account{ID: 2, Balance: "0.75", Status: domain.AccountStatusActive},
+		domain.Account{ID: 3, Balance: "1000", Status: domain.AccountStatusFrozen},
+	)
+	r := newRouter(repo, WithCurrency("EUR"))
+
+	tests := []struct {
+		name        string
+		body        string
+		status      int
+		wantBalance string
+		wantCount   int
+	}{
+		{name: "several accounts", body: `{"account_ids": [1, 2, 3]}`, status: http.StatusOK, wantBalance: "1101.00", wantCount: 3},
+		{name: "duplicate accounts", body: `{"account_ids": [1, 1, 2]}`, status: http.StatusOK, wantBalance: "101.00", wantCount: 2},
+		{name: "unknown account", body: `{"account_ids": [1, 4]}`, status: http.StatusNotFound},
+		{name: "no accounts", body: `{"account_ids": []}`, status: http.StatusBadRequest},
+		{name: "invalid id", body: `{"account_ids": [1, 0]}`, status: http.StatusBadRequest},
+		{name: "invalid body", body: `{"account_ids": "1,2"}`, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/accounts/balance/aggregate", strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Fatalf("POST /accounts/balance/aggregate answered %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var response AggregateBalanceResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode the aggregate balance: %v", err)
+			}
+			// Every account is held in the currency of the service, so the sum is in it too
+			if response.Balance != tt.wantBalance || response.AccountCount != tt.wantCount || response.Currency != "EUR" {
+				t.Errorf("aggregate = %+v, want %s EUR over %d accounts", response, tt.wantBalance, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestGetBalances(t *testing.T) {
+	repo := newMemoryRepository(
+		domain.Account{ID: 1, Balance: "100.25", Status: domain.AccountStatusActive},
+		domain.Account{ID: 2, Balance: "0.5", Status: domain.AccountStatusActive},
+		domain.Account{ID: 3, Balance: "1000", Status: domain.AccountStatusFrozen},
+	)
+	r := newRouter(repo, WithCurrency("EUR"))
+
+	// One more account than the cap allows
+	tooMany := make([]string, 1001)
+	for i := range tooMany {
+		tooMany[i] = strconv.Itoa(i + 1)
+	}
+
+	tests := []struct {
+		name         string
+		body         string
+		status       int
+		wantBalances map[int64]string
+		wantMissing  []int64
+	}{
+		{
+			name:         "existing accounts",
+			body:         `{"account_ids": [3, 1, 2]}`,
+			status:       http.StatusOK,
+			wantBalances: map[int64]string{1: "100.25", 2: "0.50", 3: "1000.00"},
+			wantMissing:  []int64{},
+		},
+		{
+			name:         "existing and missing accounts",
+			body:         `{"account_ids": [5, 1, 4, 2, 5]}`,
+			status:       http.StatusOK,
+			wantBalances: map[int64]string{1: "100.25", 2: "0.50"},
+			wantMissing:  []int64{5, 4},
+		},
+		{
+			name:         "missing accounts only",
+			body:         `{"account_ids": [7, 6]}`,
+			status:       http.StatusOK,
+			wantBalances: map[int64]string{},
+			wantMissing:  []int64{7, 6},
+		},
+		{name: "no accounts", body: `{"account_ids": []}`, status: http.StatusBadRequest},
+		{name: "too many accounts", body: `{"account_ids": [` + strings.Join(tooMany, ",") + `]}`, status: http.StatusBadRequest},
+		{name: "invalid id", body: `{"account_ids": [1, 0]}`, status: http.StatusBadRequest},
+		{name: "invalid body", body: `{"account_ids": "1,2"}`, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/accounts/balances", strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Fatalf("POST /accounts/balances answered %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var response BalancesResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode the balances: %v", err)
+			}
+			if !maps.Equal(response.Balances, tt.wantBalances) || response.Currency != "EUR" {
+				t.Errorf("balances = %v in %s, want %v in EUR", response.Balances, response.Currency, tt.wantBalances)
+			}
+			// Missing accounts are listed once each, in the order they were requested
+			if !slices.Equal(response.Missing, tt.wantMissing) {
+				t.Errorf("missing = %v, want %v", response.Missing, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestCreateAccountLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []HandlerOption
+		wantPath string
+	}{
+		{name: "default base path", wantPath: "/api/v1/accounts/5"},
+		{name: "custom base path", opts: []HandlerOption{WithBasePath("/ledger/v2")}, wantPath: "/ledger/v2/accounts/5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			RegisterHandlers(r, NewAccountHandler(application.NewAccountService(newMemoryRepository(), discardBroker{}), tt.opts...))
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(`{"account_id": 5, "initial_balance": "10.00"}`)))
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("POST /accounts answered %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantPath {
+				t.Errorf("Location = %q, want %q", got, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestRoutesUnderBasePath(t *testing.T) {
+	const basePath = "/gateway/accounts/api/v2"
+	handler := NewAccountHandler(application.NewAccountService(newMemoryRepository(), discardBroker{}), WithBasePath(basePath))
+	r := chi.NewRouter()
+	r.Route(basePath, func(r chi.Router) {
+		RegisterHandlers(r, handler)
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, basePath+"/accounts", strings.NewReader(`{"account_id": 5, "initial_balance": "10.00"}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST %s/accounts answered %d, want %d: %s", basePath, rec.Code, http.StatusCreated, rec.Body)
+	}
+
+	// The created account is found at the URL it was reported under, and only under the base path
+	location := rec.Header().Get("Location")
+	for path, want := range map[string]int{location: http.StatusOK, "/api/v1/accounts/5": http.StatusNotFound, "/accounts/5": http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s answered %d, want %d", path, rec.Code, want)
+		}
+	}
+}
+
+func TestCreateAccountIdempotencyKey(t *testing.T) {
+	flagsOff, err := features.Parse([]string{string(features.IdempotencyKeys) + "=off"})
+	if err != nil {
+		t.Fatalf("features.Parse() error = %v", err)
+	}
+	tests := []struct {
+		name       string
+		opts       []HandlerOption
+		retryKey   string
+		retryBody  string
+		wantStatus int
+	}{
+		{name: "retried with the same key", retryKey: "create-5", retryBody: `{"account_id": 5, "initial_balance": "10.00"}`, wantStatus: http.StatusCreated},
+		{name: "retried with the same key and an equal balance", retryKey: "create-5", retryBody: `{"account_id": 5, "initial_balance": "10"}`, wantStatus: http.StatusCreated},
+		{name: "key reused for another balance", retryKey: "create-5", retryBody: `{"account_id": 5, "initial_balance": "20.00"}`, wantStatus: http.StatusConflict},
+		{name: "key reused for another account", retryKey: "create-5", retryBody: `{"account_id": 6, "initial_balance": "10.00"}`, wantStatus: http.StatusConflict},
+		{name: "retried without a key", retryBody: `{"account_id": 5, "initial_balance": "10.00"}`, wantStatus: http.StatusConflict},
+		{name: "retried with the feature off", opts: []HandlerOption{WithFeatures(flagsOff)}, retryKey: "create-5", retryBody: `{"account_id": 5, "initial_balance": "10.00"}`, wantStatus: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository()
+			r := chi.NewRouter()
+			RegisterHandlers(r, NewAccountHandler(application.NewAccountService(repo, discardBroker{}), tt.opts...))
+			create := func(key, body string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(body))
+				if key != "" {
+					req.Header.Set("Idempotency-Key", key)
+				}
+				rec := httptest.NewRecorder()
+				r.ServeHTTP(rec, req)
+				return rec
+			}
+
+			first := create("create-5", `{"account_id": 5, "initial_balance": "10.00"}`)
+			if first.Code != http.StatusCreated {
+				t.Fatalf("POST /accounts answered %d, want %d: %s", first.Code, http.StatusCreated, first.Body)
+			}
+
+			retry := create(tt.retryKey, tt.retryBody)
+			if retry.Code != tt.wantStatus {
+				t.Fatalf("retried POST /accounts answered %d, want %d: %s", retry.Code, tt.wantStatus, retry.Body)
+			}
+			// A replayed creation answers exactly like the original one
+			if tt.wantStatus == http.StatusCreated {
+				if retry.Body.String() != first.Body.String() || retry.Header().Get("Location") != first.Header().Get("Location") {
+					t.Errorf("retry answered %s at %q, want %s at %q", retry.Body, retry.Header().Get("Location"), first.Body, first.Header().Get("Location"))
+				}
+			}
+			if len(repo.accounts) != 1 {
+				t.Errorf("created %d accounts, want 1", len(repo.accounts))
+			}
+		})
+	}
+}
+
+func TestValidateAccount(t *testing.T) {
+	flagsOff, err := features.Parse([]string{string(features.AccountValidation) + "=off"})
+	if err != nil {
+		t.Fatalf("features.Parse() error = %v", err)
+	}
+	tests := []struct {
+		name     string
+		opts     []HandlerOption
+		body     string
+		status   int
+		wantCode string
+	}{
+		{name: "valid", body: `{"account_id": 5, "initial_balance": "10.00"}`, status: http.StatusOK},
+		{name: "invalid amount", body: `{"account_id": 5, "initial_balance": "ten"}`, status: http.StatusBadRequest, wantCode: CodeBadRequest},
+		{name: "negative amount", body: `{"account_id": 5, "initial_balance": "-10.00"}`, status: http.StatusBadRequest, wantCode: CodeBadRequest},
+		{name: "missing id", body: `{"initial_balance": "10.00"}`, status: http.StatusBadRequest, wantCode: CodeBadRequest},
+		{name: "existing id", body: `{"account_id": 1, "initial_balance": "10.00"}`, status: http.StatusConflict, wantCode: CodeConflict},
+		{name: "feature off", opts: []HandlerOption{WithFeatures(flagsOff)}, body: `{"account_id": 5, "initial_balance": "10.00"}`, status: http.StatusNotFound, wantCode: CodeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository(domain.Account{ID: 1, Balance: "100.00", Status: domain.AccountStatusActive})
+			r := newRouter(repo, tt.opts...)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/accounts/validate", strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Fatalf("POST /accounts/validate answered %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			if tt.wantCode != "" {
+				var response ErrorResponse
+				if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+					t.Fatalf("failed to decode the error response: %v", err)
+				}
+				if response.Code != tt.wantCode {
+					t.Errorf("error code = %q, want %q", response.Code, tt.wantCode)
+				}
+			} else {
+				var response ValidateAccountResponse
+				if err := json.NewDecoder(rec.Body).Decode(&response); err != nil || !response.Valid {
+					t.Errorf("response = %+v, %v, want valid", response, err)
+				}
+			}
+
+			// Validating never creates the account
+			if exists, _ := repo.Exists(context.Background(), 5); exists {
+				t.Error("account 5 was created")
+			}
+		})
+	}
+}
+
+func TestCreateAccountGeneratedID(t *testing.T) {
+	// Account 2 was created with an ID of its own, which the sequence must skip
+	repo := newMemoryRepository(domain.Account{ID: 2, Balance: "5.00", Status: domain.AccountStatusActive})
+	r := chi.NewRouter()
+	RegisterHandlers(r, NewAccountHandler(application.NewAccountService(repo, discardBroker{}, application.WithGeneratedAccountIDs())))
+
+	create := func(body string, status int) int64 {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(body)))
+		if rec.Code != status {
+			t.Fatalf("POST /accounts %s answered %d, want %d: %s", body, rec.Code, status, rec.Body)
+		}
+		if status != http.StatusCreated {
+			return 0
+		}
+		var response CreateAccountResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode the response: %v", err)
+		}
+		if want := fmt.Sprintf("/api/v1/accounts/%d", response.AccountID); rec.Header().Get("Location") != want {
+			t.Errorf("Location = %q, want %q", rec.Header().Get("Location"), want)
+		}
+		return response.AccountID
+	}
+
+	seen := make(map[int64]bool)
+	for range 5 {
+		id := create(`{"initial_balance": "10.00"}`, http.StatusCreated)
+		if id <= 0 || seen[id] || id == 2 {
+			t.Errorf("generated account ID %d, want a new positive ID other than 2 (seen %v)", id, seen)
+		}
+		seen[id] = true
+		if exists, _ := repo.Exists(context.Background(), domain.AccountID(id)); !exists {
+			t.Errorf("account %d was not created", id)
+		}
+	}
+
+	// IDs given by clients still work, and still conflict with existing accounts
+	if id := create(`{"account_id": 100, "initial_balance": "10.00"}`, http.StatusCreated); id != 100 {
+		t.Errorf("created account %d, want 100", id)
+	}
+	create(`{"account_id": 2, "initial_balance": "10.00"}`, http.StatusConflict)
+}
+
+func TestCreateAccountWithoutIDGeneration(t *testing.T) {
+	repo := newMemoryRepository()
+	r := chi.NewRouter()
+	RegisterHandlers(r, NewAccountHandler(application.NewAccountService(repo, discardBroker{})))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(`{"initial_balance": "10.00"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /accounts without an ID answered %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if len(repo.accounts) != 0 {
+		t.Errorf("created %d accounts, want none", len(repo.accounts))
+	}
+}
+
+func TestMaxAmountScale(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		maxScale int32
+		balance  string
+		status   int
+		// wantError is part of the error reported, for amounts the cap rejects
+		wantError string
+	}{
+		{name: "within both", currency: "USD", maxScale: 2, balance: "100.50", status: http.StatusCreated},
+		{name: "trailing zeros", currency: "USD", maxScale: 2, balance: "100.5000", status: http.StatusCreated},
+		{name: "above the cap", currency: "USD", maxScale: 2, balance: "100.505", status: http.StatusBadRequest, wantError: domain.ErrAmountScale.Error()},
+		// The cap applies whatever the currency allows
+		{name: "cap below the currency", currency: "USD", maxScale: 0, balance: "100.50", status: http.StatusBadRequest, wantError: domain.ErrAmountScale.Error()},
+		{name: "cap below a three-decimal currency", currency: "KWD", maxScale: 2, balance: "100.505", status: http.StatusBadRequest, wantError: domain.ErrAmountScale.Error()},
+		// and so do the currency rules whatever the cap
+		{name: "currency below the cap", currency: "JPY", maxScale: 2, balance: "100.5", status: http.StatusBadRequest},
+		{name: "whole yen under the cap", currency: "JPY", maxScale: 2, balance: "100", status: http.StatusCreated},
+		{name: "currency below the default cap", currency: "USD", maxScale: domain.MaxScale, balance: "100.505", status: http.StatusBadRequest},
+		{name: "cap without a currency", maxScale: 2, balance: "100.505", status: http.StatusBadRequest, wantError: domain.ErrAmountScale.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository()
+			service := application.NewAccountService(repo, discardBroker{}, application.WithCurrency(tt.currency))
+			r := chi.NewRouter()
+			RegisterHandlers(r, NewAccountHandler(service, WithMaxAmountScale(tt.maxScale)))
+
+			rec := httptest.NewRecorder()
+			body := `{"account_id": 1, "initial_balance": "` + tt.balance + `"}`
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(body)))
+			if rec.Code != tt.status {
+				t.Fatalf("POST /accounts with %s answered %d, want %d: %s", tt.balance, rec.Code, tt.status, rec.Body)
+			}
+			if tt.status == http.StatusCreated {
+				return
+			}
+
+			var response ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode the error: %v", err)
+			}
+			if !strings.Contains(response.Error, tt.wantError) {
+				t.Errorf("error = %q, want it to mention %q", response.Error, tt.wantError)
+			}
+			if len(repo.accounts) != 0 {
+				t.Error("the account was created, want it rejected")
+			}
+		})
+	}
+}
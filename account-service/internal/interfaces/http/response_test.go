@@ -0,0 +1,69 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// assertGolden compares the indented JSON encoding of v with testdata/name, which is rewritten
+// instead when the tests run with -update
+func assertGolden(t *testing.T, name string, v any) {
+	t.Helper()
+	got, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	got = append(got, '\n')
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("writing %s: %v", path, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("JSON differs from %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestAccountResponseJSON(t *testing.T) {
+	minor := int64(4000)
+	tests := []struct {
+		golden   string
+		response AccountResponse
+	}{
+		{
+			// Optional fields are left out rather than written as zero values
+			golden:   "account_response_minimal.json",
+			response: AccountResponse{AccountID: 1, Balance: "40.00", Status: "active"},
+		},
+		{
+			golden: "account_response_full.json",
+			response: AccountResponse{
+				AccountID:      1,
+				Balance:        "40.00",
+				Status:         "frozen",
+				BalanceMinor:   &minor,
+				BalanceDecimal: "40.00",
+				Currency:       "USD",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			assertGolden(t, tt.golden, tt.response)
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package http
+
+import (
+	"net/http"
+
+	"internal-transfers/pkg/config"
+)
+
+// NewServer creates an HTTP server for the handler using the configured port and timeouts
+func NewServer(cfg config.HTTPConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
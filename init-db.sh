@@ -14,6 +14,7 @@ psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "accounts" -c "
     CREATE TABLE IF NOT EXISTS accounts (
         id BIGINT PRIMARY KEY,
         balance TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'frozen', 'closed')),
         created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
         updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
     );"
@@ -21,6 +22,56 @@ psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "accounts" -c "
 psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "accounts" -c "
     CREATE INDEX IF NOT EXISTS idx_accounts_id ON accounts(id);"
 
+# Create the sequence generated account IDs are drawn from
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "accounts" -c "
+    CREATE SEQUENCE IF NOT EXISTS account_ids;"
+
+# Create ledger table
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "accounts" -c "
+    CREATE TABLE IF NOT EXISTS ledger_entries (
+        id BIGSERIAL PRIMARY KEY,
+        account_id BIGINT NOT NULL REFERENCES accounts(id),
+        transaction_id BIGINT,
+        entry_type TEXT NOT NULL CHECK (entry_type IN ('opening', 'debit', 'credit', 'fee', 'hold', 'release')),
+        amount NUMERIC NOT NULL,
+        balance_after TEXT NOT NULL,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    );"
+
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "accounts" -c "
+    CREATE INDEX IF NOT EXISTS idx_ledger_entries_account ON ledger_entries(account_id, created_at);
+    CREATE INDEX IF NOT EXISTS idx_ledger_entries_transaction ON ledger_entries(transaction_id);"
+
+# Create balance snapshots table so historical balances only sum the ledger entries since a snapshot
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "accounts" -c "
+    CREATE TABLE IF NOT EXISTS balance_snapshots (
+        account_id BIGINT NOT NULL REFERENCES accounts(id),
+        as_of TIMESTAMP WITH TIME ZONE NOT NULL,
+        balance NUMERIC NOT NULL,
+        PRIMARY KEY (account_id, as_of)
+    );"
+
+# Create transfer holds table tracking transfers held for fraud review
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "accounts" -c "
+    CREATE TABLE IF NOT EXISTS transfer_holds (
+        transaction_id BIGINT PRIMARY KEY,
+        source_account_id BIGINT NOT NULL REFERENCES accounts(id),
+        transfer JSONB NOT NULL,
+        status TEXT NOT NULL CHECK (status IN ('held', 'approved', 'rejected')),
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        resolved_at TIMESTAMP WITH TIME ZONE
+    );"
+
+# Create account idempotency keys table linking retried creations to the account they created
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "accounts" -c "
+    CREATE TABLE IF NOT EXISTS account_idempotency_keys (
+        idempotency_key TEXT PRIMARY KEY,
+        account_id BIGINT NOT NULL REFERENCES accounts(id),
+        initial_balance TEXT NOT NULL,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_account_idempotency_keys_created_at ON account_idempotency_keys(created_at);"
+
 # Create transactions table
 psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "transactions" -c "
     CREATE TABLE IF NOT EXISTS transactions (
@@ -28,7 +79,10 @@ psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "transactions" -c "
         source_account_id BIGINT NOT NULL,
         destination_account_id BIGINT NOT NULL,
         amount TEXT NOT NULL,
-        status TEXT NOT NULL CHECK (status IN ('pending', 'complete', 'failed', 'rollback')),
+        fee TEXT,
+        memo TEXT CHECK (char_length(memo) <= 256),
+        status TEXT NOT NULL CHECK (status IN ('pending', 'processing', 'held', 'complete', 'failed', 'rollback')),
+        failure_code TEXT,
         created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
         updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
     );"
@@ -38,9 +92,53 @@ psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "transactions" -c "
     CREATE INDEX IF NOT EXISTS idx_transactions_id ON transactions(id);
     CREATE INDEX IF NOT EXISTS idx_transactions_source_account ON transactions(source_account_id);
     CREATE INDEX IF NOT EXISTS idx_transactions_destination_account ON transactions(destination_account_id);
-    CREATE INDEX IF NOT EXISTS idx_transactions_status ON transactions(status);"
+    CREATE INDEX IF NOT EXISTS idx_transactions_status ON transactions(status);
+    CREATE INDEX IF NOT EXISTS idx_transactions_status_updated_at ON transactions(status, updated_at);"
+
+# Create transaction status history table
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "transactions" -c "
+    CREATE TABLE IF NOT EXISTS transaction_status_history (
+        id BIGSERIAL PRIMARY KEY,
+        transaction_id INTEGER NOT NULL REFERENCES transactions(id),
+        status TEXT NOT NULL,
+        failure_code TEXT,
+        changed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    );"
+
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "transactions" -c "
+    CREATE INDEX IF NOT EXISTS idx_transaction_status_history_transaction ON transaction_status_history(transaction_id);"
+
+# Create transaction legs table holding the destinations of split transfers
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "transactions" -c "
+    CREATE TABLE IF NOT EXISTS transaction_legs (
+        transaction_id INTEGER NOT NULL REFERENCES transactions(id),
+        position INTEGER NOT NULL,
+        destination_account_id BIGINT NOT NULL,
+        amount TEXT NOT NULL,
+        PRIMARY KEY (transaction_id, position)
+    );"
+
+# Create transactions archive table holding terminal transactions moved out of the hot tables,
+# together with their legs and status history
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "transactions" -c "
+    CREATE TABLE IF NOT EXISTS transactions_archive (
+        id INTEGER PRIMARY KEY,
+        source_account_id BIGINT NOT NULL,
+        destination_account_id BIGINT NOT NULL,
+        amount TEXT NOT NULL,
+        fee TEXT,
+        memo TEXT,
+        status TEXT NOT NULL,
+        failure_code TEXT,
+        created_at TIMESTAMP WITH TIME ZONE,
+        updated_at TIMESTAMP WITH TIME ZONE,
+        legs JSONB NOT NULL DEFAULT '[]',
+        status_history JSONB NOT NULL DEFAULT '[]',
+        archived_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    );"
 
-# Create trigger function and trigger
+# Create trigger function and trigger. updated_at is the time of the last status change, which
+# reports and archiving rely on, so editing the memo leaves it alone.
 psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "transactions" -c "
     CREATE OR REPLACE FUNCTION update_updated_at_column()
     RETURNS TRIGGER AS \$\$
@@ -53,6 +151,22 @@ psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "transactions" -c "
 psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "transactions" -c "
     DROP TRIGGER IF EXISTS update_transactions_updated_at ON transactions;
     CREATE TRIGGER update_transactions_updated_at
-        BEFORE UPDATE ON transactions
+        BEFORE UPDATE OF status, failure_code ON transactions
         FOR EACH ROW
-        EXECUTE FUNCTION update_updated_at_column();" 
\ No newline at end of file
+        EXECUTE FUNCTION update_updated_at_column();" 
+
+# Create processed messages table used to skip redelivered messages
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "accounts" -c "
+    CREATE TABLE IF NOT EXISTS processed_messages (
+        message_id TEXT PRIMARY KEY,
+        processed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_processed_messages_processed_at ON processed_messages(processed_at);"
+
+# Create processed messages table used to skip redelivered messages
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "transactions" -c "
+    CREATE TABLE IF NOT EXISTS processed_messages (
+        message_id TEXT PRIMARY KEY,
+        processed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_processed_messages_processed_at ON processed_messages(processed_at);"
@@ -0,0 +1,160 @@
+// Package admin serves the operational endpoints of a service: health, readiness, metrics and
+// profiling. They can be served on a listener of their own so that they are never reachable
+// through the public API.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"internal-transfers/pkg/metrics"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// checkTimeout bounds each readiness check
+const checkTimeout = 2 * time.Second
+
+// readHeaderTimeout bounds reading request headers on the admin listener. Responses get no write
+// timeout, since CPU profiles and traces are written once collected for the requested duration.
+const readHeaderTimeout = 10 * time.Second
+
+// ErrDisconnected is reported by a ConnectionCheck while the connection is down
+var ErrDisconnected = errors.New("disconnected")
+
+// Paths are the routes of the handler other than the profiling endpoints
+var Paths = []string{"/health", "/ready", "/metrics"}
+
+// Check reports whether a dependency of the service is usable
+type Check func(ctx context.Context) error
+
+// ConnectionCheck turns a function reporting whether a connection is open into a Check
+func ConnectionCheck(connected func() bool) Check {
+	return func(context.Context) error {
+		if !connected() {
+			return ErrDisconnected
+		}
+		return nil
+	}
+}
+
+// ReadinessResponse reports the result of each readiness check, "ok" or the error it failed with
+type ReadinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// namedCheck is a readiness check and the name it is reported under
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// route is an endpoint of the service served on the admin listener only
+type route struct {
+	pattern string
+	handler http.Handler
+}
+
+// handler serves the operational endpoints
+type handler struct {
+	mux       *http.ServeMux
+	checks    []namedCheck
+	profiling bool
+	routes    []route
+}
+
+// Option configures the handler
+type Option func(*handler)
+
+// WithCheck makes the service ready only while check succeeds, reporting it under name
+func WithCheck(name string, check Check) Option {
+	return func(h *handler) {
+		h.checks = append(h.checks, namedCheck{name: name, check: check})
+	}
+}
+
+// WithProfiling serves the net/http/pprof endpoints under /debug/pprof/
+func WithProfiling() Option {
+	return func(h *handler) {
+		h.profiling = true
+	}
+}
+
+// WithRoute serves handler for pattern, e.g. "GET /ledger", next to the operational endpoints.
+// Unlike Paths, such routes are internal to the system and never served on the API listener.
+func WithRoute(pattern string, routeHandler http.Handler) Option {
+	return func(h *handler) {
+		h.routes = append(h.routes, route{pattern: pattern, handler: routeHandler})
+	}
+}
+
+// NewHandler creates a handler serving /health, which answers 200 as long as the process runs,
+// /ready, which answers 503 while any check fails, /metrics, with WithProfiling, /debug/pprof/ and
+// the routes added with WithRoute
+func NewHandler(opts ...Option) http.Handler {
+	h := &handler{mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.mux.HandleFunc("GET /health", h.health)
+	h.mux.HandleFunc("GET /ready", h.ready)
+	h.mux.Handle("GET /metrics", metrics.Handler())
+	if h.profiling {
+		h.mux.HandleFunc("/debug/pprof/", pprof.Index)
+		h.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		h.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		h.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		h.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	for _, route := range h.routes {
+		h.mux.Handle(route.pattern, route.handler)
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// health answers as long as the process is able to serve requests
+func (h *handler) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// ready runs every check and answers 503 if any fails
+func (h *handler) ready(w http.ResponseWriter, r *http.Request) {
+	response := ReadinessResponse{Status: "ready", Checks: make(map[string]string, len(h.checks))}
+	status := http.StatusOK
+	for _, c := range h.checks {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		err := c.check(ctx)
+		cancel()
+		if err != nil {
+			response.Status = "unavailable"
+			response.Checks[c.name] = err.Error()
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		response.Checks[c.name] = "ok"
+	}
+	writeJSON(w, status, response)
+}
+
+// writeJSON encodes body as JSON with the given status code
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// NewServer creates the admin listener on port, serving handler
+func NewServer(port string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+}
@@ -0,0 +1,111 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	connected := true
+	h := NewHandler(
+		WithCheck("database", func(context.Context) error { return nil }),
+		WithCheck("broker", ConnectionCheck(func() bool { return connected })),
+	)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	for _, path := range []string{"/health", "/metrics"} {
+		if rec := get(path); rec.Code != http.StatusOK {
+			t.Errorf("GET %s answered %d, want %d", path, rec.Code, http.StatusOK)
+		}
+	}
+	if rec := get("/api/v1/accounts/1"); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /api/v1/accounts/1 answered %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	tests := []struct {
+		name      string
+		connected bool
+		status    int
+		want      ReadinessResponse
+	}{
+		{
+			name:      "ready",
+			connected: true,
+			status:    http.StatusOK,
+			want:      ReadinessResponse{Status: "ready", Checks: map[string]string{"database": "ok", "broker": "ok"}},
+		},
+		{
+			name:   "check failing",
+			status: http.StatusServiceUnavailable,
+			want:   ReadinessResponse{Status: "unavailable", Checks: map[string]string{"database": "ok", "broker": ErrDisconnected.Error()}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connected = tt.connected
+			rec := get("/ready")
+			if rec.Code != tt.status {
+				t.Errorf("GET /ready answered %d, want %d", rec.Code, tt.status)
+			}
+			var got ReadinessResponse
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode the readiness: %v", err)
+			}
+			if got.Status != tt.want.Status || len(got.Checks) != len(tt.want.Checks) {
+				t.Fatalf("readiness = %+v, want %+v", got, tt.want)
+			}
+			for name, want := range tt.want.Checks {
+				if got.Checks[name] != want {
+					t.Errorf("check %s = %q, want %q", name, got.Checks[name], want)
+				}
+			}
+		})
+	}
+
+	// Health only reports that the process runs, whatever its dependencies
+	if rec := get("/health"); rec.Code != http.StatusOK {
+		t.Errorf("GET /health answered %d while a check fails, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestConnectionCheck(t *testing.T) {
+	if err := ConnectionCheck(func() bool { return true })(context.Background()); err != nil {
+		t.Errorf("check of an open connection = %v, want nil", err)
+	}
+	if err := ConnectionCheck(func() bool { return false })(context.Background()); !errors.Is(err, ErrDisconnected) {
+		t.Errorf("check of a closed connection = %v, want %v", err, ErrDisconnected)
+	}
+}
+
+func TestProfiling(t *testing.T) {
+	paths := []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/symbol"}
+	tests := []struct {
+		name string
+		opts []Option
+		want int
+	}{
+		{name: "disabled", want: http.StatusNotFound},
+		{name: "enabled", opts: []Option{WithProfiling()}, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(tt.opts...)
+			for _, path := range paths {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				if rec.Code != tt.want {
+					t.Errorf("GET %s answered %d, want %d", path, rec.Code, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package eventsv1
+
+import _ "embed"
+
+// TransactionEventAvroSchema is the Avro schema of TransactionEvent, registered with the schema
+// registry when events are published in the Avro encoding
+//
+//go:embed transaction_event.avsc
+var TransactionEventAvroSchema string
@@ -0,0 +1,7 @@
+// Package api holds the protobuf definitions shared by the services: their gRPC APIs and the
+// protobuf encoding of the events they exchange. The Go code next to each .proto file is generated
+// with protoc-gen-go and protoc-gen-go-grpc; run go generate after changing them.
+package api
+
+//go:generate protoc -I . --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative account/v1/account.proto transaction/v1/transaction.proto
+//go:generate protoc -I . --go_out=. --go_opt=paths=source_relative events/v1/events.proto
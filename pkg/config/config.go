@@ -0,0 +1,340 @@
+// Package config loads and validates the settings shared by the services from environment variables.
+package config
+
+import (
+	"internal-transfers/pkg/correlation"
+	"internal-transfers/pkg/secrets"
+	"log/slog"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Defaults applied when the corresponding variable is not set
+const (
+	DefaultDBPort             = "5432"
+	DefaultDBSSLMode          = "require"
+	DefaultDBQueryTimeout     = 5 * time.Second
+	DefaultDBAcquireTimeout   = 2 * time.Second
+	DefaultRabbitMQPort       = "5672"
+	DefaultRabbitMQVHost      = "/"
+	DefaultReadTimeout        = 10 * time.Second
+	DefaultWriteTimeout       = 15 * time.Second
+	DefaultIdleTimeout        = 60 * time.Second
+	DefaultBasePath           = "/api/v1"
+	DefaultCORSAllowedMethods = "GET,POST,PUT,PATCH,DELETE,HEAD,OPTIONS"
+	DefaultCORSAllowedHeaders = "Content-Type"
+	DefaultLogLevel           = "info"
+	DefaultLogFormat          = "json"
+	DefaultSecretsBackend     = "env"
+	DefaultVaultSecretPath    = "secret/data/internal-transfers"
+	DefaultStateStore         = "memory"
+	DefaultRedisPort          = "6379"
+	DefaultRateLimitWindow    = time.Minute
+)
+
+// Config holds the settings common to all services
+type Config struct {
+	DB       DBConfig
+	RabbitMQ RabbitMQConfig
+	HTTP     HTTPConfig
+	Log      LogConfig
+}
+
+// DBConfig holds the database connection settings
+type DBConfig struct {
+	Host           string
+	Port           string
+	User           string
+	Password       string
+	Name           string
+	SSLMode        string
+	QueryTimeout   time.Duration
+	AcquireTimeout time.Duration
+	MaxConns       int
+	// ApplicationName is reported to PostgreSQL as application_name, shown in pg_stat_activity
+	ApplicationName string
+}
+
+// RabbitMQConfig holds the connection settings for a RabbitMQ broker
+type RabbitMQConfig struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	VHost    string
+	// ConnectionName is reported to RabbitMQ as connection_name, shown in the management UI
+	ConnectionName string
+}
+
+// HTTPConfig holds the settings of the HTTP server. The default timeouts cut off slow or
+// idle clients (slow-loris) while leaving ample room for normal API requests.
+type HTTPConfig struct {
+	Port         string
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// BasePath is the path the API routes are mounted under, without a trailing slash
+	BasePath string
+	CORS     CORSConfig
+	// AdminPort is the port of the admin listener serving health, readiness, metrics and
+	// profiling; when empty they are served by the API listener, without profiling
+	AdminPort string
+	// Profiling serves the pprof endpoints on the admin listener
+	Profiling bool
+}
+
+// CORSConfig holds the cross-origin settings of the API. CORS is disabled when no origins are allowed.
+type CORSConfig struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+}
+
+// SecretsConfig selects where the database and RabbitMQ credentials are read from
+type SecretsConfig struct {
+	// Backend is "env" to read credentials from the environment only, or "vault"
+	Backend    string
+	VaultAddr  string
+	VaultToken string
+	VaultPath  string
+}
+
+// StateConfig selects where the state the instances of a service must agree on, such as idempotency
+// keys and rate limit counts, is kept
+type StateConfig struct {
+	// Store is "memory" to keep the state of each instance to itself, or "redis" to share it
+	Store         string
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	// RateLimit is how many API requests a client may make per RateLimitWindow; zero disables the limit
+	RateLimit       int
+	RateLimitWindow time.Duration
+}
+
+// LogConfig holds the logging settings
+type LogConfig struct {
+	Level  slog.Level
+	Format string
+}
+
+// Load reads the common settings, using defaultPort for the HTTP server when SERVER_PORT is unset.
+// Problems are recorded on env; check env.Err once any service-specific settings have been read too.
+// Credentials are read from the secrets backend selected by LoadSecrets, if any.
+//
+// The database and RabbitMQ connections are named CONNECTION_NAME, by default the instance name
+// of service, so that they can be told apart in pg_stat_activity and the RabbitMQ management UI.
+func Load(env *Env, service, defaultPort string) Config {
+	if provider := LoadSecrets(env).Provider(); provider != nil {
+		env.UseCredentialProvider(provider)
+	}
+	cfg := Config{
+		DB:       LoadDB(env),
+		RabbitMQ: LoadRabbitMQ(env, "RABBITMQ"),
+		HTTP:     LoadHTTP(env, defaultPort),
+		Log:      LoadLog(env),
+	}
+	name := env.String("CONNECTION_NAME", InstanceName(service))
+	cfg.DB.ApplicationName = name
+	cfg.RabbitMQ.ConnectionName = name
+	return cfg
+}
+
+// InstanceName returns the service name followed by the host name, which identifies the replica
+// running in a container
+func InstanceName(service string) string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return service
+	}
+	return service + "-" + host
+}
+
+// LoadDB reads the DB_* settings. DB_HOST, DB_USER and DB_NAME are required; DB_QUERY_TIMEOUT
+// bounds each repository call, even when the caller's context has no deadline, and
+// DB_ACQUIRE_TIMEOUT bounds the part of it spent waiting for one of DB_MAX_CONNS connections.
+//
+// The user and password are read from the "db" secret when env uses a credential provider.
+func LoadDB(env *Env) DBConfig {
+	user, password := env.Credentials("db", "DB_USER", "DB_PASSWORD")
+	return DBConfig{
+		Host:           env.Required("DB_HOST"),
+		Port:           env.Port("DB_PORT", DefaultDBPort),
+		User:           user,
+		Password:       password,
+		Name:           env.Required("DB_NAME"),
+		SSLMode:        env.OneOf("DB_SSL_MODE", DefaultDBSSLMode, "disable", "require", "verify-ca", "verify-full"),
+		QueryTimeout:   env.Duration("DB_QUERY_TIMEOUT", DefaultDBQueryTimeout),
+		AcquireTimeout: env.Duration("DB_ACQUIRE_TIMEOUT", DefaultDBAcquireTimeout),
+		MaxConns:       env.Int("DB_MAX_CONNS", 0, 1, 1000),
+	}
+}
+
+// LoadRabbitMQ reads the broker settings with the given prefix, e.g. RABBITMQ_HOST for
+// prefix "RABBITMQ". The host and user are required. The user and password are read from the
+// secret named after the prefix, e.g. "rabbitmq", when env uses a credential provider.
+func LoadRabbitMQ(env *Env, prefix string) RabbitMQConfig {
+	user, password := env.Credentials(strings.ToLower(prefix), prefix+"_USER", prefix+"_PASSWORD")
+	return RabbitMQConfig{
+		Host:     env.Required(prefix + "_HOST"),
+		Port:     env.Port(prefix+"_PORT", DefaultRabbitMQPort),
+		User:     user,
+		Password: password,
+		VHost:    env.String(prefix+"_VHOST", DefaultRabbitMQVHost),
+	}
+}
+
+// LoadOptionalRabbitMQ reads the broker settings with the given prefix only when its host is set
+func LoadOptionalRabbitMQ(env *Env, prefix string) (RabbitMQConfig, bool) {
+	if env.lookup(prefix+"_HOST") == "" {
+		return RabbitMQConfig{}, false
+	}
+	return LoadRabbitMQ(env, prefix), true
+}
+
+// LoadHTTP reads SERVER_PORT, the HTTP_*_TIMEOUT durations, API_BASE_PATH, the CORS_ALLOWED_* lists,
+// ADMIN_PORT and PPROF
+func LoadHTTP(env *Env, defaultPort string) HTTPConfig {
+	cfg := HTTPConfig{
+		Port:         env.Port("SERVER_PORT", defaultPort),
+		ReadTimeout:  env.Duration("HTTP_READ_TIMEOUT", DefaultReadTimeout),
+		WriteTimeout: env.Duration("HTTP_WRITE_TIMEOUT", DefaultWriteTimeout),
+		IdleTimeout:  env.Duration("HTTP_IDLE_TIMEOUT", DefaultIdleTimeout),
+		BasePath:     env.Path("API_BASE_PATH", DefaultBasePath),
+		CORS: CORSConfig{
+			AllowedOrigins: env.List("CORS_ALLOWED_ORIGINS", ""),
+			AllowedMethods: env.List("CORS_ALLOWED_METHODS", DefaultCORSAllowedMethods),
+			AllowedHeaders: env.List("CORS_ALLOWED_HEADERS", DefaultCORSAllowedHeaders),
+		},
+		Profiling: env.OneOf("PPROF", "off", "off", "on") == "on",
+	}
+	if env.String("ADMIN_PORT", "") != "" {
+		cfg.AdminPort = env.Port("ADMIN_PORT", "")
+	}
+	if cfg.Profiling && cfg.AdminPort == "" {
+		env.addProblem("PPROF requires ADMIN_PORT, so profiling is never served on the API listener")
+	}
+	if cfg.AdminPort != "" && cfg.AdminPort == cfg.Port {
+		env.addProblem("ADMIN_PORT %q must differ from SERVER_PORT", cfg.AdminPort)
+	}
+	return cfg
+}
+
+// LoadSecrets reads SECRETS_BACKEND ("env" or "vault") and, for Vault, VAULT_ADDR, VAULT_TOKEN and
+// VAULT_SECRET_PATH, the path of a KV version 2 engine the secrets are stored below
+func LoadSecrets(env *Env) SecretsConfig {
+	cfg := SecretsConfig{Backend: env.OneOf("SECRETS_BACKEND", DefaultSecretsBackend, "env", "vault")}
+	if cfg.Backend == "vault" {
+		cfg.VaultAddr = env.Required("VAULT_ADDR")
+		cfg.VaultToken = env.Required("VAULT_TOKEN")
+		cfg.VaultPath = env.String("VAULT_SECRET_PATH", DefaultVaultSecretPath)
+	}
+	return cfg
+}
+
+// LoadState reads STATE_STORE ("memory" or "redis") and, for Redis, REDIS_HOST, REDIS_PORT,
+// REDIS_PASSWORD and REDIS_DB, as well as RATE_LIMIT and RATE_LIMIT_WINDOW
+func LoadState(env *Env) StateConfig {
+	cfg := StateConfig{
+		Store:           env.OneOf("STATE_STORE", DefaultStateStore, "memory", "redis"),
+		RateLimit:       env.Int("RATE_LIMIT", 0, 0, math.MaxInt),
+		RateLimitWindow: env.Duration("RATE_LIMIT_WINDOW", DefaultRateLimitWindow),
+	}
+	if cfg.Store == "redis" {
+		cfg.RedisAddr = net.JoinHostPort(env.Required("REDIS_HOST"), env.Port("REDIS_PORT", DefaultRedisPort))
+		cfg.RedisPassword = env.Secret("REDIS_PASSWORD")
+		cfg.RedisDB = env.Int("REDIS_DB", 0, 0, 15)
+	}
+	return cfg
+}
+
+// Shared reports whether the state is kept in Redis, shared by every instance
+func (c StateConfig) Shared() bool {
+	return c.Store == "redis"
+}
+
+// LoadLog reads LOG_LEVEL (debug, info, warn or error) and LOG_FORMAT (json or text)
+func LoadLog(env *Env) LogConfig {
+	cfg := LogConfig{Format: env.OneOf("LOG_FORMAT", DefaultLogFormat, "json", "text")}
+	level := env.OneOf("LOG_LEVEL", DefaultLogLevel, "debug", "info", "warn", "error")
+	if err := cfg.Level.UnmarshalText([]byte(level)); err != nil {
+		cfg.Level = slog.LevelInfo
+	}
+	return cfg
+}
+
+// ConnString builds the PostgreSQL connection URL, escaping credentials as needed
+func (c DBConfig) ConnString() string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(c.User, c.Password),
+		Host:   c.Host + ":" + c.Port,
+		Path:   "/" + c.Name,
+	}
+	query := url.Values{"sslmode": {c.SSLMode}}
+	if c.ApplicationName != "" {
+		query.Set("application_name", c.ApplicationName)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// URL builds the AMQP connection URL, escaping credentials and the vhost as needed
+func (c RabbitMQConfig) URL() string {
+	vhost := c.VHost
+	if vhost == "" {
+		vhost = DefaultRabbitMQVHost
+	}
+	u := url.URL{
+		Scheme:  "amqp",
+		User:    url.UserPassword(c.User, c.Password),
+		Host:    c.Host + ":" + c.Port,
+		Path:    "/" + vhost,
+		RawPath: "/" + url.PathEscape(vhost),
+	}
+	return u.String()
+}
+
+// Provider returns the credential provider of the backend, or nil when credentials are read from
+// the environment only
+func (c SecretsConfig) Provider() secrets.CredentialProvider {
+	if c.Backend != "vault" || c.VaultAddr == "" || c.VaultToken == "" {
+		return nil
+	}
+	return secrets.NewVaultProvider(c.VaultAddr, c.VaultToken, c.VaultPath)
+}
+
+// Addr returns the listen address of the HTTP server
+func (c HTTPConfig) Addr() string {
+	return ":" + c.Port
+}
+
+// Enabled reports whether any origin is allowed
+func (c CORSConfig) Enabled() bool {
+	return len(c.AllowedOrigins) > 0
+}
+
+// AllowsOrigin reports whether the given origin may access the API. An origin of "*" allows any origin.
+func (c CORSConfig) AllowsOrigin(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewLogger creates a structured logger writing to stdout with the configured level and format,
+// which logs the correlation ID of the context records are logged with
+func (c LogConfig) NewLogger() *slog.Logger {
+	opts := &slog.HandlerOptions{Level: c.Level}
+	var handler slog.Handler = slog.NewJSONHandler(os.Stdout, opts)
+	if c.Format == "text" {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+	return slog.New(correlation.NewHandler(handler))
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"internal-transfers/pkg/secrets"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error lists every missing or invalid setting found while loading the configuration
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Env reads typed settings from environment variables. Problems are collected rather
+// than returned one by one, so that Err can report all of them at once.
+type Env struct {
+	problems []string
+	// credentials is consulted by Credentials before the variables; see UseCredentialProvider
+	credentials secrets.CredentialProvider
+}
+
+// NewEnv creates an Env reading from the process environment
+func NewEnv() *Env {
+	return &Env{}
+}
+
+// Err returns an *Error listing all problems found so far, or nil if there were none
+func (e *Env) Err() error {
+	if len(e.problems) == 0 {
+		return nil
+	}
+	return &Error{Problems: slices.Clone(e.problems)}
+}
+
+// addProblem records a missing or invalid setting
+func (e *Env) addProblem(format string, args ...any) {
+	e.problems = append(e.problems, fmt.Sprintf(format, args...))
+}
+
+// lookup returns the trimmed value of the variable, or "" when it is unset
+func (e *Env) lookup(name string) string {
+	return strings.TrimSpace(os.Getenv(name))
+}
+
+// String returns the variable, falling back to def when it is unset
+func (e *Env) String(name, def string) string {
+	if value := e.lookup(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// Required returns the variable, recording a problem when it is unset
+func (e *Env) Required(name string) string {
+	value := e.lookup(name)
+	if value == "" {
+		e.addProblem("%s is required", name)
+	}
+	return value
+}
+
+// Secret returns the variable as is, without trimming, since passwords may contain spaces
+func (e *Env) Secret(name string) string {
+	return os.Getenv(name)
+}
+
+// UseCredentialProvider makes Credentials read from provider before falling back to the variables
+func (e *Env) UseCredentialProvider(provider secrets.CredentialProvider) {
+	e.credentials = provider
+}
+
+// Credentials returns the user and password stored under name by the credential provider, if any,
+// falling back to the userVar and passwordVar variables for whichever the provider does not hold.
+// The user is required; failing to reach the provider is recorded as a problem.
+func (e *Env) Credentials(name, userVar, passwordVar string) (user, password string) {
+	var creds secrets.Credentials
+	if e.credentials != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), secrets.DefaultTimeout)
+		defer cancel()
+		var err error
+		if creds, err = e.credentials.Credentials(ctx, name); err != nil && !errors.Is(err, secrets.ErrNotFound) {
+			e.addProblem("failed to read %s credentials: %v", name, err)
+		}
+	}
+
+	user, password = creds.User, creds.Password
+	if user == "" {
+		user = e.Required(userVar)
+	}
+	if password == "" {
+		password = e.Secret(passwordVar)
+	}
+	return user, password
+}
+
+// OneOf returns the variable, falling back to def when it is unset and recording a
+// problem when it is not one of the allowed values
+func (e *Env) OneOf(name, def string, allowed ...string) string {
+	value := e.String(name, def)
+	if !slices.Contains(allowed, value) {
+		e.addProblem("%s %q must be one of %s", name, value, strings.Join(allowed, ", "))
+		return def
+	}
+	return value
+}
+
+// Int returns the variable as an integer within [min, max], falling back to def when it is unset
+func (e *Env) Int(name string, def, min, max int) int {
+	value := e.lookup(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		if max == math.MaxInt {
+			e.addProblem("%s %q must be an integer of at least %d", name, value, min)
+		} else {
+			e.addProblem("%s %q must be an integer between %d and %d", name, value, min, max)
+		}
+		return def
+	}
+	return n
+}
+
+// Port returns the variable as a TCP port number, falling back to def when it is unset
+func (e *Env) Port(name, def string) string {
+	value := e.String(name, def)
+	if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+		e.addProblem("%s %q must be a port number between 1 and 65535", name, value)
+		return def
+	}
+	return value
+}
+
+// Duration returns the variable as a positive duration such as "30s", falling back to def when it is unset
+func (e *Env) Duration(name string, def time.Duration) time.Duration {
+	value := e.lookup(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		e.addProblem("%s %q must be a positive duration", name, value)
+		return def
+	}
+	return d
+}
+
+// DurationAtLeast works like Duration, but also refuses durations shorter than min
+func (e *Env) DurationAtLeast(name string, def, min time.Duration) time.Duration {
+	d := e.Duration(name, def)
+	if e.lookup(name) != "" && d < min {
+		e.addProblem("%s %q must be at least %s", name, e.lookup(name), min)
+		return def
+	}
+	return d
+}
+
+// Path returns the variable as a URL path below the root such as "/api/v2", without a trailing
+// slash, falling back to def when it is unset
+func (e *Env) Path(name, def string) string {
+	value := strings.TrimRight(e.String(name, def), "/")
+	if !strings.HasPrefix(value, "/") || strings.Contains(value, "//") || strings.ContainsAny(value, "?#{} \t") {
+		e.addProblem("%s %q must be a URL path such as %s", name, e.String(name, def), DefaultBasePath)
+		return def
+	}
+	return value
+}
+
+// List returns the variable as a comma-separated list, falling back to def when it is unset.
+// Empty items are dropped.
+func (e *Env) List(name, def string) []string {
+	var items []string
+	for _, item := range strings.Split(e.String(name, def), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
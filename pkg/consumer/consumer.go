@@ -0,0 +1,541 @@
+// Package consumer handles deliveries from a RabbitMQ queue with retries, a dead letter queue,
+// skipping of redelivered messages and pausing while a dependency is down.
+package consumer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"internal-transfers/pkg/correlation"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Defaults applied when the corresponding option is not used
+const (
+	DefaultMaxRetries          = 3
+	DefaultHealthCheckInterval = 5 * time.Second
+	DefaultPublishTimeout      = 5 * time.Second
+)
+
+// RetryCountHeader holds the number of times a message has been retried
+const RetryCountHeader = "x-retry-count"
+
+// Reasons reported to the MetricsRecorder
+const (
+	ReasonHandlerError     = "handler_error"
+	ReasonMaxRetries       = "max_retries"
+	ReasonMalformedMessage = "malformed_message"
+)
+
+var (
+	// ErrMalformed marks a handler error for a message that can never be handled;
+	// the message is moved to the dead letter queue without being retried
+	ErrMalformed = errors.New("malformed message")
+	// ErrUnavailable marks a handler error caused by a dependency outage; the message is
+	// requeued without counting as a retry
+	ErrUnavailable = errors.New("dependency unavailable")
+)
+
+// AckMode is the way deliveries are acknowledged
+type AckMode string
+
+const (
+	// AckManual acknowledges each delivery once it is handled, retrying or dead-lettering those
+	// that fail. This is the default.
+	AckManual AckMode = "manual"
+	// AckAuto has RabbitMQ consider deliveries acknowledged as soon as they are sent. Messages are
+	// neither deduplicated, retried nor dead-lettered, and consumption is never paused: a message
+	// whose handler fails, or that is in flight when the consumer stops, is lost.
+	AckAuto AckMode = "auto"
+)
+
+// Handler handles a single delivery. Returning nil acknowledges the delivery; errors are
+// retried unless they wrap ErrMalformed or ErrUnavailable.
+type Handler func(ctx context.Context, msg amqp.Delivery) error
+
+// Channel is the subset of *amqp.Channel used by the consumer
+type Channel interface {
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Cancel(consumer string, noWait bool) error
+}
+
+// ProcessedMessageStore remembers which messages have already been handled, so that
+// redelivered messages are skipped regardless of their content
+type ProcessedMessageStore interface {
+	// IsProcessed reports whether the message ID has been recorded
+	IsProcessed(ctx context.Context, messageID string) (bool, error)
+	// MarkProcessed records the message ID once its handler succeeded and reports whether it was
+	// newly recorded. It returns false when the handler already recorded it, see MessageID.
+	MarkProcessed(ctx context.Context, messageID string) (bool, error)
+}
+
+// MetricsRecorder records how old consumed messages are, how often they were retried and those
+// that could not be handled
+type MetricsRecorder interface {
+	// MessageAge records the time between the publishing of a message and the start of its handling
+	MessageAge(queue string, age time.Duration)
+	// MessageRetryCount records how many times a message had been retried when its handling started
+	MessageRetryCount(queue string, retryCount int)
+	// MessageRetried records a message that will be delivered again
+	MessageRetried(reason string)
+	// MessageDeadLettered records a message that was moved to the dead letter queue
+	MessageDeadLettered(reason string)
+}
+
+// HealthChecker reports whether a dependency needed to handle messages, such as the database, is available
+type HealthChecker interface {
+	Ping(ctx context.Context) error
+}
+
+// Consumer consumes queues on a channel
+type Consumer struct {
+	channel   Channel
+	processed ProcessedMessageStore
+	metrics   MetricsRecorder
+	// health pauses consumption while a dependency is down; see WithHealthCheck
+	health         HealthChecker
+	healthInterval time.Duration
+	publishTimeout time.Duration
+	maxRetries     int
+	workers        int
+	// tag identifies the consumer to RabbitMQ, e.g. in the management UI; see WithTag
+	tag string
+	// ackMode is how deliveries are acknowledged; see WithAckMode
+	ackMode AckMode
+}
+
+// Option configures a Consumer
+type Option func(*Consumer)
+
+// WithProcessedMessageStore enables skipping of redelivered messages using the given store
+func WithProcessedMessageStore(store ProcessedMessageStore) Option {
+	return func(c *Consumer) {
+		c.processed = store
+	}
+}
+
+// WithMetrics reports retried and dead-lettered messages to the given recorder
+func WithMetrics(recorder MetricsRecorder) Option {
+	return func(c *Consumer) {
+		if recorder != nil {
+			c.metrics = recorder
+		}
+	}
+}
+
+// WithHealthCheck pauses consumption while checker fails and resumes once it succeeds again,
+// probing it every interval. Messages stay queued during an outage instead of using up their retries.
+func WithHealthCheck(checker HealthChecker, interval time.Duration) Option {
+	return func(c *Consumer) {
+		c.health = checker
+		if interval > 0 {
+			c.healthInterval = interval
+		}
+	}
+}
+
+// WithPublishTimeout sets how long republishing a message for another attempt may take
+func WithPublishTimeout(timeout time.Duration) Option {
+	return func(c *Consumer) {
+		if timeout > 0 {
+			c.publishTimeout = timeout
+		}
+	}
+}
+
+// WithMaxRetries sets how many times a failed message is retried before it is dead-lettered
+func WithMaxRetries(retries int) Option {
+	return func(c *Consumer) {
+		if retries >= 0 {
+			c.maxRetries = retries
+		}
+	}
+}
+
+// WithWorkers sets how many deliveries of a queue are handled in parallel
+func WithWorkers(workers int) Option {
+	return func(c *Consumer) {
+		if workers > 0 {
+			c.workers = workers
+		}
+	}
+}
+
+// WithTag sets the consumer tag registered with RabbitMQ, so the consumer can be identified in
+// the management UI and in logs. Tags must be unique per channel; by default a random tag
+// prefixed with the queue name is used.
+func WithTag(tag string) Option {
+	return func(c *Consumer) {
+		c.tag = tag
+	}
+}
+
+// WithAckMode sets how deliveries are acknowledged. AckAuto trades the delivery guarantees of the
+// default AckManual for throughput, e.g. for load tests or consumers that may lose messages.
+func WithAckMode(mode AckMode) Option {
+	return func(c *Consumer) {
+		if mode == AckManual || mode == AckAuto {
+			c.ackMode = mode
+		}
+	}
+}
+
+// New creates a consumer on the given channel
+func New(ch Channel, opts ...Option) *Consumer {
+	c := &Consumer{
+		channel:        ch,
+		metrics:        noopMetrics{},
+		healthInterval: DefaultHealthCheckInterval,
+		publishTimeout: DefaultPublishTimeout,
+		maxRetries:     DefaultMaxRetries,
+		workers:        1,
+		ackMode:        AckManual,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Start registers a consumer on the queue and hands its deliveries to handler in the background
+// until ctx is done or the channel is closed. Deliveries that are not handled by the time ctx is
+// done are requeued for the next consumer. The queue should dead-letter rejected messages.
+func (c *Consumer) Start(ctx context.Context, queue string, handler Handler) error {
+	sub, msgs, err := c.subscribe(queue)
+	if err != nil {
+		return err
+	}
+
+	go c.run(ctx, sub, msgs, handler)
+	return nil
+}
+
+// subscription is a single consumer registration on a queue; it is cancelled to pause consumption
+type subscription struct {
+	queue  string
+	tag    string
+	paused atomic.Bool
+	once   sync.Once
+}
+
+// subscribe registers a new consumer on the queue
+func (c *Consumer) subscribe(queue string) (*subscription, <-chan amqp.Delivery, error) {
+	tag := c.tag
+	if tag == "" {
+		tag = queue + "-" + newTag()
+	}
+	sub := &subscription{queue: queue, tag: tag}
+	msgs, err := c.channel.Consume(
+		queue,                // queue
+		sub.tag,              // consumer
+		c.ackMode == AckAuto, // auto-ack
+		false,                // exclusive
+		false,                // no-local
+		false,                // no-wait
+		nil,                  // args
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to register consumer: %w", err)
+	}
+	return sub, msgs, nil
+}
+
+// run hands deliveries to the workers until the subscription ends. A paused subscription
+// is renewed once the dependency has recovered; otherwise run returns.
+func (c *Consumer) run(ctx context.Context, sub *subscription, msgs <-chan amqp.Delivery, handler Handler) {
+	for {
+		// Cancelling the subscription closes msgs once the deliveries in flight are settled
+		done := make(chan struct{})
+		go func(tag string) {
+			select {
+			case <-ctx.Done():
+				c.channel.Cancel(tag, false)
+			case <-done:
+			}
+		}(sub.tag)
+
+		var wg sync.WaitGroup
+		for i := 0; i < c.workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for msg := range msgs {
+					c.handle(ctx, sub, msg, handler)
+				}
+			}()
+		}
+		wg.Wait()
+		close(done)
+
+		if ctx.Err() != nil || !sub.paused.Load() || !c.waitUntilHealthy(ctx) {
+			return
+		}
+
+		queue := sub.queue
+		var err error
+		if sub, msgs, err = c.subscribe(queue); err != nil {
+			fmt.Printf("Failed to resume consumer on %s: %v\n", queue, err)
+			return
+		}
+		fmt.Printf("Dependency available again, resumed consumer %s\n", sub.tag)
+	}
+}
+
+// handle settles a single delivery. The handler's context carries the correlation ID of the
+// message, so what it logs and publishes is tied to the request that caused the message.
+func (c *Consumer) handle(ctx context.Context, sub *subscription, msg amqp.Delivery, handler Handler) {
+	ctx = correlation.WithID(ctx, msg.CorrelationId)
+	if c.ackMode == AckAuto {
+		c.handleAcked(ctx, sub, msg, handler)
+		return
+	}
+
+	// Leave deliveries queued while consumption is paused or stopping
+	if sub.paused.Load() || ctx.Err() != nil {
+		msg.Nack(false, true)
+		return
+	}
+
+	// Publishers set the timestamp, which retries keep, so the age includes earlier attempts
+	if !msg.Timestamp.IsZero() {
+		c.metrics.MessageAge(sub.queue, max(time.Since(msg.Timestamp), 0))
+	}
+
+	retryCount := retryCount(msg)
+	c.metrics.MessageRetryCount(sub.queue, retryCount)
+	if retryCount >= c.maxRetries {
+		fmt.Printf("Max retries reached for message %s on %s, moving to DLQ\n", msg.MessageId, sub.tag)
+		msg.Nack(false, false) // Move to DLQ
+		c.metrics.MessageDeadLettered(ReasonMaxRetries)
+		return
+	}
+
+	// Skip messages that have already been processed
+	processed, err := c.isProcessed(ctx, msg)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		msg.Nack(false, true) // Requeue until the store is available again
+		c.pauseIfUnhealthy(ctx, sub)
+		return
+	}
+	if processed {
+		fmt.Printf("Skipping already processed message %s on %s\n", msg.MessageId, sub.tag)
+		msg.Ack(false)
+		return
+	}
+
+	// The message is only recorded once handled, so one whose handling is cut short by a crash
+	// is handled again when redelivered
+	err = handler(c.withMessageID(ctx, msg), msg)
+	if err == nil {
+		c.markProcessed(ctx, msg)
+		msg.Ack(false) // Acknowledge successful processing
+		return
+	}
+
+	fmt.Printf("Failed to handle message %s on %s (retry %d/%d): %v\n", msg.MessageId, sub.tag, retryCount, c.maxRetries, err)
+
+	switch {
+	case ctx.Err() != nil:
+		msg.Nack(false, true) // Shutting down; leave the message for the next consumer
+	case errors.Is(err, ErrMalformed):
+		msg.Nack(false, false) // Reject without requeue
+		c.metrics.MessageDeadLettered(ReasonMalformedMessage)
+	case errors.Is(err, ErrUnavailable), c.pauseIfUnhealthy(ctx, sub):
+		// Failures caused by an outage do not count as a retry
+		msg.Nack(false, true)
+	default:
+		c.retry(ctx, sub, msg, retryCount+1)
+	}
+}
+
+// handleAcked hands a delivery RabbitMQ already considers acknowledged to the handler. It cannot
+// be settled again, so a failure only gets logged.
+func (c *Consumer) handleAcked(ctx context.Context, sub *subscription, msg amqp.Delivery, handler Handler) {
+	if !msg.Timestamp.IsZero() {
+		c.metrics.MessageAge(sub.queue, max(time.Since(msg.Timestamp), 0))
+	}
+
+	if err := handler(ctx, msg); err != nil {
+		fmt.Printf("Failed to handle message %s on %s, dropping it: %v\n", msg.MessageId, sub.tag, err)
+	}
+}
+
+// retry publishes the message straight back to its queue with the given retry count and
+// acknowledges the original, or dead-letters it once the retries are used up
+func (c *Consumer) retry(ctx context.Context, sub *subscription, msg amqp.Delivery, retryCount int) {
+	if retryCount >= c.maxRetries {
+		fmt.Printf("Max retries reached for message %s on %s, moving to DLQ\n", msg.MessageId, sub.tag)
+		msg.Nack(false, false) // Move to DLQ
+		c.metrics.MessageDeadLettered(ReasonMaxRetries)
+		return
+	}
+
+	headers := make(amqp.Table, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[RetryCountHeader] = int32(retryCount)
+
+	publishCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.publishTimeout)
+	defer cancel()
+	err := c.channel.PublishWithContext(publishCtx,
+		"",        // default exchange, so only this queue receives the retry
+		sub.queue, // routing key
+		false,     // mandatory
+		false,     // immediate
+		amqp.Publishing{
+			ContentType:   msg.ContentType,
+			MessageId:     msg.MessageId,
+			CorrelationId: msg.CorrelationId,
+			Timestamp:     msg.Timestamp,
+			DeliveryMode:  msg.DeliveryMode,
+			Body:          msg.Body,
+			Headers:       headers,
+		},
+	)
+	if err != nil {
+		fmt.Printf("Failed to republish message %s on %s: %v\n", msg.MessageId, sub.tag, err)
+		msg.Nack(false, true) // Requeue rather than lose the message
+		return
+	}
+
+	fmt.Printf("Retrying message %s on %s (attempt %d/%d)\n", msg.MessageId, sub.tag, retryCount, c.maxRetries)
+	c.metrics.MessageRetried(ReasonHandlerError)
+	msg.Ack(false) // Acknowledge the original message
+}
+
+// retryCount reads the retry count header, which may have been encoded with any integer width
+func retryCount(msg amqp.Delivery) int {
+	switch v := msg.Headers[RetryCountHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	case int16:
+		return int(v)
+	case int8:
+		return int(v)
+	}
+	return 0
+}
+
+// isProcessed reports whether the delivery has already been processed. An error means the store
+// is unavailable.
+func (c *Consumer) isProcessed(ctx context.Context, msg amqp.Delivery) (bool, error) {
+	if c.processed == nil || msg.MessageId == "" {
+		return false, nil
+	}
+
+	processed, err := c.processed.IsProcessed(ctx, msg.MessageId)
+	if err != nil {
+		return false, fmt.Errorf("failed to check whether message %s was processed: %w", msg.MessageId, err)
+	}
+	return processed, nil
+}
+
+// markProcessed records a delivery whose handler succeeded, unless the handler already did. A
+// failure is only logged: the message has been handled and is acknowledged regardless.
+func (c *Consumer) markProcessed(ctx context.Context, msg amqp.Delivery) {
+	if c.processed == nil || msg.MessageId == "" {
+		return
+	}
+
+	// Record the message even when ctx is done, or its redelivery would be handled again
+	if _, err := c.processed.MarkProcessed(context.WithoutCancel(ctx), msg.MessageId); err != nil {
+		fmt.Printf("Failed to record message %s as processed: %v\n", msg.MessageId, err)
+	}
+}
+
+// messageIDKey is the context key of the ID of the message being handled
+type messageIDKey struct{}
+
+// withMessageID returns ctx carrying the ID of the delivery when processed messages are recorded
+func (c *Consumer) withMessageID(ctx context.Context, msg amqp.Delivery) context.Context {
+	if c.processed == nil || msg.MessageId == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, messageIDKey{}, msg.MessageId)
+}
+
+// MessageID returns the ID of the message ctx was handed to a handler for, or an empty string if
+// the consumer does not record processed messages. A handler that applies the message in a single
+// database transaction records the ID in that transaction too, so that a crash after the commit
+// cannot have the message applied again; the consumer's own record then finds it present.
+func MessageID(ctx context.Context) string {
+	id, _ := ctx.Value(messageIDKey{}).(string)
+	return id
+}
+
+// pauseIfUnhealthy cancels the subscription if the health check fails and reports whether
+// the subscription is paused. Deliveries already received should then be requeued.
+func (c *Consumer) pauseIfUnhealthy(ctx context.Context, sub *subscription) bool {
+	if c.health == nil {
+		return false
+	}
+	if sub.paused.Load() {
+		return true
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, c.healthInterval)
+	defer cancel()
+	err := c.health.Ping(pingCtx)
+	if err == nil {
+		return false
+	}
+
+	sub.once.Do(func() {
+		sub.paused.Store(true)
+		fmt.Printf("Dependency unavailable, pausing consumer %s: %v\n", sub.tag, err)
+		if err := c.channel.Cancel(sub.tag, false); err != nil {
+			fmt.Printf("Failed to cancel consumer %s: %v\n", sub.tag, err)
+		}
+	})
+	return true
+}
+
+// waitUntilHealthy blocks until the health check succeeds, returning false if ctx is done first
+func (c *Consumer) waitUntilHealthy(ctx context.Context) bool {
+	ticker := time.NewTicker(c.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			pingCtx, cancel := context.WithTimeout(ctx, c.healthInterval)
+			err := c.health.Ping(pingCtx)
+			cancel()
+			if err == nil {
+				return true
+			}
+		}
+	}
+}
+
+// newTag generates a unique suffix for a consumer tag
+func newTag() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic("failed to generate consumer tag: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// noopMetrics discards all measurements; it is used when no recorder is configured
+type noopMetrics struct{}
+
+func (noopMetrics) MessageAge(string, time.Duration) {}
+func (noopMetrics) MessageRetryCount(string, int)    {}
+func (noopMetrics) MessageRetried(string)            {}
+func (noopMetrics) MessageDeadLettered(string)       {}
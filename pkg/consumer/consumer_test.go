@@ -0,0 +1,429 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// settlement is how a delivery was settled
+type settlement struct {
+	tag     uint64
+	ack     bool
+	requeue bool
+}
+
+// fakeChannel records the messages published on it and settles deliveries handed out by delivery
+type fakeChannel struct {
+	mu          sync.Mutex
+	published   []amqp.Publishing
+	settlements []settlement
+	// autoAck is whether the last consumer was registered with auto-ack
+	autoAck bool
+}
+
+func (c *fakeChannel) PublishWithContext(_ context.Context, _, _ string, _, _ bool, msg amqp.Publishing) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, msg)
+	return nil
+}
+
+func (c *fakeChannel) Consume(_, _ string, autoAck, _, _, _ bool, _ amqp.Table) (<-chan amqp.Delivery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.autoAck = autoAck
+	return make(chan amqp.Delivery), nil
+}
+
+func (c *fakeChannel) Cancel(string, bool) error { return nil }
+
+func (c *fakeChannel) Ack(tag uint64, _ bool) error {
+	c.settle(settlement{tag: tag, ack: true})
+	return nil
+}
+
+func (c *fakeChannel) Nack(tag uint64, _ bool, requeue bool) error {
+	c.settle(settlement{tag: tag, requeue: requeue})
+	return nil
+}
+
+func (c *fakeChannel) Reject(tag uint64, requeue bool) error {
+	c.settle(settlement{tag: tag, requeue: requeue})
+	return nil
+}
+
+func (c *fakeChannel) settle(s settlement) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.settlements = append(c.settlements, s)
+}
+
+// delivery returns a delivery of the message settled through the channel
+func (c *fakeChannel) delivery(tag uint64, msg amqp.Publishing) amqp.Delivery {
+	return amqp.Delivery{
+		Acknowledger: c,
+		DeliveryTag:  tag,
+		MessageId:    msg.MessageId,
+		Timestamp:    msg.Timestamp,
+		Headers:      msg.Headers,
+		Body:         msg.Body,
+	}
+}
+
+// memoryStore keeps processed message IDs in memory
+type memoryStore struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+func newMemoryStore(ids ...string) *memoryStore {
+	s := &memoryStore{ids: make(map[string]bool)}
+	for _, id := range ids {
+		s.ids[id] = true
+	}
+	return s
+}
+
+func (s *memoryStore) IsProcessed(_ context.Context, messageID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ids[messageID], nil
+}
+
+func (s *memoryStore) MarkProcessed(_ context.Context, messageID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	first := !s.ids[messageID]
+	s.ids[messageID] = true
+	return first, nil
+}
+
+// testSubscription is the subscription deliveries are handled on
+func testSubscription() *subscription {
+	return &subscription{queue: "test_events", tag: "test_events-test"}
+}
+
+func TestHandleRecordsMessageOnceHandled(t *testing.T) {
+	ch := &fakeChannel{}
+	store := newMemoryStore()
+	c := New(ch, WithProcessedMessageStore(store))
+
+	var seen []string
+	handler := func(ctx context.Context, msg amqp.Delivery) error {
+		seen = append(seen, MessageID(ctx))
+		if processed, _ := store.IsProcessed(ctx, msg.MessageId); processed {
+			t.Error("message recorded as processed before its handler returned")
+		}
+		if len(seen) == 1 {
+			return errors.New("handler failed")
+		}
+		return nil
+	}
+
+	// The failed attempt is retried rather than recorded
+	c.handle(context.Background(), testSubscription(), ch.delivery(1, amqp.Publishing{MessageId: "msg-1"}), handler)
+	if processed, _ := store.IsProcessed(context.Background(), "msg-1"); processed {
+		t.Fatal("failed message recorded as processed")
+	}
+	if len(ch.published) != 1 {
+		t.Fatalf("published %d retries, want 1", len(ch.published))
+	}
+
+	c.handle(context.Background(), testSubscription(), ch.delivery(2, ch.published[0]), handler)
+	if processed, _ := store.IsProcessed(context.Background(), "msg-1"); !processed {
+		t.Error("handled message not recorded as processed")
+	}
+	for i, id := range seen {
+		if id != "msg-1" {
+			t.Errorf("attempt %d: handler context carries message ID %q, want %q", i+1, id, "msg-1")
+		}
+	}
+	if want := (settlement{tag: 2, ack: true}); ch.settlements[len(ch.settlements)-1] != want {
+		t.Errorf("retry settled as %+v, want %+v", ch.settlements[len(ch.settlements)-1], want)
+	}
+}
+
+func TestHandleSkipsProcessedMessage(t *testing.T) {
+	ch := &fakeChannel{}
+	c := New(ch, WithProcessedMessageStore(newMemoryStore("msg-1")))
+
+	c.handle(context.Background(), testSubscription(), ch.delivery(1, amqp.Publishing{MessageId: "msg-1"}), func(context.Context, amqp.Delivery) error {
+		t.Error("processed message handed to the handler")
+		return nil
+	})
+
+	if want := []settlement{{tag: 1, ack: true}}; len(ch.settlements) != 1 || ch.settlements[0] != want[0] {
+		t.Errorf("settlements = %+v, want %+v", ch.settlements, want)
+	}
+}
+
+func TestMessageIDWithoutStore(t *testing.T) {
+	ch := &fakeChannel{}
+	c := New(ch)
+
+	c.handle(context.Background(), testSubscription(), ch.delivery(1, amqp.Publishing{MessageId: "msg-1"}), func(ctx context.Context, _ amqp.Delivery) error {
+		if id := MessageID(ctx); id != "" {
+			t.Errorf("MessageID() = %q without a store, want none", id)
+		}
+		return nil
+	})
+}
+
+func TestHandleRetriesFailedMessage(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryCount any
+		want       int32
+	}{
+		{name: "first attempt", want: 1},
+		{name: "int32 header", retryCount: int32(1), want: 2},
+		{name: "int64 header", retryCount: int64(1), want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &fakeChannel{}
+			c := New(ch, WithMaxRetries(3))
+
+			headers := amqp.Table{"x-custom": "kept"}
+			if tt.retryCount != nil {
+				headers[RetryCountHeader] = tt.retryCount
+			}
+			msg := amqp.Publishing{MessageId: "msg-1", Headers: headers, Body: []byte("body")}
+			c.handle(context.Background(), testSubscription(), ch.delivery(1, msg), func(context.Context, amqp.Delivery) error {
+				return errors.New("handler failed")
+			})
+
+			if len(ch.published) != 1 {
+				t.Fatalf("published %d retries, want 1", len(ch.published))
+			}
+			retry := ch.published[0]
+			if got := retry.Headers[RetryCountHeader]; got != tt.want {
+				t.Errorf("retry has %s = %v (%T), want %d", RetryCountHeader, got, got, tt.want)
+			}
+			if retry.Headers["x-custom"] != "kept" || retry.MessageId != "msg-1" || string(retry.Body) != "body" {
+				t.Errorf("retry = %+v, want the original message", retry)
+			}
+			if tt.retryCount == nil && headers[RetryCountHeader] != nil {
+				t.Error("retry changed the headers of the original delivery")
+			}
+			if want := (settlement{tag: 1, ack: true}); len(ch.settlements) != 1 || ch.settlements[0] != want {
+				t.Errorf("settlements = %+v, want the original acknowledged", ch.settlements)
+			}
+		})
+	}
+}
+
+func TestHandleSettlesFailedMessage(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryCount int32
+		err        error
+		handled    bool
+		want       settlement
+	}{
+		{name: "last retry fails", retryCount: 2, err: errors.New("handler failed"), handled: true, want: settlement{tag: 1}},
+		{name: "retries used up", retryCount: 3, want: settlement{tag: 1}},
+		{name: "malformed message", err: ErrMalformed, handled: true, want: settlement{tag: 1}},
+		{name: "dependency unavailable", err: ErrUnavailable, handled: true, want: settlement{tag: 1, requeue: true}},
+		{name: "handled", retryCount: 2, handled: true, want: settlement{tag: 1, ack: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &fakeChannel{}
+			c := New(ch, WithMaxRetries(3))
+
+			handled := false
+			msg := amqp.Publishing{MessageId: "msg-1", Headers: amqp.Table{RetryCountHeader: tt.retryCount}}
+			c.handle(context.Background(), testSubscription(), ch.delivery(1, msg), func(context.Context, amqp.Delivery) error {
+				handled = true
+				return tt.err
+			})
+
+			if handled != tt.handled {
+				t.Errorf("handled = %v, want %v", handled, tt.handled)
+			}
+			if len(ch.published) != 0 {
+				t.Errorf("published %d retries, want none", len(ch.published))
+			}
+			if len(ch.settlements) != 1 || ch.settlements[0] != tt.want {
+				t.Errorf("settlements = %+v, want %+v", ch.settlements, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleAckedNeverSettles(t *testing.T) {
+	for _, err := range []error{nil, errors.New("handler failed"), ErrMalformed, ErrUnavailable} {
+		ch := &fakeChannel{}
+		c := New(ch, WithAckMode(AckAuto), WithProcessedMessageStore(newMemoryStore()))
+
+		handled := false
+		c.handle(context.Background(), testSubscription(), ch.delivery(1, amqp.Publishing{MessageId: "msg-1"}), func(context.Context, amqp.Delivery) error {
+			handled = true
+			return err
+		})
+
+		// RabbitMQ already considers the delivery acknowledged; settling it again would close the channel
+		if !handled {
+			t.Errorf("handler error %v: message not handled", err)
+		}
+		if len(ch.settlements) != 0 || len(ch.published) != 0 {
+			t.Errorf("handler error %v: settlements = %+v and %d retries, want none", err, ch.settlements, len(ch.published))
+		}
+	}
+}
+
+func TestAckMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        AckMode
+		wantAutoAck bool
+		wantRetried int
+		wantHandled bool
+	}{
+		{name: "manual", mode: AckManual, wantRetried: 1},
+		{name: "default", wantRetried: 1},
+		{name: "unknown", mode: "eventually", wantRetried: 1},
+		// Auto-acked deliveries skip deduplication and are never retried
+		{name: "auto", mode: AckAuto, wantAutoAck: true, wantHandled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &fakeChannel{}
+			recorder := &recordingMetrics{}
+			opts := []Option{WithMetrics(recorder), WithProcessedMessageStore(newMemoryStore("msg-1"))}
+			if tt.mode != "" {
+				opts = append(opts, WithAckMode(tt.mode))
+			}
+			c := New(ch, opts...)
+
+			if _, _, err := c.subscribe("test_events"); err != nil {
+				t.Fatalf("subscribe() error = %v", err)
+			}
+			if ch.autoAck != tt.wantAutoAck {
+				t.Errorf("consumer registered with auto-ack %t, want %t", ch.autoAck, tt.wantAutoAck)
+			}
+
+			failing := func(context.Context, amqp.Delivery) error {
+				return errors.New("handler failed")
+			}
+			handled := false
+			c.handle(context.Background(), testSubscription(), ch.delivery(1, amqp.Publishing{MessageId: "msg-1"}), func(ctx context.Context, msg amqp.Delivery) error {
+				handled = true
+				return failing(ctx, msg)
+			})
+			if handled != tt.wantHandled {
+				t.Errorf("already processed message handled: %t, want %t", handled, tt.wantHandled)
+			}
+
+			c.handle(context.Background(), testSubscription(), ch.delivery(2, amqp.Publishing{MessageId: "msg-2"}), failing)
+			if len(recorder.retried) != tt.wantRetried || len(ch.published) != tt.wantRetried {
+				t.Errorf("recorded %v retries and republished %d messages, want %d", recorder.retried, len(ch.published), tt.wantRetried)
+			}
+			if tt.mode == AckAuto && (len(recorder.retryCounts) != 0 || len(ch.settlements) != 0) {
+				t.Errorf("recorded retry counts %v and settlements %+v, want none", recorder.retryCounts, ch.settlements)
+			}
+			if len(recorder.deadLettered) != 0 {
+				t.Errorf("dead-lettered %v, want none", recorder.deadLettered)
+			}
+		})
+	}
+}
+
+// recordingMetrics records what the consumer reports
+type recordingMetrics struct {
+	ages         []time.Duration
+	retryCounts  []int
+	retried      []string
+	deadLettered []string
+}
+
+func (m *recordingMetrics) MessageAge(_ string, age time.Duration) {
+	m.ages = append(m.ages, age)
+}
+
+func (m *recordingMetrics) MessageRetryCount(_ string, retryCount int) {
+	m.retryCounts = append(m.retryCounts, retryCount)
+}
+
+func (m *recordingMetrics) MessageRetried(reason string) {
+	m.retried = append(m.retried, reason)
+}
+
+func (m *recordingMetrics) MessageDeadLettered(reason string) {
+	m.deadLettered = append(m.deadLettered, reason)
+}
+
+func TestHandleRecordsMessageAge(t *testing.T) {
+	ch := &fakeChannel{}
+	recorder := &recordingMetrics{}
+	c := New(ch, WithMetrics(recorder))
+
+	attempts := 0
+	handler := func(context.Context, amqp.Delivery) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("handler failed")
+		}
+		return nil
+	}
+
+	// A message published 3 seconds ago fails once; its retry keeps the original timestamp
+	published := time.Now().Add(-3 * time.Second)
+	c.handle(context.Background(), testSubscription(), ch.delivery(1, amqp.Publishing{MessageId: "msg-1", Timestamp: published}), handler)
+	if len(ch.published) != 1 || !ch.published[0].Timestamp.Equal(published) {
+		t.Fatalf("retries = %+v, want one with timestamp %v", ch.published, published)
+	}
+	c.handle(context.Background(), testSubscription(), ch.delivery(2, ch.published[0]), handler)
+
+	if len(recorder.ages) != 2 {
+		t.Fatalf("recorded %d ages, want one per attempt", len(recorder.ages))
+	}
+	for i, age := range recorder.ages {
+		if age < 3*time.Second || age > 10*time.Second {
+			t.Errorf("attempt %d: recorded age = %s, want about 3s", i+1, age)
+		}
+	}
+
+	// Messages without a timestamp have no known age
+	c.handle(context.Background(), testSubscription(), ch.delivery(3, amqp.Publishing{MessageId: "msg-2"}), handler)
+	if len(recorder.ages) != 2 {
+		t.Errorf("recorded an age of %s for a message without a timestamp", recorder.ages[len(recorder.ages)-1])
+	}
+}
+
+func TestHandleRecordsRetryCount(t *testing.T) {
+	ch := &fakeChannel{}
+	recorder := &recordingMetrics{}
+	c := New(ch, WithMetrics(recorder), WithMaxRetries(3))
+	failing := func(context.Context, amqp.Delivery) error {
+		return errors.New("handler failed")
+	}
+
+	// The message and each of its retries fail until the retries are used up
+	c.handle(context.Background(), testSubscription(), ch.delivery(1, amqp.Publishing{MessageId: "msg-1"}), failing)
+	for tag := uint64(2); len(ch.published) > 0; tag++ {
+		retry := ch.published[0]
+		ch.published = ch.published[1:]
+		c.handle(context.Background(), testSubscription(), ch.delivery(tag, retry), failing)
+	}
+
+	if want := []int{0, 1, 2}; !slices.Equal(recorder.retryCounts, want) {
+		t.Errorf("recorded retry counts %v, want %v", recorder.retryCounts, want)
+	}
+	if want := []string{ReasonHandlerError, ReasonHandlerError}; !slices.Equal(recorder.retried, want) {
+		t.Errorf("recorded retries %v, want %v", recorder.retried, want)
+	}
+	if want := []string{ReasonMaxRetries}; !slices.Equal(recorder.deadLettered, want) {
+		t.Errorf("recorded dead letters %v, want %v", recorder.deadLettered, want)
+	}
+}
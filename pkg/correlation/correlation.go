@@ -0,0 +1,99 @@
+// Package correlation carries the ID of the request that started a unit of work, so the logs it
+// produces in both services and the events it publishes can be tied back to that request.
+package correlation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+// Header is the HTTP header the correlation ID is read from and returned in
+const Header = "X-Request-ID"
+
+// LogKey is the attribute the correlation ID is logged under
+const LogKey = "correlation_id"
+
+// maxIDLength is the longest correlation ID accepted from a client
+const maxIDLength = 128
+
+// contextKey is the key the correlation ID is stored under in a context
+type contextKey struct{}
+
+// WithID returns a copy of ctx carrying the correlation ID; an empty ID leaves ctx unchanged
+func WithID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// ID returns the correlation ID carried by ctx, or an empty string
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// NewID generates a random correlation ID
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("failed to generate correlation ID: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Middleware gives every request a correlation ID: the one sent in the X-Request-ID header, if
+// valid, or a new one. The ID is carried by the request's context and returned in the response.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = NewID()
+		}
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(WithID(r.Context(), id)))
+	})
+}
+
+// valid reports whether a client-supplied ID is short and made of visible ASCII characters only,
+// so it can be logged and published as is
+func valid(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// handler adds the correlation ID of the context to the records it logs
+type handler struct {
+	slog.Handler
+}
+
+// NewHandler wraps h so that records logged with a context carrying a correlation ID, e.g. by
+// Logger.InfoContext, get it as the correlation_id attribute
+func NewHandler(h slog.Handler) slog.Handler {
+	return handler{Handler: h}
+}
+
+func (h handler) Handle(ctx context.Context, record slog.Record) error {
+	if id := ID(ctx); id != "" {
+		record.AddAttrs(slog.String(LogKey, id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return handler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h handler) WithGroup(name string) slog.Handler {
+	return handler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,96 @@
+package correlation
+
+import (
+	"context"
+	"internal-transfers/pkg/logtest"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		keepsID bool
+	}{
+		{name: "valid ID is kept", header: "req-123", keepsID: true},
+		{name: "longest ID is kept", header: strings.Repeat("a", maxIDLength), keepsID: true},
+		{name: "missing ID is generated", header: ""},
+		{name: "too long ID is replaced", header: strings.Repeat("a", maxIDLength+1)},
+		{name: "ID with spaces is replaced", header: "req 123"},
+		{name: "ID with control characters is replaced", header: "req\x01123"},
+		{name: "non-ASCII ID is replaced", header: "réq"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = ID(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(Header, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if seen == "" || !valid(seen) {
+				t.Fatalf("request carries correlation ID %q, want a valid one", seen)
+			}
+			if tt.keepsID && seen != tt.header {
+				t.Errorf("request carries correlation ID %q, want %q", seen, tt.header)
+			}
+			if !tt.keepsID && seen == tt.header {
+				t.Errorf("request kept the invalid correlation ID %q", seen)
+			}
+			if got := rec.Header().Get(Header); got != seen {
+				t.Errorf("response header %s = %q, want %q", Header, got, seen)
+			}
+		})
+	}
+}
+
+func TestWithIDEmptyKeepsContext(t *testing.T) {
+	ctx := WithID(context.Background(), "req-123")
+	if got := ID(WithID(ctx, "")); got != "req-123" {
+		t.Errorf("ID() = %q, want the earlier %q", got, "req-123")
+	}
+	if got := ID(context.Background()); got != "" {
+		t.Errorf("ID() of a bare context = %q, want none", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	records := logtest.NewHandler()
+	logger := slog.New(NewHandler(records)).With("service", "test")
+
+	logger.InfoContext(WithID(context.Background(), "req-123"), "with ID")
+	logger.InfoContext(context.Background(), "without ID")
+
+	tests := []struct {
+		message string
+		attrs   map[string]any
+	}{
+		{message: "with ID", attrs: map[string]any{"service": "test", LogKey: "req-123"}},
+		{message: "without ID", attrs: map[string]any{"service": "test"}},
+	}
+	for _, tt := range tests {
+		record, ok := records.Find(tt.message)
+		if !ok {
+			t.Fatalf("no record %q was logged", tt.message)
+		}
+		if len(record.Attrs) != len(tt.attrs) {
+			t.Errorf("record %q has attributes %v, want %v", tt.message, record.Attrs, tt.attrs)
+		}
+		for key, want := range tt.attrs {
+			if got := record.Attrs[key]; got != want {
+				t.Errorf("record %q has %s = %v, want %v", tt.message, key, got, want)
+			}
+		}
+	}
+}
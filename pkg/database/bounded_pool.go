@@ -0,0 +1,154 @@
+// Package database holds the PostgreSQL plumbing shared by the services: a connection pool that
+// fails fast when saturated, per-call query timeouts and the store of processed message IDs.
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// BoundedPool runs queries on a connection pool like pgxpool.Pool does, but gives up waiting for
+// a free connection after acquireTimeout so a saturated pool fails fast instead of piling up callers
+type BoundedPool struct {
+	pool           *pgxpool.Pool
+	acquireTimeout time.Duration
+	overloaded     error
+}
+
+// NewBoundedPool creates a pool that fails with overloaded, e.g. the domain.ErrOverloaded of the
+// service, when no connection of pool became free within acquireTimeout
+func NewBoundedPool(pool *pgxpool.Pool, acquireTimeout time.Duration, overloaded error) *BoundedPool {
+	return &BoundedPool{pool: pool, acquireTimeout: acquireTimeout, overloaded: overloaded}
+}
+
+// acquire takes a connection from the pool, returning the overloaded error when none became
+// free within the acquire timeout
+func (p *BoundedPool) acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	if p.acquireTimeout <= 0 {
+		return p.pool.Acquire(ctx)
+	}
+
+	acquireCtx, cancel := context.WithTimeout(ctx, p.acquireTimeout)
+	defer cancel()
+
+	conn, err := p.pool.Acquire(acquireCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(acquireCtx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w: no database connection available within %s", p.overloaded, p.acquireTimeout)
+	}
+	return conn, err
+}
+
+// Begin starts a transaction; its connection is returned to the pool on Commit or Rollback
+func (p *BoundedPool) Begin(ctx context.Context) (pgx.Tx, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+	return &boundedTx{Tx: tx, conn: conn}, nil
+}
+
+// Exec runs a statement on a pooled connection
+func (p *BoundedPool) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	defer conn.Release()
+
+	return conn.Exec(ctx, sql, args...)
+}
+
+// Query runs a query on a pooled connection, which is returned to the pool when the rows are closed
+func (p *BoundedPool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+	return &boundedRows{Rows: rows, conn: conn}, nil
+}
+
+// QueryRow runs a query on a pooled connection, which is returned to the pool once the row is scanned
+func (p *BoundedPool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return errRow{err: err}
+	}
+	return boundedRow{row: conn.QueryRow(ctx, sql, args...), conn: conn}
+}
+
+// boundedTx releases its connection when the transaction ends
+type boundedTx struct {
+	pgx.Tx
+	conn *pgxpool.Conn
+}
+
+func (t *boundedTx) Commit(ctx context.Context) error {
+	err := t.Tx.Commit(ctx)
+	t.release()
+	return err
+}
+
+func (t *boundedTx) Rollback(ctx context.Context) error {
+	err := t.Tx.Rollback(ctx)
+	t.release()
+	return err
+}
+
+func (t *boundedTx) release() {
+	if t.conn != nil {
+		t.conn.Release()
+		t.conn = nil
+	}
+}
+
+// boundedRows releases its connection when closed
+type boundedRows struct {
+	pgx.Rows
+	conn *pgxpool.Conn
+}
+
+func (r *boundedRows) Close() {
+	r.Rows.Close()
+	if r.conn != nil {
+		r.conn.Release()
+		r.conn = nil
+	}
+}
+
+// boundedRow releases its connection once scanned
+type boundedRow struct {
+	row  pgx.Row
+	conn *pgxpool.Conn
+}
+
+func (r boundedRow) Scan(dest ...any) error {
+	defer r.conn.Release()
+	return r.row.Scan(dest...)
+}
+
+// errRow is returned by QueryRow when no connection could be acquired
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...any) error {
+	return r.err
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"internal-transfers/pkg/config"
+	"time"
+)
+
+// Option configures a repository or store
+type Option func(*Options)
+
+// Options collects the settings applied by Option
+type Options struct {
+	QueryTimeout   time.Duration
+	AcquireTimeout time.Duration
+}
+
+// WithQueryTimeout bounds every call of the repository to the given duration.
+// A zero duration leaves calls bounded only by the caller's context.
+func WithQueryTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.QueryTimeout = timeout
+	}
+}
+
+// WithAcquireTimeout bounds how long a call waits for a free pool connection before failing
+// with the overloaded error of the pool. A zero duration waits as long as the call's context allows.
+func WithAcquireTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.AcquireTimeout = timeout
+	}
+}
+
+// NewOptions applies the options on top of the config.DefaultDBQueryTimeout and
+// config.DefaultDBAcquireTimeout defaults
+func NewOptions(opts []Option) Options {
+	o := Options{
+		QueryTimeout:   config.DefaultDBQueryTimeout,
+		AcquireTimeout: config.DefaultDBAcquireTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// QueryTimeout applies the per-call timeout; it is embedded in every repository
+type QueryTimeout struct {
+	Timeout time.Duration
+}
+
+// WithTimeout derives the context for a single repository call, so a slow query
+// cannot outlive the request even when ctx itself has no deadline
+func (q QueryTimeout) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if q.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, q.Timeout)
+}
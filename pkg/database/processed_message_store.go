@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"internal-transfers/pkg/consumer"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrOverloaded is returned by the stores of this package when no database connection became
+// free in time
+var ErrOverloaded = errors.New("database overloaded")
+
+// PruneBatchSize is the largest number of rows deleted by a single Prune, so that the deletion
+// never holds its locks for long
+const PruneBatchSize = 1000
+
+// ProcessedMessageStore records the IDs of consumed messages in the processed_messages table
+type ProcessedMessageStore struct {
+	pool *BoundedPool
+	QueryTimeout
+}
+
+// NewProcessedMessageStore creates a new instance of ProcessedMessageStore
+func NewProcessedMessageStore(pool *pgxpool.Pool, opts ...Option) *ProcessedMessageStore {
+	o := NewOptions(opts)
+	return &ProcessedMessageStore{
+		pool:         NewBoundedPool(pool, o.AcquireTimeout, ErrOverloaded),
+		QueryTimeout: QueryTimeout{Timeout: o.QueryTimeout},
+	}
+}
+
+// IsProcessed reports whether the message ID is present
+func (s *ProcessedMessageStore) IsProcessed(ctx context.Context, messageID string) (bool, error) {
+	ctx, cancel := s.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM processed_messages
+			WHERE message_id = $1
+		)
+	`
+
+	var processed bool
+	if err := s.pool.QueryRow(ctx, query, messageID).Scan(&processed); err != nil {
+		return false, fmt.Errorf("failed to check processed message: %w", err)
+	}
+
+	return processed, nil
+}
+
+// MarkProcessed inserts the message ID, returning false if it was already present
+func (s *ProcessedMessageStore) MarkProcessed(ctx context.Context, messageID string) (bool, error) {
+	ctx, cancel := s.WithTimeout(ctx)
+	defer cancel()
+
+	tag, err := s.pool.Exec(ctx, markProcessedQuery, messageID)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark message as processed: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// RecordProcessed inserts the ID of the message being handled (see consumer.MessageID) within tx,
+// so that it is recorded if and only if the handler's changes are committed. It returns false if
+// the message was already recorded, in which case tx should be rolled back, and true when ctx
+// carries no message.
+func RecordProcessed(ctx context.Context, tx pgx.Tx) (bool, error) {
+	messageID := consumer.MessageID(ctx)
+	if messageID == "" {
+		return true, nil
+	}
+
+	tag, err := tx.Exec(ctx, markProcessedQuery, messageID)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark message as processed: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// markProcessedQuery records a message ID unless it is already present
+const markProcessedQuery = `
+	INSERT INTO processed_messages (message_id)
+	VALUES ($1)
+	ON CONFLICT (message_id) DO NOTHING
+`
+
+// Prune deletes up to a batch of the message IDs recorded before the cutoff and returns how many
+// were deleted. Redeliveries of those messages are no longer recognized.
+func (s *ProcessedMessageStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := s.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		DELETE FROM processed_messages
+		WHERE message_id IN (
+			SELECT message_id
+			FROM processed_messages
+			WHERE processed_at < $1
+			LIMIT $2
+		)
+	`
+
+	tag, err := s.pool.Exec(ctx, query, before, PruneBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete processed messages: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,75 @@
+// Package features turns behaviors of the services on or off with feature flags, so that a
+// behavior can ship switched off, or be switched off again, without a new build.
+package features
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Flag names a behavior that can be turned on or off
+type Flag string
+
+// Flags known to the services
+const (
+	// AccountValidation serves dry-run account validation (POST /accounts/validate)
+	AccountValidation Flag = "account_validation"
+	// IdempotencyKeys replays account creations and transaction submissions retried with the same Idempotency-Key header
+	IdempotencyKeys Flag = "idempotency_keys"
+	// StatusStreams serves the status event streams and WebSocket of transactions
+	StatusStreams Flag = "status_streams"
+	// LenientAmounts accepts amounts written with the currency of the accounts, such as "$10.50" or "10.50 USD"
+	LenientAmounts Flag = "lenient_amounts"
+	// DuplicateTransferCheck returns an identical transfer submitted moments ago instead of creating a new one
+	DuplicateTransferCheck Flag = "duplicate_transfer_check"
+	// FraudHolds holds large transfers to accounts the source never paid before for review
+	FraudHolds Flag = "fraud_holds"
+)
+
+// defaults holds whether each flag is on when it is not set
+var defaults = map[Flag]bool{
+	AccountValidation:      true,
+	IdempotencyKeys:        true,
+	StatusStreams:          true,
+	LenientAmounts:         false,
+	DuplicateTransferCheck: false,
+	FraudHolds:             false,
+}
+
+// Flags tells which behaviors are on. The zero value has every flag at its default.
+type Flags struct {
+	overrides map[Flag]bool
+}
+
+// Parse reads flags from items such as "status_streams=off" or "account_validation=on"; a bare
+// name turns the flag on. Unknown flags and values are reported.
+func Parse(items []string) (Flags, error) {
+	flags := Flags{overrides: make(map[Flag]bool, len(items))}
+	for _, item := range items {
+		name, value, hasValue := strings.Cut(item, "=")
+		flag := Flag(strings.TrimSpace(name))
+		if _, ok := defaults[flag]; !ok {
+			return Flags{}, fmt.Errorf("unknown feature flag %q", flag)
+		}
+		on := true
+		if hasValue {
+			switch strings.ToLower(strings.TrimSpace(value)) {
+			case "on", "true", "1":
+			case "off", "false", "0":
+				on = false
+			default:
+				return Flags{}, fmt.Errorf("feature flag %s must be on or off, got %q", flag, value)
+			}
+		}
+		flags.overrides[flag] = on
+	}
+	return flags, nil
+}
+
+// Enabled tells whether the behavior behind flag is on
+func (f Flags) Enabled(flag Flag) bool {
+	if on, ok := f.overrides[flag]; ok {
+		return on
+	}
+	return defaults[flag]
+}
@@ -0,0 +1,48 @@
+package features
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		items   []string
+		flag    Flag
+		want    bool
+		wantErr bool
+	}{
+		{name: "default on", flag: StatusStreams, want: true},
+		{name: "default off", flag: LenientAmounts, want: false},
+		{name: "bare name", items: []string{"lenient_amounts"}, flag: LenientAmounts, want: true},
+		{name: "off", items: []string{"status_streams=off"}, flag: StatusStreams, want: false},
+		{name: "case and spaces", items: []string{" fraud_holds = ON "}, flag: FraudHolds, want: true},
+		{name: "false", items: []string{"idempotency_keys=false"}, flag: IdempotencyKeys, want: false},
+		{name: "last item wins", items: []string{"status_streams=off", "status_streams=1"}, flag: StatusStreams, want: true},
+		{name: "other flags untouched", items: []string{"status_streams=off"}, flag: AccountValidation, want: true},
+		{name: "unknown flag", items: []string{"velocity_limits"}, wantErr: true},
+		{name: "invalid value", items: []string{"status_streams=maybe"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, err := Parse(tt.items)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, want error %v", tt.items, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := flags.Enabled(tt.flag); got != tt.want {
+				t.Errorf("Enabled(%s) = %v, want %v", tt.flag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZeroFlagsAreDefaults(t *testing.T) {
+	var flags Flags
+	for flag, on := range defaults {
+		if got := flags.Enabled(flag); got != on {
+			t.Errorf("Enabled(%s) = %v, want its default %v", flag, got, on)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Package idempotency records the idempotency keys clients send with requests that must not be
+// applied twice, together with the outcome of the request first sent with each key. Running
+// several instances of a service requires a store they share, such as RedisStore, so that a
+// retry reaching another instance is still recognized.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Record is what a store keeps under an idempotency key
+type Record struct {
+	// Fingerprint identifies the request the key was first sent with, so that the key being reused
+	// for a different request can be told apart from a retry
+	Fingerprint string `json:"fingerprint"`
+	// Result identifies what the request produced, such as the ID of the resource it created. It
+	// is empty while the request is in progress.
+	Result string `json:"result,omitempty"`
+}
+
+// InProgress reports whether the request holding the key has not recorded its result yet
+func (r Record) InProgress() bool {
+	return r.Result == ""
+}
+
+// Store keeps idempotency keys until their TTL runs out
+type Store interface {
+	// Reserve records key as in progress for the request with the given fingerprint and returns
+	// nil, unless the key is already recorded; the existing record is returned then. Reserving is
+	// atomic: of concurrent requests with the same key, only one gets the reservation.
+	Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Record, error)
+	// Complete records the result of the request holding the reservation of key
+	Complete(ctx context.Context, key string, record Record, ttl time.Duration) error
+	// Release forgets the reservation of key, so that the request may be sent again with it
+	Release(ctx context.Context, key string) error
+}
+
+// Fingerprint hashes the parts of a request that must match for a retry to reuse its key
+func Fingerprint(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,98 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testStore checks the behavior every Store must have; newStore returns a store sharing its keys
+// with every other store it returns, like two instances of a service
+func testStore(t *testing.T, newStore func() Store) {
+	ctx := context.Background()
+
+	t.Run("reserve, complete and replay", func(t *testing.T) {
+		first, second := newStore(), newStore()
+		if record, err := first.Reserve(ctx, "replay", "fp", time.Minute); err != nil || record != nil {
+			t.Fatalf("first Reserve() = %v, %v, want the reservation", record, err)
+		}
+
+		record, err := second.Reserve(ctx, "replay", "fp", time.Minute)
+		if err != nil || record == nil || !record.InProgress() || record.Fingerprint != "fp" {
+			t.Fatalf("Reserve() while in progress = %+v, %v, want the in progress record", record, err)
+		}
+
+		if err := first.Complete(ctx, "replay", Record{Fingerprint: "fp", Result: "42"}, time.Minute); err != nil {
+			t.Fatalf("Complete() error = %v", err)
+		}
+		record, err = second.Reserve(ctx, "replay", "other", time.Minute)
+		if err != nil || record == nil || record.Result != "42" || record.Fingerprint != "fp" {
+			t.Fatalf("Reserve() once completed = %+v, %v, want the completed record", record, err)
+		}
+	})
+
+	t.Run("release", func(t *testing.T) {
+		first, second := newStore(), newStore()
+		if _, err := first.Reserve(ctx, "release", "fp", time.Minute); err != nil {
+			t.Fatalf("Reserve() error = %v", err)
+		}
+		if err := first.Release(ctx, "release"); err != nil {
+			t.Fatalf("Release() error = %v", err)
+		}
+		if record, err := second.Reserve(ctx, "release", "fp", time.Minute); err != nil || record != nil {
+			t.Errorf("Reserve() after release = %+v, %v, want the reservation", record, err)
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		store := newStore()
+		if _, err := store.Reserve(ctx, "expiry", "fp", 50*time.Millisecond); err != nil {
+			t.Fatalf("Reserve() error = %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if record, err := store.Reserve(ctx, "expiry", "fp", time.Minute); err != nil || record != nil {
+			t.Errorf("Reserve() after expiry = %+v, %v, want the reservation", record, err)
+		}
+	})
+
+	t.Run("concurrent reservations", func(t *testing.T) {
+		stores := []Store{newStore(), newStore()}
+		var reserved atomic.Int32
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				record, err := stores[i%len(stores)].Reserve(ctx, "concurrent", fmt.Sprint(i), time.Minute)
+				if err != nil {
+					t.Errorf("Reserve() error = %v", err)
+					return
+				}
+				if record == nil {
+					reserved.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		if got := reserved.Load(); got != 1 {
+			t.Errorf("%d concurrent requests got the reservation, want 1", got)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	testStore(t, func() Store { return store })
+}
+
+func TestFingerprint(t *testing.T) {
+	if Fingerprint("a", "b") == Fingerprint("ab", "") {
+		t.Error("Fingerprint() does not tell apart where the parts split")
+	}
+	if Fingerprint("a", "b") != Fingerprint("a", "b") {
+		t.Error("Fingerprint() is not stable")
+	}
+}
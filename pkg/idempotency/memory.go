@@ -0,0 +1,66 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pruneEvery is how many reservations a MemoryStore takes between two scans for expired keys
+const pruneEvery = 1024
+
+// MemoryStore keeps idempotency keys in the memory of a single instance
+type MemoryStore struct {
+	mu           sync.Mutex
+	entries      map[string]memoryEntry
+	reservations int
+	now          func() time.Time
+}
+
+type memoryEntry struct {
+	record    Record
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry), now: time.Now}
+}
+
+// Reserve records key as in progress unless it is already recorded
+func (s *MemoryStore) Reserve(_ context.Context, key, fingerprint string, ttl time.Duration) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.reservations++; s.reservations%pruneEvery == 0 {
+		for k, entry := range s.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+	}
+
+	if entry, ok := s.entries[key]; ok && now.Before(entry.expiresAt) {
+		record := entry.record
+		return &record, nil
+	}
+	s.entries[key] = memoryEntry{record: Record{Fingerprint: fingerprint}, expiresAt: now.Add(ttl)}
+	return nil, nil
+}
+
+// Complete records the result of the request holding the reservation of key
+func (s *MemoryStore) Complete(_ context.Context, key string, record Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = memoryEntry{record: record, expiresAt: s.now().Add(ttl)}
+	return nil
+}
+
+// Release forgets the reservation of key
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
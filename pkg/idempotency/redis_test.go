@@ -0,0 +1,12 @@
+package idempotency
+
+import (
+	"internal-transfers/pkg/redistest"
+	"testing"
+)
+
+func TestRedisStore(t *testing.T) {
+	server := redistest.Start(t)
+	// Each store has a client of its own, like the instances of a service sharing the keys through Redis
+	testStore(t, func() Store { return NewRedisStore(server.NewClient(t), "idempotency:") })
+}
@@ -0,0 +1,118 @@
+// Package logtest captures what is logged through log/slog, so tests can check the records a
+// piece of code logs and the attributes they carry.
+package logtest
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Record is a captured log record, with its attributes keyed by name. Attributes of groups are
+// keyed by their dotted path, e.g. "request.id".
+type Record struct {
+	Level   slog.Level
+	Message string
+	Attrs   map[string]any
+}
+
+// Handler is a slog.Handler that keeps every record it handles, whatever its level. The handlers
+// derived from it with WithAttrs and WithGroup share its records.
+type Handler struct {
+	records *records
+	attrs   []slog.Attr
+	group   string
+}
+
+// records are the records captured by a Handler and those derived from it
+type records struct {
+	mu   sync.Mutex
+	list []Record
+}
+
+// NewHandler creates a handler without any record
+func NewHandler() *Handler {
+	return &Handler{records: &records{}}
+}
+
+func (h *Handler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	record := Record{Level: r.Level, Message: r.Message, Attrs: make(map[string]any)}
+	for _, attr := range h.attrs {
+		addAttr(record.Attrs, "", attr)
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		addAttr(record.Attrs, h.group, attr)
+		return true
+	})
+
+	h.records.mu.Lock()
+	defer h.records.mu.Unlock()
+	h.records.list = append(h.records.list, record)
+	return nil
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	qualified := make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	qualified = append(qualified, h.attrs...)
+	for _, attr := range attrs {
+		if h.group != "" {
+			attr.Key = h.group + "." + attr.Key
+		}
+		qualified = append(qualified, attr)
+	}
+	return &Handler{records: h.records, attrs: qualified, group: h.group}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	group := name
+	if h.group != "" {
+		group = h.group + "." + name
+	}
+	return &Handler{records: h.records, attrs: h.attrs, group: group}
+}
+
+// Records returns the records handled so far, oldest first
+func (h *Handler) Records() []Record {
+	h.records.mu.Lock()
+	defer h.records.mu.Unlock()
+	return append([]Record(nil), h.records.list...)
+}
+
+// Find returns the first record handled with the given message
+func (h *Handler) Find(message string) (Record, bool) {
+	for _, record := range h.Records() {
+		if record.Message == message {
+			return record, true
+		}
+	}
+	return Record{}, false
+}
+
+// addAttr stores attr under its key prefixed with group, flattening the attributes of groups
+func addAttr(attrs map[string]any, group string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	key := attr.Key
+	if group != "" {
+		key = group + "." + key
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key == "" {
+			key = group
+		}
+		for _, member := range attr.Value.Group() {
+			addAttr(attrs, key, member)
+		}
+		return
+	}
+	if attr.Key == "" {
+		return
+	}
+	attrs[key] = attr.Value.Any()
+}
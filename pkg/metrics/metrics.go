@@ -0,0 +1,93 @@
+// Package metrics exposes Prometheus metrics shared by the services.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ConsumerMetrics measures the age and retry count of the messages handled by a message consumer
+// and counts those retried and dead-lettered
+type ConsumerMetrics struct {
+	age          *prometheus.HistogramVec
+	retryCount   *prometheus.HistogramVec
+	retried      *prometheus.CounterVec
+	deadLettered *prometheus.CounterVec
+}
+
+// NewConsumerMetrics creates the consumer counters and registers them with reg
+func NewConsumerMetrics(reg prometheus.Registerer) *ConsumerMetrics {
+	m := &ConsumerMetrics{
+		// AMQP timestamps have a resolution of one second, so finer buckets would mean nothing
+		age: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "transfers_message_age_seconds",
+			Help:    "Time between the publishing of a consumed message and the start of its handling, by queue.",
+			Buckets: []float64{1, 2, 5, 10, 30, 60, 300, 900, 3600},
+		}, []string{"queue"}),
+		retryCount: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "transfers_message_retry_count",
+			Help:    "Number of times a consumed message had been retried when its handling started, by queue.",
+			Buckets: []float64{0, 1, 2, 3, 5, 10},
+		}, []string{"queue"}),
+		retried: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "transfers_messages_retried_total",
+			Help: "Number of consumed messages scheduled for another attempt, by reason.",
+		}, []string{"reason"}),
+		deadLettered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "transfers_messages_dead_lettered_total",
+			Help: "Number of consumed messages moved to the dead letter queue, by reason.",
+		}, []string{"reason"}),
+	}
+	reg.MustRegister(m.age, m.retryCount, m.retried, m.deadLettered)
+	return m
+}
+
+// MessageAge records how long a message waited between being published and being handled
+func (m *ConsumerMetrics) MessageAge(queue string, age time.Duration) {
+	m.age.WithLabelValues(queue).Observe(age.Seconds())
+}
+
+// MessageRetryCount records how many times a message had been retried when its handling started
+func (m *ConsumerMetrics) MessageRetryCount(queue string, retryCount int) {
+	m.retryCount.WithLabelValues(queue).Observe(float64(retryCount))
+}
+
+// MessageRetried records a message that will be delivered again
+func (m *ConsumerMetrics) MessageRetried(reason string) {
+	m.retried.WithLabelValues(reason).Inc()
+}
+
+// MessageDeadLettered records a message that was moved to the dead letter queue
+func (m *ConsumerMetrics) MessageDeadLettered(reason string) {
+	m.deadLettered.WithLabelValues(reason).Inc()
+}
+
+// PublisherMetrics counts published messages that could not be delivered
+type PublisherMetrics struct {
+	returned *prometheus.CounterVec
+}
+
+// NewPublisherMetrics creates the publisher counters and registers them with reg
+func NewPublisherMetrics(reg prometheus.Registerer) *PublisherMetrics {
+	m := &PublisherMetrics{
+		returned: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "transfers_messages_unroutable_total",
+			Help: "Number of published messages returned because no queue was bound to their routing key.",
+		}, []string{"routing_key"}),
+	}
+	reg.MustRegister(m.returned)
+	return m
+}
+
+// MessageReturned records a message that was returned as unroutable
+func (m *PublisherMetrics) MessageReturned(routingKey string) {
+	m.returned.WithLabelValues(routingKey).Inc()
+}
+
+// Handler serves the metrics registered with the default registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,61 @@
+// Package pagination parses the limit and offset query parameters of list endpoints, so that all
+// of them apply the same defaults, caps and validation.
+package pagination
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Defaults used by ParsePagination
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// ErrInvalid is wrapped by the errors returned for malformed parameters; such requests should be
+// answered with 400 Bad Request
+var ErrInvalid = errors.New("invalid pagination")
+
+// Params holds the limit applied when none is requested and the largest limit allowed.
+// Requested limits above MaxLimit are lowered to it rather than rejected.
+type Params struct {
+	DefaultLimit int
+	MaxLimit     int
+}
+
+// Default is the pagination applied by ParsePagination
+var Default = Params{DefaultLimit: DefaultLimit, MaxLimit: MaxLimit}
+
+// ParsePagination reads limit and offset from the query string of r using the Default params
+func ParsePagination(r *http.Request) (limit, offset int, err error) {
+	return Default.Parse(r)
+}
+
+// Parse reads limit and offset from the query string of r. A missing limit is DefaultLimit and a
+// missing offset is 0. The limit must be a positive integer and the offset a non-negative one.
+func (p Params) Parse(r *http.Request) (limit, offset int, err error) {
+	query := r.URL.Query()
+
+	limit = p.DefaultLimit
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("%w: limit must be a positive integer", ErrInvalid)
+		}
+	}
+	if limit > p.MaxLimit {
+		limit = p.MaxLimit
+	}
+
+	if value := query.Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("%w: offset must be a non-negative integer", ErrInvalid)
+		}
+	}
+
+	return limit, offset, nil
+}
@@ -0,0 +1,57 @@
+package pagination
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantLimit  int
+		wantOffset int
+		wantErr    bool
+	}{
+		{name: "defaults", query: "", wantLimit: DefaultLimit},
+		{name: "limit and offset", query: "?limit=50&offset=40", wantLimit: 50, wantOffset: 40},
+		{name: "largest limit", query: "?limit=100", wantLimit: MaxLimit},
+		{name: "limit above the cap", query: "?limit=1000", wantLimit: MaxLimit},
+		{name: "empty values", query: "?limit=&offset=", wantLimit: DefaultLimit},
+		{name: "zero limit", query: "?limit=0", wantErr: true},
+		{name: "negative limit", query: "?limit=-5", wantErr: true},
+		{name: "non-numeric limit", query: "?limit=ten", wantErr: true},
+		{name: "negative offset", query: "?offset=-1", wantErr: true},
+		{name: "non-numeric offset", query: "?offset=1.5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, offset, err := ParsePagination(httptest.NewRequest(http.MethodGet, "/items"+tt.query, nil))
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalid) {
+					t.Errorf("ParsePagination() error = %v, want %v", err, ErrInvalid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePagination() error = %v", err)
+			}
+			if limit != tt.wantLimit || offset != tt.wantOffset {
+				t.Errorf("ParsePagination() = %d, %d, want %d, %d", limit, offset, tt.wantLimit, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestParamsParse(t *testing.T) {
+	params := Params{DefaultLimit: 5, MaxLimit: 10}
+	for query, want := range map[string]int{"": 5, "?limit=7": 7, "?limit=11": 10} {
+		limit, _, err := params.Parse(httptest.NewRequest(http.MethodGet, "/items"+query, nil))
+		if err != nil || limit != want {
+			t.Errorf("Parse(%q) = %d, %v, want %d", query, limit, err, want)
+		}
+	}
+}
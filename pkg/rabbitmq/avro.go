@@ -0,0 +1,170 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	eventsv1 "internal-transfers/pkg/api/events/v1"
+	"internal-transfers/pkg/schemaregistry"
+)
+
+// avroSubject is the registry subject of the transaction event schema, named after the exchange
+const avroSubject = "transactions-value"
+
+// errSchemaUnavailable is returned when the schema of an Avro event cannot be fetched from the
+// registry; such messages are requeued rather than treated as malformed
+var errSchemaUnavailable = errors.New("event schema unavailable")
+
+// WithSchemaRegistry sets the registry holding the Avro schema of transaction events. It is needed
+// to publish with EncodingAvro and to consume Avro events, whatever the publishing encoding.
+func WithSchemaRegistry(registry *schemaregistry.Client) Option {
+	return func(o *options) {
+		o.registry = registry
+	}
+}
+
+// encodeAvro encodes msg with the registered schema, in the registry wire format
+func (b *Broker[E]) encodeAvro(ctx context.Context, msg *eventsv1.TransactionEvent) ([]byte, error) {
+	id, err := b.registry.Register(ctx, avroSubject, eventsv1.TransactionEventAvroSchema)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := b.registry.Codec(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := codec.BinaryFromNative(nil, map[string]any{
+		"transaction_id":         msg.GetTransactionId(),
+		"source_account_id":      msg.GetSourceAccountId(),
+		"destination_account_id": msg.GetDestinationAccountId(),
+		"amount":                 msg.GetAmount(),
+		"fee":                    msg.GetFee(),
+		"memo":                   msg.GetMemo(),
+		"status":                 msg.GetStatus(),
+		"failure_code":           msg.GetFailureCode(),
+		"failure_reason":         msg.GetFailureReason(),
+		"legs":                   avroLegs(msg.GetLegs()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return schemaregistry.Frame(id, payload), nil
+}
+
+// decodeAvro decodes an event written with any schema in the registry. Events whose schema lacks
+// a required field of TransactionEvent, or gives it another type, are rejected.
+func (b *Broker[E]) decodeAvro(ctx context.Context, body []byte) (*eventsv1.TransactionEvent, error) {
+	if b.registry == nil {
+		return nil, errors.New("no schema registry configured to decode Avro event")
+	}
+	id, payload, err := schemaregistry.Unframe(body)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := b.registry.Codec(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errSchemaUnavailable, err)
+	}
+
+	native, _, err := codec.NativeFromBinary(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Avro event: %w", err)
+	}
+	fields, ok := native.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("schema %d is not a record", id)
+	}
+
+	r := avroRecord{fields: fields}
+	msg := &eventsv1.TransactionEvent{
+		TransactionId:        r.long("transaction_id"),
+		SourceAccountId:      r.long("source_account_id"),
+		DestinationAccountId: r.long("destination_account_id"),
+		Amount:               r.string("amount", true),
+		Fee:                  r.string("fee", false),
+		Memo:                 r.string("memo", false),
+		Status:               r.string("status", true),
+		FailureCode:          r.string("failure_code", false),
+		FailureReason:        r.string("failure_reason", false),
+		Legs:                 r.legs("legs"),
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("schema %d does not match TransactionEvent: %w", id, r.err)
+	}
+	return msg, nil
+}
+
+// avroRecord reads typed fields from a decoded Avro record, keeping the first mismatch in err
+type avroRecord struct {
+	fields map[string]any
+	err    error
+}
+
+// long returns a required long field
+func (r *avroRecord) long(name string) int64 {
+	value, ok := r.fields[name].(int64)
+	if !ok && r.err == nil {
+		r.err = fmt.Errorf("field %s must be a long", name)
+	}
+	return value
+}
+
+// string returns a string field; optional fields missing from the writer schema are empty
+func (r *avroRecord) string(name string, required bool) string {
+	raw, present := r.fields[name]
+	if !present && !required {
+		return ""
+	}
+	value, ok := raw.(string)
+	if !ok && r.err == nil {
+		r.err = fmt.Errorf("field %s must be a string", name)
+	}
+	return value
+}
+
+// legs returns the legs of a split transfer; writer schemas without legs have none
+func (r *avroRecord) legs(name string) []*eventsv1.TransferLeg {
+	raw, present := r.fields[name]
+	if !present {
+		return nil
+	}
+	items, ok := raw.([]any)
+	if !ok {
+		if r.err == nil {
+			r.err = fmt.Errorf("field %s must be an array", name)
+		}
+		return nil
+	}
+	var legs []*eventsv1.TransferLeg
+	for _, item := range items {
+		fields, ok := item.(map[string]any)
+		if !ok {
+			if r.err == nil {
+				r.err = fmt.Errorf("field %s must hold records", name)
+			}
+			return nil
+		}
+		leg := avroRecord{fields: fields}
+		legs = append(legs, &eventsv1.TransferLeg{
+			DestinationAccountId: leg.long("destination_account_id"),
+			Amount:               leg.string("amount", true),
+		})
+		if leg.err != nil && r.err == nil {
+			r.err = fmt.Errorf("field %s: %w", name, leg.err)
+		}
+	}
+	return legs
+}
+
+// avroLegs converts the legs of a split transfer to their Avro encoding
+func avroLegs(legs []*eventsv1.TransferLeg) []any {
+	out := make([]any, len(legs))
+	for i, leg := range legs {
+		out[i] = map[string]any{
+			"destination_account_id": leg.GetDestinationAccountId(),
+			"amount":                 leg.GetAmount(),
+		}
+	}
+	return out
+}
@@ -0,0 +1,160 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"internal-transfers/pkg/consumer"
+	"internal-transfers/pkg/schemaregistry"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/linkedin/goavro/v2"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeRegistry serves the schemas registered on it under sequential IDs
+type fakeRegistry struct {
+	mu      sync.Mutex
+	schemas []string
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/subjects/"):
+		var req struct {
+			Schema string `json:"schema"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		f.schemas = append(f.schemas, req.Schema)
+		json.NewEncoder(w).Encode(map[string]int{"id": len(f.schemas)})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/schemas/ids/"):
+		id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/schemas/ids/"))
+		if err != nil || id < 1 || id > len(f.schemas) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Schema not found"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"schema": f.schemas[id-1]})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// add registers schema directly and returns its ID
+func (f *fakeRegistry) add(schema string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.schemas = append(f.schemas, schema)
+	return len(f.schemas)
+}
+
+// newAvroBroker creates a broker publishing Avro events with the registry served by registry
+func newAvroBroker(t *testing.T, registry *fakeRegistry) *Broker[testEvent] {
+	t.Helper()
+	server := httptest.NewServer(registry)
+	t.Cleanup(server.Close)
+	ch := newFakeChannel()
+	broker, err := newBroker[testEvent](&fakeConnection{ch: ch}, ch, "transactions", testMapper{},
+		WithEventEncoding(EncodingAvro), WithSchemaRegistry(schemaregistry.NewClient(server.URL)))
+	if err != nil {
+		t.Fatalf("newBroker() error = %v", err)
+	}
+	return broker
+}
+
+func TestAvroRoundTrip(t *testing.T) {
+	broker := newAvroBroker(t, &fakeRegistry{})
+	body, contentType, err := broker.encodeEvent(context.Background(), testEvent{ID: 7})
+	if err != nil {
+		t.Fatalf("encodeEvent() error = %v", err)
+	}
+	if contentType != ContentTypeAvro {
+		t.Errorf("content type = %q, want %q", contentType, ContentTypeAvro)
+	}
+	event, err := broker.decodeEvent(context.Background(), contentType, body)
+	if err != nil {
+		t.Fatalf("decodeEvent() error = %v", err)
+	}
+	if event.ID != 7 {
+		t.Errorf("decoded event %+v, want ID 7", event)
+	}
+}
+
+func TestAvroIncompatibleSchema(t *testing.T) {
+	registry := &fakeRegistry{}
+	broker := newAvroBroker(t, registry)
+
+	// A producer registered a schema giving transaction_id another type
+	schema := `{"type": "record", "name": "TransactionEvent", "fields": [
+		{"name": "transaction_id", "type": "string"},
+		{"name": "source_account_id", "type": "long"},
+		{"name": "destination_account_id", "type": "long"},
+		{"name": "amount", "type": "string"},
+		{"name": "status", "type": "string"}
+	]}`
+	id := registry.add(schema)
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		t.Fatalf("goavro.NewCodec() error = %v", err)
+	}
+	payload, err := codec.BinaryFromNative(nil, map[string]any{
+		"transaction_id":         "7",
+		"source_account_id":      int64(1),
+		"destination_account_id": int64(2),
+		"amount":                 "10.00",
+		"status":                 "pending",
+	})
+	if err != nil {
+		t.Fatalf("BinaryFromNative() error = %v", err)
+	}
+
+	_, err = broker.decodeDelivery(context.Background(), amqpDelivery(ContentTypeAvro, schemaregistry.Frame(id, payload)))
+	if !errors.Is(err, consumer.ErrMalformed) || !strings.Contains(err.Error(), "transaction_id must be a long") {
+		t.Errorf("decodeDelivery() error = %v, want a malformed event naming transaction_id", err)
+	}
+}
+
+func TestAvroDecodeErrors(t *testing.T) {
+	registry := &fakeRegistry{}
+	broker := newAvroBroker(t, registry)
+	ch := newFakeChannel()
+	withoutRegistry, err := newBroker[testEvent](&fakeConnection{ch: ch}, ch, "transactions", testMapper{})
+	if err != nil {
+		t.Fatalf("newBroker() error = %v", err)
+	}
+	valid, _, err := broker.encodeEvent(context.Background(), testEvent{ID: 7})
+	if err != nil {
+		t.Fatalf("encodeEvent() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		broker  *Broker[testEvent]
+		body    []byte
+		wantErr error
+	}{
+		// The registry may be unreachable for a while, so the event is retried
+		{name: "unknown schema", broker: broker, body: schemaregistry.Frame(99, nil), wantErr: consumer.ErrUnavailable},
+		{name: "not framed", broker: broker, body: []byte{1, 2}, wantErr: consumer.ErrMalformed},
+		{name: "without a registry", broker: withoutRegistry, body: valid, wantErr: consumer.ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.broker.decodeDelivery(context.Background(), amqpDelivery(ContentTypeAvro, tt.body)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("decodeDelivery() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// amqpDelivery is a delivery of body with the given content type
+func amqpDelivery(contentType string, body []byte) amqp.Delivery {
+	return amqp.Delivery{ContentType: contentType, Body: body}
+}
@@ -0,0 +1,702 @@
+// Package rabbitmq publishes and consumes the events exchanged between the services over a RabbitMQ
+// exchange. A Broker is parameterized by the event type of the service using it; a Mapper
+// converts that type to and from the protobuf message every encoding is derived from.
+package rabbitmq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	eventsv1 "internal-transfers/pkg/api/events/v1"
+	"internal-transfers/pkg/config"
+	"internal-transfers/pkg/consumer"
+	"internal-transfers/pkg/correlation"
+	"internal-transfers/pkg/schemaregistry"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DefaultPublishTimeout bounds a single publish when WithPublishTimeout is not used
+const DefaultPublishTimeout = 5 * time.Second
+
+// DefaultHealthCheckInterval is how often a paused consumer checks whether it can resume
+const DefaultHealthCheckInterval = consumer.DefaultHealthCheckInterval
+
+// AckMode is the way subscriptions acknowledge deliveries; see WithAckMode
+type AckMode = consumer.AckMode
+
+// Ways subscriptions acknowledge deliveries
+const (
+	AckManual = consumer.AckManual
+	AckAuto   = consumer.AckAuto
+)
+
+// ErrDeclarationMismatch is returned when the exchange or a queue already exists with settings other
+// than those the broker declares it with, e.g. another type or message TTL
+var ErrDeclarationMismatch = errors.New("declaration does not match the existing one")
+
+// messageTTL is how long a message may wait in a queue before it is dead-lettered
+const messageTTL = 30000 // 30 seconds
+
+// Heartbeat interval and locale requested when connecting, the ones amqp.Dial uses
+const (
+	heartbeat = 10 * time.Second
+	locale    = "en_US"
+)
+
+// Channel is the subset of *amqp.Channel used by the broker. Publishing and consuming only go
+// through it, so they can be exercised against a fake channel without a running RabbitMQ.
+type Channel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Cancel(consumer string, noWait bool) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	NotifyReturn(c chan amqp.Return) chan amqp.Return
+	IsClosed() bool
+	Close() error
+}
+
+// Connection is the subset of *amqp.Connection used by the broker
+type Connection interface {
+	// Channel opens a new channel on the connection
+	Channel() (Channel, error)
+	IsClosed() bool
+	Close() error
+}
+
+// amqpConnection adapts *amqp.Connection to Connection
+type amqpConnection struct {
+	*amqp.Connection
+}
+
+func (c amqpConnection) Channel() (Channel, error) {
+	return c.Connection.Channel()
+}
+
+// Mapper converts events of type E to and from their protobuf message
+type Mapper[E any] interface {
+	ToProto(event E) *eventsv1.TransactionEvent
+	FromProto(msg *eventsv1.TransactionEvent) E
+}
+
+// ExchangeType is the type of the exchange events are published to. Queues are bound with the
+// exact routing keys of the events, so both types deliver the same events.
+type ExchangeType string
+
+const (
+	ExchangeTopic  ExchangeType = "topic"
+	ExchangeDirect ExchangeType = "direct"
+)
+
+// DeclareMismatch is what the broker does when the exchange or a queue already exists with other
+// settings than it declares it with
+type DeclareMismatch string
+
+const (
+	// MismatchFail reports the mismatch as ErrDeclarationMismatch
+	MismatchFail DeclareMismatch = "fail"
+	// MismatchPassive logs the mismatch and uses the existing exchange or queue as it is
+	MismatchPassive DeclareMismatch = "passive"
+)
+
+// Queue describes a durable queue consumed by a service. Rejected messages are dead-lettered
+// to a queue of the same name with a "_dlq" suffix.
+type Queue struct {
+	Name string
+	// Bindings are the routing keys of the events delivered to the queue
+	Bindings []string
+	// Args are additional queue arguments; they must match those of an existing queue
+	Args amqp.Table
+}
+
+// Broker publishes events of type E to an exchange and consumes them from queues bound to it.
+// AMQP channels must not be shared between goroutines, so events are published on a pool of
+// channels of their own and every consumer worker receives deliveries on a separate channel.
+type Broker[E any] struct {
+	conn     Connection
+	exchange string
+	mapper   Mapper[E]
+	options
+
+	// publishChannels holds the publishing channels that are not in use; a publisher takes one
+	// out for the duration of a publish
+	publishChannels chan Channel
+
+	mu sync.Mutex
+	// consumerChannels are the channels opened for subscriptions, closed along with the broker
+	consumerChannels []Channel
+}
+
+// options holds the settings applied by Option
+type options struct {
+	// consumerOpts configure the consumers of subscriptions, e.g. retries and health checks
+	consumerOpts   []consumer.Option
+	publishTimeout time.Duration
+	// concurrency is the number of deliveries handled in parallel by each subscription, each by a
+	// worker with a channel of its own
+	concurrency int
+	// prefetch limits unacknowledged deliveries per subscription; it defaults to concurrency
+	prefetch int
+	// consumerTag identifies subscriptions in RabbitMQ; see WithConsumerTag
+	consumerTag string
+	// encoding of published events; see WithEventEncoding
+	encoding EventEncoding
+	registry *schemaregistry.Client
+	// publishMetrics counts events returned as unroutable; see WithPublishMetrics
+	publishMetrics PublishMetricsRecorder
+	// publishPoolSize is the number of publishing channels; see WithPublishChannels
+	publishPoolSize int
+	// exchangeType is the type the exchange is declared with; see WithExchangeType
+	exchangeType ExchangeType
+	// declareMismatch is what to do with an exchange or queue existing with other settings; see WithDeclareMismatch
+	declareMismatch DeclareMismatch
+}
+
+// Option configures a Broker
+type Option func(*options)
+
+// PublishMetricsRecorder records published events that could not be delivered
+type PublishMetricsRecorder interface {
+	// MessageReturned records an event that no queue was bound to receive
+	MessageReturned(routingKey string)
+}
+
+// WithPublishMetrics reports events returned as unroutable to the given recorder
+func WithPublishMetrics(recorder PublishMetricsRecorder) Option {
+	return func(o *options) {
+		if recorder != nil {
+			o.publishMetrics = recorder
+		}
+	}
+}
+
+// WithProcessedMessageStore enables skipping of redelivered messages using the given store
+func WithProcessedMessageStore(store consumer.ProcessedMessageStore) Option {
+	return func(o *options) {
+		o.consumerOpts = append(o.consumerOpts, consumer.WithProcessedMessageStore(store))
+	}
+}
+
+// WithMetrics reports retried and dead-lettered messages to the given recorder
+func WithMetrics(recorder consumer.MetricsRecorder) Option {
+	return func(o *options) {
+		o.consumerOpts = append(o.consumerOpts, consumer.WithMetrics(recorder))
+	}
+}
+
+// WithAckMode sets how the deliveries of subscriptions are acknowledged; see consumer.AckMode.
+// The prefetch does not apply to automatically acknowledged deliveries.
+func WithAckMode(mode AckMode) Option {
+	return func(o *options) {
+		o.consumerOpts = append(o.consumerOpts, consumer.WithAckMode(mode))
+	}
+}
+
+// WithHealthCheck pauses consumption while checker fails and resumes once it succeeds again,
+// probing it every interval. Messages stay queued during an outage instead of using up their retries.
+func WithHealthCheck(checker consumer.HealthChecker, interval time.Duration) Option {
+	return func(o *options) {
+		o.consumerOpts = append(o.consumerOpts, consumer.WithHealthCheck(checker, interval))
+	}
+}
+
+// WithPublishTimeout sets how long a single publish may take. Publishing gets its own deadline
+// rather than the caller's, so an event is not lost because the HTTP request that triggered it was
+// about to time out.
+func WithPublishTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		if timeout > 0 {
+			o.publishTimeout = timeout
+		}
+	}
+}
+
+// WithConcurrency sets how many events each subscription handles in parallel. Every worker consumes
+// from the queue on a channel of its own.
+func WithConcurrency(workers int) Option {
+	return func(o *options) {
+		if workers > 0 {
+			o.concurrency = workers
+		}
+	}
+}
+
+// WithPublishChannels sets how many channels events are published on. Each channel carries one
+// publish at a time, so more channels let more events be published in parallel.
+func WithPublishChannels(channels int) Option {
+	return func(o *options) {
+		if channels > 0 {
+			o.publishPoolSize = channels
+		}
+	}
+}
+
+// WithPrefetch sets how many unacknowledged deliveries RabbitMQ sends each subscription ahead of
+// the workers. By default it equals the concurrency, so no delivery waits at a busy consumer.
+func WithPrefetch(count int) Option {
+	return func(o *options) {
+		if count > 0 {
+			o.prefetch = count
+		}
+	}
+}
+
+// WithExchangeType sets the type the exchange is declared with; a topic exchange is used by default.
+// An existing exchange cannot change its type, so it must be deleted before switching.
+func WithExchangeType(kind ExchangeType) Option {
+	return func(o *options) {
+		if kind == ExchangeTopic || kind == ExchangeDirect {
+			o.exchangeType = kind
+		}
+	}
+}
+
+// WithDeclareMismatch sets what happens when the exchange or a queue already exists with other
+// settings, e.g. a queue declared before its message TTL changed. By default the broker fails with
+// ErrDeclarationMismatch; MismatchPassive uses the existing one as it is instead, keeping its settings.
+func WithDeclareMismatch(mismatch DeclareMismatch) Option {
+	return func(o *options) {
+		if mismatch == MismatchFail || mismatch == MismatchPassive {
+			o.declareMismatch = mismatch
+		}
+	}
+}
+
+// WithConsumerTag sets the tag subscriptions are registered with, so that the consumer of a queue
+// can be told apart from those of other replicas in the management UI. The workers of a subscription
+// all register under the tag, each on its own channel.
+func WithConsumerTag(tag string) Option {
+	return func(o *options) {
+		o.consumerTag = tag
+	}
+}
+
+// DefaultConsumerTag returns a consumer tag made of the service name and the host name, which
+// identifies the replica running in a container
+func DefaultConsumerTag(service string) string {
+	return config.InstanceName(service)
+}
+
+// NewBroker connects to the broker described by cfg and declares the exchange events are
+// published to. Each call opens its own connection, so several brokers can be used side by side.
+func NewBroker[E any](cfg config.RabbitMQConfig, exchange string, mapper Mapper[E], opts ...Option) (*Broker[E], error) {
+	// Connect to RabbitMQ, naming the connection for the management UI
+	properties := amqp.NewConnectionProperties()
+	if cfg.ConnectionName != "" {
+		properties.SetClientConnectionName(cfg.ConnectionName)
+	}
+	conn, err := amqp.DialConfig(cfg.URL(), amqp.Config{
+		Heartbeat:  heartbeat,
+		Locale:     locale,
+		Properties: properties,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ at %s: %w", cfg.Host, err)
+	}
+
+	// Create channel
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open channel: %w", err)
+	}
+
+	broker, err := newBroker(amqpConnection{conn}, ch, exchange, mapper, opts...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return broker, nil
+}
+
+// newBroker creates a broker on an open connection, declaring the exchange on the given channel and
+// publishing on it and on as many more as the options ask for
+func newBroker[E any](conn Connection, ch Channel, exchange string, mapper Mapper[E], opts ...Option) (*Broker[E], error) {
+	broker := &Broker[E]{
+		conn:     conn,
+		exchange: exchange,
+		mapper:   mapper,
+		options: options{
+			publishTimeout:  DefaultPublishTimeout,
+			concurrency:     1,
+			encoding:        EncodingJSON,
+			publishMetrics:  noopPublishMetrics{},
+			publishPoolSize: 1,
+			exchangeType:    ExchangeTopic,
+			declareMismatch: MismatchFail,
+		},
+	}
+	for _, opt := range opts {
+		opt(&broker.options)
+	}
+
+	// Declare exchange
+	err := broker.declare(&ch, fmt.Sprintf("exchange %q", exchange), conn.Channel, func(ch Channel) error {
+		return ch.ExchangeDeclare(
+			exchange,                    // name
+			string(broker.exchangeType), // type
+			true,                        // durable
+			false,                       // auto-deleted
+			false,                       // internal
+			false,                       // no-wait
+			nil,                         // arguments
+		)
+	}, func(ch Channel) error {
+		return ch.ExchangeDeclarePassive(exchange, string(broker.exchangeType), true, false, false, false, nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to declare exchange: %w", err)
+	}
+
+	broker.publishChannels = make(chan Channel, broker.publishPoolSize)
+	broker.watchReturns(ch)
+	broker.publishChannels <- ch
+	for i := 1; i < broker.publishPoolSize; i++ {
+		ch, err := broker.openPublishChannel()
+		if err != nil {
+			return nil, err
+		}
+		broker.publishChannels <- ch
+	}
+	return broker, nil
+}
+
+// declare declares the exchange or a queue, described by what, on *ch with declare. If it already
+// exists with other settings, the server refuses the declaration with a PRECONDITION_FAILED error and
+// closes the channel. The mismatch is then reported as ErrDeclarationMismatch or, with
+// MismatchPassive, logged and the existing one checked with passive on a channel opened by open,
+// which replaces *ch.
+func (b *Broker[E]) declare(ch *Channel, what string, open func() (Channel, error), declare, passive func(Channel) error) error {
+	err := declare(*ch)
+	var amqpErr *amqp.Error
+	if !errors.As(err, &amqpErr) || amqpErr.Code != amqp.PreconditionFailed {
+		return err
+	}
+	mismatch := fmt.Errorf("%w: %s already exists with other settings, delete it or restore them (%s)", ErrDeclarationMismatch, what, amqpErr.Reason)
+	if b.declareMismatch != MismatchPassive {
+		return mismatch
+	}
+
+	fmt.Printf("%v; using its existing settings\n", mismatch)
+	reopened, err := open()
+	if err != nil {
+		return err
+	}
+	*ch = reopened
+	return passive(reopened)
+}
+
+// openPublishChannel opens a channel for publishing
+func (b *Broker[E]) openPublishChannel() (Channel, error) {
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open publish channel: %w", err)
+	}
+	b.watchReturns(ch)
+	return ch, nil
+}
+
+// watchReturns reports the events published with the mandatory flag that come back on the channel
+// because no queue is bound to their key, until the channel is closed
+func (b *Broker[E]) watchReturns(ch Channel) {
+	returns := ch.NotifyReturn(make(chan amqp.Return, 16))
+	go func() {
+		for r := range returns {
+			fmt.Printf("Event %s with routing key %s was returned as unroutable: %d %s\n", r.MessageId, r.RoutingKey, r.ReplyCode, r.ReplyText)
+			b.publishMetrics.MessageReturned(r.RoutingKey)
+		}
+	}()
+}
+
+// Publish publishes event with the given routing key in the configured encoding
+func (b *Broker[E]) Publish(ctx context.Context, routingKey string, event E) error {
+	ctx, cancel := b.publishContext(ctx)
+	defer cancel()
+
+	body, contentType, err := b.encodeEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+	return b.publish(ctx, routingKey, true, contentType, body)
+}
+
+// PublishJSON publishes v encoded as JSON with the given routing key, for events other than E.
+// Unlike those published with Publish, such events are optional and may have no subscriber.
+func (b *Broker[E]) PublishJSON(ctx context.Context, routingKey string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	ctx, cancel := b.publishContext(ctx)
+	defer cancel()
+	return b.publish(ctx, routingKey, false, ContentTypeJSON, body)
+}
+
+// publish publishes a message with a new message ID and the correlation ID of ctx. Mandatory messages that cannot be routed
+// to any queue are returned by the broker and reported by watchReturns. Events are published from
+// concurrent HTTP requests and consumers, each on a channel taken from the pool for the publish.
+func (b *Broker[E]) publish(ctx context.Context, routingKey string, mandatory bool, contentType string, body []byte) error {
+	var ch Channel
+	select {
+	case ch = <-b.publishChannels:
+	case <-ctx.Done():
+		return fmt.Errorf("no publish channel available: %w", ctx.Err())
+	}
+	defer func() { b.publishChannels <- ch }()
+
+	// The server closes a channel on a channel-level error; it is replaced before publishing
+	if ch.IsClosed() {
+		reopened, err := b.openPublishChannel()
+		if err != nil {
+			return err
+		}
+		ch = reopened
+	}
+
+	return ch.PublishWithContext(ctx,
+		b.exchange, // exchange
+		routingKey, // routing key
+		mandatory,  // mandatory
+		false,      // immediate
+		amqp.Publishing{
+			ContentType:   contentType,
+			MessageId:     newMessageID(),
+			CorrelationId: correlation.ID(ctx),
+			Timestamp:     time.Now(),
+			DeliveryMode:  amqp.Persistent, // Survives a broker restart on the durable queues
+			Body:          body,
+		},
+	)
+}
+
+// publishContext derives the context of a single publish from ctx, keeping its values but
+// replacing its deadline and cancellation with the publish timeout
+func (b *Broker[E]) publishContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), b.publishTimeout)
+}
+
+// Subscribe declares the queue with its dead letter queue and bindings, and hands the events
+// delivered to it to handler. Failed events are retried and eventually dead-lettered.
+func (b *Broker[E]) Subscribe(ctx context.Context, queue Queue, handler func(ctx context.Context, event E) error) error {
+	channels := make([]Channel, b.concurrency)
+	for i := range channels {
+		ch, err := b.openConsumerChannel()
+		if err != nil {
+			return err
+		}
+		channels[i] = ch
+	}
+
+	// Declare dead letter queue
+	var dlq amqp.Queue
+	err := b.declareQueue(&channels[0], queue.Name+"_dlq", nil, &dlq)
+	if err != nil {
+		return fmt.Errorf("failed to declare DLQ: %w", err)
+	}
+
+	// Declare main queue with DLQ binding
+	args := amqp.Table{
+		"x-dead-letter-exchange":    "", // Use default exchange
+		"x-dead-letter-routing-key": dlq.Name,
+		"x-message-ttl":             messageTTL,
+	}
+	for k, v := range queue.Args {
+		args[k] = v
+	}
+	var q amqp.Queue
+	err = b.declareQueue(&channels[0], queue.Name, args, &q)
+	if err != nil {
+		return fmt.Errorf("failed to declare queue: %w", err)
+	}
+
+	for _, key := range queue.Bindings {
+		err = channels[0].QueueBind(
+			q.Name,     // queue name
+			key,        // routing key
+			b.exchange, // exchange
+			false,      // no-wait
+			nil,        // arguments
+		)
+		if err != nil {
+			return fmt.Errorf("failed to bind queue to %s: %w", key, err)
+		}
+	}
+
+	// Limit unacknowledged deliveries to what the workers can handle at once, spreading the
+	// prefetch of the subscription over their channels
+	prefetch := 1
+	if b.prefetch > 0 {
+		prefetch = (b.prefetch + b.concurrency - 1) / b.concurrency
+	}
+
+	opts := append([]consumer.Option{
+		consumer.WithPublishTimeout(b.publishTimeout),
+		consumer.WithTag(b.consumerTag),
+	}, b.consumerOpts...)
+	for _, ch := range channels {
+		if err := ch.Qos(prefetch, 0, false); err != nil {
+			return fmt.Errorf("failed to set consumer prefetch: %w", err)
+		}
+		err := consumer.New(ch, opts...).Start(ctx, q.Name, func(ctx context.Context, msg amqp.Delivery) error {
+			event, err := b.decodeDelivery(ctx, msg)
+			if err != nil {
+				return err
+			}
+			return handler(ctx, event)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// declareQueue declares a durable queue on *ch and stores it in q, replacing *ch if the queue
+// exists with other arguments and is used as it is; see declare
+func (b *Broker[E]) declareQueue(ch *Channel, name string, args amqp.Table, q *amqp.Queue) error {
+	return b.declare(ch, fmt.Sprintf("queue %q", name), b.openConsumerChannel, func(ch Channel) error {
+		var err error
+		*q, err = ch.QueueDeclare(
+			name,  // name
+			true,  // durable
+			false, // delete when unused
+			false, // exclusive
+			false, // no-wait
+			args,  // arguments
+		)
+		return err
+	}, func(ch Channel) error {
+		var err error
+		*q, err = ch.QueueDeclarePassive(name, true, false, false, false, args)
+		return err
+	})
+}
+
+// openConsumerChannel opens a channel for consuming, which is closed along with the broker
+func (b *Broker[E]) openConsumerChannel() (Channel, error) {
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open consumer channel: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.consumerChannels = append(b.consumerChannels, ch)
+	return ch, nil
+}
+
+// SubscribeTemporary hands the messages published with routingKey to handler through a
+// server-named queue that is deleted when the connection closes. Every subscriber therefore sees
+// every message, but misses those published while it is not connected. Messages are neither
+// deduplicated nor retried: a message whose handler fails is dropped.
+func (b *Broker[E]) SubscribeTemporary(ctx context.Context, routingKey string, handler func(ctx context.Context, msg amqp.Delivery) error) error {
+	ch, err := b.openConsumerChannel()
+	if err != nil {
+		return err
+	}
+
+	q, err := ch.QueueDeclare(
+		"",    // name
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare queue: %w", err)
+	}
+
+	err = ch.QueueBind(
+		q.Name,     // queue name
+		routingKey, // routing key
+		b.exchange, // exchange
+		false,      // no-wait
+		nil,        // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to bind queue: %w", err)
+	}
+
+	msgs, err := ch.Consume(
+		q.Name, // queue
+		"",     // consumer
+		false,  // auto-ack
+		true,   // exclusive
+		false,  // no-local
+		false,  // no-wait
+		nil,    // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register consumer: %w", err)
+	}
+
+	go func() {
+		for msg := range msgs {
+			if err := handler(ctx, msg); err != nil {
+				fmt.Printf("Failed to handle %s message: %v\n", routingKey, err)
+				msg.Nack(false, false)
+				continue
+			}
+			msg.Ack(false)
+		}
+	}()
+
+	return nil
+}
+
+// IsConnected reports whether the connection is open. Publishing channels closed meanwhile are
+// reopened on their next use.
+func (b *Broker[E]) IsConnected() bool {
+	return !b.conn.IsClosed()
+}
+
+// Close closes the channels and the RabbitMQ connection
+func (b *Broker[E]) Close() error {
+	b.mu.Lock()
+	consumerChannels := b.consumerChannels
+	b.consumerChannels = nil
+	b.mu.Unlock()
+	for _, ch := range consumerChannels {
+		if err := ch.Close(); err != nil && !errors.Is(err, amqp.ErrClosed) {
+			return fmt.Errorf("failed to close consumer channel: %w", err)
+		}
+	}
+
+	// Publishes in progress finish before their channel is closed
+	for i := 0; i < b.publishPoolSize; i++ {
+		ch := <-b.publishChannels
+		if err := ch.Close(); err != nil && !errors.Is(err, amqp.ErrClosed) {
+			return fmt.Errorf("failed to close publish channel: %w", err)
+		}
+	}
+	if err := b.conn.Close(); err != nil {
+		return fmt.Errorf("failed to close connection: %w", err)
+	}
+	return nil
+}
+
+// newMessageID generates a unique ID for an outgoing message
+func newMessageID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("failed to generate message ID: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// noopPublishMetrics discards all measurements; it is used when no recorder is configured
+type noopPublishMetrics struct{}
+
+func (noopPublishMetrics) MessageReturned(string) {}
@@ -0,0 +1,567 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	eventsv1 "internal-transfers/pkg/api/events/v1"
+	"internal-transfers/pkg/consumer"
+	"internal-transfers/pkg/correlation"
+	"internal-transfers/pkg/logtest"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// testEvent is the event type of the brokers under test
+type testEvent struct {
+	ID int64 `json:"id"`
+}
+
+type testMapper struct{}
+
+func (testMapper) ToProto(event testEvent) *eventsv1.TransactionEvent {
+	return &eventsv1.TransactionEvent{TransactionId: event.ID}
+}
+
+func (testMapper) FromProto(msg *eventsv1.TransactionEvent) testEvent {
+	return testEvent{ID: msg.TransactionId}
+}
+
+// fakeConnection hands out the same fake channel every time
+type fakeConnection struct {
+	ch *fakeChannel
+}
+
+func (c *fakeConnection) Channel() (Channel, error) { return c.ch, nil }
+func (c *fakeConnection) IsClosed() bool            { return false }
+func (c *fakeConnection) Close() error              { return nil }
+
+// fakeChannel records what is published on it and delivers what is sent to deliveries to its
+// consumer
+type fakeChannel struct {
+	deliveries chan amqp.Delivery
+	cancelOnce sync.Once
+
+	mu        sync.Mutex
+	exchanges map[string]string
+	bindings  []binding
+	published []amqp.Publishing
+	acks      []uint64
+}
+
+// binding is a queue bound to an exchange with a routing key
+type binding struct {
+	queue, key, exchange string
+}
+
+func newFakeChannel() *fakeChannel {
+	return &fakeChannel{deliveries: make(chan amqp.Delivery, 16)}
+}
+
+func (c *fakeChannel) ExchangeDeclare(name, kind string, _, _, _, _ bool, _ amqp.Table) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.exchanges == nil {
+		c.exchanges = make(map[string]string)
+	}
+	c.exchanges[name] = kind
+	return nil
+}
+
+func (c *fakeChannel) ExchangeDeclarePassive(string, string, bool, bool, bool, bool, amqp.Table) error {
+	return nil
+}
+
+func (c *fakeChannel) PublishWithContext(_ context.Context, _, _ string, _, _ bool, msg amqp.Publishing) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, msg)
+	return nil
+}
+
+func (c *fakeChannel) Consume(string, string, bool, bool, bool, bool, amqp.Table) (<-chan amqp.Delivery, error) {
+	return c.deliveries, nil
+}
+
+func (c *fakeChannel) Cancel(string, bool) error {
+	c.cancelOnce.Do(func() { close(c.deliveries) })
+	return nil
+}
+
+func (c *fakeChannel) QueueDeclare(name string, _, _, _, _ bool, _ amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeChannel) QueueDeclarePassive(name string, _, _, _, _ bool, _ amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeChannel) QueueBind(queue, key, exchange string, _ bool, _ amqp.Table) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bindings = append(c.bindings, binding{queue: queue, key: key, exchange: exchange})
+	return nil
+}
+
+func (c *fakeChannel) Qos(int, int, bool) error                         { return nil }
+func (c *fakeChannel) NotifyReturn(r chan amqp.Return) chan amqp.Return { return r }
+func (c *fakeChannel) IsClosed() bool                                   { return false }
+func (c *fakeChannel) Close() error                                     { return nil }
+
+func (c *fakeChannel) Ack(tag uint64, _ bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.acks = append(c.acks, tag)
+	return nil
+}
+
+func (c *fakeChannel) Nack(uint64, bool, bool) error { return nil }
+func (c *fakeChannel) Reject(uint64, bool) error     { return nil }
+
+// deliver hands a published message to the consumer as RabbitMQ would
+func (c *fakeChannel) deliver(tag uint64, msg amqp.Publishing) {
+	c.deliveries <- amqp.Delivery{
+		Acknowledger:  c,
+		DeliveryTag:   tag,
+		ContentType:   msg.ContentType,
+		MessageId:     msg.MessageId,
+		CorrelationId: msg.CorrelationId,
+		Timestamp:     msg.Timestamp,
+		DeliveryMode:  msg.DeliveryMode,
+		Headers:       msg.Headers,
+		Body:          msg.Body,
+	}
+}
+
+func TestCorrelationIDFromRequestToConsumerLogs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := newFakeChannel()
+	broker, err := newBroker[testEvent](&fakeConnection{ch: ch}, ch, "transactions", testMapper{})
+	if err != nil {
+		t.Fatalf("newBroker() error = %v", err)
+	}
+
+	// The consumer logs through a logger built like the services' one
+	records := logtest.NewHandler()
+	logger := slog.New(correlation.NewHandler(records))
+	handled := make(chan struct{})
+	err = broker.Subscribe(ctx, Queue{Name: "test_events", Bindings: []string{"test.event"}}, func(ctx context.Context, event testEvent) error {
+		logger.InfoContext(ctx, "handling test event", "id", event.ID)
+		close(handled)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	// A request publishes the event
+	h := correlation.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := broker.Publish(r.Context(), "test.event", testEvent{ID: 7}); err != nil {
+			t.Errorf("Publish() error = %v", err)
+		}
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(correlation.Header, "req-123")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	ch.mu.Lock()
+	published := ch.published
+	ch.mu.Unlock()
+	if len(published) != 1 {
+		t.Fatalf("published %d messages, want 1", len(published))
+	}
+	if got := published[0].CorrelationId; got != "req-123" {
+		t.Fatalf("published correlation ID = %q, want %q", got, "req-123")
+	}
+
+	ch.deliver(1, published[0])
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event was not handled")
+	}
+
+	record, ok := records.Find("handling test event")
+	if !ok {
+		t.Fatal("the consumer logged nothing")
+	}
+	if got := record.Attrs[correlation.LogKey]; got != "req-123" {
+		t.Errorf("consumer log has %s = %v, want %q", correlation.LogKey, got, "req-123")
+	}
+	if got := record.Attrs["id"]; got != int64(7) {
+		t.Errorf("consumer log has id = %v, want 7", got)
+	}
+}
+
+func TestRetryKeepsCorrelationID(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := newFakeChannel()
+	broker, err := newBroker[testEvent](&fakeConnection{ch: ch}, ch, "transactions", testMapper{})
+	if err != nil {
+		t.Fatalf("newBroker() error = %v", err)
+	}
+
+	failed := make(chan struct{})
+	err = broker.Subscribe(ctx, Queue{Name: "test_events"}, func(ctx context.Context, event testEvent) error {
+		defer close(failed)
+		return errors.New("handler failed")
+	})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	if err := broker.Publish(correlation.WithID(ctx, "req-123"), "test.event", testEvent{ID: 7}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	ch.mu.Lock()
+	original := ch.published[0]
+	ch.mu.Unlock()
+	ch.deliver(1, original)
+
+	select {
+	case <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event was not handled")
+	}
+
+	// The retry is published before the original is acknowledged
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ch.mu.Lock()
+		published, acks := append([]amqp.Publishing(nil), ch.published...), len(ch.acks)
+		ch.mu.Unlock()
+		if acks > 0 {
+			if len(published) != 2 {
+				t.Fatalf("published %d messages, want the original and its retry", len(published))
+			}
+			if got := published[1].CorrelationId; got != "req-123" {
+				t.Errorf("retry correlation ID = %q, want %q", got, "req-123")
+			}
+			if got := published[1].DeliveryMode; got != amqp.Persistent {
+				t.Errorf("retry delivery mode = %d, want persistent (%d)", got, amqp.Persistent)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the failed event was not retried")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// ageRecorder records the ages of consumed messages
+type ageRecorder struct {
+	consumer.MetricsRecorder
+
+	mu   sync.Mutex
+	ages []time.Duration
+}
+
+func (r *ageRecorder) MessageAge(_ string, age time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ages = append(r.ages, age)
+}
+
+func (r *ageRecorder) MessageRetryCount(string, int) {}
+
+func TestMessageAgeOfPublishedMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := newFakeChannel()
+	recorder := &ageRecorder{}
+	broker, err := newBroker[testEvent](&fakeConnection{ch: ch}, ch, "transactions", testMapper{}, WithMetrics(recorder))
+	if err != nil {
+		t.Fatalf("newBroker() error = %v", err)
+	}
+	handled := make(chan struct{})
+	err = broker.Subscribe(ctx, Queue{Name: "test_events"}, func(context.Context, testEvent) error {
+		close(handled)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	before := time.Now()
+	if err := broker.Publish(ctx, "test.event", testEvent{ID: 7}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	ch.mu.Lock()
+	published := ch.published[0]
+	ch.mu.Unlock()
+	if published.Timestamp.Before(before) || published.Timestamp.After(time.Now()) {
+		t.Fatalf("published timestamp = %v, want the time of publishing", published.Timestamp)
+	}
+
+	const wait = 50 * time.Millisecond
+	time.Sleep(wait)
+	ch.deliver(1, published)
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event was not handled")
+	}
+
+	// The message waited at least as long as it sat in the fake queue, and not much longer
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.ages) != 1 {
+		t.Fatalf("recorded %d ages, want 1", len(recorder.ages))
+	}
+	if age := recorder.ages[0]; age < wait || age > 5*time.Second {
+		t.Errorf("recorded age = %s, want between %s and 5s", age, wait)
+	}
+}
+
+func TestPublishedMessageProperties(t *testing.T) {
+	ch := newFakeChannel()
+	broker, err := newBroker[testEvent](&fakeConnection{ch: ch}, ch, "transactions", testMapper{})
+	if err != nil {
+		t.Fatalf("newBroker() error = %v", err)
+	}
+
+	before := time.Now()
+	for id := range int64(2) {
+		if err := broker.Publish(context.Background(), "test.event", testEvent{ID: id}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if len(ch.published) != 2 {
+		t.Fatalf("published %d messages, want 2", len(ch.published))
+	}
+	for i, msg := range ch.published {
+		// Persistent messages on the durable queues survive a broker restart
+		if msg.DeliveryMode != amqp.Persistent {
+			t.Errorf("message %d delivery mode = %d, want persistent (%d)", i, msg.DeliveryMode, amqp.Persistent)
+		}
+		if msg.MessageId == "" {
+			t.Errorf("message %d has no message ID", i)
+		}
+		if msg.Timestamp.Before(before) || msg.Timestamp.After(time.Now()) {
+			t.Errorf("message %d timestamp = %v, want the time of publishing", i, msg.Timestamp)
+		}
+	}
+	if ch.published[0].MessageId == ch.published[1].MessageId {
+		t.Errorf("both messages have ID %q, want distinct IDs", ch.published[0].MessageId)
+	}
+}
+
+func TestExchangeType(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{name: "topic by default", want: "topic"},
+		{name: "direct", opts: []Option{WithExchangeType(ExchangeDirect)}, want: "direct"},
+		{name: "topic", opts: []Option{WithExchangeType(ExchangeTopic)}, want: "topic"},
+		{name: "unsupported type", opts: []Option{WithExchangeType("fanout")}, want: "topic"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ch := newFakeChannel()
+			broker, err := newBroker[testEvent](&fakeConnection{ch: ch}, ch, "transactions", testMapper{}, tt.opts...)
+			if err != nil {
+				t.Fatalf("newBroker() error = %v", err)
+			}
+			err = broker.Subscribe(ctx, Queue{Name: "test_events", Bindings: []string{"transaction.completed", "transaction.failed"}}, func(context.Context, testEvent) error {
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Subscribe() error = %v", err)
+			}
+
+			ch.mu.Lock()
+			defer ch.mu.Unlock()
+			if got := ch.exchanges["transactions"]; got != tt.want {
+				t.Errorf("exchange declared as %q, want %q", got, tt.want)
+			}
+			// Queues are bound with exact routing keys, which route the same on both types
+			want := []binding{
+				{queue: "test_events", key: "transaction.completed", exchange: "transactions"},
+				{queue: "test_events", key: "transaction.failed", exchange: "transactions"},
+			}
+			if !slices.Equal(ch.bindings, want) {
+				t.Errorf("bindings = %+v, want %+v", ch.bindings, want)
+			}
+		})
+	}
+}
+
+// mismatchChannel refuses to declare the exchanges and queues that already exist with another
+// value of an argument, as RabbitMQ does, and records those declared passively
+type mismatchChannel struct {
+	*fakeChannel
+
+	// mismatched maps the names of the exchanges and queues that exist to their mismatched argument
+	mismatched map[string]string
+	passive    []string
+}
+
+// mismatchConnection hands out the same mismatch channel every time
+type mismatchConnection struct {
+	ch *mismatchChannel
+}
+
+func (c *mismatchConnection) Channel() (Channel, error) { return c.ch, nil }
+func (c *mismatchConnection) IsClosed() bool            { return false }
+func (c *mismatchConnection) Close() error              { return nil }
+
+// preconditionFailed returns the error RabbitMQ closes the channel with when a declaration does
+// not match the existing one
+func preconditionFailed(kind, name, arg string) error {
+	return &amqp.Error{
+		Code:   amqp.PreconditionFailed,
+		Reason: "PRECONDITION_FAILED - inequivalent arg '" + arg + "' for " + kind + " '" + name + "' in vhost '/'",
+	}
+}
+
+func (c *mismatchChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	if arg, ok := c.mismatched[name]; ok {
+		return preconditionFailed("exchange", name, arg)
+	}
+	return c.fakeChannel.ExchangeDeclare(name, kind, durable, autoDelete, internal, noWait, args)
+}
+
+func (c *mismatchChannel) ExchangeDeclarePassive(name, _ string, _, _, _, _ bool, _ amqp.Table) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.passive = append(c.passive, name)
+	return nil
+}
+
+func (c *mismatchChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	if arg, ok := c.mismatched[name]; ok {
+		return amqp.Queue{}, preconditionFailed("queue", name, arg)
+	}
+	return c.fakeChannel.QueueDeclare(name, durable, autoDelete, exclusive, noWait, args)
+}
+
+func (c *mismatchChannel) QueueDeclarePassive(name string, _, _, _, _ bool, _ amqp.Table) (amqp.Queue, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.passive = append(c.passive, name)
+	return amqp.Queue{Name: name}, nil
+}
+
+func TestDeclarationMismatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		mismatched  map[string]string
+		opts        []Option
+		wantErr     []string
+		wantPassive []string
+	}{
+		{
+			name:       "exchange",
+			mismatched: map[string]string{"transactions": "type"},
+			wantErr:    []string{`exchange "transactions" already exists with other settings`, "inequivalent arg 'type'"},
+		},
+		{
+			name:       "queue",
+			mismatched: map[string]string{"test_events": "x-message-ttl"},
+			wantErr:    []string{`queue "test_events" already exists with other settings`, "inequivalent arg 'x-message-ttl'"},
+		},
+		{
+			name:       "dead letter queue",
+			mismatched: map[string]string{"test_events_dlq": "x-queue-type"},
+			wantErr:    []string{`queue "test_events_dlq" already exists with other settings`, "inequivalent arg 'x-queue-type'"},
+		},
+		{
+			name:        "exchange used as it is",
+			mismatched:  map[string]string{"transactions": "type"},
+			opts:        []Option{WithDeclareMismatch(MismatchPassive)},
+			wantPassive: []string{"transactions"},
+		},
+		{
+			name:        "queues used as they are",
+			mismatched:  map[string]string{"test_events": "x-message-ttl", "test_events_dlq": "x-queue-type"},
+			opts:        []Option{WithDeclareMismatch(MismatchPassive)},
+			wantPassive: []string{"test_events_dlq", "test_events"},
+		},
+		{
+			name:       "unknown behavior fails",
+			mismatched: map[string]string{"test_events": "x-message-ttl"},
+			opts:       []Option{WithDeclareMismatch("ignore")},
+			wantErr:    []string{`queue "test_events" already exists with other settings`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ch := &mismatchChannel{fakeChannel: newFakeChannel(), mismatched: tt.mismatched}
+			broker, err := newBroker[testEvent](&mismatchConnection{ch: ch}, ch, "transactions", testMapper{}, tt.opts...)
+			if err == nil {
+				err = broker.Subscribe(ctx, Queue{Name: "test_events", Bindings: []string{"transaction.completed"}}, func(context.Context, testEvent) error {
+					return nil
+				})
+			}
+
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("declaration error = %v, want the existing declarations used", err)
+				}
+			} else {
+				if !errors.Is(err, ErrDeclarationMismatch) {
+					t.Fatalf("declaration error = %v, want %v", err, ErrDeclarationMismatch)
+				}
+				// The error tells which declaration to fix and how it differs
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("declaration error = %q, want it to mention %q", err, want)
+					}
+				}
+			}
+
+			ch.mu.Lock()
+			defer ch.mu.Unlock()
+			if !slices.Equal(ch.passive, tt.wantPassive) {
+				t.Errorf("passively declared %v, want %v", ch.passive, tt.wantPassive)
+			}
+		})
+	}
+}
+
+// refusingChannel refuses every exchange declaration for lack of permissions
+type refusingChannel struct {
+	*fakeChannel
+}
+
+func (c *refusingChannel) ExchangeDeclare(string, string, bool, bool, bool, bool, amqp.Table) error {
+	return &amqp.Error{Code: amqp.AccessRefused, Reason: "ACCESS_REFUSED - access to exchange 'transactions' in vhost '/' refused"}
+}
+
+func TestDeclarationOtherError(t *testing.T) {
+	ch := newFakeChannel()
+	refused := &refusingChannel{fakeChannel: ch}
+	_, err := newBroker[testEvent](&fakeConnection{ch: ch}, refused, "transactions", testMapper{}, WithDeclareMismatch(MismatchPassive))
+
+	// Only mismatches are used as they are; other errors still fail the declaration
+	var amqpErr *amqp.Error
+	if !errors.As(err, &amqpErr) || amqpErr.Code != amqp.AccessRefused || errors.Is(err, ErrDeclarationMismatch) {
+		t.Errorf("declaration error = %v, want the access refusal", err)
+	}
+}
@@ -0,0 +1,104 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	eventsv1 "internal-transfers/pkg/api/events/v1"
+	"internal-transfers/pkg/consumer"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"google.golang.org/protobuf/proto"
+)
+
+// Content types of published events. Consumers decode each message according to its
+// content type, so services using different encodings can share the exchange.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "avro/binary"
+)
+
+// EventEncoding selects how events are encoded when published
+type EventEncoding string
+
+const (
+	EncodingJSON     EventEncoding = "json"
+	EncodingProtobuf EventEncoding = "protobuf"
+	EncodingAvro     EventEncoding = "avro"
+)
+
+// WithEventEncoding sets the encoding of published events; JSON is used by default.
+// EncodingAvro falls back to JSON unless a schema registry is set with WithSchemaRegistry.
+func WithEventEncoding(encoding EventEncoding) Option {
+	return func(o *options) {
+		if encoding == EncodingJSON || encoding == EncodingProtobuf || encoding == EncodingAvro {
+			o.encoding = encoding
+		}
+	}
+}
+
+// encodeEvent encodes event with the configured encoding and returns the body with its content type
+func (b *Broker[E]) encodeEvent(ctx context.Context, event E) ([]byte, string, error) {
+	switch {
+	case b.encoding == EncodingAvro && b.registry != nil:
+		body, err := b.encodeAvro(ctx, b.mapper.ToProto(event))
+		if err != nil {
+			return nil, "", err
+		}
+		return body, ContentTypeAvro, nil
+	case b.encoding == EncodingProtobuf:
+		body, err := proto.Marshal(b.mapper.ToProto(event))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to marshal event: %w", err)
+		}
+		return body, ContentTypeProtobuf, nil
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return body, ContentTypeJSON, nil
+}
+
+// decodeEvent decodes an event according to its content type. Messages without a
+// content type are treated as JSON, as published by older versions.
+func (b *Broker[E]) decodeEvent(ctx context.Context, contentType string, body []byte) (E, error) {
+	var event E
+	switch contentType {
+	case ContentTypeAvro:
+		msg, err := b.decodeAvro(ctx, body)
+		if err != nil {
+			return event, err
+		}
+		return b.mapper.FromProto(msg), nil
+	case ContentTypeProtobuf:
+		var msg eventsv1.TransactionEvent
+		if err := proto.Unmarshal(body, &msg); err != nil {
+			return event, fmt.Errorf("failed to unmarshal protobuf event: %w", err)
+		}
+		return b.mapper.FromProto(&msg), nil
+	case ContentTypeJSON, "":
+		if err := json.Unmarshal(body, &event); err != nil {
+			return event, fmt.Errorf("failed to unmarshal JSON event: %w", err)
+		}
+		return event, nil
+	default:
+		return event, fmt.Errorf("unsupported content type %q", contentType)
+	}
+}
+
+// decodeDelivery decodes a consumed event, marking errors for the consumer: events whose
+// schema cannot be fetched are retried later, undecodable events are dead-lettered
+func (b *Broker[E]) decodeDelivery(ctx context.Context, msg amqp.Delivery) (E, error) {
+	event, err := b.decodeEvent(ctx, msg.ContentType, msg.Body)
+	if errors.Is(err, errSchemaUnavailable) {
+		return event, fmt.Errorf("%w: %w", consumer.ErrUnavailable, err)
+	}
+	if err != nil {
+		return event, fmt.Errorf("%w: failed to decode event: %w", consumer.ErrMalformed, err)
+	}
+	return event, nil
+}
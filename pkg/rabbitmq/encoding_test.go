@@ -0,0 +1,82 @@
+package rabbitmq
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEventEncodingRoundTrip(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            []Option
+		wantContentType string
+	}{
+		{name: "default", wantContentType: ContentTypeJSON},
+		{name: "json", opts: []Option{WithEventEncoding(EncodingJSON)}, wantContentType: ContentTypeJSON},
+		{name: "protobuf", opts: []Option{WithEventEncoding(EncodingProtobuf)}, wantContentType: ContentTypeProtobuf},
+		// Without a schema registry Avro falls back to JSON
+		{name: "avro without a registry", opts: []Option{WithEventEncoding(EncodingAvro)}, wantContentType: ContentTypeJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := newFakeChannel()
+			broker, err := newBroker[testEvent](&fakeConnection{ch: ch}, ch, "transactions", testMapper{}, tt.opts...)
+			if err != nil {
+				t.Fatalf("newBroker() error = %v", err)
+			}
+			if err := broker.Publish(context.Background(), "test.event", testEvent{ID: 7}); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			published := ch.published[0]
+			if published.ContentType != tt.wantContentType {
+				t.Errorf("content type = %q, want %q", published.ContentType, tt.wantContentType)
+			}
+
+			// A consumer using the default encoding decodes the event by its content type
+			consumer, err := newBroker[testEvent](&fakeConnection{ch: ch}, ch, "transactions", testMapper{})
+			if err != nil {
+				t.Fatalf("newBroker() error = %v", err)
+			}
+			event, err := consumer.decodeEvent(context.Background(), published.ContentType, published.Body)
+			if err != nil {
+				t.Fatalf("decodeEvent() error = %v", err)
+			}
+			if event.ID != 7 {
+				t.Errorf("decoded event %+v, want ID 7", event)
+			}
+		})
+	}
+}
+
+func TestDecodeEvent(t *testing.T) {
+	ch := newFakeChannel()
+	broker, err := newBroker[testEvent](&fakeConnection{ch: ch}, ch, "transactions", testMapper{})
+	if err != nil {
+		t.Fatalf("newBroker() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		wantErr     bool
+	}{
+		// Older publishers sent JSON without a content type
+		{name: "without content type", body: []byte(`{"id": 7}`)},
+		{name: "invalid JSON", contentType: ContentTypeJSON, body: []byte(`{"id":`), wantErr: true},
+		{name: "JSON sent as protobuf", contentType: ContentTypeProtobuf, body: []byte(`{"id": 7}`), wantErr: true},
+		{name: "unsupported content type", contentType: "text/plain", body: []byte("7"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := broker.decodeEvent(context.Background(), tt.contentType, tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeEvent() error = %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && event.ID != 7 {
+				t.Errorf("decoded event %+v, want ID 7", event)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLimiter counts requests in the memory of a single instance
+type MemoryLimiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]*memoryWindow
+	pruneAt time.Time
+}
+
+type memoryWindow struct {
+	count int
+	endAt time.Time
+}
+
+// NewMemoryLimiter allows limit requests per key in each window
+func NewMemoryLimiter(limit int, window time.Duration) *MemoryLimiter {
+	return &MemoryLimiter{limit: limit, window: window, now: time.Now, windows: make(map[string]*memoryWindow)}
+}
+
+// Allow counts a request for key in its current window
+func (l *MemoryLimiter) Allow(_ context.Context, key string) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	// Windows that ended are dropped once per window, so that clients seen once do not pile up
+	if !now.Before(l.pruneAt) {
+		for k, w := range l.windows {
+			if !now.Before(w.endAt) {
+				delete(l.windows, k)
+			}
+		}
+		l.pruneAt = now.Add(l.window)
+	}
+
+	w, ok := l.windows[key]
+	if !ok || !now.Before(w.endAt) {
+		w = &memoryWindow{endAt: now.Add(l.window)}
+		l.windows[key] = w
+	}
+	w.count++
+	return w.count <= l.limit, w.endAt.Sub(now), nil
+}
@@ -0,0 +1,60 @@
+// Package ratelimit limits how many requests each client may make per time window. Running
+// several instances of a service requires a limiter they share, such as RedisLimiter, so that a
+// client spreading its requests over the instances is still held to the limit.
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limiter counts requests per key in fixed time windows
+type Limiter interface {
+	// Allow counts a request for key and reports whether it is within the limit of the current
+	// window, and how long is left until the window ends
+	Allow(ctx context.Context, key string) (bool, time.Duration, error)
+}
+
+// errorResponse is the body of the responses to limited requests, in the services' error format
+type errorResponse struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// Middleware answers 429 Too Many Requests, with a Retry-After header, to the requests of a client
+// over the limit. Clients are told apart by their IP address. Requests are let through, with a
+// warning, when the limiter fails, so that an unreachable Redis does not take the API down.
+func Middleware(limiter Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, retryAfter, err := limiter.Allow(r.Context(), clientIP(r))
+			if err != nil {
+				slog.WarnContext(r.Context(), "rate limiter unavailable, letting request through", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(max(retryAfter.Round(time.Second), time.Second)/time.Second)))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(w).Encode(errorResponse{Code: "too_many_requests", Error: "rate limit exceeded"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the IP address the request came from
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testLimiter checks the behavior every Limiter must have; newLimiter returns a limiter allowing
+// limit requests per window and sharing its counts with every other limiter it returns, like two
+// instances of a service
+func testLimiter(t *testing.T, limit int, window time.Duration, newLimiter func() Limiter) {
+	ctx := context.Background()
+
+	t.Run("limit", func(t *testing.T) {
+		limiters := []Limiter{newLimiter(), newLimiter()}
+		for i := range limit {
+			allowed, _, err := limiters[i%len(limiters)].Allow(ctx, "client")
+			if err != nil || !allowed {
+				t.Fatalf("request %d: Allow() = %v, %v, want it allowed", i+1, allowed, err)
+			}
+		}
+
+		allowed, retryAfter, err := limiters[limit%len(limiters)].Allow(ctx, "client")
+		if err != nil || allowed {
+			t.Fatalf("request over the limit: Allow() = %v, %v, want it denied", allowed, err)
+		}
+		if retryAfter <= 0 || retryAfter > window {
+			t.Errorf("retry after %v, want it within the window of %v", retryAfter, window)
+		}
+
+		if allowed, _, err := limiters[0].Allow(ctx, "other client"); err != nil || !allowed {
+			t.Errorf("other client: Allow() = %v, %v, want it allowed", allowed, err)
+		}
+	})
+
+	t.Run("next window", func(t *testing.T) {
+		limiter := newLimiter()
+		for range limit + 1 {
+			if _, _, err := limiter.Allow(ctx, "returning client"); err != nil {
+				t.Fatalf("Allow() error = %v", err)
+			}
+		}
+		time.Sleep(window + 50*time.Millisecond)
+		if allowed, _, err := limiter.Allow(ctx, "returning client"); err != nil || !allowed {
+			t.Errorf("next window: Allow() = %v, %v, want it allowed", allowed, err)
+		}
+	})
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	limiter := NewMemoryLimiter(3, 200*time.Millisecond)
+	testLimiter(t, 3, 200*time.Millisecond, func() Limiter { return limiter })
+}
+
+// stubLimiter answers every request with the same result
+type stubLimiter struct {
+	allowed    bool
+	retryAfter time.Duration
+	err        error
+}
+
+func (l stubLimiter) Allow(context.Context, string) (bool, time.Duration, error) {
+	return l.allowed, l.retryAfter, l.err
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		limiter        Limiter
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{name: "allowed", limiter: stubLimiter{allowed: true}, wantStatus: http.StatusOK},
+		{name: "over the limit", limiter: stubLimiter{retryAfter: 1400 * time.Millisecond}, wantStatus: http.StatusTooManyRequests, wantRetryAfter: "1"},
+		{name: "window almost over", limiter: stubLimiter{retryAfter: time.Millisecond}, wantStatus: http.StatusTooManyRequests, wantRetryAfter: "1"},
+		{name: "limiter unavailable", limiter: stubLimiter{err: errors.New("connection refused")}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Middleware(tt.limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/transactions", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
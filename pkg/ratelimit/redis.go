@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// allowScript counts a request in the window of KEYS[1], starting a window of ARGV[1] milliseconds
+// with the first request, and returns the count and the milliseconds left in the window. Running
+// it as a script makes counting and starting the window atomic.
+var allowScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return {count, redis.call("PTTL", KEYS[1])}
+`)
+
+// RedisLimiter counts requests in Redis, shared by every instance of a service
+type RedisLimiter struct {
+	client redis.UniversalClient
+	prefix string
+	limit  int
+	window time.Duration
+}
+
+// NewRedisLimiter allows limit requests per key in each window, counting them under prefix
+// followed by the key
+func NewRedisLimiter(client redis.UniversalClient, prefix string, limit int, window time.Duration) *RedisLimiter {
+	return &RedisLimiter{client: client, prefix: prefix, limit: limit, window: window}
+}
+
+// Allow counts a request for key in its current window
+func (l *RedisLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	result, err := allowScript.Run(ctx, l.client, []string{l.prefix + key}, l.window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to count request: %w", err)
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("failed to count request: unexpected script result %v", result)
+	}
+	return result[0] <= int64(l.limit), time.Duration(result[1]) * time.Millisecond, nil
+}
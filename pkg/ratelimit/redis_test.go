@@ -0,0 +1,15 @@
+package ratelimit
+
+import (
+	"internal-transfers/pkg/redistest"
+	"testing"
+	"time"
+)
+
+func TestRedisLimiter(t *testing.T) {
+	server := redistest.Start(t)
+	// Each limiter has a client of its own, like the instances of a service sharing the counts through Redis
+	testLimiter(t, 3, 200*time.Millisecond, func() Limiter {
+		return NewRedisLimiter(server.NewClient(t), "ratelimit:", 3, 200*time.Millisecond)
+	})
+}
@@ -0,0 +1,74 @@
+// Package redistest runs a Redis server in a container for the duration of a test, so that code
+// shared by several instances through Redis can be tested against a real server.
+package redistest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/testcontainers/testcontainers-go"
+	tcredis "github.com/testcontainers/testcontainers-go/modules/redis"
+)
+
+// Image is the Redis image the server runs
+const Image = "redis:7-alpine"
+
+// Server is a Redis server started for a test
+type Server struct {
+	options *redis.Options
+}
+
+// Start runs a Redis server until the test ends, skipping the test when Docker is not available
+func Start(t *testing.T) *Server {
+	t.Helper()
+	if !dockerAvailable() {
+		t.Skip("Docker is not available to run Redis")
+	}
+
+	ctx := context.Background()
+	container, err := tcredis.Run(ctx, Image)
+	t.Cleanup(func() {
+		if err := testcontainers.TerminateContainer(container); err != nil {
+			t.Errorf("failed to stop Redis: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to start Redis: %v", err)
+	}
+
+	uri, err := container.ConnectionString(ctx)
+	if err != nil {
+		t.Fatalf("failed to get the Redis address: %v", err)
+	}
+	options, err := redis.ParseURL(uri)
+	if err != nil {
+		t.Fatalf("failed to parse the Redis address %q: %v", uri, err)
+	}
+	return &Server{options: options}
+}
+
+// dockerAvailable reports whether Docker can run containers; testcontainers panics instead of
+// returning an error when it finds no Docker host
+func dockerAvailable() (available bool) {
+	defer func() {
+		if recover() != nil {
+			available = false
+		}
+	}()
+	provider, err := testcontainers.ProviderDocker.GetProvider()
+	if err != nil {
+		return false
+	}
+	defer provider.Close()
+	return provider.Health(context.Background()) == nil
+}
+
+// NewClient opens a connection of its own to the server, closed when the test ends, like another
+// instance of a service would
+func (s *Server) NewClient(t *testing.T) *redis.Client {
+	t.Helper()
+	client := redis.NewClient(s.options)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
@@ -0,0 +1,82 @@
+// Package retention periodically deletes old entries from tables that would otherwise grow without
+// bound, such as the processed message IDs used to skip redelivered messages.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Sweep settings shared by the services
+const (
+	// DefaultInterval is how often expired entries are deleted
+	DefaultInterval = time.Hour
+	// MinTTL is the shortest retention accepted. Entries are recorded once a message has been
+	// handled, so anything younger may still be protecting a delivery that is being redelivered.
+	MinTTL = time.Hour
+)
+
+// Pruner deletes the entries recorded before a cutoff. Implementations may delete in batches and
+// report how many entries were deleted by this call; Sweep calls them until nothing is left.
+type Pruner interface {
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Sweeper deletes the entries of a table once they are older than its TTL
+type Sweeper struct {
+	name     string
+	pruner   Pruner
+	ttl      time.Duration
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewSweeper creates a sweeper that deletes the entries of the named table older than ttl every interval
+func NewSweeper(name string, pruner Pruner, ttl, interval time.Duration) *Sweeper {
+	return &Sweeper{
+		name:     name,
+		pruner:   pruner,
+		ttl:      ttl,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Run sweeps on every interval until the context is cancelled
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.Sweep(ctx)
+			if err != nil {
+				fmt.Printf("Failed to delete expired %s: %v\n", s.name, err)
+				continue
+			}
+			if deleted > 0 {
+				fmt.Printf("Deleted %d expired %s\n", deleted, s.name)
+			}
+		}
+	}
+}
+
+// Sweep deletes the entries older than the TTL and returns how many were deleted
+func (s *Sweeper) Sweep(ctx context.Context) (int64, error) {
+	cutoff := s.now().Add(-s.ttl)
+	var total int64
+	for {
+		deleted, err := s.pruner.Prune(ctx, cutoff)
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+		if deleted == 0 {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// memoryPruner keeps the times entries were recorded at and deletes at most batch of them per Prune
+type memoryPruner struct {
+	entries map[string]time.Time
+	batch   int
+	calls   int
+	err     error
+}
+
+func (p *memoryPruner) Prune(_ context.Context, before time.Time) (int64, error) {
+	p.calls++
+	if p.err != nil {
+		return 0, p.err
+	}
+	var deleted int64
+	for key, recorded := range p.entries {
+		if deleted == int64(p.batch) {
+			break
+		}
+		if recorded.Before(before) {
+			delete(p.entries, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (p *memoryPruner) keys() []string {
+	keys := make([]string, 0, len(p.entries))
+	for key := range p.entries {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	pruner := &memoryPruner{
+		batch: 2,
+		entries: map[string]time.Time{
+			"a": now.Add(-72 * time.Hour),
+			"b": now.Add(-25 * time.Hour),
+			"c": now.Add(-24*time.Hour - time.Second),
+			"d": now.Add(-24 * time.Hour),
+			"e": now.Add(-time.Hour),
+			"f": now,
+		},
+	}
+	sweeper := NewSweeper("processed messages", pruner, 24*time.Hour, DefaultInterval)
+	sweeper.now = func() time.Time { return now }
+
+	// Entries are deleted in batches until none is older than the TTL
+	deleted, err := sweeper.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("Sweep() deleted %d entries, want 3", deleted)
+	}
+	if want := []string{"d", "e", "f"}; !slices.Equal(pruner.keys(), want) {
+		t.Errorf("remaining entries = %v, want %v", pruner.keys(), want)
+	}
+	if pruner.calls != 3 {
+		t.Errorf("Prune() called %d times, want 3 with batches of 2", pruner.calls)
+	}
+
+	// Entries recorded within the TTL survive later sweeps until they expire
+	deleted, err = sweeper.Sweep(context.Background())
+	if err != nil || deleted != 0 {
+		t.Errorf("second Sweep() = %d, %v, want nothing deleted", deleted, err)
+	}
+	now = now.Add(time.Hour)
+	if deleted, err := sweeper.Sweep(context.Background()); err != nil || deleted != 1 {
+		t.Errorf("Sweep() an hour later = %d, %v, want 1 deleted", deleted, err)
+	}
+	if want := []string{"e", "f"}; !slices.Equal(pruner.keys(), want) {
+		t.Errorf("remaining entries = %v, want %v", pruner.keys(), want)
+	}
+}
+
+func TestSweepError(t *testing.T) {
+	errDown := errors.New("database down")
+	pruner := &memoryPruner{err: errDown}
+	if _, err := NewSweeper("idempotency keys", pruner, MinTTL, DefaultInterval).Sweep(context.Background()); !errors.Is(err, errDown) {
+		t.Errorf("Sweep() error = %v, want %v", err, errDown)
+	}
+	if pruner.calls != 1 {
+		t.Errorf("Prune() called %d times, want the sweep to stop at the first error", pruner.calls)
+	}
+}
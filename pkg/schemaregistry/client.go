@@ -0,0 +1,172 @@
+// Package schemaregistry is a minimal client for a Confluent-compatible schema registry, together
+// with the wire format of messages whose Avro schema is kept in the registry.
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// DefaultTimeout bounds a single request to the registry when WithHTTPClient is not used
+const DefaultTimeout = 5 * time.Second
+
+// contentType is the media type of requests to and responses from the registry
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// magicByte starts every message in the registry wire format, followed by the 4-byte schema ID
+const magicByte = 0
+
+// ErrInvalidMessage is returned when a message is not in the registry wire format
+var ErrInvalidMessage = errors.New("message is not in the schema registry wire format")
+
+// Client registers and looks up Avro schemas. Schemas and IDs never change once registered,
+// so both are cached for the lifetime of the client.
+type Client struct {
+	baseURL string
+	http    *http.Client
+
+	mu     sync.Mutex
+	ids    map[string]int
+	codecs map[int]*goavro.Codec
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used to reach the registry
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		if client != nil {
+			c.http = client
+		}
+	}
+}
+
+// NewClient creates a client for the registry at baseURL, e.g. "http://schema-registry:8081"
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: DefaultTimeout},
+		ids:     make(map[string]int),
+		codecs:  make(map[int]*goavro.Codec),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Register registers schema under subject, unless the registry already has it, and returns its ID.
+// The registry rejects schemas that are incompatible with the versions already registered.
+func (c *Client) Register(ctx context.Context, subject, schema string) (int, error) {
+	key := subject + "\x00" + schema
+	c.mu.Lock()
+	id, ok := c.ids[key]
+	c.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	body, err := json.Marshal(struct {
+		Schema string `json:"schema"`
+	}{Schema: schema})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+
+	var resp struct {
+		ID int `json:"id"`
+	}
+	path := "/subjects/" + url.PathEscape(subject) + "/versions"
+	if err := c.do(ctx, http.MethodPost, path, body, &resp); err != nil {
+		return 0, fmt.Errorf("failed to register schema for subject %s: %w", subject, err)
+	}
+
+	c.mu.Lock()
+	c.ids[key] = resp.ID
+	c.mu.Unlock()
+	return resp.ID, nil
+}
+
+// Codec returns a codec for the schema with the given ID, fetching it from the registry when needed
+func (c *Client) Codec(ctx context.Context, id int) (*goavro.Codec, error) {
+	c.mu.Lock()
+	codec, ok := c.codecs[id]
+	c.mu.Unlock()
+	if ok {
+		return codec, nil
+	}
+
+	var resp struct {
+		Schema string `json:"schema"`
+	}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch schema %d: %w", id, err)
+	}
+	codec, err := goavro.NewCodec(resp.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema %d: %w", id, err)
+	}
+
+	c.mu.Lock()
+	c.codecs[id] = codec
+	c.mu.Unlock()
+	return codec, nil
+}
+
+// do sends a request to the registry and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", contentType)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("registry returned status %d: %s", resp.StatusCode, apiErr.Message)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode registry response: %w", err)
+	}
+	return nil
+}
+
+// Frame prefixes an Avro payload with the ID of the schema it was written with
+func Frame(id int, payload []byte) []byte {
+	msg := make([]byte, 5, 5+len(payload))
+	msg[0] = magicByte
+	binary.BigEndian.PutUint32(msg[1:5], uint32(id))
+	return append(msg, payload...)
+}
+
+// Unframe splits a message into the ID of the schema it was written with and its Avro payload
+func Unframe(msg []byte) (int, []byte, error) {
+	if len(msg) < 5 || msg[0] != magicByte {
+		return 0, nil, ErrInvalidMessage
+	}
+	return int(binary.BigEndian.Uint32(msg[1:5])), msg[5:], nil
+}
@@ -0,0 +1,105 @@
+// Package secrets fetches service credentials, such as the database and RabbitMQ passwords, from a
+// secrets backend instead of plaintext environment variables.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds a single request to the secrets backend when WithHTTPClient is not used
+const DefaultTimeout = 10 * time.Second
+
+// ErrNotFound is returned by a CredentialProvider that holds no credentials under the requested name
+var ErrNotFound = errors.New("credentials not found")
+
+// Credentials are the user name and password used to connect to a dependency. Either may be
+// empty when the backend only holds the other.
+type Credentials struct {
+	User     string
+	Password string
+}
+
+// CredentialProvider fetches the credentials stored under a name, e.g. "db" or "rabbitmq"
+type CredentialProvider interface {
+	Credentials(ctx context.Context, name string) (Credentials, error)
+}
+
+// VaultProvider reads credentials from a HashiCorp Vault KV version 2 secrets engine. The secret
+// of each name is read from <path>/<name> and holds the "username" and "password" keys.
+type VaultProvider struct {
+	addr  string
+	token string
+	path  string
+	http  *http.Client
+}
+
+// Option configures a VaultProvider
+type Option func(*VaultProvider)
+
+// WithHTTPClient sets the HTTP client used to reach Vault
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *VaultProvider) {
+		if client != nil {
+			p.http = client
+		}
+	}
+}
+
+// NewVaultProvider creates a provider for the Vault server at addr, e.g. "https://vault:8200",
+// authenticating with token and reading secrets below path, e.g. "secret/data/internal-transfers"
+func NewVaultProvider(addr, token, path string, opts ...Option) *VaultProvider {
+	p := &VaultProvider{
+		addr:  strings.TrimRight(addr, "/"),
+		token: token,
+		path:  strings.Trim(path, "/"),
+		http:  &http.Client{Timeout: DefaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Credentials reads the secret stored under name
+func (p *VaultProvider) Credentials(ctx context.Context, name string) (Credentials, error) {
+	endpoint := p.addr + "/v1/" + p.path + "/" + url.PathEscape(name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to reach vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return Credentials{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	case resp.StatusCode != http.StatusOK:
+		return Credentials{}, fmt.Errorf("vault returned status %d for secret %s", resp.StatusCode, name)
+	}
+
+	var body struct {
+		Data struct {
+			Data struct {
+				Username string `json:"username"`
+				Password string `json:"password"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Credentials{}, fmt.Errorf("failed to decode vault secret %s: %w", name, err)
+	}
+
+	return Credentials{User: body.Data.Data.Username, Password: body.Data.Data.Password}, nil
+}
@@ -0,0 +1,62 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVaultProvider(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/internal-transfers/db":
+			w.Write([]byte(`{"data": {"data": {"username": "app", "password": "db-secret"}, "metadata": {"version": 3}}}`))
+		case "/v1/secret/data/internal-transfers/rabbitmq":
+			w.Write([]byte(`{"data": {"data": {"password": "mq-secret"}}}`))
+		default:
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+
+	tests := []struct {
+		name    string
+		token   string
+		secret  string
+		want    Credentials
+		wantErr error
+		failure bool
+	}{
+		{name: "user and password", token: "s.token", secret: "db", want: Credentials{User: "app", Password: "db-secret"}},
+		{name: "password only", token: "s.token", secret: "rabbitmq", want: Credentials{Password: "mq-secret"}},
+		{name: "missing secret", token: "s.token", secret: "redis", wantErr: ErrNotFound},
+		{name: "invalid token", token: "s.other", secret: "db", failure: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewVaultProvider(vault.URL+"/", tt.token, "/secret/data/internal-transfers/")
+			got, err := provider.Credentials(context.Background(), tt.secret)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Credentials() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.failure:
+				if err == nil || errors.Is(err, ErrNotFound) {
+					t.Fatalf("Credentials() error = %v, want a failure other than %v", err, ErrNotFound)
+				}
+			case err != nil:
+				t.Fatalf("Credentials() error = %v", err)
+			case got != tt.want:
+				t.Errorf("Credentials() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,40 +2,211 @@ package main
 
 import (
 	"context"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	_ "internal-transfers/transaction-service/docs"
+	"internal-transfers/pkg/admin"
+	"internal-transfers/pkg/config"
+	"internal-transfers/pkg/correlation"
+	"internal-transfers/pkg/database"
+	"internal-transfers/pkg/features"
+	"internal-transfers/pkg/idempotency"
+	"internal-transfers/pkg/metrics"
+	"internal-transfers/pkg/rabbitmq"
+	"internal-transfers/pkg/ratelimit"
+	"internal-transfers/pkg/retention"
+	"internal-transfers/pkg/schemaregistry"
+	"internal-transfers/transaction-service/docs"
 	"internal-transfers/transaction-service/internal/application"
+	"internal-transfers/transaction-service/internal/clock"
 	"internal-transfers/transaction-service/internal/domain"
+	"internal-transfers/transaction-service/internal/infrastructure/accounts"
+	"internal-transfers/transaction-service/internal/infrastructure/archive"
 	"internal-transfers/transaction-service/internal/infrastructure/messaging"
 	"internal-transfers/transaction-service/internal/infrastructure/postgres"
+	"internal-transfers/transaction-service/internal/infrastructure/webhooks"
+	grpcHandler "internal-transfers/transaction-service/internal/interfaces/grpc"
 	httpHandler "internal-transfers/transaction-service/internal/interfaces/http"
 
 	"log/slog"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
 func main() {
+	// Load and validate configuration, reporting every problem at once
+	env := config.NewEnv()
+	cfg := config.Load(env, "transaction-service", "8081")
+	// Idempotency keys and rate limit counts, kept in Redis when several instances run
+	stateCfg := config.LoadState(env)
+	idempotencyKeyTTL := env.Duration("IDEMPOTENCY_KEY_TTL", httpHandler.DefaultIdempotencyKeyTTL)
+	grpcPort := env.Port("GRPC_PORT", "9091")
+	accountServiceURL := env.String("ACCOUNT_SERVICE_URL", "http://localhost:8080")
+	accountServiceBasePath := env.Path("ACCOUNT_SERVICE_BASE_PATH", config.DefaultBasePath)
+	// The ledger is read from the admin listener of the account service (unset leaves the trace and reconciliation without it)
+	accountServiceAdminURL := env.String("ACCOUNT_SERVICE_ADMIN_URL", "")
+	// Limit the number of pending transactions per source account (0 disables the limit)
+	maxPending := env.Int("MAX_PENDING_TRANSACTIONS_PER_ACCOUNT", 0, 0, math.MaxInt)
+	// Identical transfers submitted within this window return the earlier one, with duplicate_transfer_check on
+	duplicateWindow := env.Duration("DUPLICATE_TRANSFER_WINDOW", application.DefaultDuplicateWindow)
+	// Transfers are checked against known accounts, cached for this long (unset disables the check)
+	accountCacheTTL := env.Duration("ACCOUNT_CACHE_TTL", 0)
+	// Status event streams poll for changes made by other instances this often, and close after the timeout
+	streamPollInterval := env.Duration("STATUS_STREAM_POLL_INTERVAL", httpHandler.DefaultStreamPollInterval)
+	streamTimeout := env.Duration("STATUS_STREAM_TIMEOUT", httpHandler.DefaultStreamTimeout)
+	// Pending transactions older than the expiry age are failed by the sweeper
+	expiryAge := env.Duration("TRANSACTION_EXPIRY_AGE", 30*time.Minute)
+	expiryInterval := env.Duration("TRANSACTION_EXPIRY_SWEEP_INTERVAL", time.Minute)
+	// The previous day's completed transactions are checked against the ledger this often (unset disables the job)
+	reconciliationInterval := env.Duration("RECONCILIATION_INTERVAL", 0)
+	// Endpoints listed in this JSON file are notified of completed and failed transfers (unset disables webhooks)
+	webhooksFile := env.String("WEBHOOKS_FILE", "")
+	// Completed and failed transfers are archived to this sink for analytics: "off" or "s3"
+	archiveSink := env.OneOf("EVENT_ARCHIVE_SINK", "off", "off", "s3")
+	archivePrefix := env.String("EVENT_ARCHIVE_PREFIX", "transactions/")
+	archiveBatchBytes := env.Int("EVENT_ARCHIVE_BATCH_BYTES", archive.DefaultBatchBytes, 1<<10, 1<<30)
+	archiveFlushInterval := env.Duration("EVENT_ARCHIVE_FLUSH_INTERVAL", archive.DefaultFlushInterval)
+	archiveBatchEvents := env.Int("EVENT_ARCHIVE_BATCH_EVENTS", archive.DefaultBatchEvents, 1, 64)
+	var archiveEndpoint, archiveRegion, archiveBucket, archiveAccessKey, archiveSecretKey string
+	if archiveSink == "s3" {
+		archiveEndpoint = env.Required("EVENT_ARCHIVE_S3_ENDPOINT")
+		archiveRegion = env.String("EVENT_ARCHIVE_S3_REGION", "us-east-1")
+		archiveBucket = env.Required("EVENT_ARCHIVE_S3_BUCKET")
+		archiveAccessKey, archiveSecretKey = env.Credentials("archive", "EVENT_ARCHIVE_S3_ACCESS_KEY", "EVENT_ARCHIVE_S3_SECRET_KEY")
+	}
+	consumerTag := env.String("CONSUMER_TAG", rabbitmq.DefaultConsumerTag("transaction-service"))
+	// Unacknowledged deliveries per subscription (0 uses the consumer concurrency)
+	consumerPrefetch := env.Int("CONSUMER_PREFETCH", 0, 0, 1000)
+	// "auto" acknowledges deliveries on receipt, dropping failed messages instead of retrying them
+	consumerAckMode := env.OneOf("CONSUMER_ACK_MODE", string(rabbitmq.AckManual), string(rabbitmq.AckManual), string(rabbitmq.AckAuto))
+	healthCheckInterval := env.Duration("CONSUMER_HEALTH_CHECK_INTERVAL", rabbitmq.DefaultHealthCheckInterval)
+	publishTimeout := env.Duration("PUBLISH_TIMEOUT", rabbitmq.DefaultPublishTimeout)
+	publishChannels := env.Int("PUBLISH_CHANNELS", 1, 1, 64)
+	// Decimal separator of the amounts clients send over HTTP: "point" (1000.50) or "comma" (1.000,50)
+	amountFormat := env.OneOf("AMOUNT_FORMAT", string(domain.AmountFormatPoint), string(domain.AmountFormatPoint), string(domain.AmountFormatComma))
+	// Decimal places the amounts clients send may have, whatever their currency
+	amountMaxScale := env.Int("AMOUNT_MAX_SCALE", domain.MaxScale, 0, domain.MaxScale)
+	// Replaced by the lenient_amounts feature flag; refused so that lenient parsing is not dropped silently
+	amountParsing := env.String("AMOUNT_PARSING", "")
+	// Currency of the accounts, as configured in the account service
+	currency := env.String("CURRENCY", httpHandler.DefaultCurrency)
+	eventEncoding := env.OneOf("EVENT_ENCODING", string(rabbitmq.EncodingJSON), string(rabbitmq.EncodingJSON), string(rabbitmq.EncodingProtobuf), string(rabbitmq.EncodingAvro))
+	exchangeType := env.OneOf("RABBITMQ_EXCHANGE_TYPE", string(rabbitmq.ExchangeTopic), string(rabbitmq.ExchangeTopic), string(rabbitmq.ExchangeDirect))
+	// What to do when the exchange or a queue exists with other settings: "fail" or use it as it is with "passive"
+	declareMismatch := env.OneOf("RABBITMQ_DECLARE_MISMATCH", string(rabbitmq.MismatchFail), string(rabbitmq.MismatchFail), string(rabbitmq.MismatchPassive))
+	schemaRegistryURL := env.String("SCHEMA_REGISTRY_URL", "")
+	// Processed message IDs are deleted once this old (unset keeps them forever)
+	processedMessageRetention := env.DurationAtLeast("PROCESSED_MESSAGE_RETENTION", 0, retention.MinTTL)
+	// What happens to events about transactions that do not exist: "ignore", "log" or "dead-letter"
+	unknownTransactionPolicy := env.OneOf("UNKNOWN_TRANSACTION_EVENTS", string(application.UnknownTransactionLog),
+		string(application.UnknownTransactionIgnore), string(application.UnknownTransactionLog), string(application.UnknownTransactionDeadLetter))
+	// Fees charged to transfers submitted without one, e.g. "0.50", "1%" or "0=0.50,100=1%"
+	feeScheduleList := env.List("FEE_SCHEDULE", "")
+	// Behaviors turned on or off, such as "status_streams=off"; see the features package
+	featureList := env.List("FEATURE_FLAGS", "")
+	if err := env.Err(); err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+	featureFlags, err := features.Parse(featureList)
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+	if amountParsing != "" {
+		slog.Error("Failed to load configuration", "error", "AMOUNT_PARSING is replaced by the lenient_amounts feature flag")
+		os.Exit(1)
+	}
+	if env.String("DUPLICATE_TRANSFER_WINDOW", "") != "" && !featureFlags.Enabled(features.DuplicateTransferCheck) {
+		slog.Error("Failed to load configuration", "error", "DUPLICATE_TRANSFER_WINDOW is set but the duplicate_transfer_check feature flag is off")
+		os.Exit(1)
+	}
+	feeSchedule, err := application.ParseFeeSchedule(feeScheduleList, currency)
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
 	// Initialize structured logger
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-	logger.Info("Starting transaction service", "port", "8081")
+	logger := cfg.Log.NewLogger()
+	slog.SetDefault(logger)
+	logger.Info("Starting transaction service", "port", cfg.HTTP.Port)
 
 	// Initialize database connection
-	db, err := postgres.NewDBPool(context.Background())
+	db, err := postgres.NewDBPool(context.Background(), cfg.DB)
 	if err != nil {
 		logger.Error("Failed to connect to database", "error", err)
 		os.Exit(1)
 	}
 	defer db.Close()
+	if err := postgres.CheckSchema(context.Background(), db); err != nil {
+		logger.Error("Database schema check failed", "error", err)
+		os.Exit(1)
+	}
+
+	// Idempotency keys and rate limit counts stay with each instance unless they are shared through Redis
+	var (
+		idempotencyStore idempotency.Store = idempotency.NewMemoryStore()
+		rateLimiter      ratelimit.Limiter
+		redisClient      *redis.Client
+	)
+	if stateCfg.Shared() {
+		redisClient = redis.NewClient(&redis.Options{Addr: stateCfg.RedisAddr, Password: stateCfg.RedisPassword, DB: stateCfg.RedisDB})
+		defer redisClient.Close()
+		if err := redisClient.Ping(context.Background()).Err(); err != nil {
+			logger.Error("Failed to connect to Redis", "error", err)
+			os.Exit(1)
+		}
+		idempotencyStore = idempotency.NewRedisStore(redisClient, "transaction-service:idempotency:")
+	}
+	if stateCfg.RateLimit > 0 {
+		rateLimiter = ratelimit.NewMemoryLimiter(stateCfg.RateLimit, stateCfg.RateLimitWindow)
+		if redisClient != nil {
+			rateLimiter = ratelimit.NewRedisLimiter(redisClient, "transaction-service:ratelimit:", stateCfg.RateLimit, stateCfg.RateLimitWindow)
+		}
+	}
+
+	queryTimeout := database.WithQueryTimeout(cfg.DB.QueryTimeout)
+	acquireTimeout := database.WithAcquireTimeout(cfg.DB.AcquireTimeout)
+
+	// Avro events need a schema registry; without one they are published as JSON
+	var registry *schemaregistry.Client
+	if schemaRegistryURL != "" {
+		registry = schemaregistry.NewClient(schemaRegistryURL)
+	} else if eventEncoding == string(rabbitmq.EncodingAvro) {
+		logger.Warn("SCHEMA_REGISTRY_URL is not set, publishing events as JSON instead of Avro")
+	}
+
+	// Consumer metrics carry the consumer tag, so replicas can be told apart
+	consumerRegisterer := prometheus.WrapRegistererWith(prometheus.Labels{"consumer_tag": consumerTag}, prometheus.DefaultRegisterer)
 
-	// Initialize RabbitMQ connection
-	broker, err := messaging.NewRabbitMQBroker()
+	// Initialize RabbitMQ connection; consumed message IDs are recorded so redeliveries are skipped,
+	// retried or dead-lettered messages are counted, and consumption pauses while the database is down
+	processedMessages := database.NewProcessedMessageStore(db, queryTimeout, acquireTimeout)
+	broker, err := messaging.NewRabbitMQBroker(
+		cfg.RabbitMQ,
+		rabbitmq.WithProcessedMessageStore(processedMessages),
+		rabbitmq.WithMetrics(metrics.NewConsumerMetrics(consumerRegisterer)),
+		rabbitmq.WithPublishMetrics(metrics.NewPublisherMetrics(prometheus.DefaultRegisterer)),
+		rabbitmq.WithConsumerTag(consumerTag),
+		rabbitmq.WithPrefetch(consumerPrefetch),
+		rabbitmq.WithAckMode(rabbitmq.AckMode(consumerAckMode)),
+		rabbitmq.WithHealthCheck(db, healthCheckInterval),
+		rabbitmq.WithPublishTimeout(publishTimeout),
+		rabbitmq.WithPublishChannels(publishChannels),
+		rabbitmq.WithEventEncoding(rabbitmq.EventEncoding(eventEncoding)),
+		rabbitmq.WithExchangeType(rabbitmq.ExchangeType(exchangeType)),
+		rabbitmq.WithDeclareMismatch(rabbitmq.DeclareMismatch(declareMismatch)),
+		rabbitmq.WithSchemaRegistry(registry),
+	)
 	if err != nil {
 		logger.Error("Failed to connect to RabbitMQ", "error", err)
 		os.Exit(1)
@@ -43,51 +214,214 @@ func main() {
 	defer broker.Close()
 
 	// Initialize repositories
-	transactionRepo := postgres.NewTransactionRepository(db)
+	transactionRepo := postgres.NewTransactionRepository(db, queryTimeout, acquireTimeout)
+
+	// Initialize account service client
+	accountsClient := accounts.NewHTTPClient(accountServiceURL, accountServiceBasePath, accountServiceAdminURL)
 
 	// Initialize services
-	transactionService := application.NewTransactionService(transactionRepo, broker)
+	systemClock := clock.Real{}
 
-	// Subscribe to transaction events
-	if err := broker.SubscribeToTransactionEvents(context.Background(), func(event domain.TransactionEvent) error {
+	// Remember accounts as they are created, so transfers between them are accepted without a lookup
+	var accountCache *accounts.Cache
+	if accountCacheTTL > 0 {
+		accountCache = accounts.NewCache(accountCacheTTL, systemClock)
+		if err := broker.SubscribeToAccountCreated(context.Background(), func(accountID domain.AccountID) error {
+			accountCache.Add(accountID)
+			return nil
+		}); err != nil {
+			logger.Error("Failed to subscribe to account events", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Notify webhook subscribers of the final status of transfers
+	var notifier webhooks.Notifier
+	if webhooksFile != "" {
+		subscriptions, err := webhooks.LoadSubscriptions(webhooksFile)
+		if err != nil {
+			logger.Error("Failed to load webhooks", "error", err)
+			os.Exit(1)
+		}
+		notifier = webhooks.NewDispatcher(subscriptions)
+		logger.Info("Webhooks enabled", "subscriptions", len(subscriptions))
+	}
+
+	// Status changes are handed to the status event streams of clients tracking their transfers
+	statusUpdates := application.NewStatusUpdates()
+
+	serviceOptions := []application.Option{
+		application.WithClock(systemClock),
+		application.WithMaxPendingPerAccount(maxPending),
+		application.WithDuplicateWindow(duplicateWindow),
+		application.WithAccountCache(accountCache),
+		application.WithWebhooks(notifier),
+		application.WithUnknownTransactionPolicy(application.UnknownTransactionPolicy(unknownTransactionPolicy)),
+		application.WithStatusUpdates(statusUpdates),
+		application.WithFeatures(featureFlags),
+	}
+	if !feeSchedule.Empty() {
+		serviceOptions = append(serviceOptions, application.WithFees(feeSchedule, currency))
+		logger.Info("Fee schedule enabled", "tiers", len(feeScheduleList))
+	}
+	transactionService := application.NewTransactionService(transactionRepo, broker, accountsClient, serviceOptions...)
+
+	// Subscribe to transaction events; each status of a transaction is applied at most once
+	if err := broker.SubscribeToTransactionEvents(context.Background(), messaging.DeduplicateEvents(processedMessages, func(ctx context.Context, event domain.TransactionEvent) error {
 		switch event.Status {
-		case string(domain.TransactionStatusComplete):
-			return transactionService.HandleTransactionCompleted(context.Background(), event)
-		case string(domain.TransactionStatusFailed):
-			return transactionService.HandleTransactionFailed(context.Background(), event)
+		case domain.EventStatusComplete:
+			return transactionService.HandleTransactionCompleted(ctx, event)
+		case domain.EventStatusFailed:
+			return transactionService.HandleTransactionFailed(ctx, event)
+		case domain.EventStatusHeld:
+			return transactionService.HandleTransactionHeld(ctx, event)
+		case domain.EventStatusProcessing:
+			return transactionService.HandleTransactionProcessing(ctx, event)
 		default:
 			return nil
 		}
-	}); err != nil {
+	})); err != nil {
 		logger.Error("Failed to subscribe to transaction events", "error", err)
 		os.Exit(1)
 	}
 
+	// Archive completed and failed transfers for analytics. The archive has a queue of its own, consumed
+	// on a separate connection that does not skip processed messages, since their IDs are shared with
+	// the transaction_events queue. Events are acknowledged once their batch is written, so as many are
+	// handled in parallel as a batch holds.
+	var archiveBroker *messaging.RabbitMQBroker
+	var archiver *archive.Archiver
+	if archiveSink == "s3" {
+		archiveBroker, err = messaging.NewRabbitMQBroker(
+			cfg.RabbitMQ,
+			rabbitmq.WithConsumerTag(consumerTag),
+			rabbitmq.WithConcurrency(archiveBatchEvents),
+			rabbitmq.WithPrefetch(consumerPrefetch),
+			rabbitmq.WithExchangeType(rabbitmq.ExchangeType(exchangeType)),
+			rabbitmq.WithDeclareMismatch(rabbitmq.DeclareMismatch(declareMismatch)),
+			rabbitmq.WithSchemaRegistry(registry),
+		)
+		if err != nil {
+			logger.Error("Failed to connect to RabbitMQ for the event archive", "error", err)
+			os.Exit(1)
+		}
+		sink := archive.NewS3Sink(archiveEndpoint, archiveRegion, archiveBucket, archiveAccessKey, archiveSecretKey)
+		archiver = archive.NewArchiver(sink,
+			archive.WithPrefix(archivePrefix),
+			archive.WithBatching(archiveBatchBytes, archiveFlushInterval),
+			archive.WithBatchEvents(archiveBatchEvents),
+		)
+		if err := archiveBroker.SubscribeToFinalTransactionEvents(context.Background(), "transaction_archive", archiver.Archive); err != nil {
+			logger.Error("Failed to subscribe to events to archive", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Event archive enabled", "bucket", archiveBucket, "prefix", archivePrefix)
+	}
+
+	// Expire transactions that stay pending for too long
+	sweeperCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	go application.NewExpirySweeper(transactionRepo, broker, systemClock, expiryAge, expiryInterval).Run(sweeperCtx)
+
+	// Cross-check completed transactions with the account service's ledger, on demand and optionally every day
+	reconciler := application.NewReconciler(transactionRepo, accountsClient, systemClock, reconciliationInterval)
+	if reconciliationInterval > 0 {
+		go reconciler.Run(sweeperCtx)
+	}
+
+	if archiver != nil {
+		go archiver.Run(sweeperCtx)
+	}
+
+	// Delete old deduplication entries
+	if processedMessageRetention > 0 {
+		go retention.NewSweeper("processed messages", processedMessages, processedMessageRetention, retention.DefaultInterval).Run(sweeperCtx)
+	}
+
 	// Initialize handlers
-	transactionHandler := httpHandler.NewTransactionHandler(transactionService)
+	handlerOptions := []httpHandler.HandlerOption{
+		httpHandler.WithFeatures(featureFlags),
+		httpHandler.WithCurrency(currency),
+		httpHandler.WithAmountFormat(domain.AmountFormat(amountFormat)),
+		httpHandler.WithMaxAmountScale(int32(amountMaxScale)),
+		httpHandler.WithBasePath(cfg.HTTP.BasePath),
+		httpHandler.WithStatusStreams(statusUpdates, streamPollInterval, streamTimeout),
+		httpHandler.WithIdempotencyKeys(idempotencyStore, idempotencyKeyTTL),
+	}
+	transactionHandler := httpHandler.NewTransactionHandler(transactionService, reconciler, handlerOptions...)
 
 	// Setup router
 	r := chi.NewRouter()
+	// Every request gets a correlation ID, logged and published with the work it causes
+	r.Use(correlation.Middleware)
 
-	// Swagger
+	// Swagger; requests made from the UI go to the configured base path
+	docs.SwaggerInfo.BasePath = cfg.HTTP.BasePath
 	r.Get("/swagger/*", httpSwagger.Handler(
-		httpSwagger.URL("http://localhost:8081/swagger/doc.json"),
+		httpSwagger.URL("http://localhost:"+cfg.HTTP.Port+"/swagger/doc.json"),
 	))
 
+	// Health, readiness and metrics, on the API listener unless an admin listener is configured
+	adminOptions := []admin.Option{
+		admin.WithCheck("database", db.Ping),
+		admin.WithCheck("broker", admin.ConnectionCheck(broker.IsConnected)),
+	}
+	if redisClient != nil {
+		adminOptions = append(adminOptions, admin.WithCheck("redis", func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		}))
+	}
+	if cfg.HTTP.Profiling {
+		adminOptions = append(adminOptions, admin.WithProfiling())
+	}
+	adminHandler := admin.NewHandler(adminOptions...)
+	if cfg.HTTP.AdminPort == "" {
+		for _, path := range admin.Paths {
+			r.Handle(path, adminHandler)
+		}
+	}
+
 	// API routes
-	r.Route("/api/v1", func(r chi.Router) {
+	r.Route(cfg.HTTP.BasePath, func(r chi.Router) {
+		r.Use(httpHandler.CORS(cfg.HTTP.CORS))
+		if rateLimiter != nil {
+			r.Use(ratelimit.Middleware(rateLimiter))
+		}
 		httpHandler.RegisterHandlers(r, transactionHandler)
 	})
 
-	// Create HTTP server
-	server := &http.Server{
-		Addr:    ":8081",
-		Handler: r,
+	// Serve the gRPC API for internal callers alongside the HTTP API
+	grpcListener, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		logger.Error("Failed to listen for gRPC", "error", err)
+		os.Exit(1)
+	}
+	grpcServer := grpcHandler.NewServer(transactionService)
+	go func() {
+		logger.Info("Transaction service ready to accept gRPC requests", "port", grpcPort)
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			logger.Error("Failed to start gRPC server", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	// Serve the admin endpoints on their own listener, apart from the API
+	if cfg.HTTP.AdminPort != "" {
+		go func() {
+			logger.Info("Admin endpoints ready", "port", cfg.HTTP.AdminPort, "profiling", cfg.HTTP.Profiling)
+			if err := admin.NewServer(cfg.HTTP.AdminPort, adminHandler).ListenAndServe(); err != nil {
+				logger.Error("Failed to start admin server", "error", err)
+				os.Exit(1)
+			}
+		}()
 	}
 
+	// Create HTTP server
+	server := httpHandler.NewServer(cfg.HTTP, r)
+
 	// Start server in a goroutine
 	go func() {
-		logger.Info("Transaction service ready to accept requests", "port", "8081")
+		logger.Info("Transaction service ready to accept requests", "port", cfg.HTTP.Port)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Error("Failed to start server", "error", err)
 			os.Exit(1)
@@ -105,11 +439,20 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Attempt graceful shutdown
+	// Attempt graceful shutdown, letting in-flight gRPC calls finish too
+	grpcServer.GracefulStop()
 	if err := server.Shutdown(ctx); err != nil {
 		logger.Error("Server forced to shutdown", "error", err)
 		os.Exit(1)
 	}
 
+	// Write the last batch while its events can still be acknowledged; later events are requeued
+	if archiver != nil {
+		if err := archiver.Close(ctx); err != nil {
+			logger.Error("Failed to archive the last events", "error", err)
+		}
+		archiveBroker.Close()
+	}
+
 	logger.Info("Server exited")
 }
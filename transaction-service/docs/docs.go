@@ -15,6 +15,312 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/reconciliation": {
+            "get": {
+                "description": "Cross-check the transactions completed on a day, in UTC, against the ledger entries the\naccount service recorded for them, and list those that do not match. At most 1000\ntransactions are checked per request; truncated is set when there were more.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Reconcile transactions with the ledger",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Day to reconcile, as YYYY-MM-DD",
+                        "name": "date",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.ReconciliationResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/transactions/archivable": {
+            "get": {
+                "description": "List the completed, failed and rolled back transactions last updated more than older_than\nago, oldest first, to support archiving or purging them. Split transfers are listed without\ntheir legs.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List archivable transactions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Minimum age, as a number of days such as 30d or a duration such as 720h",
+                        "name": "older_than",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of transactions to return (default 20, max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of transactions to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.ArchivableTransactionsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/transactions/archive": {
+            "post": {
+                "description": "Move the completed, failed and rolled back transactions last updated more than older_than\nago, as listed by GET /admin/transactions/archivable, out of the transactions table into the\narchive, together with their legs and status history. Archived transactions are still served\nby GET /transactions/{id} and the trace, so ledger entries keep resolving, but no longer change.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Archive old transactions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Minimum age, as a number of days such as 30d or a duration such as 720h",
+                        "name": "older_than",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.ArchiveResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/transactions/{id}/reemit": {
+            "post": {
+                "description": "Publish the transaction.submitted event of a pending transaction again, e.g. when the\noriginal event was lost. Transactions that are not pending, or that the account service\nalready recorded ledger entries for, are refused with 409 so they are never applied twice.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Re-emit a transaction's submitted event",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Transaction ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/http.TransactionResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/transactions/{id}/trace": {
+            "get": {
+                "description": "Get a transaction together with its status history and the ledger entries recorded by the account service",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get transaction trace",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Transaction ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.TransactionTraceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/reports/daily": {
+            "get": {
+                "description": "Get the number and summed amount of the transactions completed on a day, in UTC",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "Get daily report",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Day to report on, as YYYY-MM-DD",
+                        "name": "date",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.DailyReportResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/transactions": {
             "post": {
                 "description": "Submit a new transaction between accounts",
@@ -27,21 +333,319 @@ const docTemplate = `{
                 "tags": [
                     "transactions"
                 ],
-                "summary": "Submit a new transaction",
+                "summary": "Submit a new transaction",
+                "parameters": [
+                    {
+                        "description": "Transaction details",
+                        "name": "transaction",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/http.SubmitTransactionRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client-chosen key identifying the submission, at most 255 characters",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Identical transfer already submitted within the duplicate window",
+                        "schema": {
+                            "$ref": "#/definitions/http.TransactionResponse"
+                        }
+                    },
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/http.TransactionResponse"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the created transaction"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The idempotency key is in use, or was used for a different transaction",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/transactions/batch": {
+            "post": {
+                "description": "Submit up to 100 transfers at once. In atomic mode (the default) every transfer is checked before\nany is submitted, and none is if one fails; the others are reported with status 424. In best_effort\nmode every transfer that can be submitted is. The response lists the outcome of each transfer, with\nthe status it would have been answered with on its own: 201 if every transfer was submitted, 207\nif only some were, and the status of the first failure if none was. Submitted transfers are\nsettled independently of each other.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transactions"
+                ],
+                "summary": "Submit a batch of transactions",
+                "parameters": [
+                    {
+                        "description": "Transfers to submit",
+                        "name": "batch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/http.BatchTransactionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/http.BatchTransactionResponse"
+                        }
+                    },
+                    "207": {
+                        "description": "Some transfers were not submitted",
+                        "schema": {
+                            "$ref": "#/definitions/http.BatchTransactionResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "No transfer was submitted, or an ErrorResponse for an invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/http.BatchTransactionResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/http.BatchTransactionResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/http.BatchTransactionResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/http.BatchTransactionResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/http.BatchTransactionResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/transactions/split": {
+            "post": {
+                "description": "Debit the source account once and credit several destination accounts, all in one atomic transfer",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transactions"
+                ],
+                "summary": "Submit a split transaction",
+                "parameters": [
+                    {
+                        "description": "Split transaction details",
+                        "name": "transaction",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/http.SplitTransactionRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client-chosen key identifying the submission, at most 255 characters",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/http.TransactionResponse"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the created transaction"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The idempotency key is in use, or was used for a different transaction",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/transactions/{id}": {
+            "get": {
+                "description": "Get details of a specific transaction",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transactions"
+                ],
+                "summary": "Get transaction details",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Transaction ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.TransactionResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Replace the memo of a transaction, whatever its status. The amount, accounts and\nstatus cannot be changed; requests that include any other field are refused.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transactions"
+                ],
+                "summary": "Update transaction metadata",
                 "parameters": [
                     {
-                        "description": "Transaction details",
+                        "type": "integer",
+                        "description": "Transaction ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Transaction metadata",
                         "name": "transaction",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/http.SubmitTransactionRequest"
+                            "$ref": "#/definitions/http.UpdateTransactionRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.TransactionResponse"
+                        }
                     },
                     "400": {
                         "description": "Bad Request",
@@ -49,28 +653,37 @@ const docTemplate = `{
                             "$ref": "#/definitions/http.ErrorResponse"
                         }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/http.ErrorResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/transactions/{id}": {
+        "/transactions/{id}/events": {
             "get": {
-                "description": "Get details of a specific transaction",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Server-sent event stream of the status of a transaction, for UIs tracking a transfer. A \"status\"\nevent with the current status is sent right away and another one on every change. The stream is\nclosed once the transaction reaches a terminal status (complete, failed or rollback), or after\nthe stream timeout.",
                 "produces": [
-                    "application/json"
+                    "text/event-stream"
                 ],
                 "tags": [
                     "transactions"
                 ],
-                "summary": "Get transaction details",
+                "summary": "Stream the status of a transaction",
                 "parameters": [
                     {
                         "type": "integer",
@@ -84,7 +697,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/http.TransactionResponse"
+                            "$ref": "#/definitions/http.StatusEvent"
                         }
                     },
                     "400": {
@@ -94,7 +707,7 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "Not Found",
+                        "description": "Transaction not found, or status streams are turned off",
                         "schema": {
                             "$ref": "#/definitions/http.ErrorResponse"
                         }
@@ -104,17 +717,382 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/http.ErrorResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ws/transactions": {
+            "get": {
+                "description": "WebSocket on which clients follow the status of several transactions. Clients send\n{\"action\": \"subscribe\", \"transaction_id\": 1} or \"unsubscribe\" messages; the service answers each\nsubscription with a \"status\" message carrying the current status and sends another one on every\nchange. A subscription ends by itself once its transaction reaches a terminal status (complete,\nfailed or rollback). Failed requests are answered with an \"error\" message.",
+                "tags": [
+                    "transactions"
+                ],
+                "summary": "Follow the status of transactions over a WebSocket",
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "$ref": "#/definitions/http.SocketMessage"
+                        }
+                    },
+                    "404": {
+                        "description": "Status streams are turned off",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorResponse"
+                        }
                     }
                 }
             }
         }
     },
     "definitions": {
+        "http.ArchivableTransactionsResponse": {
+            "type": "object",
+            "properties": {
+                "cutoff": {
+                    "type": "string",
+                    "example": "2024-01-01T00:00:00Z"
+                },
+                "limit": {
+                    "type": "integer",
+                    "example": 20
+                },
+                "offset": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "transactions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/http.TransactionResponse"
+                    }
+                }
+            }
+        },
+        "http.ArchiveResponse": {
+            "type": "object",
+            "properties": {
+                "archived": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "cutoff": {
+                    "type": "string",
+                    "example": "2024-01-01T00:00:00Z"
+                }
+            }
+        },
+        "http.BatchItemResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "$ref": "#/definitions/http.ErrorResponse"
+                },
+                "index": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "status": {
+                    "description": "Status is the status the transfer would have been answered with on its own, or 424 if it was\nleft out of an atomic batch because another transfer failed",
+                    "type": "integer",
+                    "example": 201
+                },
+                "transaction": {
+                    "$ref": "#/definitions/http.TransactionResponse"
+                }
+            }
+        },
+        "http.BatchTransactionRequest": {
+            "type": "object",
+            "required": [
+                "transactions"
+            ],
+            "properties": {
+                "mode": {
+                    "description": "Defaults to atomic",
+                    "type": "string",
+                    "enum": [
+                        "atomic",
+                        "best_effort"
+                    ]
+                },
+                "transactions": {
+                    "type": "array",
+                    "maxItems": 100,
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/http.SubmitTransactionRequest"
+                    }
+                }
+            }
+        },
+        "http.BatchTransactionResponse": {
+            "type": "object",
+            "properties": {
+                "failed": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "mode": {
+                    "type": "string",
+                    "enum": [
+                        "atomic",
+                        "best_effort"
+                    ],
+                    "example": "atomic"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/http.BatchItemResponse"
+                    }
+                },
+                "submitted": {
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "http.DailyReportResponse": {
+            "type": "object",
+            "properties": {
+                "completed_count": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "completed_total": {
+                    "type": "string",
+                    "example": "1250.00"
+                },
+                "date": {
+                    "type": "string",
+                    "example": "2024-01-31"
+                }
+            }
+        },
+        "http.DiscrepancyResponse": {
+            "type": "object",
+            "properties": {
+                "actual": {
+                    "type": "string",
+                    "example": "45.00"
+                },
+                "code": {
+                    "type": "string",
+                    "enum": [
+                        "missing_ledger_entries",
+                        "debit_mismatch",
+                        "credit_mismatch",
+                        "fee_mismatch",
+                        "unbalanced",
+                        "invalid_ledger_entry"
+                    ],
+                    "example": "credit_mismatch"
+                },
+                "expected": {
+                    "type": "string",
+                    "example": "50.00"
+                },
+                "transaction_id": {
+                    "type": "integer",
+                    "example": 7
+                }
+            }
+        },
         "http.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "enum": [
+                        "validation_failed",
+                        "bad_request",
+                        "not_found",
+                        "conflict",
+                        "too_many_requests",
+                        "internal_error",
+                        "service_overloaded",
+                        "request_cancelled",
+                        "timeout",
+                        "service_unavailable",
+                        "not_submitted"
+                    ],
+                    "example": "validation_failed"
+                },
+                "error": {
+                    "type": "string",
+                    "example": "request validation failed"
+                },
+                "fields": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    },
+                    "example": {
+                        "amount": "is required"
+                    }
+                }
+            }
+        },
+        "http.LedgerEntryResponse": {
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "integer"
+                },
+                "amount": {
+                    "type": "string"
+                },
+                "balance_after": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "opening",
+                        "debit",
+                        "credit",
+                        "fee",
+                        "hold",
+                        "release"
+                    ]
+                }
+            }
+        },
+        "http.ReconciliationResponse": {
+            "type": "object",
+            "properties": {
+                "checked": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "date": {
+                    "type": "string",
+                    "example": "2024-01-31"
+                },
+                "discrepancies": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/http.DiscrepancyResponse"
+                    }
+                },
+                "truncated": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "http.SocketMessage": {
             "type": "object",
             "properties": {
                 "error": {
                     "type": "string"
+                },
+                "failure_code": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "pending",
+                        "processing",
+                        "held",
+                        "complete",
+                        "failed",
+                        "rollback"
+                    ]
+                },
+                "transaction_id": {
+                    "type": "integer"
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "status",
+                        "error"
+                    ]
+                }
+            }
+        },
+        "http.SplitTransactionRequest": {
+            "type": "object",
+            "required": [
+                "legs",
+                "source_account_id"
+            ],
+            "properties": {
+                "fee": {
+                    "description": "Optional charge on top of the total, credited to the fee account; the fee schedule applies when omitted",
+                    "type": "string"
+                },
+                "legs": {
+                    "description": "Between 2 and 100 distinct destinations",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/http.TransferLegRequest"
+                    }
+                },
+                "memo": {
+                    "type": "string",
+                    "maxLength": 256
+                },
+                "source_account_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "http.StatusChangeResponse": {
+            "type": "object",
+            "properties": {
+                "changed_at": {
+                    "type": "string"
+                },
+                "failure_code": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "pending",
+                        "processing",
+                        "held",
+                        "complete",
+                        "failed",
+                        "rollback"
+                    ]
+                }
+            }
+        },
+        "http.StatusEvent": {
+            "type": "object",
+            "properties": {
+                "failure_code": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "pending",
+                        "processing",
+                        "held",
+                        "complete",
+                        "failed",
+                        "rollback"
+                    ]
+                },
+                "transaction_id": {
+                    "type": "integer"
                 }
             }
         },
@@ -132,6 +1110,15 @@ const docTemplate = `{
                 "destination_account_id": {
                     "type": "integer"
                 },
+                "fee": {
+                    "description": "Optional charge on top of the amount, credited to the fee account; the fee schedule applies when omitted",
+                    "type": "string"
+                },
+                "memo": {
+                    "description": "Optional reference or note, e.g. an invoice number",
+                    "type": "string",
+                    "maxLength": 256
+                },
                 "source_account_id": {
                     "type": "integer"
                 }
@@ -146,14 +1133,84 @@ const docTemplate = `{
                 "destination_account_id": {
                     "type": "integer"
                 },
+                "failure_code": {
+                    "type": "string"
+                },
+                "fee": {
+                    "type": "string"
+                },
                 "id": {
                     "type": "integer"
                 },
+                "legs": {
+                    "description": "Legs lists the destinations of a split transfer; destination_account_id is then the first\nleg's and amount their total",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/http.TransferLegRequest"
+                    }
+                },
+                "memo": {
+                    "type": "string"
+                },
                 "source_account_id": {
                     "type": "integer"
                 },
                 "status": {
+                    "type": "string",
+                    "enum": [
+                        "pending",
+                        "processing",
+                        "held",
+                        "complete",
+                        "failed",
+                        "rollback"
+                    ]
+                }
+            }
+        },
+        "http.TransactionTraceResponse": {
+            "type": "object",
+            "properties": {
+                "ledger_entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/http.LedgerEntryResponse"
+                    }
+                },
+                "ledger_error": {
                     "type": "string"
+                },
+                "status_history": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/http.StatusChangeResponse"
+                    }
+                },
+                "transaction": {
+                    "$ref": "#/definitions/http.TransactionResponse"
+                }
+            }
+        },
+        "http.TransferLegRequest": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "string",
+                    "example": "25.00"
+                },
+                "destination_account_id": {
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "http.UpdateTransactionRequest": {
+            "type": "object",
+            "properties": {
+                "memo": {
+                    "description": "Replaces the memo; empty clears it",
+                    "type": "string",
+                    "maxLength": 256
                 }
             }
         }
@@ -0,0 +1,131 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"internal-transfers/transaction-service/internal/domain"
+)
+
+// MaxBatchTransfers is the largest number of transfers submitted in one batch
+const MaxBatchTransfers = 100
+
+// BatchMode selects what happens to the other transfers of a batch when some cannot be submitted
+type BatchMode string
+
+const (
+	// BatchAtomic submits the transfers of a batch only if every one of them passes the checks
+	BatchAtomic BatchMode = "atomic"
+	// BatchBestEffort submits every transfer of a batch that can be, whatever happens to the others
+	BatchBestEffort BatchMode = "best_effort"
+)
+
+var (
+	ErrInvalidBatch = fmt.Errorf("batches need between 1 and %d transfers", MaxBatchTransfers)
+	// ErrNotSubmitted is reported for the transfers of an atomic batch left out because another failed
+	ErrNotSubmitted = errors.New("not submitted because another transfer of the batch failed")
+)
+
+// BatchItemResult is the outcome of one transfer of a batch: Result if it was submitted, Err otherwise
+type BatchItemResult struct {
+	Result *SubmitResult
+	Err    error
+}
+
+// SubmitBatch submits several transfers and reports the outcome of each, in order. In best-effort
+// mode each transfer is submitted as by SubmitTransaction. In atomic mode every transfer is checked,
+// the pending limit included, before any is recorded, and none is submitted if one fails the checks.
+// Should recording or publishing a transfer fail once submission has started, the transfers already
+// submitted stay so and the remaining ones are left out. Submitted transfers are settled
+// independently in either mode.
+func (s *transactionService) SubmitBatch(ctx context.Context, dtos []TransactionDTO, mode BatchMode) ([]BatchItemResult, error) {
+	s.logger.Info("submitting transaction batch",
+		"transfers", len(dtos),
+		"mode", mode)
+
+	if len(dtos) == 0 || len(dtos) > MaxBatchTransfers {
+		return nil, ErrInvalidBatch
+	}
+
+	results := make([]BatchItemResult, len(dtos))
+	if mode == BatchBestEffort {
+		for i, dto := range dtos {
+			results[i].Result, results[i].Err = s.SubmitTransaction(ctx, dto)
+		}
+		return results, nil
+	}
+
+	failed := false
+	for i, dto := range dtos {
+		if err := s.checkTransfer(ctx, dto); err != nil {
+			results[i].Err = err
+			failed = true
+		}
+	}
+	if !failed {
+		failed = s.checkBatchPendingLimit(ctx, dtos, results)
+	}
+	if failed {
+		s.logger.Warn("transaction batch rejected",
+			"transfers", len(dtos))
+		leaveOut(results)
+		return results, nil
+	}
+
+	for i, dto := range dtos {
+		if results[i].Result, results[i].Err = s.submitChecked(ctx, dto, false); results[i].Err != nil {
+			leaveOut(results[i+1:])
+			break
+		}
+	}
+	return results, nil
+}
+
+// checkBatchPendingLimit checks that the pending transfers of each source account stay within the
+// limit once the batch is submitted, recording the error of the transfers of sources that do not.
+// It reports whether any source failed the check.
+func (s *transactionService) checkBatchPendingLimit(ctx context.Context, dtos []TransactionDTO, results []BatchItemResult) bool {
+	if s.maxPendingPerAccount <= 0 {
+		return false
+	}
+
+	batched := make(map[domain.AccountID]int)
+	for _, dto := range dtos {
+		batched[dto.SourceAccountID]++
+	}
+
+	failed := false
+	errs := make(map[domain.AccountID]error, len(batched))
+	for source, count := range batched {
+		pending, err := s.repo.CountPendingBySourceAccount(ctx, source)
+		if err != nil {
+			s.logger.Log(ctx, errorLevel(err), "failed to count pending transactions",
+				"error", err,
+				"source_account", source)
+			errs[source] = fmt.Errorf("failed to count pending transactions: %w", err)
+		} else if pending+count > s.maxPendingPerAccount {
+			s.logger.Warn("too many pending transactions",
+				"source_account", source,
+				"pending", pending,
+				"batched", count,
+				"limit", s.maxPendingPerAccount)
+			errs[source] = ErrTooManyPendingTransfers
+		}
+	}
+	for i, dto := range dtos {
+		if err := errs[dto.SourceAccountID]; err != nil {
+			results[i].Err = err
+			failed = true
+		}
+	}
+	return failed
+}
+
+// leaveOut marks the transfers without an outcome yet as not submitted
+func leaveOut(results []BatchItemResult) {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Err = ErrNotSubmitted
+		}
+	}
+}
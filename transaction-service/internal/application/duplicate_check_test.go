@@ -0,0 +1,100 @@
+package application
+
+import (
+	"context"
+	"internal-transfers/pkg/features"
+	"internal-transfers/transaction-service/internal/clock"
+	"internal-transfers/transaction-service/internal/domain"
+	"slices"
+	"testing"
+	"time"
+)
+
+// FindRecentDuplicate finds the latest matching transaction by its CreatedAt, which must be in
+// RFC 3339 format
+func (r *memoryRepository) FindRecentDuplicate(_ context.Context, source, destination domain.AccountID, amount string, since time.Time) (*domain.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		latest   *domain.Transaction
+		latestAt time.Time
+	)
+	for _, transaction := range r.transactions {
+		if transaction.SourceAccountID != source || transaction.DestinationAccountID != destination || transaction.Amount != amount {
+			continue
+		}
+		if !slices.Contains([]domain.TransactionStatus{domain.TransactionStatusPending, domain.TransactionStatusProcessing, domain.TransactionStatusComplete}, transaction.Status) {
+			continue
+		}
+		createdAt, err := time.Parse(time.RFC3339, transaction.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if !createdAt.Before(since) && (latest == nil || createdAt.After(latestAt)) {
+			copied := *transaction
+			latest, latestAt = &copied, createdAt
+		}
+	}
+	return latest, nil
+}
+
+func TestDuplicateTransferWindow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	earlier := func(d time.Duration) string { return now.Add(-d).Format(time.RFC3339) }
+	submitted := domain.Transaction{ID: 1, SourceAccountID: 1, DestinationAccountID: 2, Amount: "10.00", Status: domain.TransactionStatusPending}
+
+	tests := []struct {
+		name          string
+		flag          bool
+		createdAt     string
+		status        domain.TransactionStatus
+		amount        string
+		wantDuplicate bool
+	}{
+		{name: "within the window", flag: true, createdAt: earlier(5 * time.Second), status: domain.TransactionStatusPending, amount: "10.00", wantDuplicate: true},
+		{name: "completed within the window", flag: true, createdAt: earlier(5 * time.Second), status: domain.TransactionStatusComplete, amount: "10.00", wantDuplicate: true},
+		{name: "at the edge of the window", flag: true, createdAt: earlier(10 * time.Second), status: domain.TransactionStatusPending, amount: "10.00", wantDuplicate: true},
+		{name: "outside the window", flag: true, createdAt: earlier(11 * time.Second), status: domain.TransactionStatusPending, amount: "10.00"},
+		{name: "failed within the window", flag: true, createdAt: earlier(5 * time.Second), status: domain.TransactionStatusFailed, amount: "10.00"},
+		{name: "different amount", flag: true, createdAt: earlier(5 * time.Second), status: domain.TransactionStatusPending, amount: "10.01"},
+		{name: "check turned off", createdAt: earlier(5 * time.Second), status: domain.TransactionStatusPending, amount: "10.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var flags features.Flags
+			if tt.flag {
+				var err error
+				if flags, err = features.Parse([]string{string(features.DuplicateTransferCheck)}); err != nil {
+					t.Fatalf("features.Parse() error = %v", err)
+				}
+			}
+			existing := submitted
+			existing.CreatedAt, existing.Status = tt.createdAt, tt.status
+			repo := newMemoryRepository(existing)
+			broker := &recordingBroker{}
+			service := NewTransactionService(repo, broker, nil,
+				WithFeatures(flags), WithClock(clock.NewFake(now)), WithDuplicateWindow(10*time.Second))
+
+			result, err := service.SubmitTransaction(context.Background(), TransactionDTO{SourceAccountID: 1, DestinationAccountID: 2, Amount: tt.amount})
+			if err != nil {
+				t.Fatalf("SubmitTransaction() error = %v", err)
+			}
+			if result.Duplicate != tt.wantDuplicate {
+				t.Errorf("Duplicate = %t, want %t", result.Duplicate, tt.wantDuplicate)
+			}
+
+			// A duplicate returns the existing transaction without submitting the transfer again
+			wantSubmitted, wantID := 1, domain.TransactionID(2)
+			if tt.wantDuplicate {
+				wantSubmitted, wantID = 0, 1
+			}
+			if result.Transaction.ID != wantID {
+				t.Errorf("transaction ID = %d, want %d", result.Transaction.ID, wantID)
+			}
+			if len(broker.submitted) != wantSubmitted {
+				t.Errorf("published %d submitted events, want %d", len(broker.submitted), wantSubmitted)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"internal-transfers/transaction-service/internal/clock"
+	"internal-transfers/transaction-service/internal/domain"
+	"internal-transfers/transaction-service/internal/infrastructure/messaging"
+	"log/slog"
+	"time"
+)
+
+// expiryBatchSize is the maximum number of transactions expired in a single sweep
+const expiryBatchSize = 100
+
+// expirableStatuses are the statuses a transaction expires in. A held transaction awaits review
+// instead, which may take longer.
+var expirableStatuses = []domain.TransactionStatus{
+	domain.TransactionStatusPending,
+	domain.TransactionStatusProcessing,
+}
+
+// ExpirySweeper periodically fails transactions whose outcome has not been reported for too long,
+// e.g. because their submitted event was never consumed or its retries ran out
+type ExpirySweeper struct {
+	repo     domain.TransactionRepository
+	broker   messaging.MessageBroker
+	maxAge   time.Duration
+	interval time.Duration
+	clock    clock.Clock
+	logger   *slog.Logger
+}
+
+// NewExpirySweeper creates a sweeper that expires transactions pending or processing longer than maxAge every interval
+func NewExpirySweeper(repo domain.TransactionRepository, broker messaging.MessageBroker, clk clock.Clock, maxAge, interval time.Duration) *ExpirySweeper {
+	return &ExpirySweeper{
+		repo:     repo,
+		broker:   broker,
+		maxAge:   maxAge,
+		interval: interval,
+		clock:    clk,
+		logger:   slog.Default(),
+	}
+}
+
+// Run sweeps on every interval until the context is cancelled
+func (s *ExpirySweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx); err != nil {
+				s.logger.Error("failed to expire transactions", "error", err)
+			}
+		}
+	}
+}
+
+// Sweep expires pending and processing transactions older than the configured age and returns how many were expired
+func (s *ExpirySweeper) Sweep(ctx context.Context) (int, error) {
+	cutoff := s.clock.Now().Add(-s.maxAge)
+	transactions, err := s.repo.ListCreatedBefore(ctx, cutoff, expiryBatchSize, expirableStatuses...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list unsettled transactions: %w", err)
+	}
+
+	expired := 0
+	for _, transaction := range transactions {
+		transaction.Status = domain.TransactionStatusFailed
+		transaction.FailureCode = domain.FailureExpired
+
+		// Only expire the transaction if it was not completed, failed or held in the meantime
+		updated, err := s.repo.UpdateIfStatus(ctx, transaction, expirableStatuses...)
+		if err != nil {
+			s.logger.Error("failed to expire transaction",
+				"error", err,
+				"transaction_id", transaction.ID)
+			continue
+		}
+		if !updated {
+			continue
+		}
+		expired++
+
+		s.logger.Warn("transaction expired",
+			"transaction_id", transaction.ID,
+			"max_age", s.maxAge.String())
+
+		event := domain.TransactionEvent{
+			TransactionID:        transaction.ID,
+			SourceAccountID:      transaction.SourceAccountID,
+			DestinationAccountID: transaction.DestinationAccountID,
+			Amount:               transaction.Amount,
+			Fee:                  transaction.Fee,
+			Memo:                 transaction.Memo,
+			Status:               domain.EventStatusFailed,
+			FailureCode:          domain.FailureExpired,
+			FailureReason:        "transaction expired before its outcome was reported",
+		}
+		if err := s.broker.PublishTransactionFailed(ctx, event); err != nil {
+			s.logger.Error("failed to publish transaction failed event",
+				"error", err,
+				"transaction_id", transaction.ID)
+		}
+	}
+
+	return expired, nil
+}
@@ -0,0 +1,90 @@
+package application
+
+import (
+	"context"
+	"internal-transfers/transaction-service/internal/clock"
+	"internal-transfers/transaction-service/internal/domain"
+	"testing"
+	"time"
+)
+
+func TestExpirySweeperExpiresUnsettledTransactions(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-time.Hour).Format(time.RFC3339)
+	recent := now.Add(-time.Minute).Format(time.RFC3339)
+
+	repo := newMemoryRepository(
+		domain.Transaction{ID: 1, Status: domain.TransactionStatusPending, CreatedAt: old},
+		domain.Transaction{ID: 2, Status: domain.TransactionStatusProcessing, CreatedAt: old},
+		domain.Transaction{ID: 3, Status: domain.TransactionStatusHeld, CreatedAt: old},
+		domain.Transaction{ID: 4, Status: domain.TransactionStatusComplete, CreatedAt: old},
+		domain.Transaction{ID: 5, Status: domain.TransactionStatusProcessing, CreatedAt: recent},
+	)
+	broker := &recordingBroker{}
+	sweeper := NewExpirySweeper(repo, broker, clock.NewFake(now), 30*time.Minute, time.Minute)
+
+	expired, err := sweeper.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	if expired != 2 {
+		t.Errorf("Sweep() expired %d transactions, want 2", expired)
+	}
+
+	want := map[domain.TransactionID]domain.TransactionStatus{
+		1: domain.TransactionStatusFailed,
+		2: domain.TransactionStatusFailed,
+		3: domain.TransactionStatusHeld,
+		4: domain.TransactionStatusComplete,
+		5: domain.TransactionStatusProcessing,
+	}
+	for id, status := range want {
+		if got := repo.transaction(t, id); got.Status != status {
+			t.Errorf("transaction %d is %s, want %s", id, got.Status, status)
+		}
+	}
+	if len(broker.failed) != 2 {
+		t.Fatalf("published %d failed events, want 2", len(broker.failed))
+	}
+	for _, event := range broker.failed {
+		if event.FailureCode != domain.FailureExpired {
+			t.Errorf("transaction %d failed with %q, want %q", event.TransactionID, event.FailureCode, domain.FailureExpired)
+		}
+	}
+}
+
+func TestExpirySweeperExpiresOnceTooOld(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	repo := newMemoryRepository(domain.Transaction{ID: 1, Status: domain.TransactionStatusPending, CreatedAt: created.Format(time.RFC3339)})
+	broker := &recordingBroker{}
+	clk := clock.NewFake(created)
+	sweeper := NewExpirySweeper(repo, broker, clk, 30*time.Minute, time.Minute)
+
+	// A transaction is left alone until it reaches the maximum age
+	for _, elapsed := range []time.Duration{time.Minute, 29 * time.Minute} {
+		clk.Advance(elapsed)
+		if expired, err := sweeper.Sweep(context.Background()); err != nil || expired != 0 {
+			t.Fatalf("Sweep() after %s = %d, %v, want nothing expired", clk.Now().Sub(created), expired, err)
+		}
+	}
+	if got := repo.transaction(t, 1); got.Status != domain.TransactionStatusPending {
+		t.Fatalf("transaction is %s at the maximum age, want %s", got.Status, domain.TransactionStatusPending)
+	}
+
+	clk.Advance(time.Second)
+	if expired, err := sweeper.Sweep(context.Background()); err != nil || expired != 1 {
+		t.Fatalf("Sweep() past the maximum age = %d, %v, want 1 expired", expired, err)
+	}
+	if got := repo.transaction(t, 1); got.Status != domain.TransactionStatusFailed || got.FailureCode != domain.FailureExpired {
+		t.Errorf("transaction is %s (%q), want %s (%q)", got.Status, got.FailureCode, domain.TransactionStatusFailed, domain.FailureExpired)
+	}
+
+	// Later sweeps do not expire it again
+	clk.Advance(time.Hour)
+	if expired, err := sweeper.Sweep(context.Background()); err != nil || expired != 0 {
+		t.Errorf("Sweep() once expired = %d, %v, want nothing expired", expired, err)
+	}
+	if len(broker.failed) != 1 {
+		t.Errorf("published %d failed events, want 1", len(broker.failed))
+	}
+}
@@ -0,0 +1,150 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"internal-transfers/transaction-service/internal/domain"
+	"math/big"
+	"strings"
+)
+
+// ErrInvalidFeeSchedule is returned by ParseFeeSchedule for a malformed schedule
+var ErrInvalidFeeSchedule = errors.New("invalid fee schedule")
+
+// FeeCalculator resolves the fee charged for a transfer of amount in currency. A zero fee means the
+// transfer is free.
+type FeeCalculator interface {
+	Fee(amount domain.Money, currency string) (domain.Money, error)
+}
+
+// FeeTier is the fee charged for amounts of at least From: Flat, or Percent of the amount when
+// Percentage is set
+type FeeTier struct {
+	From       domain.Money
+	Flat       domain.Money
+	Percent    domain.Money
+	Percentage bool
+}
+
+// fee returns the fee of the tier for amount, rounded half up to domain.DisplayScale
+func (t FeeTier) fee(amount domain.Money) (domain.Money, error) {
+	if !t.Percentage {
+		return t.Flat, nil
+	}
+
+	// amount * percent / 100, computed exactly before rounding
+	product := new(big.Int).Mul(big.NewInt(amount.Units()), big.NewInt(t.Percent.Units()))
+	scale := amount.Scale() + t.Percent.Scale() + 2
+	if scale <= domain.DisplayScale {
+		product.Mul(product, pow10(domain.DisplayScale-scale))
+	} else {
+		divisor := pow10(scale - domain.DisplayScale)
+		remainder := new(big.Int)
+		product.QuoRem(product, divisor, remainder)
+		if remainder.Mul(remainder, big.NewInt(2)).CmpAbs(divisor) >= 0 {
+			product.Add(product, big.NewInt(int64(product.Sign()|1)))
+		}
+	}
+	if !product.IsInt64() {
+		return domain.Money{}, domain.ErrAmountOverflow
+	}
+	return domain.NewMoney(product.Int64(), domain.DisplayScale), nil
+}
+
+// pow10 returns 10^n as a big.Int
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// FeeSchedule is a FeeCalculator driven by configuration. Each currency has its tiers, ordered
+// by their From amount; a transfer pays the fee of the last tier it reaches. Transfers below the
+// first tier or in a currency without tiers are free.
+type FeeSchedule struct {
+	tiers map[string][]FeeTier
+}
+
+// ParseFeeSchedule parses a schedule given as entries of the form "[CUR:][from=]fee", where fee
+// is a flat amount such as "0.50" or a percentage of the amount such as "1.5%". An entry without
+// from applies from zero and one without a currency to defaultCurrency, so "0.50" is a flat fee,
+// "1%" a percentage and "0=0.50,100=1%,1000=5.00" a tiered schedule. An empty schedule charges
+// no fees.
+func ParseFeeSchedule(entries []string, defaultCurrency string) (*FeeSchedule, error) {
+	schedule := &FeeSchedule{tiers: make(map[string][]FeeTier)}
+	for _, entry := range entries {
+		currency, tier, err := parseFeeTier(entry, defaultCurrency)
+		if err != nil {
+			return nil, err
+		}
+		tiers := schedule.tiers[currency]
+		if len(tiers) > 0 && tiers[len(tiers)-1].From.Cmp(tier.From) >= 0 {
+			return nil, fmt.Errorf("%w: %q must start above the tier before it", ErrInvalidFeeSchedule, entry)
+		}
+		schedule.tiers[currency] = append(tiers, tier)
+	}
+	return schedule, nil
+}
+
+// parseFeeTier parses a single "[CUR:][from=]fee" entry of a schedule
+func parseFeeTier(entry, defaultCurrency string) (string, FeeTier, error) {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: %q %s", ErrInvalidFeeSchedule, entry, reason)
+	}
+
+	currency, rest, found := strings.Cut(entry, ":")
+	if !found {
+		currency, rest = defaultCurrency, entry
+	}
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+
+	var tier FeeTier
+	from, fee, found := strings.Cut(rest, "=")
+	if !found {
+		from, fee = "0", rest
+	}
+	var err error
+	if tier.From, err = parseScheduleAmount(from); err != nil {
+		return "", FeeTier{}, invalid("has an invalid lower bound")
+	}
+
+	fee = strings.TrimSpace(fee)
+	if percent, ok := strings.CutSuffix(fee, "%"); ok {
+		tier.Percentage = true
+		if tier.Percent, err = domain.ParseMoney(strings.TrimSpace(percent)); err != nil || tier.Percent.Sign() < 0 || tier.Percent.Cmp(domain.NewMoney(100, 0)) > 0 {
+			return "", FeeTier{}, invalid("must be a percentage between 0% and 100%")
+		}
+		return currency, tier, nil
+	}
+	if tier.Flat, err = parseScheduleAmount(fee); err != nil {
+		return "", FeeTier{}, invalid("has an invalid fee")
+	}
+	return currency, tier, nil
+}
+
+// parseScheduleAmount parses a non-negative amount of a schedule in canonical form
+func parseScheduleAmount(s string) (domain.Money, error) {
+	normalized, err := domain.NormalizeAmount(strings.TrimSpace(s))
+	if err != nil {
+		return domain.Money{}, err
+	}
+	amount, err := domain.ParseMoney(normalized)
+	if err != nil || amount.Sign() < 0 {
+		return domain.Money{}, domain.ErrInvalidMoney
+	}
+	return amount, nil
+}
+
+// Empty reports whether the schedule charges no fees at all
+func (s *FeeSchedule) Empty() bool {
+	return len(s.tiers) == 0
+}
+
+// Fee returns the fee of the last tier of currency that amount reaches
+func (s *FeeSchedule) Fee(amount domain.Money, currency string) (domain.Money, error) {
+	tiers := s.tiers[strings.ToUpper(currency)]
+	for i := len(tiers) - 1; i >= 0; i-- {
+		if amount.Cmp(tiers[i].From) >= 0 {
+			return tiers[i].fee(amount)
+		}
+	}
+	return domain.NewMoney(0, domain.DisplayScale), nil
+}
@@ -0,0 +1,119 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"internal-transfers/transaction-service/internal/domain"
+	"testing"
+)
+
+func TestFeeSchedule(t *testing.T) {
+	tiered := []string{"0=0.50", "100=1%", "1000=5.00"}
+	tests := []struct {
+		name     string
+		schedule []string
+		amount   string
+		currency string
+		want     string
+	}{
+		{name: "no schedule", amount: "10.00", want: "0.00"},
+		{name: "flat", schedule: []string{"0.50"}, amount: "10.00", want: "0.50"},
+		{name: "flat on a tiny amount", schedule: []string{"0.50"}, amount: "0.01", want: "0.50"},
+		{name: "percentage", schedule: []string{"1.5%"}, amount: "10.00", want: "0.15"},
+		{name: "percentage rounded down", schedule: []string{"1.5%"}, amount: "0.33", want: "0.00"},
+		{name: "percentage rounded up", schedule: []string{"1.5%"}, amount: "0.35", want: "0.01"},
+		{name: "percentage rounded half up", schedule: []string{"1%"}, amount: "0.50", want: "0.01"},
+		{name: "percentage of a precise amount", schedule: []string{"2.5%"}, amount: "1.01", want: "0.03"},
+		{name: "percentage of more decimals", schedule: []string{"10%"}, amount: "10.005", want: "1.00"},
+		{name: "zero percent", schedule: []string{"0%"}, amount: "10.00", want: "0.00"},
+		{name: "first tier", schedule: tiered, amount: "99.99", want: "0.50"},
+		{name: "second tier from its lower bound", schedule: tiered, amount: "100.00", want: "1.00"},
+		{name: "second tier rounded", schedule: tiered, amount: "999.99", want: "10.00"},
+		{name: "last tier", schedule: tiered, amount: "1000.00", want: "5.00"},
+		{name: "below the first tier", schedule: []string{"10=0.25"}, amount: "5.00", want: "0.00"},
+		{name: "currency of the schedule", schedule: []string{"EUR:1%"}, amount: "10.00", currency: "eur", want: "0.10"},
+		{name: "currency without a schedule", schedule: []string{"EUR:1%"}, amount: "10.00", want: "0.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseFeeSchedule(tt.schedule, "USD")
+			if err != nil {
+				t.Fatalf("ParseFeeSchedule(%q) error = %v", tt.schedule, err)
+			}
+			amount, err := domain.ParseMoney(tt.amount)
+			if err != nil {
+				t.Fatalf("ParseMoney(%q) error = %v", tt.amount, err)
+			}
+			currency := tt.currency
+			if currency == "" {
+				currency = "USD"
+			}
+
+			fee, err := schedule.Fee(amount, currency)
+			if err != nil {
+				t.Fatalf("Fee(%s, %s) error = %v", tt.amount, currency, err)
+			}
+			if got := fee.String(); got != tt.want {
+				t.Errorf("Fee(%s, %s) = %s, want %s", tt.amount, currency, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFeeScheduleInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule []string
+	}{
+		{name: "percentage over 100", schedule: []string{"101%"}},
+		{name: "negative percentage", schedule: []string{"-1%"}},
+		{name: "negative flat fee", schedule: []string{"-0.50"}},
+		{name: "invalid lower bound", schedule: []string{"ten=0.50"}},
+		{name: "tiers out of order", schedule: []string{"100=1%", "50=0.50"}},
+		{name: "tiers starting at the same amount", schedule: []string{"100=1%", "100=0.50"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseFeeSchedule(tt.schedule, "USD"); !errors.Is(err, ErrInvalidFeeSchedule) {
+				t.Errorf("ParseFeeSchedule(%q) error = %v, want %v", tt.schedule, err, ErrInvalidFeeSchedule)
+			}
+		})
+	}
+}
+
+func TestSubmitTransactionFees(t *testing.T) {
+	schedule, err := ParseFeeSchedule([]string{"0=0.50", "100=1%"}, "USD")
+	if err != nil {
+		t.Fatalf("ParseFeeSchedule() error = %v", err)
+	}
+	tests := []struct {
+		name    string
+		amount  string
+		fee     string
+		wantFee string
+	}{
+		{name: "flat tier", amount: "10.00", wantFee: "0.50"},
+		{name: "percentage tier", amount: "250.00", wantFee: "2.50"},
+		{name: "fee given with the transfer", amount: "250.00", fee: "1.00", wantFee: "1.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &recordingBroker{}
+			service := NewTransactionService(newMemoryRepository(), broker, nil, WithFees(schedule, "USD"))
+
+			result, err := service.SubmitTransaction(context.Background(), TransactionDTO{SourceAccountID: 1, DestinationAccountID: 2, Amount: tt.amount, Fee: tt.fee})
+			if err != nil {
+				t.Fatalf("SubmitTransaction() error = %v", err)
+			}
+			if result.Transaction.Fee != tt.wantFee {
+				t.Errorf("transaction fee = %q, want %q", result.Transaction.Fee, tt.wantFee)
+			}
+			if len(broker.submitted) != 1 || broker.submitted[0].Fee != tt.wantFee {
+				t.Errorf("submitted events = %+v, want one charging %s", broker.submitted, tt.wantFee)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"internal-transfers/transaction-service/internal/clock"
+	"internal-transfers/transaction-service/internal/domain"
+	"internal-transfers/transaction-service/internal/infrastructure/accounts"
+	"log/slog"
+	"time"
+)
+
+// MaxReconciledTransactions is the largest number of transactions checked by a single reconciliation
+const MaxReconciledTransactions = 1000
+
+// ErrLedgerUnavailable is returned when the ledger entries could not be fetched from the account service
+var ErrLedgerUnavailable = errors.New("account service ledger unavailable")
+
+// Discrepancy codes reported by Reconcile
+const (
+	// DiscrepancyMissingEntries: the account service recorded nothing for the transaction
+	DiscrepancyMissingEntries = "missing_ledger_entries"
+	// DiscrepancyDebitMismatch: the source was not debited the transaction's amount
+	DiscrepancyDebitMismatch = "debit_mismatch"
+	// DiscrepancyCreditMismatch: the destinations were not credited the transaction's amount in total
+	DiscrepancyCreditMismatch = "credit_mismatch"
+	// DiscrepancyFeeMismatch: the source was not charged the transaction's fee
+	DiscrepancyFeeMismatch = "fee_mismatch"
+	// DiscrepancyUnbalanced: the entries of the transaction do not add up to zero
+	DiscrepancyUnbalanced = "unbalanced"
+	// DiscrepancyInvalidEntry: a ledger entry carries an amount that cannot be parsed
+	DiscrepancyInvalidEntry = "invalid_ledger_entry"
+)
+
+// Ledger entry types checked by Reconcile
+const (
+	ledgerEntryDebit  = "debit"
+	ledgerEntryCredit = "credit"
+	ledgerEntryFee    = "fee"
+)
+
+// Discrepancy is a completed transaction whose ledger entries do not match it
+type Discrepancy struct {
+	TransactionID domain.TransactionID
+	Code          string
+	Expected      string
+	Actual        string
+}
+
+// ReconciliationReport lists the completed transactions of a day that do not match the ledger
+type ReconciliationReport struct {
+	Date    time.Time
+	Checked int
+	// Truncated is set when more than MaxReconciledTransactions completed on the day; only the
+	// first of them were checked
+	Truncated     bool
+	Discrepancies []Discrepancy
+}
+
+// Reconciler cross-checks completed transactions against the ledger entries the account service
+// recorded for them
+type Reconciler struct {
+	repo     domain.TransactionRepository
+	accounts accounts.Client
+	clock    clock.Clock
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+// NewReconciler creates a reconciler that, when run, reconciles the previous day every interval
+func NewReconciler(repo domain.TransactionRepository, accountsClient accounts.Client, clk clock.Clock, interval time.Duration) *Reconciler {
+	return &Reconciler{
+		repo:     repo,
+		accounts: accountsClient,
+		clock:    clk,
+		interval: interval,
+		logger:   slog.Default(),
+	}
+}
+
+// Run reconciles the previous UTC day on every interval until the context is cancelled, logging
+// the discrepancies found
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := r.Reconcile(ctx, r.clock.Now().AddDate(0, 0, -1))
+			if err != nil {
+				r.logger.Error("failed to reconcile transactions", "error", err)
+				continue
+			}
+			for _, d := range report.Discrepancies {
+				r.logger.Warn("transaction does not match ledger",
+					"transaction_id", d.TransactionID,
+					"code", d.Code,
+					"expected", d.Expected,
+					"actual", d.Actual)
+			}
+			r.logger.Info("transactions reconciled",
+				"date", report.Date.Format(time.DateOnly),
+				"checked", report.Checked,
+				"discrepancies", len(report.Discrepancies),
+				"truncated", report.Truncated)
+		}
+	}
+}
+
+// Reconcile checks the transactions completed on the UTC day containing date against their ledger entries
+func (r *Reconciler) Reconcile(ctx context.Context, date time.Time) (*ReconciliationReport, error) {
+	year, month, day := date.UTC().Date()
+	from := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	transactions, err := r.repo.ListCompletedBetween(ctx, from, from.AddDate(0, 0, 1), MaxReconciledTransactions+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list completed transactions: %w", err)
+	}
+
+	report := &ReconciliationReport{Date: from, Discrepancies: []Discrepancy{}}
+	if len(transactions) > MaxReconciledTransactions {
+		transactions = transactions[:MaxReconciledTransactions]
+		report.Truncated = true
+	}
+
+	for _, transaction := range transactions {
+		entries, err := r.accounts.GetLedgerEntries(ctx, transaction.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: transaction %d: %v", ErrLedgerUnavailable, transaction.ID, err)
+		}
+		report.Discrepancies = append(report.Discrepancies, checkLedger(transaction, entries)...)
+		report.Checked++
+	}
+
+	return report, nil
+}
+
+// checkLedger compares a completed transaction with its ledger entries. Amounts are compared at
+// the display scale, which is the precision the account service reports entries with.
+func checkLedger(transaction *domain.Transaction, entries []domain.LedgerEntry) []Discrepancy {
+	if len(entries) == 0 {
+		return []Discrepancy{{TransactionID: transaction.ID, Code: DiscrepancyMissingEntries}}
+	}
+
+	zero := domain.NewMoney(0, domain.DisplayScale)
+	debit, credit, fee, net := zero, zero, zero, zero
+	var discrepancies []Discrepancy
+	for _, entry := range entries {
+		amount, err := domain.ParseMoney(entry.Amount)
+		if err != nil {
+			discrepancies = append(discrepancies, Discrepancy{TransactionID: transaction.ID, Code: DiscrepancyInvalidEntry, Actual: entry.Amount})
+			continue
+		}
+		amount = amount.RoundTo(domain.DisplayScale)
+		net = net.Add(amount)
+		switch {
+		case entry.Type == ledgerEntryDebit && entry.AccountID == transaction.SourceAccountID:
+			debit = debit.Add(amount)
+		case entry.Type == ledgerEntryCredit:
+			credit = credit.Add(amount)
+		case entry.Type == ledgerEntryFee && entry.AccountID == transaction.SourceAccountID:
+			fee = fee.Add(amount)
+		}
+	}
+
+	expectedAmount := parseExpected(transaction.Amount)
+	expectedFee := parseExpected(transaction.Fee)
+	checks := []struct {
+		code             string
+		expected, actual domain.Money
+	}{
+		{DiscrepancyDebitMismatch, expectedAmount.Neg(), debit},
+		{DiscrepancyCreditMismatch, expectedAmount, credit},
+		{DiscrepancyFeeMismatch, expectedFee.Neg(), fee},
+		{DiscrepancyUnbalanced, zero, net},
+	}
+	for _, check := range checks {
+		if check.expected.Cmp(check.actual) != 0 {
+			discrepancies = append(discrepancies, Discrepancy{
+				TransactionID: transaction.ID,
+				Code:          check.code,
+				Expected:      check.expected.Display(),
+				Actual:        check.actual.Display(),
+			})
+		}
+	}
+	return discrepancies
+}
+
+// parseExpected parses a stored transaction amount at the display scale; a missing fee is zero
+func parseExpected(amount string) domain.Money {
+	value, err := domain.ParseMoney(amount)
+	if err != nil {
+		return domain.NewMoney(0, domain.DisplayScale)
+	}
+	return value.RoundTo(domain.DisplayScale)
+}
@@ -0,0 +1,118 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"internal-transfers/transaction-service/internal/clock"
+	"internal-transfers/transaction-service/internal/domain"
+	"internal-transfers/transaction-service/internal/infrastructure/accounts"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// completedRepository lists the same completed transactions whatever the day, remembering the
+// bounds it was asked for
+type completedRepository struct {
+	domain.TransactionRepository
+
+	transactions []*domain.Transaction
+	from, to     time.Time
+}
+
+func (r *completedRepository) ListCompletedBetween(_ context.Context, from, to time.Time, limit int) ([]*domain.Transaction, error) {
+	r.from, r.to = from, to
+	return r.transactions[:min(limit, len(r.transactions))], nil
+}
+
+// ledgerClient serves the ledger entries of each transaction, or fails with err
+type ledgerClient struct {
+	accounts.Client
+
+	entries map[domain.TransactionID][]domain.LedgerEntry
+	err     error
+}
+
+func (c *ledgerClient) GetLedgerEntries(_ context.Context, transactionID domain.TransactionID) ([]domain.LedgerEntry, error) {
+	return c.entries[transactionID], c.err
+}
+
+// transferEntries are the entries the account service records for a transfer of amount with fee
+// from account 1 to account 2, with account 3 collecting fees
+func transferEntries(amount, fee string) []domain.LedgerEntry {
+	entries := []domain.LedgerEntry{
+		{AccountID: 1, Type: "debit", Amount: "-" + amount},
+		{AccountID: 2, Type: "credit", Amount: amount},
+	}
+	if fee != "" {
+		entries = append(entries,
+			domain.LedgerEntry{AccountID: 1, Type: "fee", Amount: "-" + fee},
+			domain.LedgerEntry{AccountID: 3, Type: "fee", Amount: fee})
+	}
+	return entries
+}
+
+func TestReconcile(t *testing.T) {
+	transaction := func(id domain.TransactionID, amount, fee string) *domain.Transaction {
+		return &domain.Transaction{ID: id, SourceAccountID: 1, DestinationAccountID: 2, Amount: amount, Fee: fee, Status: domain.TransactionStatusComplete}
+	}
+	repo := &completedRepository{transactions: []*domain.Transaction{
+		transaction(1, "10.00", ""),
+		transaction(2, "20.00", "0.50"),
+		transaction(3, "30.00", ""),
+		transaction(4, "40.00", ""),
+		transaction(5, "50.00", "1.00"),
+		transaction(6, "60.00", ""),
+	}}
+
+	// Transactions 1 and 2 match the ledger; each other one has a discrepancy injected
+	shortCredit := transferEntries("30.00", "")
+	shortCredit[1].Amount = "29.99"
+	invalid := transferEntries("60.00", "")
+	invalid[1].Amount = "sixty"
+	ledger := &ledgerClient{entries: map[domain.TransactionID][]domain.LedgerEntry{
+		1: transferEntries("10.00", ""),
+		2: transferEntries("20.00", "0.50"),
+		3: shortCredit,
+		5: transferEntries("50.00", "0.50"),
+		6: invalid,
+	}}
+
+	reconciler := NewReconciler(repo, ledger, clock.NewFake(time.Now()), time.Hour)
+	report, err := reconciler.Reconcile(context.Background(), time.Date(2024, 3, 10, 15, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	wantDay := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	if !repo.from.Equal(wantDay) || !repo.to.Equal(wantDay.AddDate(0, 0, 1)) || !report.Date.Equal(wantDay) {
+		t.Errorf("reconciled [%s, %s) reported as %s, want the day of %s", repo.from, repo.to, report.Date, wantDay)
+	}
+	if report.Checked != 6 || report.Truncated {
+		t.Errorf("checked %d transactions, truncated %t, want all 6", report.Checked, report.Truncated)
+	}
+	want := []Discrepancy{
+		{TransactionID: 3, Code: DiscrepancyCreditMismatch, Expected: "30.00", Actual: "29.99"},
+		{TransactionID: 3, Code: DiscrepancyUnbalanced, Expected: "0.00", Actual: "-0.01"},
+		{TransactionID: 4, Code: DiscrepancyMissingEntries},
+		{TransactionID: 5, Code: DiscrepancyFeeMismatch, Expected: "-1.00", Actual: "-0.50"},
+		{TransactionID: 6, Code: DiscrepancyInvalidEntry, Actual: "sixty"},
+		{TransactionID: 6, Code: DiscrepancyCreditMismatch, Expected: "60.00", Actual: "0.00"},
+		{TransactionID: 6, Code: DiscrepancyUnbalanced, Expected: "0.00", Actual: "-60.00"},
+	}
+	if !reflect.DeepEqual(report.Discrepancies, want) {
+		t.Errorf("discrepancies = %+v\nwant %+v", report.Discrepancies, want)
+	}
+}
+
+func TestReconcileLedgerUnavailable(t *testing.T) {
+	repo := &completedRepository{transactions: []*domain.Transaction{
+		{ID: 1, SourceAccountID: 1, DestinationAccountID: 2, Amount: "10.00", Status: domain.TransactionStatusComplete},
+	}}
+	reconciler := NewReconciler(repo, &ledgerClient{err: errors.New("connection refused")}, clock.NewFake(time.Now()), time.Hour)
+
+	// A ledger that cannot be read is not reported as missing entries
+	if _, err := reconciler.Reconcile(context.Background(), time.Now()); !errors.Is(err, ErrLedgerUnavailable) {
+		t.Errorf("Reconcile() error = %v, want %v", err, ErrLedgerUnavailable)
+	}
+}
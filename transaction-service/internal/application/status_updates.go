@@ -0,0 +1,60 @@
+package application
+
+import (
+	"internal-transfers/transaction-service/internal/domain"
+	"sync"
+)
+
+// StatusUpdates hands the status changes of transactions to the subscribers of each transaction,
+// such as the event streams of clients tracking a transfer. Only changes made by this instance
+// are seen, so subscribers should also poll for changes made by others.
+type StatusUpdates struct {
+	mu          sync.Mutex
+	subscribers map[domain.TransactionID]map[chan domain.TransactionStatus]struct{}
+}
+
+// NewStatusUpdates creates a StatusUpdates without subscribers
+func NewStatusUpdates() *StatusUpdates {
+	return &StatusUpdates{subscribers: make(map[domain.TransactionID]map[chan domain.TransactionStatus]struct{})}
+}
+
+// Subscribe returns a channel receiving the status changes of the transaction, and a function that
+// ends the subscription. A subscriber that falls behind only receives the latest status.
+func (u *StatusUpdates) Subscribe(id domain.TransactionID) (<-chan domain.TransactionStatus, func()) {
+	ch := make(chan domain.TransactionStatus, 1)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.subscribers[id] == nil {
+		u.subscribers[id] = make(map[chan domain.TransactionStatus]struct{})
+	}
+	u.subscribers[id][ch] = struct{}{}
+
+	return ch, func() {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		delete(u.subscribers[id], ch)
+		if len(u.subscribers[id]) == 0 {
+			delete(u.subscribers, id)
+		}
+	}
+}
+
+// Publish hands the new status of the transaction to its subscribers without waiting for them.
+// It does nothing on a nil StatusUpdates.
+func (u *StatusUpdates) Publish(id domain.TransactionID, status domain.TransactionStatus) {
+	if u == nil {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for ch := range u.subscribers[id] {
+		// Replace a status the subscriber has not read yet
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- status
+	}
+}
@@ -4,10 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"internal-transfers/pkg/features"
+	"internal-transfers/transaction-service/internal/clock"
 	"internal-transfers/transaction-service/internal/domain"
+	"internal-transfers/transaction-service/internal/infrastructure/accounts"
 	"internal-transfers/transaction-service/internal/infrastructure/messaging"
+	"internal-transfers/transaction-service/internal/infrastructure/webhooks"
 	"log/slog"
-	"os"
+	"slices"
+	"time"
 )
 
 // Common errors
@@ -16,29 +21,173 @@ var (
 	ErrInvalidAmount     = errors.New("invalid amount")
 	ErrInsufficientFunds = errors.New("insufficient funds")
 	ErrAccountNotFound   = errors.New("account not found")
+
+	ErrTooManyPendingTransfers = errors.New("too many pending transfers for source account")
+	ErrBrokerUnavailable       = errors.New("message broker unavailable, try again later")
+	ErrInvalidSplit            = fmt.Errorf("split transfers need between 2 and %d legs", MaxSplitLegs)
+	ErrDuplicateDestination    = errors.New("split transfer lists the same destination more than once")
+
+	ErrTransactionNotFound   = errors.New("transaction not found")
+	ErrTransactionNotPending = errors.New("only pending transactions can be re-emitted")
+	ErrAlreadyApplied        = errors.New("transaction already has ledger entries in the account service")
 )
 
+// errorLevel is the level a failed operation is logged at: a warning when err only reports that the
+// caller went away or ran out of time, which is no failure of the service, and an error otherwise
+func errorLevel(err error) slog.Level {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
+
+// MaxSplitLegs is the largest number of destinations a split transfer may credit
+const MaxSplitLegs = 100
+
 // TransactionService defines the interface for transaction operations
 type TransactionService interface {
-	SubmitTransaction(ctx context.Context, dto TransactionDTO) error
+	SubmitTransaction(ctx context.Context, dto TransactionDTO) (*SubmitResult, error)
+	SubmitSplitTransaction(ctx context.Context, dto SplitTransactionDTO) (*domain.Transaction, error)
+	SubmitBatch(ctx context.Context, dtos []TransactionDTO, mode BatchMode) ([]BatchItemResult, error)
 	GetTransaction(ctx context.Context, id domain.TransactionID) (*domain.Transaction, error)
+	UpdateTransactionMemo(ctx context.Context, id domain.TransactionID, memo string) (*domain.Transaction, error)
+	GetTransactionTrace(ctx context.Context, id domain.TransactionID) (*TransactionTrace, error)
+	GetDailyReport(ctx context.Context, date time.Time) (*DailyReport, error)
+	ListArchivableTransactions(ctx context.Context, olderThan time.Duration, limit, offset int) (*ArchivableTransactions, error)
+	ArchiveTransactions(ctx context.Context, olderThan time.Duration) (*ArchiveResult, error)
+	ReemitTransaction(ctx context.Context, id domain.TransactionID) (*domain.Transaction, error)
 	HandleTransactionCompleted(ctx context.Context, event domain.TransactionEvent) error
 	HandleTransactionFailed(ctx context.Context, event domain.TransactionEvent) error
+	HandleTransactionHeld(ctx context.Context, event domain.TransactionEvent) error
+	HandleTransactionProcessing(ctx context.Context, event domain.TransactionEvent) error
 }
 
 type transactionService struct {
-	repo   domain.TransactionRepository
-	broker messaging.MessageBroker
-	logger *slog.Logger
+	repo     domain.TransactionRepository
+	broker   messaging.MessageBroker
+	accounts accounts.Client
+	clock    clock.Clock
+	logger   *slog.Logger
+
+	maxPendingPerAccount int
+	duplicateWindow      time.Duration
+	accountCache         *accounts.Cache
+	webhooks             webhooks.Notifier
+	unknownTransactions  UnknownTransactionPolicy
+	statusUpdates        *StatusUpdates
+	fees                 FeeCalculator
+	currency             string
+	features             features.Flags
+}
+
+// UnknownTransactionPolicy decides what happens to an event about a transaction that does not exist,
+// e.g. because it was published by another environment
+type UnknownTransactionPolicy string
+
+const (
+	// UnknownTransactionIgnore acknowledges the event, logging it at debug level only
+	UnknownTransactionIgnore UnknownTransactionPolicy = "ignore"
+	// UnknownTransactionLog acknowledges the event and logs a warning
+	UnknownTransactionLog UnknownTransactionPolicy = "log"
+	// UnknownTransactionDeadLetter fails the event with domain.ErrUnknownTransaction, which moves it
+	// to the dead letter queue for inspection
+	UnknownTransactionDeadLetter UnknownTransactionPolicy = "dead-letter"
+)
+
+// Option configures optional behavior of the transaction service
+type Option func(*transactionService)
+
+// WithClock sets the clock used for time-based logic; the system clock is used by default
+func WithClock(clk clock.Clock) Option {
+	return func(s *transactionService) {
+		s.clock = clk
+	}
+}
+
+// WithMaxPendingPerAccount limits how many pending transactions a single source account may have.
+// A limit of zero disables the check.
+func WithMaxPendingPerAccount(limit int) Option {
+	return func(s *transactionService) {
+		s.maxPendingPerAccount = limit
+	}
+}
+
+// DefaultDuplicateWindow is how far back identical transfers are looked for unless WithDuplicateWindow is used
+const DefaultDuplicateWindow = 10 * time.Second
+
+// WithDuplicateWindow sets how far back the duplicate_transfer_check feature looks: while it is on,
+// SubmitTransaction returns an existing transaction instead of creating a new one when a transfer
+// between the same accounts for the same amount was submitted within the window and has not failed
+func WithDuplicateWindow(window time.Duration) Option {
+	return func(s *transactionService) {
+		if window > 0 {
+			s.duplicateWindow = window
+		}
+	}
+}
+
+// WithAccountCache checks that both accounts of a transfer exist before accepting it. Accounts in
+// the cache are accepted right away; others are looked up in the account service and cached.
+func WithAccountCache(cache *accounts.Cache) Option {
+	return func(s *transactionService) {
+		s.accountCache = cache
+	}
+}
+
+// WithWebhooks notifies subscribers once a transaction has completed, failed or been held for review
+func WithWebhooks(notifier webhooks.Notifier) Option {
+	return func(s *transactionService) {
+		s.webhooks = notifier
+	}
+}
+
+// WithStatusUpdates publishes the status changes caused by consumed events to updates
+func WithStatusUpdates(updates *StatusUpdates) Option {
+	return func(s *transactionService) {
+		s.statusUpdates = updates
+	}
+}
+
+// WithFees charges transfers submitted without a fee the fee calculator resolves for their amount
+// in currency, the currency of the accounts. Transfers carrying a fee keep theirs.
+func WithFees(calculator FeeCalculator, currency string) Option {
+	return func(s *transactionService) {
+		s.fees = calculator
+		s.currency = currency
+	}
+}
+
+// WithFeatures sets the feature flags gating behaviors of the service; all are at their default otherwise
+func WithFeatures(flags features.Flags) Option {
+	return func(s *transactionService) {
+		s.features = flags
+	}
+}
+
+// WithUnknownTransactionPolicy sets what happens to events about transactions that do not exist;
+// they are logged and acknowledged by default
+func WithUnknownTransactionPolicy(policy UnknownTransactionPolicy) Option {
+	return func(s *transactionService) {
+		s.unknownTransactions = policy
+	}
 }
 
 // NewTransactionService creates a new instance of TransactionService
-func NewTransactionService(repo domain.TransactionRepository, broker messaging.MessageBroker) TransactionService {
-	return &transactionService{
-		repo:   repo,
-		broker: broker,
-		logger: slog.New(slog.NewJSONHandler(os.Stdout, nil)),
+func NewTransactionService(repo domain.TransactionRepository, broker messaging.MessageBroker, accountsClient accounts.Client, opts ...Option) TransactionService {
+	s := &transactionService{
+		repo:     repo,
+		broker:   broker,
+		accounts: accountsClient,
+		clock:    clock.Real{},
+		logger:   slog.Default(),
+
+		duplicateWindow:     DefaultDuplicateWindow,
+		unknownTransactions: UnknownTransactionLog,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // TransactionDTO represents the data needed to create a new transaction
@@ -46,15 +195,69 @@ type TransactionDTO struct {
 	SourceAccountID      domain.AccountID
 	DestinationAccountID domain.AccountID
 	Amount               string
+	Fee                  string
+	Memo                 string
+}
+
+// SplitTransactionDTO represents the data needed to create a transfer from one source to several
+// destinations
+type SplitTransactionDTO struct {
+	SourceAccountID domain.AccountID
+	Legs            []domain.TransferLeg
+	Fee             string
+	Memo            string
+}
+
+// TransactionTrace aggregates everything known about a transaction across services
+type TransactionTrace struct {
+	Transaction   *domain.Transaction
+	StatusHistory []domain.StatusChange
+	LedgerEntries []domain.LedgerEntry
+	// LedgerError is set when the ledger entries could not be fetched from the account service
+	LedgerError string
+}
+
+// SubmitResult is the outcome of SubmitTransaction
+type SubmitResult struct {
+	Transaction *domain.Transaction
+	// Duplicate is set when Transaction is an identical transfer submitted earlier within the
+	// duplicate window rather than a newly created one
+	Duplicate bool
+}
+
+// DailyReport totals the transactions completed on a calendar day (UTC)
+type DailyReport struct {
+	Date      time.Time
+	Completed domain.TransactionTotals
+}
+
+// ArchivableTransactions lists transactions that reached a terminal status before a cutoff
+type ArchivableTransactions struct {
+	Cutoff       time.Time
+	Transactions []*domain.Transaction
+}
+
+// ArchiveResult reports how many transactions were moved to the archive
+type ArchiveResult struct {
+	Cutoff   time.Time
+	Archived int
 }
 
 // SubmitTransaction implements the transaction submission logic
-func (s *transactionService) SubmitTransaction(ctx context.Context, dto TransactionDTO) error {
-	s.logger.Info("submitting transaction",
+func (s *transactionService) SubmitTransaction(ctx context.Context, dto TransactionDTO) (*SubmitResult, error) {
+	s.logger.InfoContext(ctx, "submitting transaction",
 		"source_account", dto.SourceAccountID,
 		"destination_account", dto.DestinationAccountID,
 		"amount", dto.Amount)
 
+	if err := s.checkTransfer(ctx, dto); err != nil {
+		return nil, err
+	}
+	return s.submitChecked(ctx, dto, true)
+}
+
+// checkTransfer rejects a transfer between the same account or involving unknown accounts
+func (s *transactionService) checkTransfer(ctx context.Context, dto TransactionDTO) error {
 	// Validate source and destination accounts are different
 	if dto.SourceAccountID == dto.DestinationAccountID {
 		s.logger.Error("same account transfer attempted",
@@ -62,44 +265,215 @@ func (s *transactionService) SubmitTransaction(ctx context.Context, dto Transact
 		return ErrSameAccount
 	}
 
+	// Reject transfers involving unknown accounts before they are recorded
+	if s.accountCache != nil {
+		for _, id := range []domain.AccountID{dto.SourceAccountID, dto.DestinationAccountID} {
+			if err := s.checkAccountExists(ctx, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// submitChecked records and publishes a transfer that passed checkTransfer, unless it is a
+// duplicate. The pending limit of the source is only checked when checkPending is set.
+func (s *transactionService) submitChecked(ctx context.Context, dto TransactionDTO, checkPending bool) (*SubmitResult, error) {
+	// Treat an identical transfer submitted moments ago as an accidental resubmission
+	if s.features.Enabled(features.DuplicateTransferCheck) {
+		existing, err := s.repo.FindRecentDuplicate(ctx, dto.SourceAccountID, dto.DestinationAccountID, dto.Amount, s.clock.Now().Add(-s.duplicateWindow))
+		if err != nil {
+			s.logger.Log(ctx, errorLevel(err), "failed to look up duplicate transactions",
+				"error", err,
+				"source_account", dto.SourceAccountID)
+			return nil, fmt.Errorf("failed to look up duplicate transactions: %w", err)
+		}
+		if existing != nil {
+			s.logger.Info("duplicate transaction submission, returning existing transaction",
+				"transaction_id", existing.ID,
+				"source_account", dto.SourceAccountID,
+				"destination_account", dto.DestinationAccountID)
+			return &SubmitResult{Transaction: existing, Duplicate: true}, nil
+		}
+	}
+
+	if checkPending {
+		if err := s.checkPendingLimit(ctx, dto.SourceAccountID); err != nil {
+			return nil, err
+		}
+	}
+
+	fee, err := s.resolveFee(dto.Amount, dto.Fee)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create transaction record
 	transaction := &domain.Transaction{
 		SourceAccountID:      dto.SourceAccountID,
 		DestinationAccountID: dto.DestinationAccountID,
 		Amount:               dto.Amount,
+		Fee:                  fee,
+		Memo:                 dto.Memo,
+		Status:               domain.TransactionStatusPending,
+	}
+	if err := s.createAndPublish(ctx, transaction); err != nil {
+		return nil, err
+	}
+
+	return &SubmitResult{Transaction: transaction}, nil
+}
+
+// SubmitSplitTransaction implements the submission of a transfer from one source to several
+// destinations. It is recorded and applied as a single transaction, so either every leg is
+// credited or none is.
+func (s *transactionService) SubmitSplitTransaction(ctx context.Context, dto SplitTransactionDTO) (*domain.Transaction, error) {
+	s.logger.InfoContext(ctx, "submitting split transaction",
+		"source_account", dto.SourceAccountID,
+		"legs", len(dto.Legs))
+
+	if len(dto.Legs) < 2 || len(dto.Legs) > MaxSplitLegs {
+		return nil, ErrInvalidSplit
+	}
+
+	// Validate the destinations and add up the amount debited from the source
+	total := domain.NewMoney(0, domain.DisplayScale)
+	destinations := make(map[domain.AccountID]bool, len(dto.Legs))
+	for _, leg := range dto.Legs {
+		if leg.DestinationAccountID == dto.SourceAccountID {
+			s.logger.Error("same account transfer attempted",
+				"account_id", dto.SourceAccountID)
+			return nil, ErrSameAccount
+		}
+		if destinations[leg.DestinationAccountID] {
+			return nil, fmt.Errorf("%w: account %d", ErrDuplicateDestination, leg.DestinationAccountID)
+		}
+		destinations[leg.DestinationAccountID] = true
+
+		amount, err := domain.ParseMoney(leg.Amount)
+		if err != nil || amount.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: leg to account %d", ErrInvalidAmount, leg.DestinationAccountID)
+		}
+		if total, err = total.CheckedAdd(amount); err != nil {
+			return nil, fmt.Errorf("%w: legs add up to more than the largest amount", ErrInvalidAmount)
+		}
+	}
+
+	// Reject transfers involving unknown accounts before they are recorded
+	if s.accountCache != nil {
+		if err := s.checkAccountExists(ctx, dto.SourceAccountID); err != nil {
+			return nil, err
+		}
+		for _, leg := range dto.Legs {
+			if err := s.checkAccountExists(ctx, leg.DestinationAccountID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := s.checkPendingLimit(ctx, dto.SourceAccountID); err != nil {
+		return nil, err
+	}
+
+	fee, err := s.resolveFee(total.String(), dto.Fee)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction := &domain.Transaction{
+		SourceAccountID:      dto.SourceAccountID,
+		DestinationAccountID: dto.Legs[0].DestinationAccountID,
+		Amount:               total.String(),
+		Fee:                  fee,
+		Memo:                 dto.Memo,
 		Status:               domain.TransactionStatusPending,
+		Legs:                 dto.Legs,
+	}
+	if err := s.createAndPublish(ctx, transaction); err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+// resolveFee returns the fee of a transfer of amount: the fee it was submitted with, if any, or the
+// one the fee calculator resolves. A zero fee is returned empty, as for transfers without a fee.
+func (s *transactionService) resolveFee(amount, fee string) (string, error) {
+	if fee != "" || s.fees == nil {
+		return fee, nil
+	}
+	money, err := domain.ParseMoney(amount)
+	if err != nil {
+		return "", ErrInvalidAmount
+	}
+	resolved, err := s.fees.Fee(money, s.currency)
+	if err != nil {
+		s.logger.Error("failed to resolve transfer fee", "error", err, "amount", amount)
+		return "", fmt.Errorf("%w: no fee can be charged for the amount", ErrInvalidAmount)
+	}
+	if resolved.Sign() == 0 {
+		return "", nil
+	}
+	return domain.NormalizeAmount(resolved.String())
+}
+
+// checkPendingLimit prevents a single account from flooding the system with pending transfers
+func (s *transactionService) checkPendingLimit(ctx context.Context, source domain.AccountID) error {
+	if s.maxPendingPerAccount <= 0 {
+		return nil
+	}
+
+	pending, err := s.repo.CountPendingBySourceAccount(ctx, source)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to count pending transactions",
+			"error", err,
+			"source_account", source)
+		return fmt.Errorf("failed to count pending transactions: %w", err)
+	}
+	if pending >= s.maxPendingPerAccount {
+		s.logger.Warn("too many pending transactions",
+			"source_account", source,
+			"pending", pending,
+			"limit", s.maxPendingPerAccount)
+		return ErrTooManyPendingTransfers
+	}
+	return nil
+}
+
+// createAndPublish records the pending transaction and publishes its submitted event. The
+// transaction is marked failed when the event cannot be published.
+func (s *transactionService) createAndPublish(ctx context.Context, transaction *domain.Transaction) error {
+	// Refuse the transfer while its event cannot be published, rather than recording it only to fail it
+	if !s.broker.IsConnected() {
+		s.logger.Error("message broker unavailable, rejecting transaction",
+			"source_account", transaction.SourceAccountID,
+			"destination_account", transaction.DestinationAccountID)
+		return ErrBrokerUnavailable
 	}
 
 	// Save transaction to database
 	if err := s.repo.Create(ctx, transaction); err != nil {
-		s.logger.Error("failed to create transaction",
+		s.logger.Log(ctx, errorLevel(err), "failed to create transaction",
 			"error", err,
-			"source_account", dto.SourceAccountID,
-			"destination_account", dto.DestinationAccountID)
+			"source_account", transaction.SourceAccountID,
+			"destination_account", transaction.DestinationAccountID)
 		return fmt.Errorf("failed to create transaction: %w", err)
 	}
 
-	s.logger.Info("transaction created",
+	s.logger.InfoContext(ctx, "transaction created",
 		"transaction_id", transaction.ID,
 		"status", transaction.Status)
 
 	// Publish transaction submitted event
-	event := domain.TransactionEvent{
-		TransactionID:        transaction.ID,
-		SourceAccountID:      transaction.SourceAccountID,
-		DestinationAccountID: transaction.DestinationAccountID,
-		Amount:               transaction.Amount,
-		Status:               string(transaction.Status),
-	}
-
-	if err := s.broker.PublishTransactionSubmitted(ctx, event); err != nil {
-		s.logger.Error("failed to publish transaction event",
+	if err := s.broker.PublishTransactionSubmitted(ctx, submittedEvent(transaction)); err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to publish transaction event",
 			"error", err,
 			"transaction_id", transaction.ID)
 		// Log the error and mark transaction as failed
 		transaction.Status = domain.TransactionStatusFailed
+		transaction.FailureCode = domain.FailurePublishFailed
 		if updateErr := s.repo.Update(ctx, transaction); updateErr != nil {
-			s.logger.Error("failed to update transaction status",
+			s.logger.Log(ctx, errorLevel(updateErr), "failed to update transaction status",
 				"error", updateErr,
 				"transaction_id", transaction.ID)
 		}
@@ -113,6 +487,86 @@ func (s *transactionService) SubmitTransaction(ctx context.Context, dto Transact
 	return nil
 }
 
+// submittedEvent returns the transaction submitted event of a pending transaction
+func submittedEvent(transaction *domain.Transaction) domain.TransactionEvent {
+	return domain.TransactionEvent{
+		TransactionID:        transaction.ID,
+		SourceAccountID:      transaction.SourceAccountID,
+		DestinationAccountID: transaction.DestinationAccountID,
+		Amount:               transaction.Amount,
+		Fee:                  transaction.Fee,
+		Memo:                 transaction.Memo,
+		Status:               domain.EventStatus(transaction.Status),
+		Legs:                 transaction.Legs,
+	}
+}
+
+// ReemitTransaction publishes the submitted event of a pending transaction again, for when the
+// original event was lost. Transactions the account service already applied are refused, as their
+// event was consumed and only its outcome went missing; re-emitting would apply them twice.
+func (s *transactionService) ReemitTransaction(ctx context.Context, id domain.TransactionID) (*domain.Transaction, error) {
+	transaction, err := s.GetTransaction(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if transaction.Status != domain.TransactionStatusPending {
+		return nil, ErrTransactionNotPending
+	}
+
+	entries, err := s.accounts.GetLedgerEntries(ctx, id)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to get ledger entries",
+			"error", err,
+			"transaction_id", id)
+		return nil, fmt.Errorf("%w: %v", ErrLedgerUnavailable, err)
+	}
+	if len(entries) > 0 {
+		return nil, ErrAlreadyApplied
+	}
+
+	if !s.broker.IsConnected() {
+		return nil, ErrBrokerUnavailable
+	}
+	if err := s.broker.PublishTransactionSubmitted(ctx, submittedEvent(transaction)); err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to re-emit transaction event",
+			"error", err,
+			"transaction_id", id)
+		return nil, fmt.Errorf("failed to publish transaction event: %w", err)
+	}
+
+	s.logger.Warn("transaction event re-emitted",
+		"transaction_id", id,
+		"event_type", domain.EventTransactionSubmitted)
+
+	return transaction, nil
+}
+
+// checkAccountExists returns ErrAccountNotFound when the account service does not know the account.
+// The transfer is let through when the account service cannot be reached; the account service
+// still rejects it when processing the transfer.
+func (s *transactionService) checkAccountExists(ctx context.Context, id domain.AccountID) error {
+	if s.accountCache.Contains(id) {
+		return nil
+	}
+
+	exists, err := s.accounts.AccountExists(ctx, id)
+	if err != nil {
+		s.logger.Warn("failed to check account existence",
+			"error", err,
+			"account_id", id)
+		return nil
+	}
+	if !exists {
+		s.logger.Warn("transfer involves unknown account",
+			"account_id", id)
+		return fmt.Errorf("%w: %d", ErrAccountNotFound, id)
+	}
+
+	s.accountCache.Add(id)
+	return nil
+}
+
 // GetTransaction implements the transaction retrieval logic
 func (s *transactionService) GetTransaction(ctx context.Context, id domain.TransactionID) (*domain.Transaction, error) {
 	s.logger.Info("getting transaction",
@@ -120,16 +574,26 @@ func (s *transactionService) GetTransaction(ctx context.Context, id domain.Trans
 
 	transaction, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		s.logger.Error("failed to get transaction",
+		s.logger.Log(ctx, errorLevel(err), "failed to get transaction",
 			"error", err,
 			"transaction_id", id)
 		return nil, fmt.Errorf("failed to get transaction: %w", err)
 	}
 
+	if transaction == nil {
+		// Ledger entries keep referring to archived transactions, so they are still served
+		if transaction, err = s.repo.GetArchived(ctx, id); err != nil {
+			s.logger.Log(ctx, errorLevel(err), "failed to get archived transaction",
+				"error", err,
+				"transaction_id", id)
+			return nil, fmt.Errorf("failed to get transaction: %w", err)
+		}
+	}
+
 	if transaction == nil {
 		s.logger.Warn("transaction not found",
 			"transaction_id", id)
-		return nil, fmt.Errorf("transaction not found")
+		return nil, ErrTransactionNotFound
 	}
 
 	s.logger.Info("transaction retrieved",
@@ -139,6 +603,151 @@ func (s *transactionService) GetTransaction(ctx context.Context, id domain.Trans
 	return transaction, nil
 }
 
+// UpdateTransactionMemo replaces the memo of a transaction, whatever its status. The memo is
+// metadata only: it is not sent to the account service again.
+func (s *transactionService) UpdateTransactionMemo(ctx context.Context, id domain.TransactionID, memo string) (*domain.Transaction, error) {
+	found, err := s.repo.UpdateMemo(ctx, id, memo)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to update transaction memo",
+			"error", err,
+			"transaction_id", id)
+		return nil, fmt.Errorf("failed to update transaction memo: %w", err)
+	}
+	if !found {
+		return nil, ErrTransactionNotFound
+	}
+
+	s.logger.Info("transaction memo updated",
+		"transaction_id", id)
+
+	return s.GetTransaction(ctx, id)
+}
+
+// GetTransactionTrace composes the transaction, its status history and its ledger entries
+func (s *transactionService) GetTransactionTrace(ctx context.Context, id domain.TransactionID) (*TransactionTrace, error) {
+	transaction, err := s.GetTransaction(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.repo.GetStatusHistory(ctx, id)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to get status history",
+			"error", err,
+			"transaction_id", id)
+		return nil, fmt.Errorf("failed to get status history: %w", err)
+	}
+
+	trace := &TransactionTrace{
+		Transaction:   transaction,
+		StatusHistory: history,
+		LedgerEntries: []domain.LedgerEntry{},
+	}
+
+	// Ledger entries live in the account service; a failure there should not hide the local data
+	entries, err := s.accounts.GetLedgerEntries(ctx, id)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to get ledger entries",
+			"error", err,
+			"transaction_id", id)
+		trace.LedgerError = err.Error()
+	} else {
+		trace.LedgerEntries = entries
+	}
+
+	return trace, nil
+}
+
+// GetDailyReport totals the transactions completed on the UTC day containing date
+func (s *transactionService) GetDailyReport(ctx context.Context, date time.Time) (*DailyReport, error) {
+	year, month, day := date.UTC().Date()
+	from := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	totals, err := s.repo.SumCompletedBetween(ctx, from, from.AddDate(0, 0, 1))
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to sum completed transactions",
+			"error", err,
+			"date", from.Format(time.DateOnly))
+		return nil, fmt.Errorf("failed to sum completed transactions: %w", err)
+	}
+
+	return &DailyReport{Date: from, Completed: totals}, nil
+}
+
+// ListArchivableTransactions lists the completed, failed and rolled back transactions last updated
+// more than olderThan ago, oldest first, so they can be archived or purged. Split transfers are
+// listed without their legs.
+func (s *transactionService) ListArchivableTransactions(ctx context.Context, olderThan time.Duration, limit, offset int) (*ArchivableTransactions, error) {
+	cutoff := s.clock.Now().Add(-olderThan)
+	transactions, err := s.repo.ListUpdatedBefore(ctx, cutoff, limit, offset, domain.TerminalStatuses...)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to list archivable transactions",
+			"error", err,
+			"cutoff", cutoff)
+		return nil, fmt.Errorf("failed to list archivable transactions: %w", err)
+	}
+
+	return &ArchivableTransactions{Cutoff: cutoff, Transactions: transactions}, nil
+}
+
+// archiveBatchSize is the largest number of transactions moved to the archive in one database transaction
+const archiveBatchSize = 100
+
+// ArchiveTransactions moves the completed, failed and rolled back transactions last updated more
+// than olderThan ago to the archive, batch by batch. Archived transactions can still be read but no
+// longer change. Batches archived before an error are kept.
+func (s *transactionService) ArchiveTransactions(ctx context.Context, olderThan time.Duration) (*ArchiveResult, error) {
+	result := &ArchiveResult{Cutoff: s.clock.Now().Add(-olderThan)}
+	for {
+		archived, err := s.repo.ArchiveUpdatedBefore(ctx, result.Cutoff, archiveBatchSize, domain.TerminalStatuses...)
+		if err != nil {
+			s.logger.Log(ctx, errorLevel(err), "failed to archive transactions",
+				"error", err,
+				"cutoff", result.Cutoff,
+				"archived", result.Archived)
+			return nil, fmt.Errorf("failed to archive transactions: %w", err)
+		}
+		result.Archived += archived
+		if archived < archiveBatchSize {
+			break
+		}
+	}
+
+	s.logger.Info("transactions archived",
+		"cutoff", result.Cutoff,
+		"archived", result.Archived)
+
+	return result, nil
+}
+
+// handleUnknownTransaction applies the unknown transaction policy to an event about a transaction
+// that does not exist; kind names what the event reports, e.g. "completion"
+func (s *transactionService) handleUnknownTransaction(event domain.TransactionEvent, kind string) error {
+	switch s.unknownTransactions {
+	case UnknownTransactionIgnore:
+		s.logger.Debug("transaction not found for "+kind+", ignoring event",
+			"transaction_id", event.TransactionID)
+		return nil
+	case UnknownTransactionDeadLetter:
+		s.logger.Warn("transaction not found for "+kind+", dead-lettering event",
+			"transaction_id", event.TransactionID)
+		return fmt.Errorf("%w: transaction %d", domain.ErrUnknownTransaction, event.TransactionID)
+	default:
+		s.logger.Warn("transaction not found for "+kind,
+			"transaction_id", event.TransactionID)
+		return nil
+	}
+}
+
+// unsettledStatuses are the statuses of transactions whose outcome has not been reported yet.
+// Completed and failed events only apply to them, so that a redelivered or late event cannot
+// overwrite the outcome recorded first.
+var unsettledStatuses = []domain.TransactionStatus{
+	domain.TransactionStatusPending,
+	domain.TransactionStatusProcessing,
+	domain.TransactionStatusHeld,
+}
+
 // HandleTransactionCompleted updates transaction status when completed
 func (s *transactionService) HandleTransactionCompleted(ctx context.Context, event domain.TransactionEvent) error {
 	s.logger.Info("handling transaction completed",
@@ -146,22 +755,48 @@ func (s *transactionService) HandleTransactionCompleted(ctx context.Context, eve
 
 	transaction, err := s.repo.GetByID(ctx, event.TransactionID)
 	if err != nil {
-		s.logger.Error("failed to get transaction for completion",
+		s.logger.Log(ctx, errorLevel(err), "failed to get transaction for completion",
 			"error", err,
 			"transaction_id", event.TransactionID)
 		return fmt.Errorf("failed to get transaction: %w", err)
 	}
 
+	if transaction == nil {
+		return s.handleUnknownTransaction(event, "completion")
+	}
+
+	// An expired transaction may still have been applied by the account service, whose outcome wins
+	expected := unsettledStatuses
+	if transaction.Status == domain.TransactionStatusFailed && transaction.FailureCode == domain.FailureExpired {
+		s.logger.Warn("expired transaction was completed by the account service",
+			"transaction_id", event.TransactionID)
+		expected = append(slices.Clone(unsettledStatuses), domain.TransactionStatusFailed)
+	}
+
+	previous := transaction.Status
 	transaction.Status = domain.TransactionStatusComplete
-	if err := s.repo.Update(ctx, transaction); err != nil {
-		s.logger.Error("failed to update transaction status to complete",
+	transaction.FailureCode = ""
+	updated, err := s.repo.UpdateIfStatus(ctx, transaction, expected...)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to update transaction status to complete",
 			"error", err,
 			"transaction_id", event.TransactionID)
 		return fmt.Errorf("failed to update transaction: %w", err)
 	}
+	if !updated {
+		s.logger.Warn("ignoring stale transaction completed event",
+			"transaction_id", event.TransactionID,
+			"status", previous)
+		return nil
+	}
 
 	s.logger.Info("transaction marked as complete",
 		"transaction_id", event.TransactionID)
+	s.statusUpdates.Publish(event.TransactionID, domain.TransactionStatusComplete)
+
+	if s.webhooks != nil {
+		s.webhooks.Notify(ctx, domain.EventTransactionCompleted, event)
+	}
 
 	return nil
 }
@@ -170,34 +805,124 @@ func (s *transactionService) HandleTransactionCompleted(ctx context.Context, eve
 func (s *transactionService) HandleTransactionFailed(ctx context.Context, event domain.TransactionEvent) error {
 	s.logger.Info("handling transaction failed",
 		"transaction_id", event.TransactionID,
-		"error", event.Status)
+		"failure_code", event.FailureCode,
+		"failure_reason", event.FailureReason)
 
 	transaction, err := s.repo.GetByID(ctx, event.TransactionID)
 	if err != nil {
-		s.logger.Error("failed to get transaction for failure",
+		s.logger.Log(ctx, errorLevel(err), "failed to get transaction for failure",
 			"error", err,
 			"transaction_id", event.TransactionID)
 		return fmt.Errorf("failed to get transaction: %w", err)
 	}
 
 	if transaction == nil {
-		s.logger.Warn("transaction not found for failure",
-			"transaction_id", event.TransactionID)
-		return nil
+		return s.handleUnknownTransaction(event, "failure")
 	}
 
 	// Update transaction status
+	previous := transaction.Status
 	transaction.Status = domain.TransactionStatusFailed
-	if err := s.repo.Update(ctx, transaction); err != nil {
-		s.logger.Error("failed to update transaction status to failed",
+	transaction.FailureCode = event.FailureCode
+	updated, err := s.repo.UpdateIfStatus(ctx, transaction, unsettledStatuses...)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to update transaction status to failed",
 			"error", err,
 			"transaction_id", event.TransactionID)
 		return fmt.Errorf("failed to update transaction: %w", err)
 	}
+	if !updated {
+		s.logger.Warn("ignoring stale transaction failed event",
+			"transaction_id", event.TransactionID,
+			"status", previous)
+		return nil
+	}
 
 	s.logger.Info("transaction marked as failed",
 		"transaction_id", event.TransactionID,
-		"error", event.Status)
+		"failure_code", event.FailureCode)
+	s.statusUpdates.Publish(event.TransactionID, domain.TransactionStatusFailed)
+
+	if s.webhooks != nil {
+		s.webhooks.Notify(ctx, domain.EventTransactionFailed, event)
+	}
+
+	return nil
+}
+
+// HandleTransactionHeld marks a pending transaction as held for fraud review. The account service
+// later completes or fails it once reviewed.
+func (s *transactionService) HandleTransactionHeld(ctx context.Context, event domain.TransactionEvent) error {
+	s.logger.Info("handling transaction held",
+		"transaction_id", event.TransactionID)
+
+	transaction, err := s.repo.GetByID(ctx, event.TransactionID)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to get transaction for hold",
+			"error", err,
+			"transaction_id", event.TransactionID)
+		return fmt.Errorf("failed to get transaction: %w", err)
+	}
+
+	if transaction == nil {
+		return s.handleUnknownTransaction(event, "hold")
+	}
+
+	// Only a pending or processing transaction is held, in case the review already finished or it
+	// expired meanwhile
+	transaction.Status = domain.TransactionStatusHeld
+	updated, err := s.repo.UpdateIfStatus(ctx, transaction, domain.TransactionStatusPending, domain.TransactionStatusProcessing)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to update transaction status to held",
+			"error", err,
+			"transaction_id", event.TransactionID)
+		return fmt.Errorf("failed to update transaction: %w", err)
+	}
+	if !updated {
+		s.logger.Warn("transaction no longer pending or processing, not marking it as held",
+			"transaction_id", event.TransactionID)
+		return nil
+	}
+
+	s.logger.Info("transaction marked as held",
+		"transaction_id", event.TransactionID)
+	s.statusUpdates.Publish(event.TransactionID, domain.TransactionStatusHeld)
+
+	if s.webhooks != nil {
+		s.webhooks.Notify(ctx, domain.EventTransactionHeld, event)
+	}
+
+	return nil
+}
+
+// HandleTransactionProcessing marks a pending transaction as being processed by the account service.
+// Events are not ordered, so a transaction whose outcome was already recorded keeps it.
+func (s *transactionService) HandleTransactionProcessing(ctx context.Context, event domain.TransactionEvent) error {
+	transaction, err := s.repo.GetByID(ctx, event.TransactionID)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to get transaction for processing",
+			"error", err,
+			"transaction_id", event.TransactionID)
+		return fmt.Errorf("failed to get transaction: %w", err)
+	}
+
+	if transaction == nil {
+		return s.handleUnknownTransaction(event, "processing")
+	}
+
+	transaction.Status = domain.TransactionStatusProcessing
+	updated, err := s.repo.UpdateIfStatus(ctx, transaction, domain.TransactionStatusPending)
+	if err != nil {
+		s.logger.Log(ctx, errorLevel(err), "failed to update transaction status to processing",
+			"error", err,
+			"transaction_id", event.TransactionID)
+		return fmt.Errorf("failed to update transaction: %w", err)
+	}
+	if updated {
+		s.logger.Info("transaction marked as processing",
+			"transaction_id", event.TransactionID)
+		s.statusUpdates.Publish(event.TransactionID, domain.TransactionStatusProcessing)
+	}
 
 	return nil
 }
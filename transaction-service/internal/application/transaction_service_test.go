@@ -0,0 +1,357 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"internal-transfers/pkg/logtest"
+	"internal-transfers/transaction-service/internal/domain"
+	"internal-transfers/transaction-service/internal/infrastructure/messaging"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryRepository keeps transactions in memory, handing out copies like a database would
+type memoryRepository struct {
+	domain.TransactionRepository
+
+	mu           sync.Mutex
+	transactions map[domain.TransactionID]*domain.Transaction
+	nextID       domain.TransactionID
+}
+
+func newMemoryRepository(transactions ...domain.Transaction) *memoryRepository {
+	r := &memoryRepository{transactions: make(map[domain.TransactionID]*domain.Transaction)}
+	for _, transaction := range transactions {
+		r.transactions[transaction.ID] = &transaction
+		r.nextID = max(r.nextID, transaction.ID)
+	}
+	return r
+}
+
+func (r *memoryRepository) Create(_ context.Context, transaction *domain.Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	transaction.ID = r.nextID
+	stored := *transaction
+	r.transactions[stored.ID] = &stored
+	return nil
+}
+
+func (r *memoryRepository) GetByID(_ context.Context, id domain.TransactionID) (*domain.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	transaction, ok := r.transactions[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *transaction
+	return &copied, nil
+}
+
+func (r *memoryRepository) UpdateIfStatus(_ context.Context, transaction *domain.Transaction, expected ...domain.TransactionStatus) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.transactions[transaction.ID]
+	if !ok || !slices.Contains(expected, stored.Status) {
+		return false, nil
+	}
+	copied := *transaction
+	r.transactions[transaction.ID] = &copied
+	return true, nil
+}
+
+// CountPendingBySourceAccount counts the pending and processing transactions of the source
+func (r *memoryRepository) CountPendingBySourceAccount(_ context.Context, accountID domain.AccountID) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, transaction := range r.transactions {
+		if transaction.SourceAccountID == accountID && (transaction.Status == domain.TransactionStatusPending || transaction.Status == domain.TransactionStatusProcessing) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ListCreatedBefore lists the transactions by their CreatedAt, which must be in RFC 3339 format
+func (r *memoryRepository) ListCreatedBefore(_ context.Context, cutoff time.Time, limit int, statuses ...domain.TransactionStatus) ([]*domain.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var transactions []*domain.Transaction
+	for _, transaction := range r.transactions {
+		createdAt, err := time.Parse(time.RFC3339, transaction.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(statuses, transaction.Status) && createdAt.Before(cutoff) {
+			copied := *transaction
+			transactions = append(transactions, &copied)
+		}
+	}
+	slices.SortFunc(transactions, func(a, b *domain.Transaction) int {
+		return strings.Compare(a.CreatedAt, b.CreatedAt)
+	})
+	return transactions[:min(limit, len(transactions))], nil
+}
+
+// transaction returns the stored transaction, failing the test if there is none
+func (r *memoryRepository) transaction(t *testing.T, id domain.TransactionID) domain.Transaction {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	transaction, ok := r.transactions[id]
+	if !ok {
+		t.Fatalf("transaction %d does not exist", id)
+	}
+	return *transaction
+}
+
+// recordingBroker records the events published by the service
+type recordingBroker struct {
+	messaging.MessageBroker
+
+	mu        sync.Mutex
+	submitted []domain.TransactionEvent
+	failed    []domain.TransactionEvent
+}
+
+func (b *recordingBroker) IsConnected() bool { return true }
+
+func (b *recordingBroker) PublishTransactionSubmitted(_ context.Context, event domain.TransactionEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.submitted = append(b.submitted, event)
+	return nil
+}
+
+func (b *recordingBroker) PublishTransactionFailed(_ context.Context, event domain.TransactionEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failed = append(b.failed, event)
+	return nil
+}
+
+func TestOutcomeEventsOutOfOrder(t *testing.T) {
+	completed := domain.TransactionEvent{TransactionID: 1, Status: domain.EventStatusComplete}
+	failed := domain.TransactionEvent{TransactionID: 1, Status: domain.EventStatusFailed, FailureCode: domain.FailureInsufficientFunds}
+
+	tests := []struct {
+		name        string
+		events      []domain.TransactionEvent
+		wantStatus  domain.TransactionStatus
+		wantFailure domain.FailureCode
+	}{
+		{
+			name:       "completed then failed",
+			events:     []domain.TransactionEvent{completed, failed},
+			wantStatus: domain.TransactionStatusComplete,
+		},
+		{
+			name:        "failed then completed",
+			events:      []domain.TransactionEvent{failed, completed},
+			wantStatus:  domain.TransactionStatusFailed,
+			wantFailure: domain.FailureInsufficientFunds,
+		},
+		{
+			name:       "completed twice",
+			events:     []domain.TransactionEvent{completed, completed},
+			wantStatus: domain.TransactionStatusComplete,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository(domain.Transaction{ID: 1, Status: domain.TransactionStatusProcessing})
+			service := NewTransactionService(repo, nil, nil)
+
+			for _, event := range tt.events {
+				var err error
+				if event.Status == domain.EventStatusComplete {
+					err = service.HandleTransactionCompleted(context.Background(), event)
+				} else {
+					err = service.HandleTransactionFailed(context.Background(), event)
+				}
+				if err != nil {
+					t.Fatalf("handling %s event: %v", event.Status, err)
+				}
+			}
+
+			got := repo.transaction(t, 1)
+			if got.Status != tt.wantStatus || got.FailureCode != tt.wantFailure {
+				t.Errorf("transaction is %s (%q), want %s (%q)", got.Status, got.FailureCode, tt.wantStatus, tt.wantFailure)
+			}
+		})
+	}
+}
+
+func TestCompletedEventForUnknownTransaction(t *testing.T) {
+	records := logtest.NewHandler()
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(records))
+	defer slog.SetDefault(defaultLogger)
+
+	repo := newMemoryRepository(domain.Transaction{ID: 1, Status: domain.TransactionStatusProcessing})
+	service := NewTransactionService(repo, nil, nil)
+
+	// The event is acknowledged with a warning instead of crashing the consumer
+	event := domain.TransactionEvent{TransactionID: 2, Status: domain.EventStatusComplete}
+	if err := service.HandleTransactionCompleted(context.Background(), event); err != nil {
+		t.Fatalf("HandleTransactionCompleted() error = %v", err)
+	}
+	if record, ok := records.Find("transaction not found for completion"); !ok || record.Level != slog.LevelWarn {
+		t.Errorf("unknown transaction logged as %+v, want a warning", record)
+	}
+	if got := repo.transaction(t, 1); got.Status != domain.TransactionStatusProcessing {
+		t.Errorf("other transaction is %s, want it left %s", got.Status, domain.TransactionStatusProcessing)
+	}
+}
+
+func TestSubmitSplitTransactionOverflow(t *testing.T) {
+	repo := newMemoryRepository()
+	broker := &recordingBroker{}
+	service := NewTransactionService(repo, broker, nil)
+
+	// Each leg fits, but together they are one unit over the largest amount
+	_, err := service.SubmitSplitTransaction(context.Background(), SplitTransactionDTO{
+		SourceAccountID: 1,
+		Legs: []domain.TransferLeg{
+			{DestinationAccountID: 2, Amount: "92233720368547758.07"},
+			{DestinationAccountID: 3, Amount: "0.01"},
+		},
+	})
+	if !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("error = %v, want %v", err, ErrInvalidAmount)
+	}
+	if len(broker.submitted) != 0 || len(repo.transactions) != 0 {
+		t.Errorf("%d transactions recorded and %d submitted, want none", len(repo.transactions), len(broker.submitted))
+	}
+}
+
+func TestUnknownTransactionPolicy(t *testing.T) {
+	tests := []struct {
+		policy    UnknownTransactionPolicy
+		wantLevel slog.Level
+		wantErr   error
+	}{
+		{policy: UnknownTransactionIgnore, wantLevel: slog.LevelDebug},
+		{policy: UnknownTransactionLog, wantLevel: slog.LevelWarn},
+		{policy: UnknownTransactionDeadLetter, wantLevel: slog.LevelWarn, wantErr: domain.ErrUnknownTransaction},
+	}
+	handlers := []struct {
+		kind   string
+		handle func(TransactionService, context.Context, domain.TransactionEvent) error
+	}{
+		{kind: "completion", handle: TransactionService.HandleTransactionCompleted},
+		{kind: "failure", handle: TransactionService.HandleTransactionFailed},
+		{kind: "hold", handle: TransactionService.HandleTransactionHeld},
+		{kind: "processing", handle: TransactionService.HandleTransactionProcessing},
+	}
+
+	for _, tt := range tests {
+		for _, handler := range handlers {
+			t.Run(string(tt.policy)+" "+handler.kind, func(t *testing.T) {
+				records := logtest.NewHandler()
+				defaultLogger := slog.Default()
+				slog.SetDefault(slog.New(records))
+				defer slog.SetDefault(defaultLogger)
+
+				service := NewTransactionService(newMemoryRepository(), nil, nil, WithUnknownTransactionPolicy(tt.policy))
+				err := handler.handle(service, context.Background(), domain.TransactionEvent{TransactionID: 42})
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error = %v, want %v", err, tt.wantErr)
+				}
+
+				var found bool
+				for _, record := range records.Records() {
+					if strings.HasPrefix(record.Message, "transaction not found for "+handler.kind) {
+						found = true
+						if record.Level != tt.wantLevel {
+							t.Errorf("%q logged at %s, want %s", record.Message, record.Level, tt.wantLevel)
+						}
+					}
+				}
+				if !found {
+					t.Errorf("unknown transaction not logged")
+				}
+			})
+		}
+	}
+}
+
+func TestHandleTransactionFailedCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		status domain.TransactionStatus
+		event  domain.TransactionEvent
+	}{
+		{
+			name:   "insufficient funds",
+			status: domain.TransactionStatusProcessing,
+			event:  domain.TransactionEvent{TransactionID: 1, Status: domain.EventStatusFailed, FailureCode: domain.FailureInsufficientFunds, FailureReason: "balance 5.00 is below 10.00"},
+		},
+		{
+			name:   "unknown destination while pending",
+			status: domain.TransactionStatusPending,
+			event:  domain.TransactionEvent{TransactionID: 1, Status: domain.EventStatusFailed, FailureCode: domain.FailureDestinationAccountNotFound},
+		},
+		{
+			name:   "frozen source",
+			status: domain.TransactionStatusProcessing,
+			event:  domain.TransactionEvent{TransactionID: 1, Status: domain.EventStatusFailed, FailureCode: domain.FailureSourceAccountFrozen, FailureReason: "account 1 is frozen"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository(domain.Transaction{ID: 1, Status: tt.status})
+			service := NewTransactionService(repo, nil, nil)
+
+			if err := service.HandleTransactionFailed(context.Background(), tt.event); err != nil {
+				t.Fatalf("HandleTransactionFailed() error = %v", err)
+			}
+
+			// The status stays a plain enum, with the reason carried by the code alone
+			got := repo.transaction(t, 1)
+			if got.Status != domain.TransactionStatusFailed || got.FailureCode != tt.event.FailureCode {
+				t.Errorf("transaction is %s (%q), want %s (%q)", got.Status, got.FailureCode, domain.TransactionStatusFailed, tt.event.FailureCode)
+			}
+		})
+	}
+}
+
+func TestMaxPendingPerAccount(t *testing.T) {
+	repo := newMemoryRepository()
+	service := NewTransactionService(repo, &recordingBroker{}, nil, WithMaxPendingPerAccount(2))
+	submit := func(source domain.AccountID) (*SubmitResult, error) {
+		return service.SubmitTransaction(context.Background(), TransactionDTO{SourceAccountID: source, DestinationAccountID: 9, Amount: "10.00"})
+	}
+
+	first, err := submit(1)
+	if err != nil {
+		t.Fatalf("first transfer of account 1: %v", err)
+	}
+	if _, err := submit(1); err != nil {
+		t.Fatalf("second transfer of account 1: %v", err)
+	}
+	if _, err := submit(1); !errors.Is(err, ErrTooManyPendingTransfers) {
+		t.Errorf("third transfer of account 1 error = %v, want %v", err, ErrTooManyPendingTransfers)
+	}
+
+	// Other accounts are not affected by the pending transfers of account 1
+	if _, err := submit(2); err != nil {
+		t.Errorf("transfer of account 2: %v", err)
+	}
+
+	// Settling a transfer makes room for another
+	if err := service.HandleTransactionCompleted(context.Background(), domain.TransactionEvent{TransactionID: first.Transaction.ID, Status: domain.EventStatusComplete}); err != nil {
+		t.Fatalf("HandleTransactionCompleted() error = %v", err)
+	}
+	if _, err := submit(1); err != nil {
+		t.Errorf("transfer of account 1 after one completed: %v", err)
+	}
+}
@@ -1,18 +1,58 @@
 package domain
 
+// EventStatus represents the state carried by a transaction event
+type EventStatus string
+
+const (
+	EventStatusPending  EventStatus = "pending"
+	EventStatusComplete EventStatus = "complete"
+	EventStatusFailed   EventStatus = "failed"
+	EventStatusHeld     EventStatus = "held"
+	// EventStatusProcessing events report that the account service has started applying a transfer
+	EventStatusProcessing EventStatus = "processing"
+)
+
+// FailureCode is a stable, machine-readable reason for a failed transaction
+type FailureCode string
+
+const (
+	FailureSourceAccountNotFound      FailureCode = "source_account_not_found"
+	FailureDestinationAccountNotFound FailureCode = "destination_account_not_found"
+	FailureInvalidAmount              FailureCode = "invalid_amount"
+	FailureInsufficientFunds          FailureCode = "insufficient_funds"
+	FailureAccountUpdateFailed        FailureCode = "account_update_failed"
+	FailurePublishFailed              FailureCode = "publish_failed"
+	FailureFeeAccountNotFound         FailureCode = "fee_account_not_found"
+	FailureSourceAccountFrozen        FailureCode = "source_account_frozen"
+	FailureSourceAccountClosed        FailureCode = "source_account_closed"
+	FailureDestinationAccountFrozen   FailureCode = "destination_account_frozen"
+	FailureDestinationAccountClosed   FailureCode = "destination_account_closed"
+	FailureExpired                    FailureCode = "expired"
+	FailureRejectedInReview           FailureCode = "rejected_in_review"
+)
+
 // TransactionEvent represents a transaction-related event
 type TransactionEvent struct {
 	TransactionID        TransactionID `json:"transaction_id"`
 	SourceAccountID      AccountID     `json:"source_account_id"`
 	DestinationAccountID AccountID     `json:"destination_account_id"`
 	Amount               string        `json:"amount"`
-	Status               string        `json:"status"`
+	Fee                  string        `json:"fee,omitempty"`
+	Memo                 string        `json:"memo,omitempty"`
+	Status               EventStatus   `json:"status"`
+	FailureCode          FailureCode   `json:"failure_code,omitempty"`
+	FailureReason        string        `json:"failure_reason,omitempty"`
+	// Legs is set for split transfers; see Transaction.Legs
+	Legs []TransferLeg `json:"legs,omitempty"`
 }
 
 // Event types
 const (
-	EventTransactionSubmitted = "transaction.submitted"
-	EventTransactionCompleted = "transaction.completed"
-	EventTransactionFailed    = "transaction.failed"
-	EventTransactionRollback  = "transaction.rollback"
+	EventTransactionSubmitted  = "transaction.submitted"
+	EventTransactionCompleted  = "transaction.completed"
+	EventTransactionFailed     = "transaction.failed"
+	EventTransactionHeld       = "transaction.held"
+	EventTransactionProcessing = "transaction.processing"
+	EventTransactionRollback   = "transaction.rollback"
+	EventAccountCreated        = "account.created"
 )
@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFailedEventJSON(t *testing.T) {
+	event := TransactionEvent{TransactionID: 7, SourceAccountID: 1, DestinationAccountID: 2, Amount: "10.00", Status: EventStatusFailed, FailureCode: FailureInsufficientFunds, FailureReason: "insufficient funds"}
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	// Consumers branch on the code, so the status carries the state alone
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if fields["status"] != "failed" || fields["failure_code"] != "insufficient_funds" || fields["failure_reason"] != "insufficient funds" {
+		t.Errorf("event = %s, want status failed with failure code insufficient_funds", data)
+	}
+
+	var decoded TransactionEvent
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(decoded, event) {
+		t.Errorf("decoded event = %+v, want %+v", decoded, event)
+	}
+}
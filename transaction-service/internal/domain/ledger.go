@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// LedgerEntry is a balance movement recorded by the account service for a transaction
+type LedgerEntry struct {
+	ID            int64         `json:"id"`
+	AccountID     AccountID     `json:"account_id"`
+	TransactionID TransactionID `json:"transaction_id"`
+	Type          string        `json:"type"`
+	Amount        string        `json:"amount"`
+	BalanceAfter  string        `json:"balance_after"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
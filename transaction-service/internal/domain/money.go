@@ -0,0 +1,388 @@
+package domain
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DisplayScale is the number of decimal places amounts are presented with
+const DisplayScale = 2
+
+// MaxScale is the largest number of significant decimal places an amount may have, which is also
+// the largest balance scale
+const MaxScale = 8
+
+// ErrInvalidMoney is returned when a string is not a valid decimal amount
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+// ErrCurrencyMismatch is returned when an amount is written with another currency than expected
+var ErrCurrencyMismatch = errors.New("amount currency does not match the account currency")
+
+// ErrAmountScale is returned when an amount has more decimal places than allowed
+var ErrAmountScale = errors.New("amount has too many decimal places")
+
+// ErrAmountOverflow is returned when the result of an operation does not fit in an amount
+var ErrAmountOverflow = errors.New("amount overflow")
+
+// Money is an exact fixed-point decimal amount: units scaled by 10^scale,
+// e.g. 12.3456 is stored as 123456 units at scale 4. Arithmetic never rounds;
+// rounding only happens when explicitly changing to a smaller scale.
+type Money struct {
+	units int64
+	scale int32
+}
+
+// NewMoney creates an amount from its units at the given scale
+func NewMoney(units int64, scale int32) Money {
+	return Money{units: units, scale: scale}
+}
+
+// ParseMoney parses a decimal string such as "-10.50", keeping every fractional digit given
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	intPart, fracPart, hasPoint := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" || hasPoint && fracPart == "" {
+		return Money{}, ErrInvalidMoney
+	}
+
+	var units int64
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return Money{}, ErrInvalidMoney
+		}
+		if units > (1<<63-1-int64(c-'0'))/10 {
+			return Money{}, ErrInvalidMoney
+		}
+		units = units*10 + int64(c-'0')
+	}
+	if negative {
+		units = -units
+	}
+
+	return Money{units: units, scale: int32(len(fracPart))}, nil
+}
+
+// NormalizeAmount converts an amount as received from a client or event into its canonical
+// form, so that equal amounts are always written the same way:
+//   - surrounding whitespace, a leading "+" and leading zeros are dropped, so " +007.5 " becomes
+//     "7.50"; a missing integer part is written as 0 (".5" becomes "0.50") and zero is never negative
+//   - exactly DisplayScale decimal places are shown unless more are significant: "10", "10.5" and
+//     "10.500" all become "10.50", while "10.125" and "10.12500" become "10.125"
+//
+// Amounts with significant decimal places beyond MaxScale, or too large once written with
+// DisplayScale decimal places, are rejected, as are a point without decimals ("10.") and
+// whitespace within the amount ("1 000").
+func NormalizeAmount(s string) (string, error) {
+	m, err := ParseMoney(s)
+	if err != nil {
+		return "", err
+	}
+	for m.scale > DisplayScale && m.units%10 == 0 {
+		m = Money{units: m.units / 10, scale: m.scale - 1}
+	}
+	if m.scale > MaxScale {
+		return "", ErrInvalidMoney
+	}
+	if m, err = m.scaleUp(DisplayScale); err != nil {
+		return "", ErrInvalidMoney
+	}
+	return m.String(), nil
+}
+
+// AmountFormat is the way clients write the decimal separator of amounts
+type AmountFormat string
+
+const (
+	// AmountFormatPoint amounts use "." as decimal separator and no grouping, e.g. "1000.50".
+	// Commas are rejected.
+	AmountFormatPoint AmountFormat = "point"
+	// AmountFormatComma amounts use "," as decimal separator and may group thousands with ".",
+	// e.g. "1000,50" or "1.000,50". Since "." only groups thousands, "1.000" is a thousand and
+	// "1.5" is rejected.
+	AmountFormatComma AmountFormat = "comma"
+)
+
+// NormalizeLocalizedAmount works like NormalizeAmount for an amount written in the given format
+func NormalizeLocalizedAmount(s string, format AmountFormat) (string, error) {
+	if format == AmountFormatComma {
+		var err error
+		if s, err = delocalizeAmount(s); err != nil {
+			return "", err
+		}
+	}
+	return NormalizeAmount(s)
+}
+
+// currencyDecimals maps ISO 4217 codes to the number of decimal places of their minor unit, for
+// the currencies that do not have DisplayScale of them
+var currencyDecimals = map[string]int32{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+	"CLP": 0,
+	"ISK": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"OMR": 3,
+	"JOD": 3,
+	"TND": 3,
+}
+
+// CurrencyDecimals returns the number of decimal places amounts in the currency may have, e.g. 2
+// for USD and 0 for JPY
+func CurrencyDecimals(currency string) int32 {
+	if decimals, ok := currencyDecimals[strings.ToUpper(currency)]; ok {
+		return decimals
+	}
+	return DisplayScale
+}
+
+// currencySymbols maps ISO 4217 codes to the symbol StripCurrency accepts for them
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"INR": "₹",
+	"IDR": "Rp",
+}
+
+// StripCurrency removes a currency symbol or ISO 4217 code written before or after an amount, such
+// as "$10.50" or "10.50 USD", and returns the bare amount. The currency written must be the given
+// one, or ErrCurrencyMismatch is returned; amounts written without a currency are returned as is.
+func StripCurrency(s, currency string) (string, error) {
+	s = strings.TrimSpace(s)
+	start := strings.IndexFunc(s, isAmountRune)
+	if start < 0 {
+		return s, nil
+	}
+	end := strings.LastIndexFunc(s, isAmountRune) + 1
+
+	prefix, amount, suffix := strings.TrimSpace(s[:start]), s[start:end], strings.TrimSpace(s[end:])
+	marker := prefix + suffix
+	switch {
+	case prefix != "" && suffix != "":
+		return "", ErrInvalidMoney
+	case marker == "":
+		return amount, nil
+	}
+
+	if code := strings.ToUpper(marker); len(code) == 3 && strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == "" {
+		if code != strings.ToUpper(currency) {
+			return "", ErrCurrencyMismatch
+		}
+		return amount, nil
+	}
+	if marker == currencySymbols[strings.ToUpper(currency)] {
+		return amount, nil
+	}
+	for _, symbol := range currencySymbols {
+		if marker == symbol {
+			return "", ErrCurrencyMismatch
+		}
+	}
+	return "", ErrInvalidMoney
+}
+
+// isAmountRune reports whether r may appear in an amount written without its currency
+func isAmountRune(r rune) bool {
+	return r >= '0' && r <= '9' || strings.ContainsRune(".,+-", r)
+}
+
+// delocalizeAmount rewrites an amount in AmountFormatComma with a "." decimal separator and
+// without grouping, leaving the digits to be checked by ParseMoney
+func delocalizeAmount(s string) (string, error) {
+	intPart, fracPart, hasFrac := strings.Cut(strings.TrimSpace(s), ",")
+	if strings.ContainsAny(fracPart, ",.") {
+		return "", ErrInvalidMoney
+	}
+
+	if strings.Contains(intPart, ".") {
+		groups := strings.Split(intPart, ".")
+		if first := strings.TrimLeft(groups[0], "+-"); len(first) == 0 || len(first) > 3 {
+			return "", ErrInvalidMoney
+		}
+		for _, group := range groups[1:] {
+			if len(group) != 3 {
+				return "", ErrInvalidMoney
+			}
+		}
+		intPart = strings.Join(groups, "")
+	}
+
+	if hasFrac {
+		return intPart + "." + fracPart, nil
+	}
+	return intPart, nil
+}
+
+// Units returns the amount in units of 10^-scale
+func (m Money) Units() int64 {
+	return m.units
+}
+
+// Scale returns the number of decimal places of the amount
+func (m Money) Scale() int32 {
+	return m.scale
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of the amount
+func (m Money) Sign() int {
+	switch {
+	case m.units < 0:
+		return -1
+	case m.units > 0:
+		return 1
+	}
+	return 0
+}
+
+// Neg returns the negated amount
+func (m Money) Neg() Money {
+	return Money{units: -m.units, scale: m.scale}
+}
+
+// RoundTo returns the amount at the given scale. Increasing the scale is exact;
+// decreasing it rounds half away from zero.
+func (m Money) RoundTo(scale int32) Money {
+	switch {
+	case scale == m.scale:
+		return m
+	case scale > m.scale:
+		return Money{units: m.units * pow10(scale-m.scale), scale: scale}
+	}
+
+	divisor := pow10(m.scale - scale)
+	quotient, remainder := m.units/divisor, m.units%divisor
+	if remainder < 0 {
+		remainder = -remainder
+	}
+	if remainder*2 >= divisor {
+		if m.units < 0 {
+			quotient--
+		} else {
+			quotient++
+		}
+	}
+	return Money{units: quotient, scale: scale}
+}
+
+// RoundsAt reports whether RoundTo(scale) would change the value of the amount, i.e. whether it
+// has non-zero digits beyond scale decimal places
+func (m Money) RoundsAt(scale int32) bool {
+	if scale >= m.scale {
+		return false
+	}
+	if m.scale-scale > 18 {
+		return m.units != 0
+	}
+	return m.units%pow10(m.scale-scale) != 0
+}
+
+// Add returns m + other at the larger of the two scales
+func (m Money) Add(other Money) Money {
+	a, b := align(m, other)
+	return Money{units: a.units + b.units, scale: a.scale}
+}
+
+// CheckedAdd returns m + other at the larger of the two scales like Add, or ErrAmountOverflow
+// instead of a wrapped-around result when the sum does not fit
+func (m Money) CheckedAdd(other Money) (Money, error) {
+	a, err := m.scaleUp(other.scale)
+	if err != nil {
+		return Money{}, err
+	}
+	b, err := other.scaleUp(m.scale)
+	if err != nil {
+		return Money{}, err
+	}
+
+	sum := a.units + b.units
+	if (b.units > 0 && sum < a.units) || (b.units < 0 && sum > a.units) {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{units: sum, scale: a.scale}, nil
+}
+
+// scaleUp returns the amount at the given scale if it is larger than its own, or
+// ErrAmountOverflow if its units no longer fit there
+func (m Money) scaleUp(scale int32) (Money, error) {
+	if scale <= m.scale || m.units == 0 {
+		return Money{units: m.units, scale: max(scale, m.scale)}, nil
+	}
+	if scale-m.scale > 18 {
+		return Money{}, ErrAmountOverflow
+	}
+	factor := pow10(scale - m.scale)
+	if m.units > math.MaxInt64/factor || m.units < math.MinInt64/factor {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{units: m.units * factor, scale: scale}, nil
+}
+
+// Sub returns m - other at the larger of the two scales
+func (m Money) Sub(other Money) Money {
+	return m.Add(other.Neg())
+}
+
+// Cmp compares m and other, returning -1, 0 or +1
+func (m Money) Cmp(other Money) int {
+	a, b := align(m, other)
+	switch {
+	case a.units < b.units:
+		return -1
+	case a.units > b.units:
+		return 1
+	}
+	return 0
+}
+
+// String formats the amount with all of its decimal places, e.g. "12.3456". It never rounds; an
+// amount is only shortened by an explicit RoundTo or by Display.
+func (m Money) String() string {
+	units := m.units
+	sign := ""
+	if units < 0 {
+		sign = "-"
+	}
+
+	digits := strings.TrimPrefix(strconv.FormatInt(units, 10), "-")
+	if m.scale <= 0 {
+		return sign + digits
+	}
+	if pad := int(m.scale) + 1 - len(digits); pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+	point := len(digits) - int(m.scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// Display formats the amount rounded to DisplayScale decimal places, e.g. "12.35"
+func (m Money) Display() string {
+	return m.RoundTo(DisplayScale).String()
+}
+
+// align brings both amounts to the larger of their scales
+func align(a, b Money) (Money, Money) {
+	if a.scale < b.scale {
+		return a.RoundTo(b.scale), b
+	}
+	return a, b.RoundTo(a.scale)
+}
+
+// pow10 returns 10^n for a non-negative n
+func pow10(n int32) int64 {
+	result := int64(1)
+	for i := int32(0); i < n; i++ {
+		result *= 10
+	}
+	return result
+}
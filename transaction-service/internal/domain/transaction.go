@@ -1,6 +1,11 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
 
 // TransactionID represents a unique identifier for a transaction
 type TransactionID int64
@@ -16,21 +21,98 @@ const (
 	TransactionStatusComplete TransactionStatus = "complete"
 	TransactionStatusFailed   TransactionStatus = "failed"
 	TransactionStatusRollback TransactionStatus = "rollback"
+	// TransactionStatusHeld transactions await fraud review with their funds reserved
+	TransactionStatusHeld TransactionStatus = "held"
+	// TransactionStatusProcessing transactions have been picked up by the account service, which
+	// has not reported their outcome yet
+	TransactionStatusProcessing TransactionStatus = "processing"
 )
 
+// TerminalStatuses are the statuses no transaction ever leaves
+var TerminalStatuses = []TransactionStatus{
+	TransactionStatusComplete,
+	TransactionStatusFailed,
+	TransactionStatusRollback,
+}
+
+// Terminal reports whether s is one of TerminalStatuses
+func (s TransactionStatus) Terminal() bool {
+	return slices.Contains(TerminalStatuses, s)
+}
+
 // Transaction represents a money transfer between accounts
 type Transaction struct {
 	ID                   TransactionID     `json:"id"`
 	SourceAccountID      AccountID         `json:"source_account_id"`
 	DestinationAccountID AccountID         `json:"destination_account_id"`
 	Amount               string            `json:"amount"`
+	Fee                  string            `json:"fee,omitempty"`
+	Memo                 string            `json:"memo,omitempty"`
 	Status               TransactionStatus `json:"status"`
-	CreatedAt            string            `json:"created_at"`
-	UpdatedAt            string            `json:"updated_at"`
+	FailureCode          FailureCode       `json:"failure_code,omitempty"`
+	// Legs lists the destinations of a split transfer, which credits several accounts from a single
+	// debit of the source. DestinationAccountID is then the first leg's and Amount their total.
+	Legs      []TransferLeg `json:"legs,omitempty"`
+	CreatedAt string        `json:"created_at"`
+	UpdatedAt string        `json:"updated_at"`
+}
+
+// TransferLeg is the amount a split transfer credits to one destination account
+type TransferLeg struct {
+	DestinationAccountID AccountID `json:"destination_account_id"`
+	Amount               string    `json:"amount"`
 }
 
+// StatusChange records a status the transaction moved into and when
+type StatusChange struct {
+	Status      TransactionStatus `json:"status"`
+	FailureCode FailureCode       `json:"failure_code,omitempty"`
+	ChangedAt   time.Time         `json:"changed_at"`
+}
+
+// TransactionTotals aggregates the number and summed amount of a set of transactions
+type TransactionTotals struct {
+	Count  int    `json:"count"`
+	Amount string `json:"amount"`
+}
+
+// ErrOverloaded is returned by repositories when no database connection became free in time
+var ErrOverloaded = errors.New("service overloaded")
+
+// ErrUnknownTransaction is returned by event handlers for an event about a transaction that does
+// not exist, when such events are to be dead-lettered
+var ErrUnknownTransaction = errors.New("event references an unknown transaction")
+
 type TransactionRepository interface {
 	Create(ctx context.Context, transaction *Transaction) error
 	GetByID(ctx context.Context, id TransactionID) (*Transaction, error)
 	Update(ctx context.Context, transaction *Transaction) error
+	// GetStatusHistory retrieves the status changes of a transaction, archived or not
+	GetStatusHistory(ctx context.Context, id TransactionID) ([]StatusChange, error)
+	CountPendingBySourceAccount(ctx context.Context, accountID AccountID) (int, error)
+	// UpdateIfStatus updates the transaction only if its stored status is still one of expected,
+	// reporting whether the update was applied
+	UpdateIfStatus(ctx context.Context, transaction *Transaction, expected ...TransactionStatus) (bool, error)
+	// UpdateMemo sets the memo of a transaction, leaving everything else untouched, and reports
+	// whether the transaction exists
+	UpdateMemo(ctx context.Context, id TransactionID, memo string) (bool, error)
+	// ListCreatedBefore retrieves up to limit of the transactions in one of the statuses that were
+	// created before the cutoff, oldest first
+	ListCreatedBefore(ctx context.Context, cutoff time.Time, limit int, statuses ...TransactionStatus) ([]*Transaction, error)
+	// FindRecentDuplicate returns the latest transaction with the same accounts and amount created
+	// at or after since that has not failed, or nil if there is none. Split transfers never match.
+	FindRecentDuplicate(ctx context.Context, source, destination AccountID, amount string, since time.Time) (*Transaction, error)
+	// SumCompletedBetween totals the transactions completed in [from, to)
+	SumCompletedBetween(ctx context.Context, from, to time.Time) (TransactionTotals, error)
+	// ListCompletedBetween retrieves up to limit of the transactions completed in [from, to), oldest first
+	ListCompletedBetween(ctx context.Context, from, to time.Time, limit int) ([]*Transaction, error)
+	// ListUpdatedBefore retrieves up to limit of the transactions in one of the statuses that were last
+	// updated before the cutoff, oldest first, skipping the first offset of them
+	ListUpdatedBefore(ctx context.Context, cutoff time.Time, limit, offset int, statuses ...TransactionStatus) ([]*Transaction, error)
+	// ArchiveUpdatedBefore moves up to limit of the transactions in one of the statuses last updated
+	// before the cutoff, oldest first, into the archive together with their legs and status history,
+	// in a single database transaction. It returns how many were archived.
+	ArchiveUpdatedBefore(ctx context.Context, cutoff time.Time, limit int, statuses ...TransactionStatus) (int, error)
+	// GetArchived retrieves an archived transaction by its ID, or nil if it was not archived
+	GetArchived(ctx context.Context, id TransactionID) (*Transaction, error)
 }
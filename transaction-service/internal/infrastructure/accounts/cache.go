@@ -0,0 +1,49 @@
+package accounts
+
+import (
+	"internal-transfers/transaction-service/internal/clock"
+	"internal-transfers/transaction-service/internal/domain"
+	"sync"
+	"time"
+)
+
+// Cache remembers accounts known to exist, so transfers between them can be accepted without asking
+// the account service. Entries expire after a TTL; a missing entry only means the account is unknown.
+type Cache struct {
+	ttl   time.Duration
+	clock clock.Clock
+
+	mu      sync.Mutex
+	expires map[domain.AccountID]time.Time
+}
+
+// NewCache creates an empty cache whose entries expire ttl after they were added
+func NewCache(ttl time.Duration, clk clock.Clock) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		clock:   clk,
+		expires: make(map[domain.AccountID]time.Time),
+	}
+}
+
+// Add records that the account exists, restarting its TTL
+func (c *Cache) Add(id domain.AccountID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expires[id] = c.clock.Now().Add(c.ttl)
+}
+
+// Contains reports whether the account is known to exist. Expired entries are dropped.
+func (c *Cache) Contains(id domain.AccountID) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires, ok := c.expires[id]
+	if !ok {
+		return false
+	}
+	if !c.clock.Now().Before(expires) {
+		delete(c.expires, id)
+		return false
+	}
+	return true
+}
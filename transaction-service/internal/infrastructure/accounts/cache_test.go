@@ -0,0 +1,30 @@
+package accounts
+
+import (
+	"internal-transfers/transaction-service/internal/clock"
+	"testing"
+	"time"
+)
+
+func TestCacheExpires(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	cache := NewCache(time.Minute, clk)
+	cache.Add(1)
+
+	clk.Advance(59 * time.Second)
+	if !cache.Contains(1) {
+		t.Fatal("account 1 expired before its TTL")
+	}
+
+	// Adding the account again restarts its TTL
+	cache.Add(1)
+	clk.Advance(59 * time.Second)
+	if !cache.Contains(1) {
+		t.Fatal("account 1 expired before its restarted TTL")
+	}
+
+	clk.Advance(time.Second)
+	if cache.Contains(1) {
+		t.Error("account 1 is still cached after its TTL")
+	}
+}
@@ -0,0 +1,108 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"internal-transfers/transaction-service/internal/domain"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client defines the account service operations used by the transaction service
+type Client interface {
+	// GetLedgerEntries retrieves the ledger entries recorded for a transaction
+	GetLedgerEntries(ctx context.Context, transactionID domain.TransactionID) ([]domain.LedgerEntry, error)
+	// AccountExists reports whether the account exists
+	AccountExists(ctx context.Context, id domain.AccountID) (bool, error)
+}
+
+// ErrNoAdminURL is returned for the ledger entries when the admin listener of the account service is unknown
+var ErrNoAdminURL = errors.New("account service admin URL is not configured")
+
+// HTTPClient implements Client against the account service HTTP API
+type HTTPClient struct {
+	baseURL    string
+	adminURL   string
+	httpClient *http.Client
+}
+
+// NewHTTPClient creates a new account service client for the given base URL, e.g.
+// http://account-service:8080, and the path its API is mounted under, e.g. /api/v1. Ledger
+// entries are only served on the admin listener of the account service, read from adminURL, e.g.
+// http://account-service:8090; without it they are reported as ErrNoAdminURL.
+func NewHTTPClient(baseURL, basePath, adminURL string) *HTTPClient {
+	return &HTTPClient{
+		baseURL:    strings.TrimRight(baseURL, "/") + basePath,
+		adminURL:   strings.TrimRight(adminURL, "/"),
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// GetLedgerEntries retrieves the ledger entries recorded for a transaction from the admin listener
+func (c *HTTPClient) GetLedgerEntries(ctx context.Context, transactionID domain.TransactionID) ([]domain.LedgerEntry, error) {
+	if c.adminURL == "" {
+		return nil, ErrNoAdminURL
+	}
+	query := url.Values{"transaction_id": {strconv.FormatInt(int64(transactionID), 10)}}
+
+	var entries []domain.LedgerEntry
+	if err := c.get(ctx, c.adminURL+"/ledger?"+query.Encode(), &entries); err != nil {
+		return nil, fmt.Errorf("failed to get ledger entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// AccountExists reports whether the account exists, without fetching it
+func (c *HTTPClient) AccountExists(ctx context.Context, id domain.AccountID) (bool, error) {
+	path := "/accounts/" + strconv.FormatInt(int64(id), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.baseURL+path, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("account service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("account service returned status %d", resp.StatusCode)
+	}
+}
+
+// get performs a GET request against the account service and decodes the JSON response into out
+func (c *HTTPClient) get(ctx context.Context, rawURL string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("account service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("account service returned status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode account service response: %w", err)
+	}
+
+	return nil
+}
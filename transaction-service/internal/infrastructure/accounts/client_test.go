@@ -0,0 +1,63 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"internal-transfers/transaction-service/internal/domain"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetLedgerEntriesFromAdminListener(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("the API received %s %s, want the ledger read from the admin listener", r.Method, r.URL)
+		http.NotFound(w, r)
+	}))
+	defer api.Close()
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ledger" || r.URL.Query().Get("transaction_id") != "7" {
+			t.Errorf("the admin listener received %s %s, want GET /ledger?transaction_id=7", r.Method, r.URL)
+		}
+		json.NewEncoder(w).Encode([]domain.LedgerEntry{{ID: 1, AccountID: 1, TransactionID: 7, Type: "debit", Amount: "-10.00"}})
+	}))
+	defer admin.Close()
+
+	entries, err := NewHTTPClient(api.URL, "/api/v1", admin.URL+"/").GetLedgerEntries(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("GetLedgerEntries() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != 1 {
+		t.Errorf("GetLedgerEntries() = %+v, want entry 1", entries)
+	}
+}
+
+func TestGetLedgerEntriesWithoutAdminURL(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("the API received %s %s, want no request", r.Method, r.URL)
+	}))
+	defer api.Close()
+
+	if _, err := NewHTTPClient(api.URL, "/api/v1", "").GetLedgerEntries(context.Background(), 7); !errors.Is(err, ErrNoAdminURL) {
+		t.Errorf("GetLedgerEntries() error = %v, want %v", err, ErrNoAdminURL)
+	}
+}
+
+func TestAccountExistsUnderBasePath(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.URL.Path != "/gateway/accounts/api/v2/accounts/1" {
+			t.Errorf("the API received %s %s, want HEAD /gateway/accounts/api/v2/accounts/1", r.Method, r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer api.Close()
+
+	exists, err := NewHTTPClient(api.URL+"/", "/gateway/accounts/api/v2", "").AccountExists(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("AccountExists() error = %v", err)
+	}
+	if !exists {
+		t.Error("AccountExists() = false, want true")
+	}
+}
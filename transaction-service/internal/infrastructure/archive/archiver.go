@@ -0,0 +1,237 @@
+// Package archive copies the final events of transactions to object storage for analytics, as
+// newline-delimited JSON files batched by size and time.
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"internal-transfers/pkg/consumer"
+	"internal-transfers/transaction-service/internal/domain"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Defaults applied when the corresponding option is not used
+const (
+	DefaultFlushInterval = time.Minute
+	DefaultBatchBytes    = 8 << 20
+	DefaultBatchEvents   = 32
+)
+
+// errClosed refuses events archived after Close; they are requeued for the next consumer
+var errClosed = fmt.Errorf("%w: archiver closed", consumer.ErrUnavailable)
+
+// Sink stores archived batches, e.g. as objects of an S3-compatible bucket
+type Sink interface {
+	// Put stores data under name, replacing anything stored there before
+	Put(ctx context.Context, name string, data []byte) error
+}
+
+// line is an archived event: the event type next to the event's fields
+type line struct {
+	Event string `json:"event"`
+	domain.TransactionEvent
+}
+
+// Archiver collects events into batches and writes each batch to the sink as one file, once it
+// reaches the batch size or event count or has been open for the flush interval. Archive returns
+// only once the batch of its event is written, so an event is never acknowledged before it is
+// stored.
+type Archiver struct {
+	sink        Sink
+	prefix      string
+	interval    time.Duration
+	batchBytes  int
+	batchEvents int
+	now         func() time.Time
+	logger      *slog.Logger
+
+	// mu guards batch and closed; it is held while a batch is written, which holds up Archive
+	mu     sync.Mutex
+	batch  *batch
+	closed bool
+}
+
+// batch is the events collected for a single file. done is closed once the file is written or
+// failed to be, with err set accordingly.
+type batch struct {
+	data   bytes.Buffer
+	events int
+	done   chan struct{}
+	err    error
+}
+
+func newBatch() *batch {
+	return &batch{done: make(chan struct{})}
+}
+
+// Option configures an Archiver
+type Option func(*Archiver)
+
+// WithPrefix sets the prefix of the names batches are stored under, e.g. "transactions/"
+func WithPrefix(prefix string) Option {
+	return func(a *Archiver) {
+		a.prefix = prefix
+	}
+}
+
+// WithBatching sets the size at which a batch is written and how often a smaller one is
+func WithBatching(batchBytes int, interval time.Duration) Option {
+	return func(a *Archiver) {
+		if batchBytes > 0 {
+			a.batchBytes = batchBytes
+		}
+		if interval > 0 {
+			a.interval = interval
+		}
+	}
+}
+
+// WithBatchEvents sets how many events a batch holds at most. Archive waits for the batch of its
+// event to be written, so a batch only fills up if as many events are archived in parallel;
+// smaller batches wait for the flush interval.
+func WithBatchEvents(events int) Option {
+	return func(a *Archiver) {
+		if events > 0 {
+			a.batchEvents = events
+		}
+	}
+}
+
+// NewArchiver creates an archiver writing batches to sink
+func NewArchiver(sink Sink, opts ...Option) *Archiver {
+	a := &Archiver{
+		sink:        sink,
+		interval:    DefaultFlushInterval,
+		batchBytes:  DefaultBatchBytes,
+		batchEvents: DefaultBatchEvents,
+		now:         time.Now,
+		logger:      slog.Default(),
+		batch:       newBatch(),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Archive adds a completed or failed event to the current batch and waits until the batch is
+// written, returning the error of that write. The event is then redelivered rather than lost, e.g.
+// while the sink is unavailable or when the service stops before the batch is written.
+func (a *Archiver) Archive(ctx context.Context, event domain.TransactionEvent) error {
+	var eventType string
+	switch event.Status {
+	case domain.EventStatusComplete:
+		eventType = domain.EventTransactionCompleted
+	case domain.EventStatusFailed:
+		eventType = domain.EventTransactionFailed
+	default:
+		return nil
+	}
+
+	data, err := json.Marshal(line{Event: eventType, TransactionEvent: event})
+	if err != nil {
+		return fmt.Errorf("failed to marshal archived event: %w", err)
+	}
+
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return errClosed
+	}
+	// A full batch is written without this event; its own events learn how that went
+	if a.batch.data.Len() > 0 && a.batch.data.Len()+len(data)+1 > a.batchBytes {
+		a.flushLocked(ctx)
+	}
+	b := a.batch
+	b.data.Write(data)
+	b.data.WriteByte('\n')
+	b.events++
+	if b.events >= a.batchEvents {
+		a.flushLocked(ctx)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return b.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run writes the current batch every flush interval until ctx is done
+func (a *Archiver) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.Flush(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				a.logger.Error("failed to archive transaction events", "error", err)
+			}
+		}
+	}
+}
+
+// Flush writes the current batch, if any. The events of a batch that cannot be written are
+// refused and redelivered.
+func (a *Archiver) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.flushLocked(ctx)
+}
+
+// Close writes the last batch and refuses the events archived afterwards. It should be called before
+// the consumer stops, so that the events of the last batch can still be acknowledged.
+func (a *Archiver) Close(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.closed = true
+	return a.flushLocked(ctx)
+}
+
+// flushLocked writes the current batch, reports the outcome to the events waiting for it and
+// starts a new batch; the caller holds mu
+func (a *Archiver) flushLocked(ctx context.Context) error {
+	b := a.batch
+	if b.events == 0 {
+		return nil
+	}
+	a.batch = newBatch()
+	defer close(b.done)
+
+	name, err := a.batchName()
+	if err != nil {
+		b.err = err
+		return err
+	}
+	if err := a.sink.Put(ctx, name, b.data.Bytes()); err != nil {
+		b.err = fmt.Errorf("failed to store archive batch %s: %w", name, err)
+		return b.err
+	}
+
+	a.logger.Info("archived transaction events", "name", name, "events", b.events, "bytes", b.data.Len())
+	return nil
+}
+
+// batchName returns a new name for a batch, partitioned by date, such as
+// "transactions/date=2024-05-01/20240501T101500Z-1f2e3d4c5b6a7988.ndjson". The random suffix keeps
+// the batches of several instances apart.
+func (a *Archiver) batchName() (string, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate archive batch name: %w", err)
+	}
+	now := a.now().UTC()
+	return fmt.Sprintf("%sdate=%s/%s-%s.ndjson", a.prefix, now.Format(time.DateOnly), now.Format("20060102T150405Z"), hex.EncodeToString(suffix)), nil
+}
@@ -0,0 +1,151 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"internal-transfers/pkg/consumer"
+	"internal-transfers/transaction-service/internal/domain"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySink keeps the stored batches, or fails while err is set
+type memorySink struct {
+	mu      sync.Mutex
+	err     error
+	batches []string
+}
+
+func (s *memorySink) Put(_ context.Context, _ string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.batches = append(s.batches, string(data))
+	return nil
+}
+
+func (s *memorySink) stored() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.batches...)
+}
+
+// archiveAsync archives the event in the background, as a consumer worker would, and returns the
+// channel its outcome is sent to
+func archiveAsync(a *Archiver, id domain.TransactionID) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Archive(context.Background(), domain.TransactionEvent{TransactionID: id, Status: domain.EventStatusComplete})
+	}()
+	return done
+}
+
+// waitBuffered waits until the current batch holds events events
+func waitBuffered(t *testing.T, a *Archiver, events int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		a.mu.Lock()
+		buffered := a.batch.events
+		a.mu.Unlock()
+		if buffered == events {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("batch holds %d events, want %d", buffered, events)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// outcome waits for the outcome of an archived event
+func outcome(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Archive did not return")
+		return nil
+	}
+}
+
+func TestArchiveReturnsOnceBatchIsWritten(t *testing.T) {
+	sink := &memorySink{}
+	a := NewArchiver(sink, WithBatchEvents(2), WithBatching(DefaultBatchBytes, time.Hour))
+
+	first := archiveAsync(a, 1)
+	waitBuffered(t, a, 1)
+	select {
+	case err := <-first:
+		t.Fatalf("Archive returned %v before its batch was written", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The second event fills the batch, which is written for both
+	second := archiveAsync(a, 2)
+	for _, done := range []<-chan error{first, second} {
+		if err := outcome(t, done); err != nil {
+			t.Errorf("Archive() error = %v", err)
+		}
+	}
+	if batches := sink.stored(); len(batches) != 1 || strings.Count(batches[0], "\n") != 2 {
+		t.Errorf("stored batches %q, want one with both events", batches)
+	}
+}
+
+func TestArchiveRefusesEventsOfFailedBatch(t *testing.T) {
+	sink := &memorySink{err: errors.New("store unavailable")}
+	a := NewArchiver(sink, WithBatchEvents(10), WithBatching(DefaultBatchBytes, time.Hour))
+
+	done := archiveAsync(a, 1)
+	waitBuffered(t, a, 1)
+	if err := a.Flush(context.Background()); err == nil {
+		t.Fatal("Flush() succeeded with the store unavailable")
+	}
+	if err := outcome(t, done); err == nil {
+		t.Fatal("Archive() succeeded although its batch was not written")
+	}
+
+	// The refused event is redelivered into a new batch rather than kept in the failed one
+	sink.mu.Lock()
+	sink.err = nil
+	sink.mu.Unlock()
+	done = archiveAsync(a, 1)
+	waitBuffered(t, a, 1)
+	if err := a.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if err := outcome(t, done); err != nil {
+		t.Errorf("Archive() error = %v", err)
+	}
+	if batches := sink.stored(); len(batches) != 1 || strings.Count(batches[0], "\n") != 1 {
+		t.Errorf("stored batches %q, want one with the redelivered event only", batches)
+	}
+}
+
+func TestCloseWritesLastBatch(t *testing.T) {
+	sink := &memorySink{}
+	a := NewArchiver(sink, WithBatchEvents(10), WithBatching(DefaultBatchBytes, time.Hour))
+
+	done := archiveAsync(a, 1)
+	waitBuffered(t, a, 1)
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := outcome(t, done); err != nil {
+		t.Errorf("Archive() error = %v", err)
+	}
+	if len(sink.stored()) != 1 {
+		t.Errorf("stored %d batches, want the last one", len(sink.stored()))
+	}
+
+	// Events arriving after Close are requeued for the next consumer
+	if err := outcome(t, archiveAsync(a, 2)); !errors.Is(err, consumer.ErrUnavailable) {
+		t.Errorf("Archive() after Close error = %v, want %v", err, consumer.ErrUnavailable)
+	}
+}
@@ -0,0 +1,149 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultS3Timeout bounds a single upload when WithS3HTTPClient is not used
+const DefaultS3Timeout = 30 * time.Second
+
+// S3Sink stores batches as objects of a bucket of an S3-compatible object store, such as Amazon S3
+// or MinIO. Requests use path-style URLs and are signed with AWS Signature Version 4.
+type S3Sink struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	http      *http.Client
+	now       func() time.Time
+}
+
+// S3Option configures an S3Sink
+type S3Option func(*S3Sink)
+
+// WithS3HTTPClient sets the HTTP client used to reach the object store
+func WithS3HTTPClient(client *http.Client) S3Option {
+	return func(s *S3Sink) {
+		if client != nil {
+			s.http = client
+		}
+	}
+}
+
+// NewS3Sink creates a sink storing objects in bucket at endpoint, e.g. "https://s3.eu-west-1.amazonaws.com"
+// or "http://minio:9000", authenticating with the access and secret keys
+func NewS3Sink(endpoint, region, bucket, accessKey, secretKey string, opts ...S3Option) *S3Sink {
+	s := &S3Sink{
+		endpoint:  strings.TrimRight(endpoint, "/"),
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		http:      &http.Client{Timeout: DefaultS3Timeout},
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Put uploads data as the object name
+func (s *S3Sink) Put(ctx context.Context, name string, data []byte) error {
+	path := "/" + escapeS3Path(s.bucket) + "/" + escapeS3Path(name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	s.sign(req, path, "", data)
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach object store: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("object store returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sign adds the AWS Signature Version 4 headers to req. query is the canonical query string, with
+// the parameters sorted and encoded, which is empty for uploads.
+func (s *S3Sink) sign(req *http.Request, path, query string, payload []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		query,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	signature := hex.EncodeToString(hmacSHA256(signingKey(s.secretKey, date, s.region, "s3"), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// escapeS3Path percent-encodes everything but unreserved characters and slashes, as signing expects
+func escapeS3Path(path string) string {
+	var b strings.Builder
+	for _, c := range []byte(path) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// signingKey derives the key requests to service in region are signed with on date
+func signingKey(secretKey, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
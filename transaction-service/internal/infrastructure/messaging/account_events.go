@@ -0,0 +1,33 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"internal-transfers/transaction-service/internal/domain"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// accountCreatedEvent holds the fields of an account.created event used by the transaction service
+type accountCreatedEvent struct {
+	ID domain.AccountID `json:"id"`
+}
+
+// SubscribeToAccountCreated subscribes to account created events. Each subscription gets its own
+// temporary queue, so every instance of the service sees every new account; events published
+// while an instance is down are not delivered to it.
+func (b *RabbitMQBroker) SubscribeToAccountCreated(ctx context.Context, handler func(accountID domain.AccountID) error) error {
+	return b.SubscribeTemporary(ctx, domain.EventAccountCreated, accountCreatedHandler(handler))
+}
+
+// accountCreatedHandler decodes account created deliveries and passes the account ID to handler
+func accountCreatedHandler(handler func(accountID domain.AccountID) error) func(ctx context.Context, msg amqp.Delivery) error {
+	return func(ctx context.Context, msg amqp.Delivery) error {
+		var event accountCreatedEvent
+		if err := json.Unmarshal(msg.Body, &event); err != nil {
+			return fmt.Errorf("failed to unmarshal account created event: %w", err)
+		}
+		return handler(event.ID)
+	}
+}
@@ -0,0 +1,35 @@
+package messaging
+
+import (
+	"context"
+	"internal-transfers/transaction-service/internal/clock"
+	"internal-transfers/transaction-service/internal/domain"
+	"internal-transfers/transaction-service/internal/infrastructure/accounts"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestAccountCreatedUpdatesCache(t *testing.T) {
+	cache := accounts.NewCache(time.Minute, clock.NewFake(time.Now()))
+	handle := accountCreatedHandler(func(accountID domain.AccountID) error {
+		cache.Add(accountID)
+		return nil
+	})
+
+	// The body is the account as published by the account service
+	if err := handle(context.Background(), amqp.Delivery{Body: []byte(`{"id": 5, "balance": "100.00", "status": "active"}`)}); err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+	if !cache.Contains(5) {
+		t.Error("account 5 is not cached after its account.created event")
+	}
+	if cache.Contains(6) {
+		t.Error("account 6 is cached without an event")
+	}
+
+	if err := handle(context.Background(), amqp.Delivery{Body: []byte(`{"id":`)}); err == nil {
+		t.Error("handler accepted a malformed event")
+	}
+}
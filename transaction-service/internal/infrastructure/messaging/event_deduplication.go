@@ -0,0 +1,51 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"internal-transfers/pkg/consumer"
+	"internal-transfers/transaction-service/internal/domain"
+	"log/slog"
+)
+
+// DeduplicateEvents wraps handler so that each status of a transaction is handled at most once.
+// Redeliveries of the same message are already skipped by their message ID; this also skips an
+// event that was published again as a separate message, e.g. a completed event republished after
+// a publish timeout. Events of a different status are passed on, for the handler to accept or
+// reject as a transition. An event is only recorded once handled, so one whose handling fails or
+// is cut short by a crash is handled again; the handler's conditional status updates keep that
+// from applying a status twice.
+func DeduplicateEvents(store consumer.ProcessedMessageStore, handler func(ctx context.Context, event domain.TransactionEvent) error) func(ctx context.Context, event domain.TransactionEvent) error {
+	return func(ctx context.Context, event domain.TransactionEvent) error {
+		key := eventKey(event)
+		processed, err := store.IsProcessed(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to check whether event %s was processed: %w", key, err)
+		}
+		if processed {
+			slog.Info("skipping duplicate transaction event",
+				"transaction_id", event.TransactionID,
+				"status", event.Status)
+			return nil
+		}
+
+		if err := handler(ctx, event); err != nil {
+			return err
+		}
+
+		// Record the event even when ctx is done, or its republished copy would be handled again
+		if _, err := store.MarkProcessed(context.WithoutCancel(ctx), key); err != nil {
+			slog.Error("failed to record transaction event as processed",
+				"error", err,
+				"transaction_id", event.TransactionID,
+				"status", event.Status)
+		}
+		return nil
+	}
+}
+
+// eventKey identifies the status change of a transaction an event reports. It is recorded next to
+// message IDs, which it cannot collide with.
+func eventKey(event domain.TransactionEvent) string {
+	return fmt.Sprintf("transaction-event:%d:%s", event.TransactionID, event.Status)
+}
@@ -0,0 +1,66 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"internal-transfers/transaction-service/internal/domain"
+	"testing"
+)
+
+// memoryStore keeps processed keys in memory
+type memoryStore map[string]bool
+
+func (s memoryStore) IsProcessed(_ context.Context, key string) (bool, error) {
+	return s[key], nil
+}
+
+func (s memoryStore) MarkProcessed(_ context.Context, key string) (bool, error) {
+	first := !s[key]
+	s[key] = true
+	return first, nil
+}
+
+func TestDeduplicateEvents(t *testing.T) {
+	store := memoryStore{}
+	var handled []domain.EventStatus
+	fail := true
+	handler := DeduplicateEvents(store, func(ctx context.Context, event domain.TransactionEvent) error {
+		handled = append(handled, event.Status)
+		if store[eventKey(event)] {
+			t.Errorf("event %s recorded before its handler returned", event.Status)
+		}
+		if fail {
+			fail = false
+			return errors.New("handler failed")
+		}
+		return nil
+	})
+
+	completed := domain.TransactionEvent{TransactionID: 1, Status: domain.EventStatusComplete}
+	steps := []struct {
+		name    string
+		event   domain.TransactionEvent
+		wantErr bool
+	}{
+		{name: "failed attempt", event: completed, wantErr: true},
+		{name: "retry of the failed attempt", event: completed},
+		{name: "republished copy", event: completed},
+		{name: "event of another status", event: domain.TransactionEvent{TransactionID: 1, Status: domain.EventStatusFailed}},
+	}
+	for _, step := range steps {
+		if err := handler(context.Background(), step.event); (err != nil) != step.wantErr {
+			t.Fatalf("%s: error = %v, want error %v", step.name, err, step.wantErr)
+		}
+	}
+
+	want := []domain.EventStatus{domain.EventStatusComplete, domain.EventStatusComplete, domain.EventStatusFailed}
+	if len(handled) != len(want) {
+		t.Fatalf("handled %v, want %v", handled, want)
+	}
+	for i := range want {
+		if handled[i] != want[i] {
+			t.Errorf("handled %v, want %v", handled, want)
+			break
+		}
+	}
+}
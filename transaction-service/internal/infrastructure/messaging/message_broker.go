@@ -2,10 +2,12 @@ package messaging
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"internal-transfers/pkg/config"
+	"internal-transfers/pkg/consumer"
+	"internal-transfers/pkg/rabbitmq"
 	"internal-transfers/transaction-service/internal/domain"
-	"os"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -19,241 +21,72 @@ type MessageBroker interface {
 	// PublishTransactionFailed publishes a transaction failed event
 	PublishTransactionFailed(ctx context.Context, event domain.TransactionEvent) error
 	// SubscribeToTransactionEvents subscribes to transaction events
-	SubscribeToTransactionEvents(ctx context.Context, handler func(event domain.TransactionEvent) error) error
+	SubscribeToTransactionEvents(ctx context.Context, handler func(ctx context.Context, event domain.TransactionEvent) error) error
+	// SubscribeToFinalTransactionEvents subscribes to transaction completed and failed events on a queue of its own
+	SubscribeToFinalTransactionEvents(ctx context.Context, queue string, handler func(ctx context.Context, event domain.TransactionEvent) error) error
+	// SubscribeToAccountCreated subscribes to account created events
+	SubscribeToAccountCreated(ctx context.Context, handler func(accountID domain.AccountID) error) error
+	// IsConnected reports whether the broker connection is open, i.e. whether publishing can succeed
+	IsConnected() bool
 	// Close closes the message broker connection
 	Close() error
 }
 
 // RabbitMQBroker implements MessageBroker using RabbitMQ
 type RabbitMQBroker struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
+	*rabbitmq.Broker[domain.TransactionEvent]
 }
 
-// NewRabbitMQBroker creates a new RabbitMQ broker instance
-func NewRabbitMQBroker() (*RabbitMQBroker, error) {
-	// Get RabbitMQ connection details from environment
-	user := os.Getenv("RABBITMQ_USER")
-	password := os.Getenv("RABBITMQ_PASSWORD")
-	host := os.Getenv("RABBITMQ_HOST")
-	port := os.Getenv("RABBITMQ_PORT")
-
-	// Create connection URL
-	url := fmt.Sprintf("amqp://%s:%s@%s:%s/", user, password, host, port)
-
-	// Connect to RabbitMQ
-	conn, err := amqp.Dial(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
-	}
-
-	// Create channel
-	ch, err := conn.Channel()
+// NewRabbitMQBroker creates a new RabbitMQ broker instance for the given connection config.
+// Each call opens its own connection, so several brokers can be used side by side.
+func NewRabbitMQBroker(cfg config.RabbitMQConfig, opts ...rabbitmq.Option) (*RabbitMQBroker, error) {
+	broker, err := rabbitmq.NewBroker[domain.TransactionEvent](cfg, "transactions", eventMapper{}, opts...)
 	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to open channel: %w", err)
+		return nil, err
 	}
-
-	// Declare exchange
-	err = ch.ExchangeDeclare(
-		"transactions", // name
-		"topic",        // type
-		true,           // durable
-		false,          // auto-deleted
-		false,          // internal
-		false,          // no-wait
-		nil,            // arguments
-	)
-	if err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, fmt.Errorf("failed to declare exchange: %w", err)
-	}
-
-	return &RabbitMQBroker{
-		conn:    conn,
-		channel: ch,
-	}, nil
+	return &RabbitMQBroker{Broker: broker}, nil
 }
 
 // PublishTransactionSubmitted publishes a transaction submitted event
 func (b *RabbitMQBroker) PublishTransactionSubmitted(ctx context.Context, event domain.TransactionEvent) error {
-	body, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
-	}
-
-	return b.channel.PublishWithContext(ctx,
-		"transactions",                   // exchange
-		domain.EventTransactionSubmitted, // routing key
-		false,                            // mandatory
-		false,                            // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+	return b.Publish(ctx, domain.EventTransactionSubmitted, event)
 }
 
 // PublishTransactionCompleted publishes a transaction completed event
 func (b *RabbitMQBroker) PublishTransactionCompleted(ctx context.Context, event domain.TransactionEvent) error {
-	body, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
-	}
-
-	return b.channel.PublishWithContext(ctx,
-		"transactions",                   // exchange
-		domain.EventTransactionCompleted, // routing key
-		false,                            // mandatory
-		false,                            // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+	return b.Publish(ctx, domain.EventTransactionCompleted, event)
 }
 
 // PublishTransactionFailed publishes a transaction failed event
 func (b *RabbitMQBroker) PublishTransactionFailed(ctx context.Context, event domain.TransactionEvent) error {
-	body, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
-	}
-
-	return b.channel.PublishWithContext(ctx,
-		"transactions",                // exchange
-		domain.EventTransactionFailed, // routing key
-		false,                         // mandatory
-		false,                         // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+	return b.Publish(ctx, domain.EventTransactionFailed, event)
 }
 
-// SubscribeToTransactionEvents subscribes to transaction events
-func (b *RabbitMQBroker) SubscribeToTransactionEvents(ctx context.Context, handler func(event domain.TransactionEvent) error) error {
-	// Declare dead letter queue
-	dlq, err := b.channel.QueueDeclare(
-		"transaction_events_dlq", // name
-		true,                     // durable
-		false,                    // delete when unused
-		false,                    // exclusive
-		false,                    // no-wait
-		nil,                      // arguments
-	)
-	if err != nil {
-		return fmt.Errorf("failed to declare DLQ: %w", err)
-	}
-
-	// Declare main queue with DLQ binding
-	q, err := b.channel.QueueDeclare(
-		"transaction_events", // name
-		true,                 // durable
-		false,                // delete when unused
-		false,                // exclusive
-		false,                // no-wait
-		amqp.Table{
-			"x-dead-letter-exchange":    "", // Use default exchange
-			"x-dead-letter-routing-key": dlq.Name,
-			"x-message-ttl":             30000, // 30 seconds
-			"x-max-retries":             3,     // Maximum 3 retries
+// SubscribeToTransactionEvents subscribes to transaction processing, completed, failed and held events.
+// Events the handler reports as referencing an unknown transaction are dead-lettered without retries.
+func (b *RabbitMQBroker) SubscribeToTransactionEvents(ctx context.Context, handler func(ctx context.Context, event domain.TransactionEvent) error) error {
+	queue := rabbitmq.Queue{
+		Name:     "transaction_events",
+		Bindings: []string{domain.EventTransactionProcessing, domain.EventTransactionCompleted, domain.EventTransactionFailed, domain.EventTransactionHeld},
+		Args: amqp.Table{
+			"x-max-retries": 3, // Kept so the queue matches its existing declaration
 		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to declare queue: %w", err)
-	}
-
-	// Bind queue to exchange for completed and failed events only
-	err = b.channel.QueueBind(
-		q.Name,                  // queue name
-		"transaction.completed", // routing key
-		"transactions",          // exchange
-		false,                   // no-wait
-		nil,                     // arguments
-	)
-	if err != nil {
-		return fmt.Errorf("failed to bind queue: %w", err)
 	}
-
-	// Bind queue for failed events
-	err = b.channel.QueueBind(
-		q.Name,               // queue name
-		"transaction.failed", // routing key
-		"transactions",       // exchange
-		false,                // no-wait
-		nil,                  // arguments
-	)
-	if err != nil {
-		return fmt.Errorf("failed to bind queue: %w", err)
-	}
-
-	// Consume messages
-	msgs, err := b.channel.Consume(
-		q.Name, // queue
-		"",     // consumer
-		false,  // auto-ack
-		false,  // exclusive
-		false,  // no-local
-		false,  // no-wait
-		nil,    // args
-	)
-	if err != nil {
-		return fmt.Errorf("failed to register consumer: %w", err)
-	}
-
-	// Process messages
-	go func() {
-		for msg := range msgs {
-			var event domain.TransactionEvent
-			if err := json.Unmarshal(msg.Body, &event); err != nil {
-				fmt.Printf("Failed to unmarshal event: %v\n", err)
-				msg.Nack(false, false) // Reject without requeue
-				continue
-			}
-
-			// Initialize headers if nil
-			if msg.Headers == nil {
-				msg.Headers = make(amqp.Table)
-			}
-
-			// Get retry count from headers
-			retryCount := 0
-			if retries, ok := msg.Headers["x-retry-count"].(int32); ok {
-				retryCount = int(retries)
-			}
-
-			if err := handler(event); err != nil {
-				fmt.Printf("Failed to handle event: %v\n", err)
-
-				// Check if we should retry
-				if retryCount < 3 {
-					// Increment retry count and requeue
-					msg.Headers["x-retry-count"] = retryCount + 1
-					msg.Nack(false, true)
-				} else {
-					// Max retries reached, move to DLQ
-					msg.Nack(false, false)
-				}
-				continue
-			}
-
-			msg.Ack(false)
+	return b.Subscribe(ctx, queue, func(ctx context.Context, event domain.TransactionEvent) error {
+		err := handler(ctx, event)
+		if errors.Is(err, domain.ErrUnknownTransaction) {
+			return fmt.Errorf("%w: %w", consumer.ErrMalformed, err)
 		}
-	}()
-
-	return nil
+		return err
+	})
 }
 
-// Close closes the RabbitMQ connection
-func (b *RabbitMQBroker) Close() error {
-	if err := b.channel.Close(); err != nil {
-		return fmt.Errorf("failed to close channel: %w", err)
-	}
-	if err := b.conn.Close(); err != nil {
-		return fmt.Errorf("failed to close connection: %w", err)
-	}
-	return nil
+// SubscribeToFinalTransactionEvents subscribes to transaction completed and failed events on the named
+// queue, which receives a copy of every such event independently of the transaction_events queue.
+// Message IDs are shared between the queues, so the broker must not skip processed messages.
+func (b *RabbitMQBroker) SubscribeToFinalTransactionEvents(ctx context.Context, queue string, handler func(ctx context.Context, event domain.TransactionEvent) error) error {
+	return b.Subscribe(ctx, rabbitmq.Queue{
+		Name:     queue,
+		Bindings: []string{domain.EventTransactionCompleted, domain.EventTransactionFailed},
+	}, handler)
 }
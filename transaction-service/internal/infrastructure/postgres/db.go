@@ -3,21 +3,24 @@ package postgres
 import (
 	"context"
 	"fmt"
-	"os"
+
+	"internal-transfers/pkg/config"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func NewDBPool(ctx context.Context) (*pgxpool.Pool, error) {
-	connString := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_SSL_MODE"),
-	)
-	pool, err := pgxpool.New(ctx, connString)
+// NewDBPool creates a connection pool for the configured database, capped at cfg.MaxConns
+// connections when set
+func NewDBPool(ctx context.Context, cfg config.DBConfig) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.ConnString())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
+	}
+	if cfg.MaxConns > 0 {
+		poolConfig.MaxConns = int32(cfg.MaxConns)
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create connection pool: %w", err)
 	}
@@ -2,40 +2,61 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"internal-transfers/pkg/database"
 	"internal-transfers/transaction-service/internal/domain"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type transactionRepository struct {
-	pool *pgxpool.Pool
+	pool *database.BoundedPool
+	database.QueryTimeout
 }
 
 // NewTransactionRepository creates a new instance of TransactionRepository
-func NewTransactionRepository(pool *pgxpool.Pool) domain.TransactionRepository {
-	return &transactionRepository{pool: pool}
+func NewTransactionRepository(pool *pgxpool.Pool, opts ...database.Option) domain.TransactionRepository {
+	o := database.NewOptions(opts)
+	return &transactionRepository{
+		pool:         database.NewBoundedPool(pool, o.AcquireTimeout, domain.ErrOverloaded),
+		QueryTimeout: database.QueryTimeout{Timeout: o.QueryTimeout},
+	}
 }
 
 // Create creates a new transaction record
 func (r *transactionRepository) Create(ctx context.Context, transaction *domain.Transaction) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
 	query := `
 		INSERT INTO transactions (
 			source_account_id,
 			destination_account_id,
 			amount,
+			fee,
+			memo,
 			status
-		) VALUES ($1, $2, $3, $4)
+		) VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6)
 		RETURNING id
 	`
 
-	err := r.pool.QueryRow(
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(
 		ctx,
 		query,
 		transaction.SourceAccountID,
 		transaction.DestinationAccountID,
 		transaction.Amount,
+		transaction.Fee,
+		transaction.Memo,
 		transaction.Status,
 	).Scan(&transaction.ID)
 
@@ -43,13 +64,28 @@ func (r *transactionRepository) Create(ctx context.Context, transaction *domain.
 		return fmt.Errorf("failed to create transaction: %w", err)
 	}
 
+	if err := insertStatusChange(ctx, tx, transaction); err != nil {
+		return err
+	}
+
+	if err := insertLegs(ctx, tx, transaction); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return nil
 }
 
 // GetByID retrieves a transaction by its ID
 func (r *transactionRepository) GetByID(ctx context.Context, id domain.TransactionID) (*domain.Transaction, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT id, source_account_id, destination_account_id, amount, status
+		SELECT id, source_account_id, destination_account_id, amount, COALESCE(fee, ''), COALESCE(memo, ''), status, COALESCE(failure_code, '')
 		FROM transactions
 		WHERE id = $1
 	`
@@ -60,7 +96,10 @@ func (r *transactionRepository) GetByID(ctx context.Context, id domain.Transacti
 		&transaction.SourceAccountID,
 		&transaction.DestinationAccountID,
 		&transaction.Amount,
+		&transaction.Fee,
+		&transaction.Memo,
 		&transaction.Status,
+		&transaction.FailureCode,
 	)
 
 	if err != nil {
@@ -70,21 +109,576 @@ func (r *transactionRepository) GetByID(ctx context.Context, id domain.Transacti
 		return nil, fmt.Errorf("failed to get transaction: %w", err)
 	}
 
+	if transaction.Legs, err = r.getLegs(ctx, id); err != nil {
+		return nil, err
+	}
+
 	return &transaction, nil
 }
 
+// getLegs retrieves the legs of a split transfer in the order they were submitted; other
+// transactions have none
+func (r *transactionRepository) getLegs(ctx context.Context, id domain.TransactionID) ([]domain.TransferLeg, error) {
+	query := `
+		SELECT destination_account_id, amount
+		FROM transaction_legs
+		WHERE transaction_id = $1
+		ORDER BY position
+	`
+
+	rows, err := r.pool.Query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction legs: %w", err)
+	}
+	defer rows.Close()
+
+	var legs []domain.TransferLeg
+	for rows.Next() {
+		var leg domain.TransferLeg
+		if err := rows.Scan(&leg.DestinationAccountID, &leg.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction leg: %w", err)
+		}
+		legs = append(legs, leg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate transaction legs: %w", err)
+	}
+
+	return legs, nil
+}
+
 // Update updates a transaction's information
 func (r *transactionRepository) Update(ctx context.Context, transaction *domain.Transaction) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE transactions
-		SET status = $1
-		WHERE id = $2
+		SET status = $1, failure_code = NULLIF($2, '')
+		WHERE id = $3
 	`
 
-	_, err := r.pool.Exec(ctx, query, transaction.Status, transaction.ID)
+	tx, err := r.pool.Begin(ctx)
 	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, query, transaction.Status, transaction.FailureCode, transaction.ID); err != nil {
 		return fmt.Errorf("failed to update transaction: %w", err)
 	}
 
+	if err := insertStatusChange(ctx, tx, transaction); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction update: %w", err)
+	}
+
+	return nil
+}
+
+// GetStatusHistory retrieves the status changes of a transaction in the order they happened,
+// reading them from the archive if the transaction was archived
+func (r *transactionRepository) GetStatusHistory(ctx context.Context, id domain.TransactionID) ([]domain.StatusChange, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT status, COALESCE(failure_code, ''), changed_at
+		FROM transaction_status_history
+		WHERE transaction_id = $1
+		ORDER BY id
+	`
+
+	rows, err := r.pool.Query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []domain.StatusChange{}
+	for rows.Next() {
+		var change domain.StatusChange
+		if err := rows.Scan(&change.Status, &change.FailureCode, &change.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan status change: %w", err)
+		}
+		history = append(history, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read status history: %w", err)
+	}
+
+	if len(history) > 0 {
+		return history, nil
+	}
+	return r.getArchivedStatusHistory(ctx, id)
+}
+
+// getArchivedStatusHistory retrieves the status changes recorded with an archived transaction
+func (r *transactionRepository) getArchivedStatusHistory(ctx context.Context, id domain.TransactionID) ([]domain.StatusChange, error) {
+	query := `
+		SELECT status_history
+		FROM transactions_archive
+		WHERE id = $1
+	`
+
+	var raw []byte
+	if err := r.pool.QueryRow(ctx, query, id).Scan(&raw); err != nil {
+		if err == pgx.ErrNoRows {
+			return []domain.StatusChange{}, nil
+		}
+		return nil, fmt.Errorf("failed to get archived status history: %w", err)
+	}
+
+	history := []domain.StatusChange{}
+	if err := json.Unmarshal(raw, &history); err != nil {
+		return nil, fmt.Errorf("failed to decode archived status history: %w", err)
+	}
+
+	return history, nil
+}
+
+// CountPendingBySourceAccount counts the pending transactions debiting the given account, including
+// those the account service is processing
+func (r *transactionRepository) CountPendingBySourceAccount(ctx context.Context, accountID domain.AccountID) (int, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT COUNT(*)
+		FROM transactions
+		WHERE source_account_id = $1 AND status IN ($2, $3)
+	`
+
+	var count int
+	if err := r.pool.QueryRow(ctx, query, accountID, domain.TransactionStatusPending, domain.TransactionStatusProcessing).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count pending transactions: %w", err)
+	}
+
+	return count, nil
+}
+
+// UpdateIfStatus updates a transaction's status only if it still has one of the expected statuses
+func (r *transactionRepository) UpdateIfStatus(ctx context.Context, transaction *domain.Transaction, expected ...domain.TransactionStatus) (bool, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE transactions
+		SET status = $1, failure_code = NULLIF($2, '')
+		WHERE id = $3 AND status = ANY($4)
+	`
+
+	statuses := make([]string, len(expected))
+	for i, status := range expected {
+		statuses[i] = string(status)
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, query, transaction.Status, transaction.FailureCode, transaction.ID, statuses)
+	if err != nil {
+		return false, fmt.Errorf("failed to update transaction: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if err := insertStatusChange(ctx, tx, transaction); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction update: %w", err)
+	}
+
+	return true, nil
+}
+
+// UpdateMemo sets a transaction's memo; the amount, accounts, status and updated_at are never changed here
+func (r *transactionRepository) UpdateMemo(ctx context.Context, id domain.TransactionID, memo string) (bool, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE transactions
+		SET memo = NULLIF($1, '')
+		WHERE id = $2
+	`
+
+	tag, err := r.pool.Exec(ctx, query, memo, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to update transaction memo: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// ListCreatedBefore retrieves up to limit of the transactions in one of the statuses created before the cutoff, oldest first
+func (r *transactionRepository) ListCreatedBefore(ctx context.Context, cutoff time.Time, limit int, statuses ...domain.TransactionStatus) ([]*domain.Transaction, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, source_account_id, destination_account_id, amount, COALESCE(fee, ''), COALESCE(memo, ''), status, COALESCE(failure_code, '')
+		FROM transactions
+		WHERE status = ANY($1) AND created_at < $2
+		ORDER BY created_at
+		LIMIT $3
+	`
+
+	values := make([]string, len(statuses))
+	for i, status := range statuses {
+		values[i] = string(status)
+	}
+
+	rows, err := r.pool.Query(ctx, query, values, cutoff, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []*domain.Transaction
+	for rows.Next() {
+		var transaction domain.Transaction
+		if err := rows.Scan(
+			&transaction.ID,
+			&transaction.SourceAccountID,
+			&transaction.DestinationAccountID,
+			&transaction.Amount,
+			&transaction.Fee,
+			&transaction.Memo,
+			&transaction.Status,
+			&transaction.FailureCode,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		transactions = append(transactions, &transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// FindRecentDuplicate retrieves the latest transaction between the same accounts for the same amount
+// created at or after since, ignoring failed and rolled back ones
+func (r *transactionRepository) FindRecentDuplicate(ctx context.Context, source, destination domain.AccountID, amount string, since time.Time) (*domain.Transaction, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, source_account_id, destination_account_id, amount, COALESCE(fee, ''), COALESCE(memo, ''), status, COALESCE(failure_code, '')
+		FROM transactions
+		WHERE source_account_id = $1 AND destination_account_id = $2 AND amount = $3
+			AND created_at >= $4 AND status IN ($5, $6, $7)
+			AND NOT EXISTS (SELECT 1 FROM transaction_legs WHERE transaction_id = transactions.id)
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	var transaction domain.Transaction
+	err := r.pool.QueryRow(ctx, query, source, destination, amount, since,
+		domain.TransactionStatusPending, domain.TransactionStatusProcessing, domain.TransactionStatusComplete,
+	).Scan(
+		&transaction.ID,
+		&transaction.SourceAccountID,
+		&transaction.DestinationAccountID,
+		&transaction.Amount,
+		&transaction.Fee,
+		&transaction.Memo,
+		&transaction.Status,
+		&transaction.FailureCode,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find duplicate transaction: %w", err)
+	}
+
+	return &transaction, nil
+}
+
+// SumCompletedBetween counts and sums the transactions completed in [from, to). updated_at only
+// moves when the status changes, and a completed transaction keeps its status, so it is the
+// completion time.
+func (r *transactionRepository) SumCompletedBetween(ctx context.Context, from, to time.Time) (domain.TransactionTotals, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT COUNT(*), COALESCE(SUM(amount::numeric), 0)::text
+		FROM transactions
+		WHERE status = $1 AND updated_at >= $2 AND updated_at < $3
+	`
+
+	var totals domain.TransactionTotals
+	if err := r.pool.QueryRow(ctx, query, domain.TransactionStatusComplete, from, to).Scan(&totals.Count, &totals.Amount); err != nil {
+		return domain.TransactionTotals{}, fmt.Errorf("failed to sum completed transactions: %w", err)
+	}
+
+	return totals, nil
+}
+
+// ListCompletedBetween retrieves up to limit of the transactions completed in [from, to), oldest first
+func (r *transactionRepository) ListCompletedBetween(ctx context.Context, from, to time.Time, limit int) ([]*domain.Transaction, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, source_account_id, destination_account_id, amount, COALESCE(fee, ''), COALESCE(memo, ''), status, COALESCE(failure_code, '')
+		FROM transactions
+		WHERE status = $1 AND updated_at >= $2 AND updated_at < $3
+		ORDER BY updated_at, id
+		LIMIT $4
+	`
+
+	rows, err := r.pool.Query(ctx, query, domain.TransactionStatusComplete, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list completed transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []*domain.Transaction
+	for rows.Next() {
+		var transaction domain.Transaction
+		if err := rows.Scan(
+			&transaction.ID,
+			&transaction.SourceAccountID,
+			&transaction.DestinationAccountID,
+			&transaction.Amount,
+			&transaction.Fee,
+			&transaction.Memo,
+			&transaction.Status,
+			&transaction.FailureCode,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		transactions = append(transactions, &transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read completed transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// ListUpdatedBefore retrieves up to limit of the transactions in one of the statuses last updated
+// before the cutoff, oldest first
+func (r *transactionRepository) ListUpdatedBefore(ctx context.Context, cutoff time.Time, limit, offset int, statuses ...domain.TransactionStatus) ([]*domain.Transaction, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, source_account_id, destination_account_id, amount, COALESCE(fee, ''), COALESCE(memo, ''), status, COALESCE(failure_code, '')
+		FROM transactions
+		WHERE status = ANY($1) AND updated_at < $2
+		ORDER BY updated_at, id
+		LIMIT $3 OFFSET $4
+	`
+
+	values := make([]string, len(statuses))
+	for i, status := range statuses {
+		values[i] = string(status)
+	}
+
+	rows, err := r.pool.Query(ctx, query, values, cutoff, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions: %w", err)
+	}
+	defer rows.Close()
+
+	transactions := []*domain.Transaction{}
+	for rows.Next() {
+		var transaction domain.Transaction
+		if err := rows.Scan(
+			&transaction.ID,
+			&transaction.SourceAccountID,
+			&transaction.DestinationAccountID,
+			&transaction.Amount,
+			&transaction.Fee,
+			&transaction.Memo,
+			&transaction.Status,
+			&transaction.FailureCode,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		transactions = append(transactions, &transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// ArchiveUpdatedBefore moves a batch of transactions last updated before the cutoff into the archive.
+// Rows locked by a concurrent update are skipped and left for a later batch.
+func (r *transactionRepository) ArchiveUpdatedBefore(ctx context.Context, cutoff time.Time, limit int, statuses ...domain.TransactionStatus) (int, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	selectQuery := `
+		SELECT id
+		FROM transactions
+		WHERE status = ANY($1) AND updated_at < $2
+		ORDER BY updated_at, id
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	`
+
+	archiveQuery := `
+		INSERT INTO transactions_archive (
+			id, source_account_id, destination_account_id, amount, fee, memo, status, failure_code,
+			created_at, updated_at, legs, status_history
+		)
+		SELECT
+			t.id, t.source_account_id, t.destination_account_id, t.amount, t.fee, t.memo, t.status, t.failure_code,
+			t.created_at, t.updated_at,
+			COALESCE((
+				SELECT jsonb_agg(jsonb_build_object(
+					'destination_account_id', l.destination_account_id,
+					'amount', l.amount
+				) ORDER BY l.position)
+				FROM transaction_legs l
+				WHERE l.transaction_id = t.id
+			), '[]'),
+			COALESCE((
+				SELECT jsonb_agg(jsonb_build_object(
+					'status', h.status,
+					'failure_code', COALESCE(h.failure_code, ''),
+					'changed_at', h.changed_at
+				) ORDER BY h.id)
+				FROM transaction_status_history h
+				WHERE h.transaction_id = t.id
+			), '[]')
+		FROM transactions t
+		WHERE t.id = ANY($1)
+	`
+
+	// Rows referencing the transaction go first
+	deleteQueries := []string{
+		`DELETE FROM transaction_legs WHERE transaction_id = ANY($1)`,
+		`DELETE FROM transaction_status_history WHERE transaction_id = ANY($1)`,
+		`DELETE FROM transactions WHERE id = ANY($1)`,
+	}
+
+	values := make([]string, len(statuses))
+	for i, status := range statuses {
+		values[i] = string(status)
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, selectQuery, values, cutoff, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to select transactions to archive: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return 0, fmt.Errorf("failed to read transactions to archive: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	if _, err := tx.Exec(ctx, archiveQuery, ids); err != nil {
+		return 0, fmt.Errorf("failed to archive transactions: %w", err)
+	}
+	for _, query := range deleteQueries {
+		if _, err := tx.Exec(ctx, query, ids); err != nil {
+			return 0, fmt.Errorf("failed to delete archived transactions: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit archive: %w", err)
+	}
+
+	return len(ids), nil
+}
+
+// GetArchived retrieves an archived transaction by its ID, including the legs of split transfers
+func (r *transactionRepository) GetArchived(ctx context.Context, id domain.TransactionID) (*domain.Transaction, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, source_account_id, destination_account_id, amount, COALESCE(fee, ''), COALESCE(memo, ''), status, COALESCE(failure_code, ''), legs
+		FROM transactions_archive
+		WHERE id = $1
+	`
+
+	var (
+		transaction domain.Transaction
+		legs        []byte
+	)
+	err := r.pool.QueryRow(ctx, query, id).Scan(
+		&transaction.ID,
+		&transaction.SourceAccountID,
+		&transaction.DestinationAccountID,
+		&transaction.Amount,
+		&transaction.Fee,
+		&transaction.Memo,
+		&transaction.Status,
+		&transaction.FailureCode,
+		&legs,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get archived transaction: %w", err)
+	}
+
+	if err := json.Unmarshal(legs, &transaction.Legs); err != nil {
+		return nil, fmt.Errorf("failed to decode archived transaction legs: %w", err)
+	}
+	if len(transaction.Legs) == 0 {
+		transaction.Legs = nil
+	}
+
+	return &transaction, nil
+}
+
+// insertLegs records the legs of a split transfer
+func insertLegs(ctx context.Context, tx pgx.Tx, transaction *domain.Transaction) error {
+	query := `
+		INSERT INTO transaction_legs (transaction_id, position, destination_account_id, amount)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	for i, leg := range transaction.Legs {
+		if _, err := tx.Exec(ctx, query, transaction.ID, i, leg.DestinationAccountID, leg.Amount); err != nil {
+			return fmt.Errorf("failed to record transaction leg: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// insertStatusChange records the transaction's current status in its history
+func insertStatusChange(ctx context.Context, tx pgx.Tx, transaction *domain.Transaction) error {
+	query := `
+		INSERT INTO transaction_status_history (transaction_id, status, failure_code)
+		VALUES ($1, $2, NULLIF($3, ''))
+	`
+
+	if _, err := tx.Exec(ctx, query, transaction.ID, transaction.Status, transaction.FailureCode); err != nil {
+		return fmt.Errorf("failed to record status change: %w", err)
+	}
+
 	return nil
 }
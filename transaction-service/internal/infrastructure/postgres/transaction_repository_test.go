@@ -0,0 +1,239 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"internal-transfers/pkg/database"
+	"internal-transfers/transaction-service/internal/domain"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testPool connects to the database named by TEST_DATABASE_URL, which must have been set up by
+// init-db.sh, and skips the test when it is not set
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	if err := CheckSchema(ctx, pool); err != nil {
+		t.Fatalf("test database is not set up: %v", err)
+	}
+	return pool
+}
+
+// updatedAt reads the updated_at column of a transaction
+func updatedAt(t *testing.T, pool *pgxpool.Pool, id domain.TransactionID) time.Time {
+	t.Helper()
+	var at time.Time
+	if err := pool.QueryRow(context.Background(), "SELECT updated_at FROM transactions WHERE id = $1", id).Scan(&at); err != nil {
+		t.Fatalf("failed to read updated_at: %v", err)
+	}
+	return at
+}
+
+func TestUpdateMemoKeepsCompletionTime(t *testing.T) {
+	pool := testPool(t)
+	repo := NewTransactionRepository(pool)
+	ctx := context.Background()
+
+	transaction := &domain.Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: "10.00", Status: domain.TransactionStatusPending}
+	if err := repo.Create(ctx, transaction); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	transaction.Status = domain.TransactionStatusComplete
+	if updated, err := repo.UpdateIfStatus(ctx, transaction, domain.TransactionStatusPending); err != nil || !updated {
+		t.Fatalf("UpdateIfStatus() = %v, %v, want true", updated, err)
+	}
+	completedAt := updatedAt(t, pool, transaction.ID)
+
+	time.Sleep(10 * time.Millisecond)
+	if found, err := repo.UpdateMemo(ctx, transaction.ID, "Invoice 2024-017"); err != nil || !found {
+		t.Fatalf("UpdateMemo() = %v, %v, want true", found, err)
+	}
+
+	if got := updatedAt(t, pool, transaction.ID); !got.Equal(completedAt) {
+		t.Errorf("updated_at moved from %v to %v when the memo changed", completedAt, got)
+	}
+	got, err := repo.GetByID(ctx, transaction.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if got.Memo != "Invoice 2024-017" {
+		t.Errorf("memo = %q, want it updated", got.Memo)
+	}
+}
+
+func TestSaturatedPool(t *testing.T) {
+	config := testPool(t).Config()
+	config.MaxConns = 1
+	ctx := context.Background()
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+	defer pool.Close()
+	repo := NewTransactionRepository(pool, database.WithAcquireTimeout(50*time.Millisecond))
+
+	// With the only connection taken, queries give up after the acquire timeout instead of waiting
+	held, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	start := time.Now()
+	_, err = repo.GetByID(ctx, 1)
+	if !errors.Is(err, domain.ErrOverloaded) {
+		t.Errorf("GetByID() on a saturated pool error = %v, want %v", err, domain.ErrOverloaded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetByID() on a saturated pool took %v, want it to give up after the acquire timeout", elapsed)
+	}
+
+	held.Release()
+	if _, err := repo.GetByID(ctx, 1); err != nil {
+		t.Errorf("GetByID() once the connection is free error = %v", err)
+	}
+}
+
+func TestListUpdatedBefore(t *testing.T) {
+	pool := testPool(t)
+	repo := NewTransactionRepository(pool)
+	ctx := context.Background()
+
+	now := time.Now()
+	seeds := []struct {
+		status    domain.TransactionStatus
+		updatedAt time.Time
+	}{
+		{status: domain.TransactionStatusComplete, updatedAt: now.AddDate(0, 0, -40)},
+		{status: domain.TransactionStatusFailed, updatedAt: now.AddDate(0, 0, -31)},
+		{status: domain.TransactionStatusComplete, updatedAt: now.AddDate(0, 0, -29)},
+		{status: domain.TransactionStatusPending, updatedAt: now.AddDate(0, 0, -50)},
+	}
+	ids := make([]domain.TransactionID, len(seeds))
+	for i, seed := range seeds {
+		transaction := &domain.Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: "10.00", Status: seed.status}
+		if err := repo.Create(ctx, transaction); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		ids[i] = transaction.ID
+		if _, err := pool.Exec(ctx, "UPDATE transactions SET updated_at = $2 WHERE id = $1", transaction.ID, seed.updatedAt); err != nil {
+			t.Fatalf("failed to set updated_at: %v", err)
+		}
+	}
+	// Backdated rows would otherwise be listed by every later run
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), "DELETE FROM transactions WHERE id = ANY($1)", ids)
+	})
+
+	listed, err := repo.ListUpdatedBefore(ctx, now.AddDate(0, 0, -30), 100, 0, domain.TransactionStatusComplete, domain.TransactionStatusFailed)
+	if err != nil {
+		t.Fatalf("ListUpdatedBefore() error = %v", err)
+	}
+	var got []domain.TransactionID
+	for _, transaction := range listed {
+		if slices.Contains(ids, transaction.ID) {
+			got = append(got, transaction.ID)
+		}
+	}
+	if want := []domain.TransactionID{ids[0], ids[1]}; !slices.Equal(got, want) {
+		t.Errorf("ListUpdatedBefore() listed %v, want the old terminal transactions %v", got, want)
+	}
+}
+
+func TestArchiveUpdatedBefore(t *testing.T) {
+	pool := testPool(t)
+	repo := NewTransactionRepository(pool)
+	ctx := context.Background()
+
+	// A completed split transfer and a pending transfer, both last updated long before any other test ran
+	split := &domain.Transaction{
+		SourceAccountID:      1,
+		DestinationAccountID: 2,
+		Amount:               "35.00",
+		Memo:                 "rent",
+		Status:               domain.TransactionStatusPending,
+		Legs:                 []domain.TransferLeg{{DestinationAccountID: 2, Amount: "25.00"}, {DestinationAccountID: 3, Amount: "10.00"}},
+	}
+	pending := &domain.Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: "10.00", Status: domain.TransactionStatusPending}
+	for _, transaction := range []*domain.Transaction{split, pending} {
+		if err := repo.Create(ctx, transaction); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+	split.Status = domain.TransactionStatusComplete
+	if updated, err := repo.UpdateIfStatus(ctx, split, domain.TransactionStatusPending); err != nil || !updated {
+		t.Fatalf("UpdateIfStatus() = %v, %v, want true", updated, err)
+	}
+	history, err := repo.GetStatusHistory(ctx, split.ID)
+	if err != nil {
+		t.Fatalf("GetStatusHistory() error = %v", err)
+	}
+	longAgo := time.Date(1971, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := pool.Exec(ctx, "UPDATE transactions SET updated_at = $2 WHERE id = ANY($1)", []domain.TransactionID{split.ID, pending.ID}, longAgo); err != nil {
+		t.Fatalf("failed to set updated_at: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), "DELETE FROM transactions_archive WHERE id = $1", split.ID)
+		pool.Exec(context.Background(), "DELETE FROM transaction_status_history WHERE transaction_id = $1", pending.ID)
+		pool.Exec(context.Background(), "DELETE FROM transactions WHERE id = $1", pending.ID)
+	})
+
+	archived, err := repo.ArchiveUpdatedBefore(ctx, longAgo.Add(time.Hour), 100, domain.TransactionStatusComplete, domain.TransactionStatusFailed, domain.TransactionStatusRollback)
+	if err != nil {
+		t.Fatalf("ArchiveUpdatedBefore() error = %v", err)
+	}
+	if archived != 1 {
+		t.Errorf("ArchiveUpdatedBefore() archived %d transactions, want 1", archived)
+	}
+
+	// The completed transfer left the hot table, legs and history included
+	if got, err := repo.GetByID(ctx, split.ID); err != nil || got != nil {
+		t.Errorf("GetByID() = %+v, %v, want the archived transaction gone", got, err)
+	}
+	var legs int
+	if err := pool.QueryRow(ctx, "SELECT COUNT(*) FROM transaction_legs WHERE transaction_id = $1", split.ID).Scan(&legs); err != nil || legs != 0 {
+		t.Errorf("%d legs left in transaction_legs (%v), want none", legs, err)
+	}
+
+	// and is recovered whole from the archive
+	got, err := repo.GetArchived(ctx, split.ID)
+	if err != nil || got == nil {
+		t.Fatalf("GetArchived() = %+v, %v, want the transaction", got, err)
+	}
+	if got.Status != domain.TransactionStatusComplete || got.Amount != "35.00" || got.Memo != "rent" || !slices.Equal(got.Legs, split.Legs) {
+		t.Errorf("GetArchived() = %+v, want %+v", got, split)
+	}
+	archivedHistory, err := repo.GetStatusHistory(ctx, split.ID)
+	if err != nil {
+		t.Fatalf("GetStatusHistory() error = %v", err)
+	}
+	if len(archivedHistory) != len(history) {
+		t.Fatalf("archived status history = %+v, want %+v", archivedHistory, history)
+	}
+	for i := range history {
+		if archivedHistory[i].Status != history[i].Status || !archivedHistory[i].ChangedAt.Equal(history[i].ChangedAt) {
+			t.Errorf("archived status change %d = %+v, want %+v", i, archivedHistory[i], history[i])
+		}
+	}
+
+	// The pending transfer is still in flight, so it stays however old it is
+	if got, err := repo.GetByID(ctx, pending.ID); err != nil || got == nil {
+		t.Errorf("GetByID() = %+v, %v, want the pending transaction kept", got, err)
+	}
+	if got, err := repo.GetArchived(ctx, pending.ID); err != nil || got != nil {
+		t.Errorf("GetArchived() = %+v, %v, want the pending transaction not archived", got, err)
+	}
+}
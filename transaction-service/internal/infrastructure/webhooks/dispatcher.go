@@ -0,0 +1,190 @@
+// Package webhooks notifies external subscribers over HTTP when transactions reach a final status
+// or are held for review.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"internal-transfers/transaction-service/internal/domain"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+)
+
+// Defaults applied when the corresponding option is not used
+const (
+	DefaultTimeout     = 5 * time.Second
+	DefaultMaxAttempts = 3
+	DefaultBackoff     = time.Second
+)
+
+// Events a subscription can select
+var supportedEvents = []string{domain.EventTransactionCompleted, domain.EventTransactionFailed, domain.EventTransactionHeld}
+
+// Notifier delivers transaction events to the subscribers interested in them
+type Notifier interface {
+	// Notify delivers the event in the background, so callers are not held up by slow subscribers
+	Notify(ctx context.Context, eventType string, event domain.TransactionEvent)
+}
+
+// Subscription is an endpoint notified of the listed events. Without events it receives all of them.
+type Subscription struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+}
+
+// Wants reports whether the subscription selected the event type
+func (s Subscription) Wants(eventType string) bool {
+	return len(s.Events) == 0 || slices.Contains(s.Events, eventType)
+}
+
+// LoadSubscriptions reads a JSON array of subscriptions such as
+// [{"url": "https://example.com/hooks", "events": ["transaction.completed"]}]
+func LoadSubscriptions(path string) ([]Subscription, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhooks file: %w", err)
+	}
+
+	var subs []Subscription
+	if err := json.Unmarshal(data, &subs); err != nil {
+		return nil, fmt.Errorf("failed to parse webhooks file %s: %w", path, err)
+	}
+
+	for i, sub := range subs {
+		u, err := url.Parse(sub.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook %d: invalid URL %q", i, sub.URL)
+		}
+		for _, event := range sub.Events {
+			if !slices.Contains(supportedEvents, event) {
+				return nil, fmt.Errorf("webhook %d: unsupported event %q, must be one of %v", i, event, supportedEvents)
+			}
+		}
+	}
+
+	return subs, nil
+}
+
+// payload is the JSON body posted to subscribers: the event type next to the event's fields
+type payload struct {
+	Event string `json:"event"`
+	domain.TransactionEvent
+}
+
+// Dispatcher posts events to subscriptions, retrying failed deliveries with a doubling backoff
+type Dispatcher struct {
+	subs        []Subscription
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	logger      *slog.Logger
+}
+
+// Option configures a Dispatcher
+type Option func(*Dispatcher)
+
+// WithHTTPClient sets the HTTP client used to deliver events
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		if client != nil {
+			d.client = client
+		}
+	}
+}
+
+// WithRetries sets how many times a delivery is attempted and the wait before the first retry
+func WithRetries(maxAttempts int, backoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		if maxAttempts > 0 {
+			d.maxAttempts = maxAttempts
+		}
+		if backoff > 0 {
+			d.backoff = backoff
+		}
+	}
+}
+
+// NewDispatcher creates a dispatcher for the given subscriptions
+func NewDispatcher(subs []Subscription, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		subs:        subs,
+		client:      &http.Client{Timeout: DefaultTimeout},
+		maxAttempts: DefaultMaxAttempts,
+		backoff:     DefaultBackoff,
+		logger:      slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Notify delivers the event to every subscription that selected its type
+func (d *Dispatcher) Notify(ctx context.Context, eventType string, event domain.TransactionEvent) {
+	body, err := json.Marshal(payload{Event: eventType, TransactionEvent: event})
+	if err != nil {
+		d.logger.Error("failed to marshal webhook payload", "error", err, "transaction_id", event.TransactionID)
+		return
+	}
+
+	// Deliveries outlive the message that triggered them
+	ctx = context.WithoutCancel(ctx)
+	for _, sub := range d.subs {
+		if !sub.Wants(eventType) {
+			continue
+		}
+		go d.deliver(ctx, sub, eventType, event.TransactionID, body)
+	}
+}
+
+// deliver posts body to the subscription until it is accepted or the attempts are used up
+func (d *Dispatcher) deliver(ctx context.Context, sub Subscription, eventType string, transactionID domain.TransactionID, body []byte) {
+	backoff := d.backoff
+	for attempt := 1; ; attempt++ {
+		err := d.post(ctx, sub.URL, eventType, body)
+		if err == nil {
+			d.logger.Info("webhook delivered",
+				"url", sub.URL, "event", eventType, "transaction_id", transactionID, "attempt", attempt)
+			return
+		}
+
+		d.logger.Warn("webhook delivery attempt failed",
+			"error", err, "url", sub.URL, "event", eventType, "transaction_id", transactionID,
+			"attempt", attempt, "max_attempts", d.maxAttempts)
+		if attempt >= d.maxAttempts {
+			d.logger.Error("giving up on webhook delivery",
+				"url", sub.URL, "event", eventType, "transaction_id", transactionID)
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends a single delivery; any 2xx response accepts it
+func (d *Dispatcher) post(ctx context.Context, target, eventType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Type", eventType)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("subscriber returned status %d", resp.StatusCode)
+	}
+	return nil
+}
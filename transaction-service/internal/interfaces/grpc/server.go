@@ -0,0 +1,116 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"unicode/utf8"
+
+	transactionv1 "internal-transfers/pkg/api/transaction/v1"
+	"internal-transfers/transaction-service/internal/application"
+	"internal-transfers/transaction-service/internal/domain"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxMemoLength matches the limit enforced by the HTTP API and the database
+const maxMemoLength = 256
+
+// TransactionServer implements the gRPC TransactionService on top of the application service
+type TransactionServer struct {
+	transactionv1.UnimplementedTransactionServiceServer
+	transactionService application.TransactionService
+}
+
+// NewTransactionServer creates a new instance of TransactionServer
+func NewTransactionServer(transactionService application.TransactionService) *TransactionServer {
+	return &TransactionServer{transactionService: transactionService}
+}
+
+// NewServer creates a gRPC server with the transaction service registered
+func NewServer(transactionService application.TransactionService) *grpc.Server {
+	server := grpc.NewServer()
+	transactionv1.RegisterTransactionServiceServer(server, NewTransactionServer(transactionService))
+	return server
+}
+
+// SubmitTransaction submits a transfer, returning the created transaction or, within the duplicate
+// window, an identical one submitted earlier
+func (s *TransactionServer) SubmitTransaction(ctx context.Context, req *transactionv1.SubmitTransactionRequest) (*transactionv1.SubmitTransactionResponse, error) {
+	if req.GetSourceAccountId() == 0 || req.GetDestinationAccountId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "source and destination accounts are required")
+	}
+	if utf8.RuneCountInString(req.GetMemo()) > maxMemoLength {
+		return nil, status.Error(codes.InvalidArgument, "memo must be at most 256 characters")
+	}
+
+	// Normalize amounts once at the boundary so the service only sees canonical amounts
+	amount, err := domain.NormalizeAmount(req.GetAmount())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, application.ErrInvalidAmount.Error())
+	}
+	var fee string
+	if req.GetFee() != "" {
+		if fee, err = domain.NormalizeAmount(req.GetFee()); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid fee")
+		}
+	}
+
+	result, err := s.transactionService.SubmitTransaction(ctx, application.TransactionDTO{
+		SourceAccountID:      domain.AccountID(req.GetSourceAccountId()),
+		DestinationAccountID: domain.AccountID(req.GetDestinationAccountId()),
+		Amount:               amount,
+		Fee:                  fee,
+		Memo:                 req.GetMemo(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, application.ErrSameAccount),
+			errors.Is(err, application.ErrInvalidAmount),
+			errors.Is(err, application.ErrInsufficientFunds):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, application.ErrAccountNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, application.ErrTooManyPendingTransfers):
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		case errors.Is(err, domain.ErrOverloaded):
+			return nil, status.Error(codes.Unavailable, domain.ErrOverloaded.Error())
+		case errors.Is(err, application.ErrBrokerUnavailable):
+			return nil, status.Error(codes.Unavailable, err.Error())
+		default:
+			return nil, status.Error(codes.Internal, "failed to process transaction")
+		}
+	}
+
+	return &transactionv1.SubmitTransactionResponse{
+		Transaction: newTransaction(result.Transaction),
+		Duplicate:   result.Duplicate,
+	}, nil
+}
+
+// GetTransaction retrieves a transaction by its ID
+func (s *TransactionServer) GetTransaction(ctx context.Context, req *transactionv1.GetTransactionRequest) (*transactionv1.Transaction, error) {
+	transaction, err := s.transactionService.GetTransaction(ctx, domain.TransactionID(req.GetId()))
+	if err != nil {
+		if errors.Is(err, domain.ErrOverloaded) {
+			return nil, status.Error(codes.Unavailable, domain.ErrOverloaded.Error())
+		}
+		return nil, status.Error(codes.NotFound, "transaction not found")
+	}
+	return newTransaction(transaction), nil
+}
+
+// newTransaction maps a domain transaction to its gRPC representation
+func newTransaction(transaction *domain.Transaction) *transactionv1.Transaction {
+	return &transactionv1.Transaction{
+		Id:                   int64(transaction.ID),
+		SourceAccountId:      int64(transaction.SourceAccountID),
+		DestinationAccountId: int64(transaction.DestinationAccountID),
+		Amount:               transaction.Amount,
+		Fee:                  transaction.Fee,
+		Memo:                 transaction.Memo,
+		Status:               string(transaction.Status),
+		FailureCode:          string(transaction.FailureCode),
+	}
+}
@@ -0,0 +1,140 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	transactionv1 "internal-transfers/pkg/api/transaction/v1"
+	"internal-transfers/transaction-service/internal/application"
+	"internal-transfers/transaction-service/internal/domain"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// memoryTransactionService keeps transactions in memory; methods the tests do not use panic
+// through the embedded nil interface
+type memoryTransactionService struct {
+	application.TransactionService
+
+	mu           sync.Mutex
+	transactions map[domain.TransactionID]domain.Transaction
+	submitted    []application.TransactionDTO
+}
+
+// SubmitTransaction refuses transfers from account 9 as if it had too many pending ones
+func (s *memoryTransactionService) SubmitTransaction(_ context.Context, dto application.TransactionDTO) (*application.SubmitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case dto.SourceAccountID == dto.DestinationAccountID:
+		return nil, application.ErrSameAccount
+	case dto.SourceAccountID == 9:
+		return nil, application.ErrTooManyPendingTransfers
+	}
+	s.submitted = append(s.submitted, dto)
+	transaction := domain.Transaction{
+		ID:                   domain.TransactionID(len(s.transactions) + 1),
+		SourceAccountID:      dto.SourceAccountID,
+		DestinationAccountID: dto.DestinationAccountID,
+		Amount:               dto.Amount,
+		Fee:                  dto.Fee,
+		Memo:                 dto.Memo,
+		Status:               domain.TransactionStatusPending,
+	}
+	s.transactions[transaction.ID] = transaction
+	return &application.SubmitResult{Transaction: &transaction}, nil
+}
+
+func (s *memoryTransactionService) GetTransaction(_ context.Context, id domain.TransactionID) (*domain.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	transaction, ok := s.transactions[id]
+	if !ok {
+		return nil, application.ErrTransactionNotFound
+	}
+	return &transaction, nil
+}
+
+// dial serves server in process and returns a client connected to it
+func dial(t *testing.T, server *grpc.Server) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to connect to the in-process server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestTransactionServer(t *testing.T) {
+	service := &memoryTransactionService{transactions: make(map[domain.TransactionID]domain.Transaction)}
+	client := transactionv1.NewTransactionServiceClient(dial(t, NewServer(service)))
+	ctx := context.Background()
+
+	response, err := client.SubmitTransaction(ctx, &transactionv1.SubmitTransactionRequest{
+		SourceAccountId: 1, DestinationAccountId: 2, Amount: "10.5", Fee: "0.25", Memo: "rent",
+	})
+	if err != nil {
+		t.Fatalf("SubmitTransaction() error = %v", err)
+	}
+	submitted := response.GetTransaction()
+	if submitted.GetId() != 1 || submitted.GetStatus() != string(domain.TransactionStatusPending) || response.GetDuplicate() {
+		t.Errorf("SubmitTransaction() = %v, want pending transaction 1", response)
+	}
+	// Amounts reach the service in their canonical form
+	if dto := service.submitted[0]; dto.Amount != "10.50" || dto.Fee != "0.25" || dto.Memo != "rent" {
+		t.Errorf("submitted %+v, want 10.50 with a fee of 0.25 and the memo", dto)
+	}
+
+	transaction, err := client.GetTransaction(ctx, &transactionv1.GetTransactionRequest{Id: 1})
+	if err != nil {
+		t.Fatalf("GetTransaction() error = %v", err)
+	}
+	if transaction.GetSourceAccountId() != 1 || transaction.GetDestinationAccountId() != 2 || transaction.GetAmount() != "10.50" {
+		t.Errorf("GetTransaction() = %v, want 10.50 from account 1 to 2", transaction)
+	}
+
+	tests := []struct {
+		name string
+		req  *transactionv1.SubmitTransactionRequest
+		want codes.Code
+	}{
+		{name: "missing destination", req: &transactionv1.SubmitTransactionRequest{SourceAccountId: 1, Amount: "10"}, want: codes.InvalidArgument},
+		{name: "invalid amount", req: &transactionv1.SubmitTransactionRequest{SourceAccountId: 1, DestinationAccountId: 2, Amount: "ten"}, want: codes.InvalidArgument},
+		{name: "invalid fee", req: &transactionv1.SubmitTransactionRequest{SourceAccountId: 1, DestinationAccountId: 2, Amount: "10", Fee: "one"}, want: codes.InvalidArgument},
+		{name: "memo too long", req: &transactionv1.SubmitTransactionRequest{SourceAccountId: 1, DestinationAccountId: 2, Amount: "10", Memo: strings.Repeat("m", maxMemoLength+1)}, want: codes.InvalidArgument},
+		{name: "same account", req: &transactionv1.SubmitTransactionRequest{SourceAccountId: 1, DestinationAccountId: 1, Amount: "10"}, want: codes.InvalidArgument},
+		{name: "too many pending transfers", req: &transactionv1.SubmitTransactionRequest{SourceAccountId: 9, DestinationAccountId: 1, Amount: "10"}, want: codes.ResourceExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.SubmitTransaction(ctx, tt.req)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("status code = %s, want %s: %v", got, tt.want, err)
+			}
+		})
+	}
+
+	if _, err := client.GetTransaction(ctx, &transactionv1.GetTransactionRequest{Id: 7}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetTransaction() of an unknown transaction error = %v, want %s", err, codes.NotFound)
+	}
+	if len(service.submitted) != 1 {
+		t.Errorf("the service received %d transfers, want only the valid one", len(service.submitted))
+	}
+}
@@ -0,0 +1,136 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"internal-transfers/transaction-service/internal/application"
+	"internal-transfers/transaction-service/internal/clock"
+	"internal-transfers/transaction-service/internal/domain"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestListArchivableTransactions(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) string {
+		return now.AddDate(0, 0, -days).Format(time.RFC3339)
+	}
+	repo := &memoryRepository{transactions: map[domain.TransactionID]domain.Transaction{
+		1: {ID: 1, Amount: "10.00", Status: domain.TransactionStatusComplete, UpdatedAt: daysAgo(40)},
+		2: {ID: 2, Amount: "10.00", Status: domain.TransactionStatusFailed, UpdatedAt: daysAgo(31)},
+		3: {ID: 3, Amount: "10.00", Status: domain.TransactionStatusRollback, UpdatedAt: daysAgo(60)},
+		4: {ID: 4, Amount: "10.00", Status: domain.TransactionStatusComplete, UpdatedAt: daysAgo(29)},
+		5: {ID: 5, Amount: "10.00", Status: domain.TransactionStatusFailed, UpdatedAt: daysAgo(1)},
+		6: {ID: 6, Amount: "10.00", Status: domain.TransactionStatusPending, UpdatedAt: daysAgo(90)},
+		7: {ID: 7, Amount: "10.00", Status: domain.TransactionStatusProcessing, UpdatedAt: daysAgo(45)},
+		8: {ID: 8, Amount: "10.00", Status: domain.TransactionStatusHeld, UpdatedAt: daysAgo(35)},
+	}}
+	service := application.NewTransactionService(repo, &recordingBroker{}, nil, application.WithClock(clock.NewFake(now)))
+	r := chi.NewRouter()
+	RegisterHandlers(r, NewTransactionHandler(service, nil))
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		want   []int64
+	}{
+		// Only terminal transactions are listed, oldest first; pending, processing and held ones
+		// are still in flight however old they are
+		{name: "days", query: "?older_than=30d", status: http.StatusOK, want: []int64{3, 1, 2}},
+		{name: "duration", query: "?older_than=720h", status: http.StatusOK, want: []int64{3, 1, 2}},
+		{name: "recent cutoff", query: "?older_than=2d", status: http.StatusOK, want: []int64{3, 1, 2, 4}},
+		{name: "nothing old enough", query: "?older_than=365d", status: http.StatusOK, want: []int64{}},
+		{name: "paginated", query: "?older_than=30d&limit=1&offset=1", status: http.StatusOK, want: []int64{1}},
+		{name: "missing age", status: http.StatusBadRequest},
+		{name: "zero days", query: "?older_than=0d", status: http.StatusBadRequest},
+		{name: "negative duration", query: "?older_than=-24h", status: http.StatusBadRequest},
+		{name: "fractional days", query: "?older_than=1.5d", status: http.StatusBadRequest},
+		{name: "invalid limit", query: "?older_than=30d&limit=0", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/transactions/archivable"+tt.query, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("GET /admin/transactions/archivable%s answered %d, want %d: %s", tt.query, rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var response ArchivableTransactionsResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode the response: %v", err)
+			}
+			ids := make([]int64, 0, len(response.Transactions))
+			for _, transaction := range response.Transactions {
+				ids = append(ids, transaction.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("listed transactions %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestArchiveTransactions(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) string {
+		return now.AddDate(0, 0, -days).Format(time.RFC3339)
+	}
+	repo := &memoryRepository{transactions: map[domain.TransactionID]domain.Transaction{
+		1: {ID: 1, SourceAccountID: 1, DestinationAccountID: 2, Amount: "10.00", Status: domain.TransactionStatusComplete, UpdatedAt: daysAgo(40)},
+		2: {ID: 2, SourceAccountID: 1, DestinationAccountID: 2, Amount: "20.00", Status: domain.TransactionStatusFailed, UpdatedAt: daysAgo(31)},
+		3: {ID: 3, SourceAccountID: 1, DestinationAccountID: 2, Amount: "30.00", Status: domain.TransactionStatusComplete, UpdatedAt: daysAgo(1)},
+		4: {ID: 4, SourceAccountID: 1, DestinationAccountID: 2, Amount: "40.00", Status: domain.TransactionStatusPending, UpdatedAt: daysAgo(90)},
+	}}
+	service := application.NewTransactionService(repo, &recordingBroker{}, nil, application.WithClock(clock.NewFake(now)))
+	r := chi.NewRouter()
+	RegisterHandlers(r, NewTransactionHandler(service, nil))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/transactions/archive?older_than=30d", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /admin/transactions/archive answered %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var response ArchiveResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode the response: %v", err)
+	}
+	if want := (ArchiveResponse{Cutoff: "2024-03-01T12:00:00Z", Archived: 2}); response != want {
+		t.Errorf("response = %+v, want %+v", response, want)
+	}
+
+	// Archived transactions left the hot table but are still served, so ledger entries keep resolving
+	for id, archived := range map[domain.TransactionID]bool{1: true, 2: true, 3: false, 4: false} {
+		if _, hot := repo.transactions[id]; hot == archived {
+			t.Errorf("transaction %d in the hot table: %t, want %t", id, hot, !archived)
+		}
+		path := fmt.Sprintf("/transactions/%d", id)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s answered %d, want %d", path, rec.Code, http.StatusOK)
+		}
+	}
+
+	// Nothing is left to archive
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/transactions/archive?older_than=30d", nil))
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil || response.Archived != 0 {
+		t.Errorf("second archive = %+v, %v, want nothing archived", response, err)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/transactions/archive?older_than=soon", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST with an invalid age answered %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,192 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"internal-transfers/transaction-service/internal/application"
+	"internal-transfers/transaction-service/internal/domain"
+	"net/http"
+)
+
+// BatchTransactionRequest represents the request body for submitting several transfers at once
+type BatchTransactionRequest struct {
+	Mode         string                     `json:"mode,omitempty" validate:"omitempty,oneof=atomic best_effort" enums:"atomic,best_effort"` // Defaults to atomic
+	Transactions []SubmitTransactionRequest `json:"transactions" validate:"required,min=1,max=100"`
+}
+
+// BatchItemResponse is the outcome of one transfer of a batch
+type BatchItemResponse struct {
+	Index int `json:"index" example:"0"`
+	// Status is the status the transfer would have been answered with on its own, or 424 if it was
+	// left out of an atomic batch because another transfer failed
+	Status      int                  `json:"status" example:"201"`
+	Transaction *TransactionResponse `json:"transaction,omitempty"`
+	Error       *ErrorResponse       `json:"error,omitempty"`
+}
+
+// BatchTransactionResponse lists the outcome of each transfer of a batch, in request order
+type BatchTransactionResponse struct {
+	Mode      string              `json:"mode" enums:"atomic,best_effort" example:"atomic"`
+	Submitted int                 `json:"submitted" example:"2"`
+	Failed    int                 `json:"failed" example:"0"`
+	Results   []BatchItemResponse `json:"results"`
+}
+
+// SubmitBatch handles the submission of several transfers at once
+// @Summary Submit a batch of transactions
+// @Description Submit up to 100 transfers at once. In atomic mode (the default) every transfer is checked before
+// @Description any is submitted, and none is if one fails; the others are reported with status 424. In best_effort
+// @Description mode every transfer that can be submitted is. The response lists the outcome of each transfer, with
+// @Description the status it would have been answered with on its own: 201 if every transfer was submitted, 207
+// @Description if only some were, and the status of the first failure if none was. Submitted transfers are
+// @Description settled independently of each other.
+// @Tags transactions
+// @Accept json
+// @Produce json
+// @Param batch body BatchTransactionRequest true "Transfers to submit"
+// @Success 201 {object} BatchTransactionResponse
+// @Success 207 {object} BatchTransactionResponse "Some transfers were not submitted"
+// @Failure 400 {object} BatchTransactionResponse "No transfer was submitted, or an ErrorResponse for an invalid request"
+// @Failure 404 {object} BatchTransactionResponse
+// @Failure 429 {object} BatchTransactionResponse
+// @Failure 500 {object} BatchTransactionResponse
+// @Failure 503 {object} BatchTransactionResponse
+// @Router /transactions/batch [post]
+func (h *TransactionHandler) SubmitBatch(w http.ResponseWriter, r *http.Request) {
+	var req BatchTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+	mode := application.BatchAtomic
+	if req.Mode != "" {
+		mode = application.BatchMode(req.Mode)
+	}
+
+	// Transfers rejected here never reach the service, which gets the others in order
+	results := make([]BatchItemResponse, len(req.Transactions))
+	var dtos []application.TransactionDTO
+	var indexes []int
+	for i, item := range req.Transactions {
+		results[i].Index = i
+		dto, errResponse := h.batchItem(item)
+		if errResponse != nil {
+			results[i].Status = http.StatusBadRequest
+			results[i].Error = errResponse
+			continue
+		}
+		dtos = append(dtos, dto)
+		indexes = append(indexes, i)
+	}
+
+	if mode == application.BatchAtomic && len(dtos) < len(req.Transactions) {
+		for _, i := range indexes {
+			results[i].Status, results[i].Error = batchItemError(application.ErrNotSubmitted)
+		}
+	} else if len(dtos) > 0 {
+		outcomes, err := h.transactionService.SubmitBatch(r.Context(), dtos, mode)
+		if err != nil {
+			if errors.Is(err, application.ErrInvalidBatch) {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			respondWithServerError(w, err, "Failed to process transactions")
+			return
+		}
+		for j, outcome := range outcomes {
+			i := indexes[j]
+			if outcome.Err != nil {
+				results[i].Status, results[i].Error = batchItemError(outcome.Err)
+				continue
+			}
+			results[i].Status = http.StatusCreated
+			if outcome.Result.Duplicate {
+				results[i].Status = http.StatusOK
+			}
+			transaction := newTransactionResponse(outcome.Result.Transaction)
+			results[i].Transaction = &transaction
+		}
+	}
+
+	response := BatchTransactionResponse{Mode: string(mode), Results: results}
+	status := 0
+	for _, result := range results {
+		if result.Error == nil {
+			response.Submitted++
+		} else {
+			response.Failed++
+			if status == 0 && result.Status != http.StatusFailedDependency {
+				status = result.Status
+			}
+		}
+	}
+	switch {
+	case response.Failed == 0:
+		status = http.StatusCreated
+	case response.Submitted > 0:
+		status = http.StatusMultiStatus
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// batchItem validates a transfer of a batch and normalizes its amounts, as SubmitTransaction does
+func (h *TransactionHandler) batchItem(item SubmitTransactionRequest) (application.TransactionDTO, *ErrorResponse) {
+	if err := h.validator.Struct(item); err != nil {
+		response := validationErrorResponse(err)
+		return application.TransactionDTO{}, &response
+	}
+
+	amount, err := h.normalizeAmount(item.Amount)
+	if err != nil {
+		return application.TransactionDTO{}, &ErrorResponse{Code: CodeBadRequest, Error: amountErrorMessage(err, application.ErrInvalidAmount.Error())}
+	}
+
+	var fee string
+	if item.Fee != "" {
+		if fee, err = h.normalizeAmount(item.Fee); err != nil {
+			return application.TransactionDTO{}, &ErrorResponse{Code: CodeBadRequest, Error: amountErrorMessage(err, "invalid fee")}
+		}
+	}
+
+	return application.TransactionDTO{
+		SourceAccountID:      domain.AccountID(item.SourceAccountID),
+		DestinationAccountID: domain.AccountID(item.DestinationAccountID),
+		Amount:               amount,
+		Fee:                  fee,
+		Memo:                 item.Memo,
+	}, nil
+}
+
+// batchItemError returns the status and error a transfer of a batch is reported with
+func batchItemError(err error) (int, *ErrorResponse) {
+	status := http.StatusInternalServerError
+	response := ErrorResponse{Code: CodeInternalError, Error: "Failed to process transaction"}
+	switch {
+	case errors.Is(err, application.ErrNotSubmitted):
+		status, response = http.StatusFailedDependency, ErrorResponse{Code: CodeNotSubmitted, Error: err.Error()}
+	case errors.Is(err, application.ErrSameAccount), errors.Is(err, application.ErrInvalidAmount), errors.Is(err, application.ErrInsufficientFunds):
+		status, response = http.StatusBadRequest, ErrorResponse{Code: CodeBadRequest, Error: err.Error()}
+	case errors.Is(err, application.ErrAccountNotFound):
+		status, response = http.StatusNotFound, ErrorResponse{Code: CodeNotFound, Error: err.Error()}
+	case errors.Is(err, application.ErrTooManyPendingTransfers):
+		status, response = http.StatusTooManyRequests, ErrorResponse{Code: CodeTooManyRequests, Error: err.Error()}
+	case errors.Is(err, application.ErrBrokerUnavailable):
+		status, response = http.StatusServiceUnavailable, ErrorResponse{Code: CodeUnavailable, Error: err.Error()}
+	case errors.Is(err, domain.ErrOverloaded):
+		status, response = http.StatusServiceUnavailable, ErrorResponse{Code: CodeOverloaded, Error: domain.ErrOverloaded.Error()}
+	case errors.Is(err, context.Canceled):
+		status, response = StatusClientClosedRequest, ErrorResponse{Code: CodeCancelled, Error: "Request cancelled"}
+	case errors.Is(err, context.DeadlineExceeded):
+		status, response = http.StatusGatewayTimeout, ErrorResponse{Code: CodeTimeout, Error: "Request timed out"}
+	}
+	return status, &response
+}
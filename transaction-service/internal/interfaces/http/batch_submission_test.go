@@ -0,0 +1,123 @@
+package http
+
+import (
+	"encoding/json"
+	"internal-transfers/transaction-service/internal/application"
+	"internal-transfers/transaction-service/internal/domain"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestSubmitBatch(t *testing.T) {
+	const (
+		valid         = `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00"}`
+		otherValid    = `{"source_account_id": 3, "destination_account_id": 4, "amount": "2.50"}`
+		sameAccount   = `{"source_account_id": 1, "destination_account_id": 1, "amount": "10.00"}`
+		invalidAmount = `{"source_account_id": 1, "destination_account_id": 2, "amount": "ten"}`
+	)
+	tests := []struct {
+		name          string
+		mode          string
+		transactions  []string
+		status        int
+		wantStatuses  []int
+		wantSubmitted int
+	}{
+		{
+			name:          "all valid",
+			transactions:  []string{valid, otherValid},
+			status:        http.StatusCreated,
+			wantStatuses:  []int{http.StatusCreated, http.StatusCreated},
+			wantSubmitted: 2,
+		},
+		{
+			name:         "atomic with a transfer the service refuses",
+			mode:         "atomic",
+			transactions: []string{valid, sameAccount, otherValid},
+			status:       http.StatusBadRequest,
+			wantStatuses: []int{http.StatusFailedDependency, http.StatusBadRequest, http.StatusFailedDependency},
+		},
+		{
+			name:         "atomic with an invalid transfer",
+			mode:         "atomic",
+			transactions: []string{valid, invalidAmount, otherValid},
+			status:       http.StatusBadRequest,
+			wantStatuses: []int{http.StatusFailedDependency, http.StatusBadRequest, http.StatusFailedDependency},
+		},
+		{
+			name:          "best effort with a transfer the service refuses",
+			mode:          "best_effort",
+			transactions:  []string{valid, sameAccount, otherValid},
+			status:        http.StatusMultiStatus,
+			wantStatuses:  []int{http.StatusCreated, http.StatusBadRequest, http.StatusCreated},
+			wantSubmitted: 2,
+		},
+		{
+			name:          "best effort with an invalid transfer",
+			mode:          "best_effort",
+			transactions:  []string{valid, invalidAmount, otherValid},
+			status:        http.StatusMultiStatus,
+			wantStatuses:  []int{http.StatusCreated, http.StatusBadRequest, http.StatusCreated},
+			wantSubmitted: 2,
+		},
+		{
+			name:         "best effort without a valid transfer",
+			mode:         "best_effort",
+			transactions: []string{sameAccount, invalidAmount},
+			status:       http.StatusBadRequest,
+			wantStatuses: []int{http.StatusBadRequest, http.StatusBadRequest},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &recordingBroker{}
+			service := application.NewTransactionService(&memoryRepository{transactions: make(map[domain.TransactionID]domain.Transaction)}, broker, nil)
+			r := chi.NewRouter()
+			RegisterHandlers(r, NewTransactionHandler(service, nil))
+
+			body := `{"mode": "` + tt.mode + `", "transactions": [` + strings.Join(tt.transactions, ",") + `]}`
+			if tt.mode == "" {
+				body = `{"transactions": [` + strings.Join(tt.transactions, ",") + `]}`
+			}
+			req := httptest.NewRequest(http.MethodPost, "/transactions/batch", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("POST /transactions/batch answered %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			var response BatchTransactionResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("POST /transactions/batch answered an invalid body: %v", err)
+			}
+			statuses := make([]int, 0, len(response.Results))
+			for i, result := range response.Results {
+				statuses = append(statuses, result.Status)
+				if result.Index != i {
+					t.Errorf("result %d has index %d", i, result.Index)
+				}
+				if (result.Transaction != nil) == (result.Error != nil) {
+					t.Errorf("result %d = %+v, want either a transaction or an error", i, result)
+				}
+			}
+			if !slices.Equal(statuses, tt.wantStatuses) {
+				t.Errorf("statuses = %v, want %v", statuses, tt.wantStatuses)
+			}
+			if response.Submitted != tt.wantSubmitted || response.Failed != len(tt.transactions)-tt.wantSubmitted {
+				t.Errorf("submitted %d and failed %d, want %d submitted out of %d", response.Submitted, response.Failed, tt.wantSubmitted, len(tt.transactions))
+			}
+
+			// Only the submitted transfers reach the account service
+			if len(broker.submitted) != tt.wantSubmitted {
+				t.Errorf("published %d submitted events, want %d", len(broker.submitted), tt.wantSubmitted)
+			}
+		})
+	}
+}
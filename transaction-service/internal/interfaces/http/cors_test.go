@@ -0,0 +1,69 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"internal-transfers/pkg/config"
+)
+
+func TestCORS(t *testing.T) {
+	enabled := config.CORSConfig{
+		AllowedOrigins: []string{"https://admin.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type"},
+	}
+	tests := []struct {
+		name        string
+		cfg         config.CORSConfig
+		method      string
+		origin      string
+		preflight   bool
+		status      int
+		allowOrigin string
+		allowMethod string
+	}{
+		{name: "disabled", method: http.MethodGet, origin: "https://admin.example.com", status: http.StatusOK},
+		{name: "permitted origin", cfg: enabled, method: http.MethodGet, origin: "https://admin.example.com", status: http.StatusOK, allowOrigin: "https://admin.example.com"},
+		{name: "other origin", cfg: enabled, method: http.MethodGet, origin: "https://evil.example.com", status: http.StatusOK},
+		{name: "same origin", cfg: enabled, method: http.MethodGet, status: http.StatusOK},
+		{name: "preflight", cfg: enabled, method: http.MethodOptions, origin: "https://admin.example.com", preflight: true, status: http.StatusNoContent, allowOrigin: "https://admin.example.com", allowMethod: "GET, POST"},
+		{name: "preflight from another origin", cfg: enabled, method: http.MethodOptions, origin: "https://evil.example.com", preflight: true, status: http.StatusOK},
+		{
+			name:        "any origin",
+			cfg:         config.CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}},
+			method:      http.MethodGet,
+			origin:      "https://other.example.com",
+			status:      http.StatusOK,
+			allowOrigin: "https://other.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			req := httptest.NewRequest(tt.method, "/transactions/1", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			rec := httptest.NewRecorder()
+			CORS(tt.cfg)(next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Methods"); got != tt.allowMethod {
+				t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, tt.allowMethod)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"internal-transfers/transaction-service/internal/domain"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// StatusClientClosedRequest is the non-standard status, borrowed from nginx, reported for
+// requests whose client went away before they were handled
+const StatusClientClosedRequest = 499
+
+// Error codes returned in ErrorResponse.Code
+const (
+	CodeValidationFailed = "validation_failed"
+	CodeBadRequest       = "bad_request"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeTooManyRequests  = "too_many_requests"
+	CodeInternalError    = "internal_error"
+	CodeOverloaded       = "service_overloaded"
+	CodeCancelled        = "request_cancelled"
+	CodeTimeout          = "timeout"
+	CodeUnavailable      = "service_unavailable"
+	CodeNotSubmitted     = "not_submitted"
+)
+
+// ErrorResponse represents an error response. Code is stable and meant for clients to branch on,
+// while Error is a human-readable message. Fields maps each invalid request field to the
+// reason it was rejected and is only set for validation_failed.
+type ErrorResponse struct {
+	Code   string            `json:"code" enums:"validation_failed,bad_request,not_found,conflict,too_many_requests,internal_error,service_overloaded,request_cancelled,timeout,service_unavailable,not_submitted" example:"validation_failed"`
+	Error  string            `json:"error" example:"request validation failed"`
+	Fields map[string]string `json:"fields,omitempty" example:"amount:is required"`
+}
+
+// newValidator creates a validator that reports fields by their JSON names
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return v
+}
+
+// errorCode returns the error code matching an HTTP status
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	case http.StatusServiceUnavailable:
+		return CodeOverloaded
+	case StatusClientClosedRequest:
+		return CodeCancelled
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	default:
+		return CodeInternalError
+	}
+}
+
+// respondWithError sends an error response with the given status code and message
+func respondWithError(w http.ResponseWriter, status int, message string) {
+	writeError(w, status, ErrorResponse{Code: errorCode(status), Error: message})
+}
+
+// respondWithServerError sends a 503 when err reports that no database connection was free in
+// time, so clients back off instead of retrying immediately, a 499 or 504 when the request was
+// cancelled or timed out, since neither is a failure of the service, and a 500 with message otherwise
+func respondWithServerError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, domain.ErrOverloaded):
+		w.Header().Set("Retry-After", "1")
+		respondWithError(w, http.StatusServiceUnavailable, domain.ErrOverloaded.Error())
+	case errors.Is(err, context.Canceled):
+		respondWithError(w, StatusClientClosedRequest, "Request cancelled")
+	case errors.Is(err, context.DeadlineExceeded):
+		respondWithError(w, http.StatusGatewayTimeout, "Request timed out")
+	default:
+		respondWithError(w, http.StatusInternalServerError, message)
+	}
+}
+
+// interrupted reports whether err is an operation cut short by its context being cancelled or
+// timing out rather than a failure of the operation itself
+func interrupted(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// respondWithValidationError sends a 400 listing the fields rejected by the validator
+func respondWithValidationError(w http.ResponseWriter, err error) {
+	writeError(w, http.StatusBadRequest, validationErrorResponse(err))
+}
+
+// validationErrorResponse lists the fields rejected by the validator
+func validationErrorResponse(err error) ErrorResponse {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return ErrorResponse{Code: CodeBadRequest, Error: err.Error()}
+	}
+
+	fields := make(map[string]string, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		fields[fieldError.Field()] = validationMessage(fieldError)
+	}
+	return ErrorResponse{
+		Code:   CodeValidationFailed,
+		Error:  "request validation failed",
+		Fields: fields,
+	}
+}
+
+// validationMessage describes why a field failed validation
+func validationMessage(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return "is required"
+	case "gt":
+		return "must be greater than " + fieldError.Param()
+	case "min":
+		if fieldError.Kind() == reflect.Slice {
+			return "must have at least " + fieldError.Param() + " items"
+		}
+		return "must be at least " + fieldError.Param() + " characters"
+	case "max":
+		if fieldError.Kind() == reflect.Slice {
+			return "must have at most " + fieldError.Param() + " items"
+		}
+		return "must be at most " + fieldError.Param() + " characters"
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fieldError.Param(), " ", ", ")
+	default:
+		return "failed the " + fieldError.Tag() + " rule"
+	}
+}
+
+// writeError encodes response as JSON with the given status code
+func writeError(w http.ResponseWriter, status int, response ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -3,10 +3,18 @@ package http
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"internal-transfers/pkg/config"
+	"internal-transfers/pkg/features"
+	"internal-transfers/pkg/idempotency"
+	"internal-transfers/pkg/pagination"
 	"internal-transfers/transaction-service/internal/application"
 	"internal-transfers/transaction-service/internal/domain"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
@@ -15,21 +23,147 @@ import (
 // TransactionHandler handles HTTP requests for transactions
 type TransactionHandler struct {
 	transactionService application.TransactionService
+	reconciler         *application.Reconciler
 	validator          *validator.Validate
+	amountFormat       domain.AmountFormat
+	basePath           string
+	// currency is the one amounts may be written with while the lenient_amounts feature is on
+	currency string
+	// maxAmountScale caps the decimal places of the amounts clients send; see WithMaxAmountScale
+	maxAmountScale int32
+	// statusUpdates, streamPollInterval and streamTimeout drive the status event streams; see WithStatusStreams
+	statusUpdates      *application.StatusUpdates
+	streamPollInterval time.Duration
+	streamTimeout      time.Duration
+	features           features.Flags
+	// idempotencyKeys and idempotencyKeyTTL remember submissions by Idempotency-Key; see WithIdempotencyKeys
+	idempotencyKeys   idempotency.Store
+	idempotencyKeyTTL time.Duration
+}
+
+// HandlerOption configures optional behavior of the transaction handler
+type HandlerOption func(*TransactionHandler)
+
+// WithAmountFormat sets how clients write the decimal separator of the amounts they send
+func WithAmountFormat(format domain.AmountFormat) HandlerOption {
+	return func(h *TransactionHandler) {
+		h.amountFormat = format
+	}
+}
+
+// WithMaxAmountScale rejects the amounts clients send with more than scale significant decimal
+// places, whatever their currency. Amounts may have up to domain.MaxScale by default.
+func WithMaxAmountScale(scale int32) HandlerOption {
+	return func(h *TransactionHandler) {
+		if scale >= 0 && scale <= domain.MaxScale {
+			h.maxAmountScale = scale
+		}
+	}
+}
+
+// DefaultCurrency is the ISO 4217 code of the accounts unless WithCurrency is used
+const DefaultCurrency = "USD"
+
+// WithCurrency sets the ISO 4217 code of the currency of the accounts, the only one amounts may be
+// written with while the lenient_amounts feature is on
+func WithCurrency(code string) HandlerOption {
+	return func(h *TransactionHandler) {
+		h.currency = code
+	}
+}
+
+// WithBasePath sets the path the routes are mounted under, used in the URLs of created transactions
+func WithBasePath(path string) HandlerOption {
+	return func(h *TransactionHandler) {
+		h.basePath = path
+	}
+}
+
+// WithStatusStreams drives the status event streams of transactions by the updates published by
+// this instance, and by polling every pollInterval for changes made by other instances. A stream
+// is closed after timeout even if its transaction has not reached a terminal status.
+func WithStatusStreams(updates *application.StatusUpdates, pollInterval, timeout time.Duration) HandlerOption {
+	return func(h *TransactionHandler) {
+		h.statusUpdates = updates
+		if pollInterval > 0 {
+			h.streamPollInterval = pollInterval
+		}
+		if timeout > 0 {
+			h.streamTimeout = timeout
+		}
+	}
+}
+
+// WithFeatures sets the feature flags gating behaviors of the handler; all are at their default otherwise
+func WithFeatures(flags features.Flags) HandlerOption {
+	return func(h *TransactionHandler) {
+		h.features = flags
+	}
 }
 
 // NewTransactionHandler creates a new instance of TransactionHandler
-func NewTransactionHandler(transactionService application.TransactionService) *TransactionHandler {
-	return &TransactionHandler{
+func NewTransactionHandler(transactionService application.TransactionService, reconciler *application.Reconciler, opts ...HandlerOption) *TransactionHandler {
+	h := &TransactionHandler{
 		transactionService: transactionService,
-		validator:          validator.New(),
+		reconciler:         reconciler,
+		validator:          newValidator(),
+		currency:           DefaultCurrency,
+		amountFormat:       domain.AmountFormatPoint,
+		maxAmountScale:     domain.MaxScale,
+		basePath:           config.DefaultBasePath,
+		streamPollInterval: DefaultStreamPollInterval,
+		streamTimeout:      DefaultStreamTimeout,
+		idempotencyKeyTTL:  DefaultIdempotencyKeyTTL,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// normalizeAmount converts an amount sent by a client into its canonical form, first stripping its
+// currency if the lenient_amounts feature is on, and rejects it if it has more decimal places than allowed
+func (h *TransactionHandler) normalizeAmount(s string) (string, error) {
+	if h.features.Enabled(features.LenientAmounts) {
+		var err error
+		if s, err = domain.StripCurrency(s, h.currency); err != nil {
+			return "", err
+		}
+	}
+	normalized, err := domain.NormalizeLocalizedAmount(s, h.amountFormat)
+	if err != nil {
+		return "", err
 	}
+	if amount, err := domain.ParseMoney(normalized); err != nil || amount.RoundsAt(h.maxAmountScale) {
+		return "", fmt.Errorf("%w: at most %d are allowed", domain.ErrAmountScale, h.maxAmountScale)
+	}
+	return normalized, nil
+}
+
+// amountErrorMessage returns the message reported for an amount normalizeAmount refused: why the
+// currency does not match or the amount is too precise, or message for any other problem
+func amountErrorMessage(err error, message string) string {
+	if errors.Is(err, domain.ErrCurrencyMismatch) || errors.Is(err, domain.ErrAmountScale) {
+		return err.Error()
+	}
+	return message
 }
 
 // RegisterHandlers registers all transaction-related routes
 func RegisterHandlers(r chi.Router, h *TransactionHandler) {
 	r.Post("/transactions", h.SubmitTransaction)
+	r.Post("/transactions/split", h.SubmitSplitTransaction)
+	r.Post("/transactions/batch", h.SubmitBatch)
 	r.Get("/transactions/{id}", h.GetTransaction)
+	r.Patch("/transactions/{id}", h.UpdateTransaction)
+	r.Get("/transactions/{id}/events", h.StreamTransactionEvents)
+	r.Get("/ws/transactions", h.TransactionSocket)
+	r.Get("/admin/transactions/{id}/trace", h.GetTransactionTrace)
+	r.Get("/reports/daily", h.GetDailyReport)
+	r.Get("/admin/reconciliation", h.Reconcile)
+	r.Get("/admin/transactions/archivable", h.ListArchivableTransactions)
+	r.Post("/admin/transactions/archive", h.ArchiveTransactions)
+	r.Post("/admin/transactions/{id}/reemit", h.ReemitTransaction)
 }
 
 // SubmitTransactionRequest represents the request body for submitting a transaction
@@ -37,6 +171,29 @@ type SubmitTransactionRequest struct {
 	SourceAccountID      int64  `json:"source_account_id" validate:"required"`
 	DestinationAccountID int64  `json:"destination_account_id" validate:"required"`
 	Amount               string `json:"amount" validate:"required"`
+	Fee                  string `json:"fee,omitempty"`                     // Optional charge on top of the amount, credited to the fee account; the fee schedule applies when omitted
+	Memo                 string `json:"memo,omitempty" validate:"max=256"` // Optional reference or note, e.g. an invoice number
+}
+
+// SplitTransactionRequest represents the request body for submitting a transfer from one source
+// account to several destinations, applied all together or not at all
+type SplitTransactionRequest struct {
+	SourceAccountID int64                `json:"source_account_id" validate:"required"`
+	Legs            []TransferLegRequest `json:"legs" validate:"required"` // Between 2 and 100 distinct destinations
+	Fee             string               `json:"fee,omitempty"`            // Optional charge on top of the total, credited to the fee account; the fee schedule applies when omitted
+	Memo            string               `json:"memo,omitempty" validate:"max=256"`
+}
+
+// UpdateTransactionRequest represents the request body for updating the metadata of a transaction.
+// Only the memo may change; the amount, accounts and status are fixed once submitted.
+type UpdateTransactionRequest struct {
+	Memo string `json:"memo" validate:"max=256"` // Replaces the memo; empty clears it
+}
+
+// TransferLegRequest is the amount a split transfer credits to one destination account
+type TransferLegRequest struct {
+	DestinationAccountID int64  `json:"destination_account_id" example:"2"`
+	Amount               string `json:"amount" example:"25.00"`
 }
 
 // TransactionResponse represents the response for transaction queries
@@ -45,12 +202,75 @@ type TransactionResponse struct {
 	SourceAccountID      int64  `json:"source_account_id"`
 	DestinationAccountID int64  `json:"destination_account_id"`
 	Amount               string `json:"amount"`
-	Status               string `json:"status"`
+	Fee                  string `json:"fee,omitempty"`
+	Memo                 string `json:"memo,omitempty"`
+	Status               string `json:"status" enums:"pending,processing,held,complete,failed,rollback"`
+	FailureCode          string `json:"failure_code,omitempty"`
+	// Legs lists the destinations of a split transfer; destination_account_id is then the first
+	// leg's and amount their total
+	Legs []TransferLegRequest `json:"legs,omitempty"`
+}
+
+// StatusChangeResponse represents a single entry of a transaction's status history
+type StatusChangeResponse struct {
+	Status      string `json:"status" enums:"pending,processing,held,complete,failed,rollback"`
+	FailureCode string `json:"failure_code,omitempty"`
+	ChangedAt   string `json:"changed_at"`
+}
+
+// LedgerEntryResponse represents a ledger entry recorded by the account service
+type LedgerEntryResponse struct {
+	ID           int64  `json:"id"`
+	AccountID    int64  `json:"account_id"`
+	Type         string `json:"type" enums:"opening,debit,credit,fee,hold,release"`
+	Amount       string `json:"amount"`
+	BalanceAfter string `json:"balance_after"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// TransactionTraceResponse represents the full trail of a transaction across services
+type TransactionTraceResponse struct {
+	Transaction   TransactionResponse    `json:"transaction"`
+	StatusHistory []StatusChangeResponse `json:"status_history"`
+	LedgerEntries []LedgerEntryResponse  `json:"ledger_entries"`
+	LedgerError   string                 `json:"ledger_error,omitempty"`
+}
+
+// DailyReportResponse represents the totals of the transactions completed on a day
+type DailyReportResponse struct {
+	Date           string `json:"date" example:"2024-01-31"`
+	CompletedCount int    `json:"completed_count" example:"42"`
+	CompletedTotal string `json:"completed_total" example:"1250.00"`
+}
+
+// ArchivableTransactionsResponse lists transactions in a terminal status last updated before a cutoff
+type ArchivableTransactionsResponse struct {
+	Cutoff       string                `json:"cutoff" example:"2024-01-01T00:00:00Z"`
+	Limit        int                   `json:"limit" example:"20"`
+	Offset       int                   `json:"offset" example:"0"`
+	Transactions []TransactionResponse `json:"transactions"`
+}
+
+// ArchiveResponse reports how many transactions were moved to the archive
+type ArchiveResponse struct {
+	Cutoff   string `json:"cutoff" example:"2024-01-01T00:00:00Z"`
+	Archived int    `json:"archived" example:"42"`
+}
+
+// ReconciliationResponse lists the transactions completed on a day that do not match the ledger
+type ReconciliationResponse struct {
+	Date          string                `json:"date" example:"2024-01-31"`
+	Checked       int                   `json:"checked" example:"42"`
+	Truncated     bool                  `json:"truncated"`
+	Discrepancies []DiscrepancyResponse `json:"discrepancies"`
 }
 
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error string `json:"error"`
+// DiscrepancyResponse describes how a transaction differs from its ledger entries
+type DiscrepancyResponse struct {
+	TransactionID int64  `json:"transaction_id" example:"7"`
+	Code          string `json:"code" enums:"missing_ledger_entries,debit_mismatch,credit_mismatch,fee_mismatch,unbalanced,invalid_ledger_entry" example:"credit_mismatch"`
+	Expected      string `json:"expected,omitempty" example:"50.00"`
+	Actual        string `json:"actual,omitempty" example:"45.00"`
 }
 
 // SubmitTransaction handles the submission of a new transaction
@@ -60,9 +280,15 @@ type ErrorResponse struct {
 // @Accept json
 // @Produce json
 // @Param transaction body SubmitTransactionRequest true "Transaction details"
-// @Success 201 "Created"
+// @Param Idempotency-Key header string false "Client-chosen key identifying the submission, at most 255 characters"
+// @Success 200 {object} TransactionResponse "Identical transfer already submitted within the duplicate window"
+// @Success 201 {object} TransactionResponse
+// @Header 201 {string} Location "URL of the created transaction"
 // @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "The idempotency key is in use, or was used for a different transaction"
+// @Failure 429 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Router /transactions [post]
 func (h *TransactionHandler) SubmitTransaction(w http.ResponseWriter, r *http.Request) {
 	var req SubmitTransactionRequest
@@ -72,17 +298,42 @@ func (h *TransactionHandler) SubmitTransaction(w http.ResponseWriter, r *http.Re
 	}
 
 	if err := h.validator.Struct(req); err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithValidationError(w, err)
+		return
+	}
+
+	// Normalize the amount once at the boundary so the service only sees canonical amounts
+	amount, err := h.normalizeAmount(req.Amount)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, amountErrorMessage(err, application.ErrInvalidAmount.Error()))
 		return
 	}
 
+	var fee string
+	if req.Fee != "" {
+		if fee, err = h.normalizeAmount(req.Fee); err != nil {
+			respondWithError(w, http.StatusBadRequest, amountErrorMessage(err, "invalid fee"))
+			return
+		}
+	}
+
 	dto := application.TransactionDTO{
 		SourceAccountID:      domain.AccountID(req.SourceAccountID),
 		DestinationAccountID: domain.AccountID(req.DestinationAccountID),
-		Amount:               req.Amount,
+		Amount:               amount,
+		Fee:                  fee,
+		Memo:                 req.Memo,
 	}
 
-	if err := h.transactionService.SubmitTransaction(r.Context(), dto); err != nil {
+	fingerprint := idempotency.Fingerprint("transfer", strconv.FormatInt(req.SourceAccountID, 10), strconv.FormatInt(req.DestinationAccountID, 10), amount, fee, req.Memo)
+	idempotencyKey, ok := h.reserveIdempotencyKey(w, r, fingerprint)
+	if !ok {
+		return
+	}
+
+	result, err := h.transactionService.SubmitTransaction(r.Context(), dto)
+	if err != nil {
+		h.completeIdempotencyKey(r.Context(), idempotencyKey, fingerprint, nil)
 		switch {
 		case errors.Is(err, application.ErrSameAccount):
 			respondWithError(w, http.StatusBadRequest, err.Error())
@@ -92,13 +343,130 @@ func (h *TransactionHandler) SubmitTransaction(w http.ResponseWriter, r *http.Re
 			respondWithError(w, http.StatusBadRequest, err.Error())
 		case errors.Is(err, application.ErrAccountNotFound):
 			respondWithError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, application.ErrTooManyPendingTransfers):
+			respondWithError(w, http.StatusTooManyRequests, err.Error())
+		case errors.Is(err, application.ErrBrokerUnavailable):
+			w.Header().Set("Retry-After", "5")
+			writeError(w, http.StatusServiceUnavailable, ErrorResponse{Code: CodeUnavailable, Error: err.Error()})
+		default:
+			respondWithServerError(w, err, "Failed to process transaction")
+		}
+		return
+	}
+	h.completeIdempotencyKey(r.Context(), idempotencyKey, fingerprint, result.Transaction)
+
+	status := http.StatusCreated
+	if result.Duplicate {
+		status = http.StatusOK
+	} else {
+		w.Header().Set("Location", h.transactionLocation(result.Transaction.ID))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(newTransactionResponse(result.Transaction))
+}
+
+// SubmitSplitTransaction handles the submission of a transfer to several destinations
+// @Summary Submit a split transaction
+// @Description Debit the source account once and credit several destination accounts, all in one atomic transfer
+// @Tags transactions
+// @Accept json
+// @Produce json
+// @Param transaction body SplitTransactionRequest true "Split transaction details"
+// @Param Idempotency-Key header string false "Client-chosen key identifying the submission, at most 255 characters"
+// @Success 201 {object} TransactionResponse
+// @Header 201 {string} Location "URL of the created transaction"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "The idempotency key is in use, or was used for a different transaction"
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /transactions/split [post]
+func (h *TransactionHandler) SubmitSplitTransaction(w http.ResponseWriter, r *http.Request) {
+	var req SplitTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+
+	// Normalize the leg amounts once at the boundary so the service only sees canonical amounts
+	legs := make([]domain.TransferLeg, len(req.Legs))
+	for i, leg := range req.Legs {
+		if leg.DestinationAccountID <= 0 {
+			respondWithError(w, http.StatusBadRequest, "invalid destination account ID")
+			return
+		}
+		amount, err := h.normalizeAmount(leg.Amount)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, amountErrorMessage(err, application.ErrInvalidAmount.Error()))
+			return
+		}
+		legs[i] = domain.TransferLeg{DestinationAccountID: domain.AccountID(leg.DestinationAccountID), Amount: amount}
+	}
+
+	var fee string
+	if req.Fee != "" {
+		var err error
+		if fee, err = h.normalizeAmount(req.Fee); err != nil {
+			respondWithError(w, http.StatusBadRequest, amountErrorMessage(err, "invalid fee"))
+			return
+		}
+	}
+
+	parts := []string{"split", strconv.FormatInt(req.SourceAccountID, 10), fee, req.Memo}
+	for _, leg := range legs {
+		parts = append(parts, strconv.FormatInt(int64(leg.DestinationAccountID), 10), leg.Amount)
+	}
+	fingerprint := idempotency.Fingerprint(parts...)
+	idempotencyKey, ok := h.reserveIdempotencyKey(w, r, fingerprint)
+	if !ok {
+		return
+	}
+
+	transaction, err := h.transactionService.SubmitSplitTransaction(r.Context(), application.SplitTransactionDTO{
+		SourceAccountID: domain.AccountID(req.SourceAccountID),
+		Legs:            legs,
+		Fee:             fee,
+		Memo:            req.Memo,
+	})
+	if err != nil {
+		h.completeIdempotencyKey(r.Context(), idempotencyKey, fingerprint, nil)
+		switch {
+		case errors.Is(err, application.ErrSameAccount),
+			errors.Is(err, application.ErrInvalidAmount),
+			errors.Is(err, application.ErrInvalidSplit),
+			errors.Is(err, application.ErrDuplicateDestination):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, application.ErrAccountNotFound):
+			respondWithError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, application.ErrTooManyPendingTransfers):
+			respondWithError(w, http.StatusTooManyRequests, err.Error())
+		case errors.Is(err, application.ErrBrokerUnavailable):
+			w.Header().Set("Retry-After", "5")
+			writeError(w, http.StatusServiceUnavailable, ErrorResponse{Code: CodeUnavailable, Error: err.Error()})
 		default:
-			respondWithError(w, http.StatusInternalServerError, "Failed to process transaction")
+			respondWithServerError(w, err, "Failed to process transaction")
 		}
 		return
 	}
+	h.completeIdempotencyKey(r.Context(), idempotencyKey, fingerprint, transaction)
 
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", h.transactionLocation(transaction.ID))
 	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newTransactionResponse(transaction))
+}
+
+// transactionLocation returns the URL path of a transaction, as served by GetTransaction
+func (h *TransactionHandler) transactionLocation(id domain.TransactionID) string {
+	return h.basePath + "/transactions/" + strconv.FormatInt(int64(id), 10)
 }
 
 // GetTransaction handles the retrieval of a transaction by ID
@@ -112,6 +480,7 @@ func (h *TransactionHandler) SubmitTransaction(w http.ResponseWriter, r *http.Re
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Router /transactions/{id} [get]
 func (h *TransactionHandler) GetTransaction(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
@@ -122,25 +491,391 @@ func (h *TransactionHandler) GetTransaction(w http.ResponseWriter, r *http.Reque
 
 	transaction, err := h.transactionService.GetTransaction(r.Context(), domain.TransactionID(id))
 	if err != nil {
+		if errors.Is(err, domain.ErrOverloaded) || interrupted(err) {
+			respondWithServerError(w, err, "Failed to get transaction")
+			return
+		}
+		respondWithError(w, http.StatusNotFound, "Transaction not found")
+		return
+	}
+
+	response := newTransactionResponse(transaction)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateTransaction handles updating the memo of a transaction
+// @Summary Update transaction metadata
+// @Description Replace the memo of a transaction, whatever its status. The amount, accounts and
+// @Description status cannot be changed; requests that include any other field are refused.
+// @Tags transactions
+// @Accept json
+// @Produce json
+// @Param id path int true "Transaction ID"
+// @Param transaction body UpdateTransactionRequest true "Transaction metadata"
+// @Success 200 {object} TransactionResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /transactions/{id} [patch]
+func (h *TransactionHandler) UpdateTransaction(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+
+	// Decode the fields first so attempts to change immutable fields are refused by name
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil || fields == nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	for name := range fields {
+		if name != "memo" {
+			respondWithError(w, http.StatusBadRequest, "field "+name+" cannot be changed")
+			return
+		}
+	}
+	memo, ok := fields["memo"]
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "memo is required")
+		return
+	}
+
+	var req UpdateTransactionRequest
+	if err := json.Unmarshal(memo, &req.Memo); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := h.validator.Struct(req); err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+
+	transaction, err := h.transactionService.UpdateTransactionMemo(r.Context(), domain.TransactionID(id), req.Memo)
+	if err != nil {
+		if errors.Is(err, application.ErrTransactionNotFound) {
+			respondWithError(w, http.StatusNotFound, "Transaction not found")
+			return
+		}
+		respondWithServerError(w, err, "Failed to update transaction")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newTransactionResponse(transaction))
+}
+
+// GetTransactionTrace handles the retrieval of a transaction's full event trail
+// @Summary Get transaction trace
+// @Description Get a transaction together with its status history and the ledger entries recorded by the account service
+// @Tags admin
+// @Produce json
+// @Param id path int true "Transaction ID"
+// @Success 200 {object} TransactionTraceResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /admin/transactions/{id}/trace [get]
+func (h *TransactionHandler) GetTransactionTrace(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+
+	trace, err := h.transactionService.GetTransactionTrace(r.Context(), domain.TransactionID(id))
+	if err != nil {
+		if errors.Is(err, domain.ErrOverloaded) || interrupted(err) {
+			respondWithServerError(w, err, "Failed to get transaction")
+			return
+		}
 		respondWithError(w, http.StatusNotFound, "Transaction not found")
 		return
 	}
 
-	response := TransactionResponse{
+	response := TransactionTraceResponse{
+		Transaction:   newTransactionResponse(trace.Transaction),
+		StatusHistory: make([]StatusChangeResponse, 0, len(trace.StatusHistory)),
+		LedgerEntries: make([]LedgerEntryResponse, 0, len(trace.LedgerEntries)),
+		LedgerError:   trace.LedgerError,
+	}
+	for _, change := range trace.StatusHistory {
+		response.StatusHistory = append(response.StatusHistory, StatusChangeResponse{
+			Status:      string(change.Status),
+			FailureCode: string(change.FailureCode),
+			ChangedAt:   change.ChangedAt.Format(time.RFC3339),
+		})
+	}
+	for _, entry := range trace.LedgerEntries {
+		response.LedgerEntries = append(response.LedgerEntries, LedgerEntryResponse{
+			ID:           entry.ID,
+			AccountID:    int64(entry.AccountID),
+			Type:         entry.Type,
+			Amount:       entry.Amount,
+			BalanceAfter: entry.BalanceAfter,
+			CreatedAt:    entry.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetDailyReport handles the reconciliation report of a single day
+// @Summary Get daily report
+// @Description Get the number and summed amount of the transactions completed on a day, in UTC
+// @Tags reports
+// @Produce json
+// @Param date query string true "Day to report on, as YYYY-MM-DD"
+// @Success 200 {object} DailyReportResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /reports/daily [get]
+func (h *TransactionHandler) GetDailyReport(w http.ResponseWriter, r *http.Request) {
+	date, err := time.Parse(time.DateOnly, r.URL.Query().Get("date"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD")
+		return
+	}
+
+	report, err := h.transactionService.GetDailyReport(r.Context(), date)
+	if err != nil {
+		respondWithServerError(w, err, "Failed to build daily report")
+		return
+	}
+
+	response := DailyReportResponse{
+		Date:           report.Date.Format(time.DateOnly),
+		CompletedCount: report.Completed.Count,
+		CompletedTotal: report.Completed.Amount,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Reconcile handles the reconciliation of a day's completed transactions against the ledger
+// @Summary Reconcile transactions with the ledger
+// @Description Cross-check the transactions completed on a day, in UTC, against the ledger entries the
+// @Description account service recorded for them, and list those that do not match. At most 1000
+// @Description transactions are checked per request; truncated is set when there were more.
+// @Tags admin
+// @Produce json
+// @Param date query string true "Day to reconcile, as YYYY-MM-DD"
+// @Success 200 {object} ReconciliationResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /admin/reconciliation [get]
+func (h *TransactionHandler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	date, err := time.Parse(time.DateOnly, r.URL.Query().Get("date"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD")
+		return
+	}
+
+	report, err := h.reconciler.Reconcile(r.Context(), date)
+	if err != nil {
+		if errors.Is(err, application.ErrLedgerUnavailable) {
+			w.Header().Set("Retry-After", "5")
+			writeError(w, http.StatusServiceUnavailable, ErrorResponse{Code: CodeUnavailable, Error: err.Error()})
+			return
+		}
+		respondWithServerError(w, err, "Failed to reconcile transactions")
+		return
+	}
+
+	response := ReconciliationResponse{
+		Date:          report.Date.Format(time.DateOnly),
+		Checked:       report.Checked,
+		Truncated:     report.Truncated,
+		Discrepancies: make([]DiscrepancyResponse, 0, len(report.Discrepancies)),
+	}
+	for _, d := range report.Discrepancies {
+		response.Discrepancies = append(response.Discrepancies, DiscrepancyResponse{
+			TransactionID: int64(d.TransactionID),
+			Code:          d.Code,
+			Expected:      d.Expected,
+			Actual:        d.Actual,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListArchivableTransactions handles listing the transactions old enough to be archived
+// @Summary List archivable transactions
+// @Description List the completed, failed and rolled back transactions last updated more than older_than
+// @Description ago, oldest first, to support archiving or purging them. Split transfers are listed without
+// @Description their legs.
+// @Tags admin
+// @Produce json
+// @Param older_than query string true "Minimum age, as a number of days such as 30d or a duration such as 720h"
+// @Param limit query int false "Maximum number of transactions to return (default 20, max 100)"
+// @Param offset query int false "Number of transactions to skip"
+// @Success 200 {object} ArchivableTransactionsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /admin/transactions/archivable [get]
+func (h *TransactionHandler) ListArchivableTransactions(w http.ResponseWriter, r *http.Request) {
+	olderThan, err := parseAge(r.URL.Query().Get("older_than"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid older_than, expected a number of days such as 30d or a duration such as 720h")
+		return
+	}
+
+	limit, offset, err := pagination.ParsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	archivable, err := h.transactionService.ListArchivableTransactions(r.Context(), olderThan, limit, offset)
+	if err != nil {
+		respondWithServerError(w, err, "Failed to list archivable transactions")
+		return
+	}
+
+	response := ArchivableTransactionsResponse{
+		Cutoff:       archivable.Cutoff.UTC().Format(time.RFC3339),
+		Limit:        limit,
+		Offset:       offset,
+		Transactions: make([]TransactionResponse, 0, len(archivable.Transactions)),
+	}
+	for _, transaction := range archivable.Transactions {
+		response.Transactions = append(response.Transactions, newTransactionResponse(transaction))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ArchiveTransactions handles moving old terminal transactions to the archive
+// @Summary Archive old transactions
+// @Description Move the completed, failed and rolled back transactions last updated more than older_than
+// @Description ago, as listed by GET /admin/transactions/archivable, out of the transactions table into the
+// @Description archive, together with their legs and status history. Archived transactions are still served
+// @Description by GET /transactions/{id} and the trace, so ledger entries keep resolving, but no longer change.
+// @Tags admin
+// @Produce json
+// @Param older_than query string true "Minimum age, as a number of days such as 30d or a duration such as 720h"
+// @Success 200 {object} ArchiveResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /admin/transactions/archive [post]
+func (h *TransactionHandler) ArchiveTransactions(w http.ResponseWriter, r *http.Request) {
+	olderThan, err := parseAge(r.URL.Query().Get("older_than"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid older_than, expected a number of days such as 30d or a duration such as 720h")
+		return
+	}
+
+	result, err := h.transactionService.ArchiveTransactions(r.Context(), olderThan)
+	if err != nil {
+		respondWithServerError(w, err, "Failed to archive transactions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ArchiveResponse{
+		Cutoff:   result.Cutoff.UTC().Format(time.RFC3339),
+		Archived: result.Archived,
+	})
+}
+
+// parseAge parses a positive age written as a whole number of days, such as "30d", or as a Go
+// duration, such as "720h"
+func parseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 || n > math.MaxInt64/int(24*time.Hour) {
+			return 0, fmt.Errorf("invalid number of days %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
+
+// ReemitTransaction handles re-publishing the submitted event of a pending transaction
+// @Summary Re-emit a transaction's submitted event
+// @Description Publish the transaction.submitted event of a pending transaction again, e.g. when the
+// @Description original event was lost. Transactions that are not pending, or that the account service
+// @Description already recorded ledger entries for, are refused with 409 so they are never applied twice.
+// @Tags admin
+// @Produce json
+// @Param id path int true "Transaction ID"
+// @Success 202 {object} TransactionResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /admin/transactions/{id}/reemit [post]
+func (h *TransactionHandler) ReemitTransaction(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+
+	transaction, err := h.transactionService.ReemitTransaction(r.Context(), domain.TransactionID(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, application.ErrTransactionNotFound):
+			respondWithError(w, http.StatusNotFound, "Transaction not found")
+		case errors.Is(err, application.ErrTransactionNotPending),
+			errors.Is(err, application.ErrAlreadyApplied):
+			respondWithError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, application.ErrBrokerUnavailable),
+			errors.Is(err, application.ErrLedgerUnavailable):
+			w.Header().Set("Retry-After", "5")
+			writeError(w, http.StatusServiceUnavailable, ErrorResponse{Code: CodeUnavailable, Error: err.Error()})
+		default:
+			respondWithServerError(w, err, "Failed to re-emit transaction event")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(newTransactionResponse(transaction))
+}
+
+// newTransactionResponse maps a domain transaction to its API representation
+func newTransactionResponse(transaction *domain.Transaction) TransactionResponse {
+	return TransactionResponse{
 		ID:                   int64(transaction.ID),
 		SourceAccountID:      int64(transaction.SourceAccountID),
 		DestinationAccountID: int64(transaction.DestinationAccountID),
 		Amount:               transaction.Amount,
+		Fee:                  transaction.Fee,
+		Memo:                 transaction.Memo,
 		Status:               string(transaction.Status),
+		FailureCode:          string(transaction.FailureCode),
+		Legs:                 newTransferLegResponses(transaction.Legs),
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
 }
 
-// respondWithError sends an error response with the given status code and message
-func respondWithError(w http.ResponseWriter, status int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+// newTransferLegResponses maps the legs of a split transfer to their API representation
+func newTransferLegResponses(legs []domain.TransferLeg) []TransferLegRequest {
+	if len(legs) == 0 {
+		return nil
+	}
+	out := make([]TransferLegRequest, len(legs))
+	for i, leg := range legs {
+		out[i] = TransferLegRequest{DestinationAccountID: int64(leg.DestinationAccountID), Amount: leg.Amount}
+	}
+	return out
 }
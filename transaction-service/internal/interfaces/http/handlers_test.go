@@ -0,0 +1,672 @@
+package http
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"internal-transfers/pkg/features"
+	"internal-transfers/pkg/idempotency"
+	"internal-transfers/pkg/logtest"
+	"internal-transfers/transaction-service/internal/application"
+	"internal-transfers/transaction-service/internal/domain"
+	"internal-transfers/transaction-service/internal/infrastructure/messaging"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// memoryRepository keeps transactions in memory; methods the tests do not use panic through the
+// embedded nil interface
+type memoryRepository struct {
+	domain.TransactionRepository
+
+	mu           sync.Mutex
+	transactions map[domain.TransactionID]domain.Transaction
+	archived     map[domain.TransactionID]domain.Transaction
+}
+
+func (r *memoryRepository) Create(_ context.Context, transaction *domain.Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	transaction.ID = domain.TransactionID(len(r.transactions) + 1)
+	r.transactions[transaction.ID] = *transaction
+	return nil
+}
+
+func (r *memoryRepository) GetByID(_ context.Context, id domain.TransactionID) (*domain.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	transaction, ok := r.transactions[id]
+	if !ok {
+		return nil, nil
+	}
+	return &transaction, nil
+}
+
+// GetArchived finds the transactions moved by ArchiveUpdatedBefore
+func (r *memoryRepository) GetArchived(_ context.Context, id domain.TransactionID) (*domain.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	transaction, ok := r.archived[id]
+	if !ok {
+		return nil, nil
+	}
+	return &transaction, nil
+}
+
+// FindRecentDuplicate treats every stored transaction as recent
+func (r *memoryRepository) FindRecentDuplicate(_ context.Context, source, destination domain.AccountID, amount string, _ time.Time) (*domain.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, transaction := range r.transactions {
+		if transaction.SourceAccountID == source && transaction.DestinationAccountID == destination && transaction.Amount == amount {
+			return &transaction, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListUpdatedBefore lists the transactions in one of the statuses with an RFC 3339 UpdatedAt before
+// the cutoff, oldest first
+func (r *memoryRepository) ListUpdatedBefore(_ context.Context, cutoff time.Time, limit, offset int, statuses ...domain.TransactionStatus) ([]*domain.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	matches := []*domain.Transaction{}
+	for _, transaction := range r.transactions {
+		updatedAt, err := time.Parse(time.RFC3339, transaction.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if updatedAt.Before(cutoff) && slices.Contains(statuses, transaction.Status) {
+			matches = append(matches, &transaction)
+		}
+	}
+	slices.SortFunc(matches, func(a, b *domain.Transaction) int {
+		return cmp.Or(strings.Compare(a.UpdatedAt, b.UpdatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	matches = matches[min(offset, len(matches)):]
+	return matches[:min(limit, len(matches))], nil
+}
+
+// ArchiveUpdatedBefore moves the transactions ListUpdatedBefore lists to the archived ones
+func (r *memoryRepository) ArchiveUpdatedBefore(ctx context.Context, cutoff time.Time, limit int, statuses ...domain.TransactionStatus) (int, error) {
+	transactions, err := r.ListUpdatedBefore(ctx, cutoff, limit, 0, statuses...)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.archived == nil {
+		r.archived = make(map[domain.TransactionID]domain.Transaction)
+	}
+	for _, transaction := range transactions {
+		r.archived[transaction.ID] = *transaction
+		delete(r.transactions, transaction.ID)
+	}
+	return len(transactions), nil
+}
+
+// CountPendingBySourceAccount counts the pending and processing transactions of the source
+func (r *memoryRepository) CountPendingBySourceAccount(_ context.Context, accountID domain.AccountID) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, transaction := range r.transactions {
+		if transaction.SourceAccountID == accountID && (transaction.Status == domain.TransactionStatusPending || transaction.Status == domain.TransactionStatusProcessing) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// interruptedRepository fails lookups with the error of the caller's context, as a query cut short would
+type interruptedRepository struct {
+	domain.TransactionRepository
+}
+
+func (interruptedRepository) GetByID(ctx context.Context, _ domain.TransactionID) (*domain.Transaction, error) {
+	return nil, fmt.Errorf("failed to query transaction: %w", ctx.Err())
+}
+
+// overloadedRepository fails like a repository whose connection pool stayed saturated
+type overloadedRepository struct {
+	domain.TransactionRepository
+}
+
+func (overloadedRepository) GetByID(context.Context, domain.TransactionID) (*domain.Transaction, error) {
+	return nil, fmt.Errorf("%w: no database connection available within 50ms", domain.ErrOverloaded)
+}
+
+// recordingBroker records the submitted events
+type recordingBroker struct {
+	messaging.MessageBroker
+
+	disconnected bool
+
+	mu        sync.Mutex
+	submitted []domain.TransactionEvent
+}
+
+func (b *recordingBroker) IsConnected() bool { return !b.disconnected }
+
+func (b *recordingBroker) PublishTransactionSubmitted(_ context.Context, event domain.TransactionEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.submitted = append(b.submitted, event)
+	return nil
+}
+
+func TestAmountRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		amount    string
+		canonical string
+	}{
+		{name: "canonical", amount: "10.50", canonical: "10.50"},
+		{name: "significant decimals", amount: "10.125", canonical: "10.125"},
+		{name: "max scale", amount: "0.00000001", canonical: "0.00000001"},
+		{name: "largest amount", amount: "92233720368547758.07", canonical: "92233720368547758.07"},
+		{name: "whole", amount: "10", canonical: "10.00"},
+		{name: "trailing zeros", amount: "10.500", canonical: "10.50"},
+		{name: "leading zeros, sign and whitespace", amount: " +007.5 ", canonical: "7.50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &recordingBroker{}
+			service := application.NewTransactionService(&memoryRepository{transactions: make(map[domain.TransactionID]domain.Transaction)}, broker, nil)
+			r := chi.NewRouter()
+			RegisterHandlers(r, NewTransactionHandler(service, nil))
+
+			body := fmt.Sprintf(`{"source_account_id": 1, "destination_account_id": 2, "amount": %q}`, tt.amount)
+			submitted := doTransactionRequest(t, r, http.MethodPost, "/transactions", body, http.StatusCreated)
+			if submitted.Amount != tt.canonical {
+				t.Errorf("submitted amount = %q, want %q", submitted.Amount, tt.canonical)
+			}
+
+			// The account service processes the amount of the event
+			if len(broker.submitted) != 1 || broker.submitted[0].Amount != tt.canonical {
+				t.Errorf("published events = %+v, want one with amount %q", broker.submitted, tt.canonical)
+			}
+
+			fetched := doTransactionRequest(t, r, http.MethodGet, fmt.Sprintf("/transactions/%d", submitted.ID), "", http.StatusOK)
+			if fetched.Amount != submitted.Amount {
+				t.Errorf("fetched amount = %q, want the submitted %q", fetched.Amount, submitted.Amount)
+			}
+		})
+	}
+}
+
+func TestAmountRejected(t *testing.T) {
+	for _, amount := range []string{"0.000000001", "10.", "1 000", "92233720368547758.08"} {
+		t.Run(amount, func(t *testing.T) {
+			broker := &recordingBroker{}
+			service := application.NewTransactionService(&memoryRepository{transactions: make(map[domain.TransactionID]domain.Transaction)}, broker, nil)
+			r := chi.NewRouter()
+			RegisterHandlers(r, NewTransactionHandler(service, nil))
+
+			body := fmt.Sprintf(`{"source_account_id": 1, "destination_account_id": 2, "amount": %q}`, amount)
+			doTransactionRequest(t, r, http.MethodPost, "/transactions", body, http.StatusBadRequest)
+			if len(broker.submitted) != 0 {
+				t.Errorf("published events = %+v, want none", broker.submitted)
+			}
+		})
+	}
+}
+
+func TestLenientAmountsFeature(t *testing.T) {
+	tests := []struct {
+		name   string
+		flags  []string
+		status int
+	}{
+		{name: "off by default", status: http.StatusBadRequest},
+		{name: "turned off", flags: []string{"lenient_amounts=off"}, status: http.StatusBadRequest},
+		{name: "turned on", flags: []string{"lenient_amounts"}, status: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, err := features.Parse(tt.flags)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			service := application.NewTransactionService(&memoryRepository{transactions: make(map[domain.TransactionID]domain.Transaction)}, &recordingBroker{}, nil)
+			r := chi.NewRouter()
+			RegisterHandlers(r, NewTransactionHandler(service, nil, WithFeatures(flags), WithCurrency("USD")))
+
+			body := `{"source_account_id": 1, "destination_account_id": 2, "amount": "$10.50"}`
+			submitted := doTransactionRequest(t, r, http.MethodPost, "/transactions", body, tt.status)
+			if tt.status == http.StatusCreated && submitted.Amount != "10.50" {
+				t.Errorf("submitted amount = %q, want %q", submitted.Amount, "10.50")
+			}
+		})
+	}
+}
+
+func TestMaxAmountScale(t *testing.T) {
+	lenient, err := features.Parse([]string{string(features.LenientAmounts)})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	tests := []struct {
+		name     string
+		maxScale int32
+		amount   string
+		fee      string
+		status   int
+		// wantError is part of the error reported for refused amounts
+		wantError string
+	}{
+		{name: "within the cap", maxScale: 2, amount: "10.50", status: http.StatusCreated},
+		{name: "trailing zeros", maxScale: 2, amount: "10.5000", status: http.StatusCreated},
+		{name: "above the cap", maxScale: 2, amount: "10.505", status: http.StatusBadRequest, wantError: domain.ErrAmountScale.Error()},
+		{name: "fee above the cap", maxScale: 2, amount: "10.50", fee: "0.255", status: http.StatusBadRequest, wantError: domain.ErrAmountScale.Error()},
+		{name: "whole amounts only", maxScale: 0, amount: "10.50", status: http.StatusBadRequest, wantError: domain.ErrAmountScale.Error()},
+		// The cap applies once the currency is stripped, and the currency still has to match
+		{name: "currency within the cap", maxScale: 2, amount: "$10.50", status: http.StatusCreated},
+		{name: "currency above the cap", maxScale: 2, amount: "10.505 USD", status: http.StatusBadRequest, wantError: domain.ErrAmountScale.Error()},
+		{name: "other currency within the cap", maxScale: 2, amount: "10.50 EUR", status: http.StatusBadRequest, wantError: domain.ErrCurrencyMismatch.Error()},
+		{name: "default cap", maxScale: domain.MaxScale, amount: "10.5055", status: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &recordingBroker{}
+			service := application.NewTransactionService(&memoryRepository{transactions: make(map[domain.TransactionID]domain.Transaction)}, broker, nil)
+			r := chi.NewRouter()
+			RegisterHandlers(r, NewTransactionHandler(service, nil, WithFeatures(lenient), WithCurrency("USD"), WithMaxAmountScale(tt.maxScale)))
+
+			body := fmt.Sprintf(`{"source_account_id": 1, "destination_account_id": 2, "amount": %q, "fee": %q}`, tt.amount, tt.fee)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/transactions", strings.NewReader(body)))
+			if rec.Code != tt.status {
+				t.Fatalf("POST /transactions with %s answered %d, want %d: %s", tt.amount, rec.Code, tt.status, rec.Body)
+			}
+			if tt.status == http.StatusCreated {
+				return
+			}
+
+			var response ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode the error response: %v", err)
+			}
+			if !strings.Contains(response.Error, tt.wantError) {
+				t.Errorf("error = %q, want it to mention %q", response.Error, tt.wantError)
+			}
+			if len(broker.submitted) != 0 {
+				t.Errorf("published events = %+v, want none", broker.submitted)
+			}
+		})
+	}
+}
+
+func TestLenientAmounts(t *testing.T) {
+	lenient, err := features.Parse([]string{string(features.LenientAmounts)})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	tests := []struct {
+		name     string
+		flags    features.Flags
+		amount   string
+		fee      string
+		status   int
+		wantCode string
+	}{
+		{name: "leading symbol", flags: lenient, amount: "$10.50", status: http.StatusCreated},
+		{name: "trailing code", flags: lenient, amount: "10.50 USD", status: http.StatusCreated},
+		{name: "fee with a symbol", flags: lenient, amount: "10.50", fee: "$0.25", status: http.StatusCreated},
+		{name: "bare amount", flags: lenient, amount: "10.50", status: http.StatusCreated},
+		{name: "other currency code", flags: lenient, amount: "10.50 EUR", status: http.StatusBadRequest, wantCode: CodeBadRequest},
+		{name: "other currency symbol", flags: lenient, amount: "€10.50", status: http.StatusBadRequest, wantCode: CodeBadRequest},
+		{name: "strict symbol", amount: "$10.50", status: http.StatusBadRequest, wantCode: CodeBadRequest},
+		{name: "strict code", amount: "10.50 USD", status: http.StatusBadRequest, wantCode: CodeBadRequest},
+		{name: "strict fee", amount: "10.50", fee: "$0.25", status: http.StatusBadRequest, wantCode: CodeBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &recordingBroker{}
+			service := application.NewTransactionService(&memoryRepository{transactions: make(map[domain.TransactionID]domain.Transaction)}, broker, nil)
+			r := chi.NewRouter()
+			RegisterHandlers(r, NewTransactionHandler(service, nil, WithFeatures(tt.flags), WithCurrency("USD")))
+
+			body := fmt.Sprintf(`{"source_account_id": 1, "destination_account_id": 2, "amount": %q, "fee": %q}`, tt.amount, tt.fee)
+			req := httptest.NewRequest(http.MethodPost, "/transactions", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("POST /transactions answered %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			if tt.wantCode != "" {
+				var response ErrorResponse
+				if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+					t.Fatalf("failed to decode the error response: %v", err)
+				}
+				if response.Code != tt.wantCode {
+					t.Errorf("error code = %q, want %q", response.Code, tt.wantCode)
+				}
+				if len(broker.submitted) != 0 {
+					t.Errorf("published events = %+v, want none", broker.submitted)
+				}
+				return
+			}
+
+			// The currency is stripped before the amount is stored and published
+			if len(broker.submitted) != 1 || broker.submitted[0].Amount != "10.50" {
+				t.Fatalf("published events = %+v, want one with amount 10.50", broker.submitted)
+			}
+			if tt.fee != "" && broker.submitted[0].Fee != "0.25" {
+				t.Errorf("published fee = %q, want 0.25", broker.submitted[0].Fee)
+			}
+		})
+	}
+}
+
+func TestDuplicateTransferCheckFeature(t *testing.T) {
+	tests := []struct {
+		name   string
+		flags  []string
+		status int
+	}{
+		{name: "off by default", status: http.StatusCreated},
+		{name: "turned on", flags: []string{"duplicate_transfer_check=on"}, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, err := features.Parse(tt.flags)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			broker := &recordingBroker{}
+			service := application.NewTransactionService(&memoryRepository{transactions: make(map[domain.TransactionID]domain.Transaction)}, broker, nil,
+				application.WithFeatures(flags), application.WithDuplicateWindow(time.Minute))
+			r := chi.NewRouter()
+			RegisterHandlers(r, NewTransactionHandler(service, nil))
+
+			body := `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.50"}`
+			first := doTransactionRequest(t, r, http.MethodPost, "/transactions", body, http.StatusCreated)
+			second := doTransactionRequest(t, r, http.MethodPost, "/transactions", body, tt.status)
+
+			// A duplicate returns the earlier transaction without submitting it again
+			if duplicate := tt.status == http.StatusOK; (second.ID == first.ID) != duplicate || (len(broker.submitted) == 1) != duplicate {
+				t.Errorf("second submission returned transaction %d after %d with %d events published, want duplicate %v",
+					second.ID, first.ID, len(broker.submitted), duplicate)
+			}
+		})
+	}
+}
+
+func TestInterruptedRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    func() (context.Context, context.CancelFunc)
+		status int
+	}{
+		{name: "cancelled", ctx: func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx, cancel
+		}, status: StatusClientClosedRequest},
+		{name: "timed out", ctx: func() (context.Context, context.CancelFunc) {
+			return context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		}, status: http.StatusGatewayTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := logtest.NewHandler()
+			defaultLogger := slog.Default()
+			slog.SetDefault(slog.New(records))
+			defer slog.SetDefault(defaultLogger)
+
+			service := application.NewTransactionService(interruptedRepository{}, &recordingBroker{}, nil)
+			r := chi.NewRouter()
+			RegisterHandlers(r, NewTransactionHandler(service, nil))
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/transactions/1", nil)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("GET /transactions/1 answered %d, want %d", rec.Code, tt.status)
+			}
+
+			// The client went away or ran out of time, which is no failure of the service
+			if record, ok := records.Find("failed to get transaction"); !ok || record.Level != slog.LevelWarn {
+				t.Errorf("failed lookup logged as %+v, want a warning", record)
+			}
+			for _, record := range records.Records() {
+				if record.Level >= slog.LevelError {
+					t.Errorf("logged %q at %s, want no errors", record.Message, record.Level)
+				}
+			}
+		})
+	}
+}
+
+func TestOverloadedRequest(t *testing.T) {
+	service := application.NewTransactionService(overloadedRepository{}, &recordingBroker{}, nil)
+	r := chi.NewRouter()
+	RegisterHandlers(r, NewTransactionHandler(service, nil))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/transactions/1", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("GET /transactions/1 answered %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	var response ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("GET /transactions/1 answered an invalid body: %v", err)
+	}
+	if response.Code != CodeOverloaded {
+		t.Errorf("error code = %q, want %q", response.Code, CodeOverloaded)
+	}
+	if got := rec.Header().Get("Retry-After"); got == "" {
+		t.Error("no Retry-After header, want clients told to back off")
+	}
+}
+
+func TestTooManyPendingTransfers(t *testing.T) {
+	repo := &memoryRepository{transactions: make(map[domain.TransactionID]domain.Transaction)}
+	service := application.NewTransactionService(repo, &recordingBroker{}, nil, application.WithMaxPendingPerAccount(1))
+	r := chi.NewRouter()
+	RegisterHandlers(r, NewTransactionHandler(service, nil))
+
+	body := `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00"}`
+	doTransactionRequest(t, r, http.MethodPost, "/transactions", body, http.StatusCreated)
+
+	req := httptest.NewRequest(http.MethodPost, "/transactions", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("POST /transactions answered %d, want %d: %s", rec.Code, http.StatusTooManyRequests, rec.Body)
+	}
+	var response ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("POST /transactions answered an invalid body: %v", err)
+	}
+	if response.Code != CodeTooManyRequests {
+		t.Errorf("error code = %q, want %q", response.Code, CodeTooManyRequests)
+	}
+}
+
+func TestSubmitWhileBrokerDisconnected(t *testing.T) {
+	repo := &memoryRepository{transactions: make(map[domain.TransactionID]domain.Transaction)}
+	broker := &recordingBroker{disconnected: true}
+	r := chi.NewRouter()
+	RegisterHandlers(r, NewTransactionHandler(application.NewTransactionService(repo, broker, nil), nil))
+
+	req := httptest.NewRequest(http.MethodPost, "/transactions", strings.NewReader(`{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00"}`))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("POST /transactions answered %d, want %d: %s", rec.Code, http.StatusServiceUnavailable, rec.Body)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("POST /transactions answered without a Retry-After header")
+	}
+	var response ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("POST /transactions answered an invalid body: %v", err)
+	}
+	if response.Code != CodeUnavailable {
+		t.Errorf("error code = %q, want %q", response.Code, CodeUnavailable)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/transactions/batch", strings.NewReader(`{"transactions": [{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00"}]}`))
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("POST /transactions/batch answered %d, want %d: %s", rec.Code, http.StatusServiceUnavailable, rec.Body)
+	}
+	var batch BatchTransactionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&batch); err != nil {
+		t.Fatalf("POST /transactions/batch answered an invalid body: %v", err)
+	}
+	if len(batch.Results) != 1 || batch.Results[0].Error == nil || batch.Results[0].Error.Code != CodeUnavailable {
+		t.Errorf("batch results = %+v, want the transfer refused with %q", batch.Results, CodeUnavailable)
+	}
+
+	// Transfers are refused before they are recorded, so a retry starts afresh
+	if len(repo.transactions) != 0 || len(broker.submitted) != 0 {
+		t.Errorf("created %d transactions and published %d events, want none", len(repo.transactions), len(broker.submitted))
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	tests := []struct {
+		name       string
+		flags      []string
+		firstKey   string
+		secondKey  string
+		secondBody string
+		status     int
+		replayed   bool
+	}{
+		{name: "retried", firstKey: "key-1", secondKey: "key-1", status: http.StatusCreated, replayed: true},
+		{name: "reused for another transfer", firstKey: "key-1", secondKey: "key-1",
+			secondBody: `{"source_account_id": 1, "destination_account_id": 2, "amount": "99.00"}`, status: http.StatusConflict},
+		{name: "another key", firstKey: "key-1", secondKey: "key-2", status: http.StatusCreated},
+		{name: "no key", status: http.StatusCreated},
+		{name: "turned off", flags: []string{"idempotency_keys=off"}, firstKey: "key-1", secondKey: "key-1", status: http.StatusCreated},
+		{name: "key too long", firstKey: "key-1", secondKey: strings.Repeat("k", MaxIdempotencyKeyLength+1), status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, err := features.Parse(tt.flags)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			broker := &recordingBroker{}
+			service := application.NewTransactionService(&memoryRepository{transactions: make(map[domain.TransactionID]domain.Transaction)}, broker, nil)
+			// Two instances sharing their keys, with the retry reaching the other one
+			store := idempotency.NewMemoryStore()
+			first, second := chi.NewRouter(), chi.NewRouter()
+			RegisterHandlers(first, NewTransactionHandler(service, nil, WithFeatures(flags), WithIdempotencyKeys(store, time.Minute)))
+			RegisterHandlers(second, NewTransactionHandler(service, nil, WithFeatures(flags), WithIdempotencyKeys(store, time.Minute)))
+
+			body := `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.50"}`
+			secondBody := body
+			if tt.secondBody != "" {
+				secondBody = tt.secondBody
+			}
+			created := doIdempotentRequest(t, first, tt.firstKey, body, http.StatusCreated)
+			retried := doIdempotentRequest(t, second, tt.secondKey, secondBody, tt.status)
+
+			// A replayed submission returns the first transaction without submitting it again
+			wantSubmitted := 2
+			if tt.replayed || tt.status != http.StatusCreated {
+				wantSubmitted = 1
+			}
+			if tt.replayed && retried.ID != created.ID {
+				t.Errorf("retry returned transaction %d, want %d", retried.ID, created.ID)
+			}
+			if len(broker.submitted) != wantSubmitted {
+				t.Errorf("%d transactions submitted, want %d", len(broker.submitted), wantSubmitted)
+			}
+		})
+	}
+}
+
+// doIdempotentRequest submits a transfer with an Idempotency-Key header, unless key is empty
+func doIdempotentRequest(t *testing.T, h http.Handler, key, body string, status int) TransactionResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/transactions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != status {
+		t.Fatalf("POST /transactions with key %q answered %d, want %d: %s", key, rec.Code, status, rec.Body)
+	}
+
+	var response TransactionResponse
+	if status < http.StatusBadRequest {
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("POST /transactions answered an invalid body: %v", err)
+		}
+	}
+	return response
+}
+
+// doTransactionRequest serves a request and decodes the transaction it answers with
+func doTransactionRequest(t *testing.T, h http.Handler, method, path, body string, status int) TransactionResponse {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != status {
+		t.Fatalf("%s %s answered %d, want %d: %s", method, path, rec.Code, status, rec.Body)
+	}
+
+	var response TransactionResponse
+	if status < http.StatusBadRequest {
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("%s %s answered an invalid body: %v", method, path, err)
+		}
+	}
+	return response
+}
+
+func TestCreateTransactionLocation(t *testing.T) {
+	repo := &memoryRepository{transactions: make(map[domain.TransactionID]domain.Transaction)}
+	service := application.NewTransactionService(repo, &recordingBroker{}, nil)
+	r := chi.NewRouter()
+	r.Route("/payments/v2", func(r chi.Router) {
+		RegisterHandlers(r, NewTransactionHandler(service, nil, WithBasePath("/payments/v2")))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/payments/v2/transactions", strings.NewReader(`{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00"}`))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /transactions answered %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	location := rec.Header().Get("Location")
+	if location != "/payments/v2/transactions/1" {
+		t.Fatalf("Location = %q, want %q", location, "/payments/v2/transactions/1")
+	}
+
+	// The location serves the created transaction
+	created := doTransactionRequest(t, r, http.MethodGet, location, "", http.StatusOK)
+	if created.ID != 1 || created.Amount != "10.00" {
+		t.Errorf("GET %s = %+v, want transaction 1 of 10.00", location, created)
+	}
+}
@@ -0,0 +1,108 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"internal-transfers/pkg/features"
+	"internal-transfers/pkg/idempotency"
+	"internal-transfers/transaction-service/internal/domain"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MaxIdempotencyKeyLength is the longest Idempotency-Key header accepted when submitting a transaction
+const MaxIdempotencyKeyLength = 255
+
+// DefaultIdempotencyKeyTTL is how long idempotency keys are kept unless WithIdempotencyKeys says otherwise
+const DefaultIdempotencyKeyTTL = 24 * time.Hour
+
+// WithIdempotencyKeys answers a submission retried with the same Idempotency-Key header and body
+// with the transaction the first one created, instead of submitting it again, while the
+// idempotency_keys feature is on. Keys are kept in store for ttl; a store shared by every instance,
+// such as idempotency.RedisStore, also catches retries reaching another instance.
+func WithIdempotencyKeys(store idempotency.Store, ttl time.Duration) HandlerOption {
+	return func(h *TransactionHandler) {
+		h.idempotencyKeys = store
+		if ttl > 0 {
+			h.idempotencyKeyTTL = ttl
+		}
+	}
+}
+
+// reserveIdempotencyKey reserves the Idempotency-Key of a submission whose body has the given
+// fingerprint, returning the key to complete once the submission is done, or "" when the request
+// has none. It returns false, having answered the request, if the key cannot be used: with the
+// transaction of the submission first sent with it, or with 409 Conflict while that submission is
+// in progress or if it had another body.
+func (h *TransactionHandler) reserveIdempotencyKey(w http.ResponseWriter, r *http.Request, fingerprint string) (string, bool) {
+	key := r.Header.Get("Idempotency-Key")
+	if len(key) > MaxIdempotencyKeyLength {
+		respondWithError(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+		return "", false
+	}
+	if key == "" || h.idempotencyKeys == nil || !h.features.Enabled(features.IdempotencyKeys) {
+		return "", true
+	}
+
+	record, err := h.idempotencyKeys.Reserve(r.Context(), key, fingerprint, h.idempotencyKeyTTL)
+	if err != nil {
+		respondWithServerError(w, err, "Failed to check idempotency key")
+		return "", false
+	}
+	switch {
+	case record == nil:
+		return key, true
+	case record.Fingerprint != fingerprint:
+		respondWithError(w, http.StatusConflict, "Idempotency-Key was already used for a different transaction")
+	case record.InProgress():
+		w.Header().Set("Retry-After", "1")
+		respondWithError(w, http.StatusConflict, "a transaction with this Idempotency-Key is being submitted")
+	default:
+		h.replaySubmission(w, r, record.Result)
+	}
+	return "", false
+}
+
+// replaySubmission answers a retried submission like the first one, with the transaction it created
+func (h *TransactionHandler) replaySubmission(w http.ResponseWriter, r *http.Request, result string) {
+	id, err := strconv.ParseInt(result, 10, 64)
+	if err != nil {
+		respondWithServerError(w, fmt.Errorf("invalid idempotency key result %q: %w", result, err), "Failed to check idempotency key")
+		return
+	}
+	transaction, err := h.transactionService.GetTransaction(r.Context(), domain.TransactionID(id))
+	if err != nil {
+		respondWithServerError(w, err, "Failed to get transaction")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", h.transactionLocation(transaction.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newTransactionResponse(transaction))
+}
+
+// completeIdempotencyKey records the transaction a submission created under its key, or releases
+// the key if the submission failed, so that it can be retried. It does nothing without a key.
+func (h *TransactionHandler) completeIdempotencyKey(ctx context.Context, key, fingerprint string, transaction *domain.Transaction) {
+	if key == "" {
+		return
+	}
+	// The outcome is recorded even if the client went away meanwhile, as it may retry
+	ctx = context.WithoutCancel(ctx)
+
+	var err error
+	if transaction == nil {
+		err = h.idempotencyKeys.Release(ctx, key)
+	} else {
+		record := idempotency.Record{Fingerprint: fingerprint, Result: strconv.FormatInt(int64(transaction.ID), 10)}
+		err = h.idempotencyKeys.Complete(ctx, key, record, h.idempotencyKeyTTL)
+	}
+	if err != nil {
+		// The reservation expires after its TTL; until then retries are answered 409 Conflict
+		slog.WarnContext(ctx, "failed to record the outcome of an idempotent submission", "error", err)
+	}
+}
@@ -0,0 +1,79 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"internal-transfers/transaction-service/internal/application"
+	"internal-transfers/transaction-service/internal/domain"
+	"internal-transfers/transaction-service/internal/infrastructure/accounts"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ledgerClient serves the ledger entries of each transaction, or fails with err
+type ledgerClient struct {
+	accounts.Client
+
+	entries map[domain.TransactionID][]domain.LedgerEntry
+	err     error
+}
+
+func (c *ledgerClient) GetLedgerEntries(_ context.Context, transactionID domain.TransactionID) ([]domain.LedgerEntry, error) {
+	return c.entries[transactionID], c.err
+}
+
+func TestReemitTransaction(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		ledgerErr     error
+		status        int
+		wantRepublish bool
+	}{
+		{name: "pending transaction", path: "/admin/transactions/1/reemit", status: http.StatusAccepted, wantRepublish: true},
+		{name: "completed transaction", path: "/admin/transactions/2/reemit", status: http.StatusConflict},
+		{name: "pending transaction already applied", path: "/admin/transactions/3/reemit", status: http.StatusConflict},
+		{name: "unknown transaction", path: "/admin/transactions/9/reemit", status: http.StatusNotFound},
+		{name: "invalid id", path: "/admin/transactions/one/reemit", status: http.StatusBadRequest},
+		{name: "ledger unavailable", path: "/admin/transactions/1/reemit", ledgerErr: errors.New("connection refused"), status: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memoryRepository{transactions: map[domain.TransactionID]domain.Transaction{
+				1: {ID: 1, SourceAccountID: 1, DestinationAccountID: 2, Amount: "10.00", Status: domain.TransactionStatusPending},
+				2: {ID: 2, SourceAccountID: 1, DestinationAccountID: 2, Amount: "20.00", Status: domain.TransactionStatusComplete},
+				3: {ID: 3, SourceAccountID: 1, DestinationAccountID: 2, Amount: "30.00", Status: domain.TransactionStatusPending},
+			}}
+			ledger := &ledgerClient{
+				entries: map[domain.TransactionID][]domain.LedgerEntry{3: {{AccountID: 1, TransactionID: 3, Type: "debit", Amount: "-30.00"}}},
+				err:     tt.ledgerErr,
+			}
+			broker := &recordingBroker{}
+			r := chi.NewRouter()
+			RegisterHandlers(r, NewTransactionHandler(application.NewTransactionService(repo, broker, ledger), nil))
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("POST %s answered %d, want %d: %s", tt.path, rec.Code, tt.status, rec.Body)
+			}
+
+			if !tt.wantRepublish {
+				if len(broker.submitted) != 0 {
+					t.Errorf("published %d submitted events, want none", len(broker.submitted))
+				}
+				return
+			}
+			if len(broker.submitted) != 1 {
+				t.Fatalf("published %d submitted events, want 1", len(broker.submitted))
+			}
+			if event := broker.submitted[0]; event.TransactionID != 1 || event.Amount != "10.00" {
+				t.Errorf("republished %+v, want the event of transaction 1", event)
+			}
+		})
+	}
+}
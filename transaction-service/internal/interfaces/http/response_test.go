@@ -0,0 +1,80 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// assertGolden compares the indented JSON encoding of v with testdata/name, which is rewritten
+// instead when the tests run with -update
+func assertGolden(t *testing.T, name string, v any) {
+	t.Helper()
+	got, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	got = append(got, '\n')
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("writing %s: %v", path, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("JSON differs from %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestTransactionResponseJSON(t *testing.T) {
+	tests := []struct {
+		golden   string
+		response TransactionResponse
+	}{
+		{
+			// Optional fields are left out rather than written as zero values
+			golden: "transaction_response_minimal.json",
+			response: TransactionResponse{
+				ID:                   7,
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               "10.00",
+				Status:               "pending",
+			},
+		},
+		{
+			golden: "transaction_response_full.json",
+			response: TransactionResponse{
+				ID:                   7,
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               "35.00",
+				Fee:                  "0.50",
+				Memo:                 "rent",
+				Status:               "failed",
+				FailureCode:          "insufficient_funds",
+				Legs: []TransferLegRequest{
+					{DestinationAccountID: 2, Amount: "25.00"},
+					{DestinationAccountID: 3, Amount: "10.00"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			assertGolden(t, tt.golden, tt.response)
+		})
+	}
+}
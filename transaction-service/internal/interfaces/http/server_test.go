@@ -0,0 +1,32 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"internal-transfers/pkg/config"
+)
+
+func TestNewServer(t *testing.T) {
+	cfg := config.HTTPConfig{Port: "8080", ReadTimeout: 3 * time.Second, WriteTimeout: 7 * time.Second, IdleTimeout: 30 * time.Second}
+	server := NewServer(cfg, http.NotFoundHandler())
+
+	if server.Addr != ":8080" {
+		t.Errorf("Addr = %q, want %q", server.Addr, ":8080")
+	}
+	// Without timeouts a slow client could hold a connection open forever
+	for _, tt := range []struct {
+		name      string
+		got, want time.Duration
+	}{
+		{"ReadTimeout", server.ReadTimeout, 3 * time.Second},
+		{"ReadHeaderTimeout", server.ReadHeaderTimeout, 3 * time.Second},
+		{"WriteTimeout", server.WriteTimeout, 7 * time.Second},
+		{"IdleTimeout", server.IdleTimeout, 30 * time.Second},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"internal-transfers/pkg/features"
+	"internal-transfers/transaction-service/internal/domain"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Defaults applied when WithStatusStreams does not set them
+const (
+	DefaultStreamPollInterval = 2 * time.Second
+	DefaultStreamTimeout      = 5 * time.Minute
+)
+
+// StatusEvent is the data of a status event sent on the event stream of a transaction
+type StatusEvent struct {
+	TransactionID int64  `json:"transaction_id"`
+	Status        string `json:"status" enums:"pending,processing,held,complete,failed,rollback"`
+	FailureCode   string `json:"failure_code,omitempty"`
+}
+
+// StreamTransactionEvents handles streaming the status of a transaction
+// @Summary Stream the status of a transaction
+// @Description Server-sent event stream of the status of a transaction, for UIs tracking a transfer. A "status"
+// @Description event with the current status is sent right away and another one on every change. The stream is
+// @Description closed once the transaction reaches a terminal status (complete, failed or rollback), or after
+// @Description the stream timeout.
+// @Tags transactions
+// @Produce text/event-stream
+// @Param id path int true "Transaction ID"
+// @Success 200 {object} StatusEvent
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse "Transaction not found, or status streams are turned off"
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /transactions/{id}/events [get]
+func (h *TransactionHandler) StreamTransactionEvents(w http.ResponseWriter, r *http.Request) {
+	if !h.features.Enabled(features.StatusStreams) {
+		respondWithError(w, http.StatusNotFound, "Status streams are not enabled")
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+	transactionID := domain.TransactionID(id)
+
+	// Subscribe before reading the current status, so no change is missed in between
+	updates, unsubscribe := h.subscribeStatus(transactionID)
+	defer unsubscribe()
+
+	transaction, err := h.transactionService.GetTransaction(r.Context(), transactionID)
+	if err != nil {
+		if errors.Is(err, domain.ErrOverloaded) || interrupted(err) {
+			respondWithServerError(w, err, "Failed to get transaction")
+			return
+		}
+		respondWithError(w, http.StatusNotFound, "Transaction not found")
+		return
+	}
+
+	// The stream outlives the server's write timeout, which would otherwise cut it off
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		respondWithServerError(w, err, "Failed to open event stream")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// The stream ends when the client disconnects, at the latest after the timeout
+	ctx, cancel := context.WithTimeout(r.Context(), h.streamTimeout)
+	defer cancel()
+	h.followStatus(ctx, transaction, updates, func(transaction *domain.Transaction) error {
+		return writeStatusEvent(w, rc, transaction)
+	})
+}
+
+// subscribeStatus subscribes to the status updates of the transaction published by this
+// instance, if any, and returns the updates with the function ending the subscription
+func (h *TransactionHandler) subscribeStatus(id domain.TransactionID) (<-chan domain.TransactionStatus, func()) {
+	if h.statusUpdates == nil {
+		return nil, func() {}
+	}
+	return h.statusUpdates.Subscribe(id)
+}
+
+// followStatus sends the transaction and then again on every change of its status, until it
+// reaches a terminal status, the context is done or send fails. Changes are noticed through
+// updates and by polling every streamPollInterval, for changes made by other instances; a lookup
+// that fails, e.g. while the database is overloaded, is retried at the next poll.
+func (h *TransactionHandler) followStatus(ctx context.Context, transaction *domain.Transaction, updates <-chan domain.TransactionStatus, send func(transaction *domain.Transaction) error) {
+	poll := time.NewTicker(h.streamPollInterval)
+	defer poll.Stop()
+
+	status := transaction.Status
+	if err := send(transaction); err != nil {
+		return
+	}
+	for !status.Terminal() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-updates:
+		case <-poll.C:
+		}
+
+		current, err := h.transactionService.GetTransaction(ctx, transaction.ID)
+		if err != nil {
+			continue
+		}
+		if current.Status == status {
+			continue
+		}
+		status = current.Status
+		if err := send(current); err != nil {
+			return
+		}
+	}
+}
+
+// writeStatusEvent sends the status of the transaction as a "status" event and flushes it to the client
+func writeStatusEvent(w http.ResponseWriter, rc *http.ResponseController, transaction *domain.Transaction) error {
+	data, err := json.Marshal(StatusEvent{
+		TransactionID: int64(transaction.ID),
+		Status:        string(transaction.Status),
+		FailureCode:   string(transaction.FailureCode),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
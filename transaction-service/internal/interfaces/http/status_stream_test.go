@@ -0,0 +1,59 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"internal-transfers/transaction-service/internal/application"
+	"internal-transfers/transaction-service/internal/domain"
+	"testing"
+	"time"
+)
+
+// flakyService answers lookups of a transaction with the given results in turn, repeating the last
+type flakyService struct {
+	application.TransactionService
+
+	results []flakyResult
+}
+
+type flakyResult struct {
+	status domain.TransactionStatus
+	err    error
+}
+
+func (s *flakyService) GetTransaction(_ context.Context, id domain.TransactionID) (*domain.Transaction, error) {
+	result := s.results[0]
+	if len(s.results) > 1 {
+		s.results = s.results[1:]
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+	return &domain.Transaction{ID: id, Status: result.status}, nil
+}
+
+func TestFollowStatusSurvivesFailedLookup(t *testing.T) {
+	service := &flakyService{results: []flakyResult{
+		{err: domain.ErrOverloaded},
+		{status: domain.TransactionStatusPending},
+		{err: domain.ErrOverloaded},
+		{status: domain.TransactionStatusComplete},
+	}}
+	h := NewTransactionHandler(service, nil, WithStatusStreams(nil, time.Millisecond, time.Minute))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var sent []domain.TransactionStatus
+	h.followStatus(ctx, &domain.Transaction{ID: 1, Status: domain.TransactionStatusPending}, nil, func(transaction *domain.Transaction) error {
+		sent = append(sent, transaction.Status)
+		return nil
+	})
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Fatal("stream did not end once the transaction completed")
+	}
+	want := []domain.TransactionStatus{domain.TransactionStatusPending, domain.TransactionStatusComplete}
+	if len(sent) != len(want) || sent[0] != want[0] || sent[1] != want[1] {
+		t.Errorf("sent statuses %v, want %v", sent, want)
+	}
+}
@@ -0,0 +1,191 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"internal-transfers/pkg/features"
+	"internal-transfers/transaction-service/internal/domain"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// MaxSocketSubscriptions is the largest number of transactions a WebSocket client can follow at once
+const MaxSocketSubscriptions = 100
+
+// Actions of the messages clients send on the status WebSocket
+const (
+	SocketActionSubscribe   = "subscribe"
+	SocketActionUnsubscribe = "unsubscribe"
+)
+
+// SocketRequest is a message sent by clients on the status WebSocket
+type SocketRequest struct {
+	Action        string `json:"action" enums:"subscribe,unsubscribe"`
+	TransactionID int64  `json:"transaction_id"`
+}
+
+// SocketMessage is a message sent to clients on the status WebSocket: the status of a transaction
+// they subscribed to, or why a request of theirs failed
+type SocketMessage struct {
+	Type          string `json:"type" enums:"status,error"`
+	TransactionID int64  `json:"transaction_id,omitempty"`
+	Status        string `json:"status,omitempty" enums:"pending,processing,held,complete,failed,rollback"`
+	FailureCode   string `json:"failure_code,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// TransactionSocket handles the status WebSocket
+// @Summary Follow the status of transactions over a WebSocket
+// @Description WebSocket on which clients follow the status of several transactions. Clients send
+// @Description {"action": "subscribe", "transaction_id": 1} or "unsubscribe" messages; the service answers each
+// @Description subscription with a "status" message carrying the current status and sends another one on every
+// @Description change. A subscription ends by itself once its transaction reaches a terminal status (complete,
+// @Description failed or rollback). Failed requests are answered with an "error" message.
+// @Tags transactions
+// @Success 101 {object} SocketMessage
+// @Failure 404 {object} ErrorResponse "Status streams are turned off"
+// @Router /ws/transactions [get]
+func (h *TransactionHandler) TransactionSocket(w http.ResponseWriter, r *http.Request) {
+	if !h.features.Enabled(features.StatusStreams) {
+		respondWithError(w, http.StatusNotFound, "Status streams are not enabled")
+		return
+	}
+	websocket.Server{Handler: h.serveSocket}.ServeHTTP(w, r)
+}
+
+// socketSession is a WebSocket connection and the transactions its client follows
+type socketSession struct {
+	h    *TransactionHandler
+	conn *websocket.Conn
+
+	// mu serializes the writes to the connection and guards subscriptions
+	mu            sync.Mutex
+	subscriptions map[domain.TransactionID]*socketSubscription
+}
+
+// socketSubscription is a transaction followed by the client of a socketSession
+type socketSubscription struct {
+	cancel context.CancelFunc
+}
+
+// serveSocket handles the requests of a client until it disconnects, which ends its subscriptions
+func (h *TransactionHandler) serveSocket(conn *websocket.Conn) {
+	// The connection outlives the server's read and write timeouts, which would otherwise cut it off
+	conn.SetDeadline(time.Time{})
+
+	ctx, cancel := context.WithCancel(conn.Request().Context())
+	defer cancel()
+
+	session := &socketSession{
+		h:             h,
+		conn:          conn,
+		subscriptions: make(map[domain.TransactionID]*socketSubscription),
+	}
+	for {
+		var req SocketRequest
+		if err := websocket.JSON.Receive(conn, &req); err != nil {
+			// A message that is not a request is answered, anything else means the client is gone
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				session.send(SocketMessage{Type: "error", Error: "invalid request"})
+				continue
+			}
+			return
+		}
+
+		id := domain.TransactionID(req.TransactionID)
+		switch req.Action {
+		case SocketActionSubscribe:
+			session.subscribe(ctx, id)
+		case SocketActionUnsubscribe:
+			session.unsubscribe(id)
+		default:
+			session.send(SocketMessage{Type: "error", TransactionID: req.TransactionID, Error: "action must be subscribe or unsubscribe"})
+		}
+	}
+}
+
+// subscribe starts following the status of the transaction, unless the client already does
+func (s *socketSession) subscribe(ctx context.Context, id domain.TransactionID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subscriptions[id]; ok {
+		return
+	}
+	if len(s.subscriptions) >= MaxSocketSubscriptions {
+		s.write(SocketMessage{Type: "error", TransactionID: int64(id), Error: "too many subscriptions"})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	subscription := &socketSubscription{cancel: cancel}
+	s.subscriptions[id] = subscription
+	go func() {
+		defer s.end(id, subscription)
+		s.follow(ctx, id)
+	}()
+}
+
+// unsubscribe stops following the status of the transaction
+func (s *socketSession) unsubscribe(id domain.TransactionID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if subscription, ok := s.subscriptions[id]; ok {
+		subscription.cancel()
+		delete(s.subscriptions, id)
+	}
+}
+
+// end removes the subscription once it is over, unless the client already replaced it
+func (s *socketSession) end(id domain.TransactionID, subscription *socketSubscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscription.cancel()
+	if s.subscriptions[id] == subscription {
+		delete(s.subscriptions, id)
+	}
+}
+
+// follow sends the status of the transaction and its changes until it reaches a terminal status or
+// the subscription ends
+func (s *socketSession) follow(ctx context.Context, id domain.TransactionID) {
+	// Subscribe before reading the current status, so no change is missed in between
+	updates, unsubscribe := s.h.subscribeStatus(id)
+	defer unsubscribe()
+
+	transaction, err := s.h.transactionService.GetTransaction(ctx, id)
+	if err != nil {
+		message := "transaction not found"
+		if errors.Is(err, domain.ErrOverloaded) {
+			message = "service overloaded, subscribe again later"
+		}
+		s.send(SocketMessage{Type: "error", TransactionID: int64(id), Error: message})
+		return
+	}
+
+	s.h.followStatus(ctx, transaction, updates, func(transaction *domain.Transaction) error {
+		return s.send(SocketMessage{
+			Type:          "status",
+			TransactionID: int64(transaction.ID),
+			Status:        string(transaction.Status),
+			FailureCode:   string(transaction.FailureCode),
+		})
+	})
+}
+
+// send writes a message to the client
+func (s *socketSession) send(message SocketMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(message)
+}
+
+// write writes a message to the client; the caller holds mu
+func (s *socketSession) write(message SocketMessage) error {
+	return websocket.JSON.Send(s.conn, message)
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"internal-transfers/transaction-service/internal/application"
+	"internal-transfers/transaction-service/internal/domain"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/net/websocket"
+)
+
+func TestTransactionSocket(t *testing.T) {
+	repo := &memoryRepository{transactions: map[domain.TransactionID]domain.Transaction{
+		1: {ID: 1, SourceAccountID: 1, DestinationAccountID: 2, Amount: "10.00", Status: domain.TransactionStatusPending},
+	}}
+	updates := application.NewStatusUpdates()
+	// Polling is too slow to matter, so the update has to be pushed through the published changes
+	h := NewTransactionHandler(application.NewTransactionService(repo, nil, nil), nil, WithStatusStreams(updates, time.Hour, time.Hour))
+	r := chi.NewRouter()
+	RegisterHandlers(r, h)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/transactions", "", server.URL)
+	if err != nil {
+		t.Fatalf("failed to connect to the status WebSocket: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request := func(req SocketRequest) {
+		t.Helper()
+		if err := websocket.JSON.Send(conn, req); err != nil {
+			t.Fatalf("failed to send %+v: %v", req, err)
+		}
+	}
+	expect := func(want SocketMessage) {
+		t.Helper()
+		var message SocketMessage
+		if err := websocket.JSON.Receive(conn, &message); err != nil {
+			t.Fatalf("failed to receive %+v: %v", want, err)
+		}
+		if message != want {
+			t.Errorf("received %+v, want %+v", message, want)
+		}
+	}
+
+	// The current status answers the subscription
+	request(SocketRequest{Action: SocketActionSubscribe, TransactionID: 1})
+	expect(SocketMessage{Type: "status", TransactionID: 1, Status: string(domain.TransactionStatusPending)})
+
+	repo.mu.Lock()
+	transaction := repo.transactions[1]
+	transaction.Status = domain.TransactionStatusComplete
+	repo.transactions[1] = transaction
+	repo.mu.Unlock()
+	updates.Publish(1, domain.TransactionStatusComplete)
+	expect(SocketMessage{Type: "status", TransactionID: 1, Status: string(domain.TransactionStatusComplete)})
+
+	request(SocketRequest{Action: SocketActionSubscribe, TransactionID: 99})
+	expect(SocketMessage{Type: "error", TransactionID: 99, Error: "transaction not found"})
+	request(SocketRequest{Action: "follow", TransactionID: 1})
+	expect(SocketMessage{Type: "error", TransactionID: 1, Error: "action must be subscribe or unsubscribe"})
+}